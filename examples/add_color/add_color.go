@@ -24,9 +24,9 @@ func main() {
 	draw.Fill(false)                   // Fill the rectangle without stroke
 	document.AddObject(draw)
 	page := godyf.NewDictionary(map[string]interface{}{
-		"Type":     "/Page",
-		"Parent":   document.Pages.Reference(),
-		"Contents": draw.Reference(),
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
+		"Contents": draw.Ref(),
 		"MediaBox": godyf.NewArray(0, 0, 200, 200),
 	})
 	document.AddPage(page)
@@ -12,8 +12,8 @@ func main() {
 	document := pdf.NewPDF()
 
 	page := godyf.NewDictionary(map[string]interface{}{
-		"Type":     "/Page",
-		"Parent":   string(document.Pages.Reference()),
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
 		"MediaBox": godyf.NewArray(0, 0, 595, 842),
 	})
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stackquest-hq/godyf/font"
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("Usage: embedded_font <font.ttf or font.otf>")
+		return
+	}
+	document := pdf.NewPDF()
+
+	data, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Printf("Error reading font: %v\n", err)
+		return
+	}
+	embedded, err := font.NewTrueType(data)
+	if err != nil {
+		fmt.Printf("Error loading font: %v\n", err)
+		return
+	}
+	// Only the glyphs shown on the page are embedded when writing
+	fontRef := document.AddResource(embedded)
+
+	text := godyf.NewStream(nil, nil, true)
+	text.BeginText()
+	text.SetFontSize("F1", 24)
+	for i, line := range []string{"Embedded font", "Centered, déjà vu"} {
+		x := (595 - embedded.MeasureString(24, line)) / 2
+		text.SetTextMatrix(1, 0, 0, 1, x, float64(780-40*i))
+		text.ShowText(godyf.EncodedText(embedded, line))
+	}
+	// Shaped text gets the ligatures and the kerning of the font
+	shaped := "Office affluence, AVA"
+	text.SetTextMatrix(1, 0, 0, 1, (595-embedded.MeasureShapedString(24, shaped))/2, 700)
+	embedded.ShowShapedText(text, 24, shaped)
+	text.EndText()
+	document.AddObject(text)
+
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
+		"MediaBox": godyf.NewArray(0, 0, 595, 842),
+		"Contents": text.Ref(),
+		"Resources": godyf.NewDictionary(map[string]interface{}{
+			"Font": godyf.NewDictionary(map[string]interface{}{
+				"F1": fontRef,
+			}),
+		}),
+	}))
+
+	// Write the document to a PDF file
+	file, err := os.Create("embedded_font.pdf")
+	if err != nil {
+		fmt.Printf("Error creating file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	err = document.Write(file, nil, nil, false)
+	if err != nil {
+		fmt.Printf("Error writing PDF: %v\n", err)
+		return
+	}
+
+	fmt.Println("PDF document written to embedded_font.pdf")
+}
@@ -21,8 +21,8 @@ func main() {
 
 	// Add a page to the document
 	page := godyf.NewDictionary(map[string]interface{}{
-		"Type":     "/Page",
-		"Parent":   string(document.Pages.Reference()),
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
 		"MediaBox": godyf.NewArray(0, 0, 200, 200),
 	})
 	document.AddPage(page)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("Usage: read_pdf <file.pdf>")
+		return
+	}
+
+	file, err := os.Open(os.Args[1])
+	if err != nil {
+		fmt.Printf("Error opening file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Printf("Error reading file: %v\n", err)
+		return
+	}
+
+	document, err := pdf.Open(file, info.Size())
+	if err != nil {
+		fmt.Printf("Error reading PDF: %v\n", err)
+		return
+	}
+
+	fmt.Printf("PDF version %s, %d objects\n", document.Version, len(document.Objects))
+	if document.Info != nil {
+		if title, ok := document.Info.Values["Title"].(*godyf.String); ok {
+			fmt.Printf("Title: %s\n", title.String)
+		}
+	}
+	for i, ref := range document.PageReferences() {
+		page, ok := document.Resolve(ref).(*godyf.Dictionary)
+		if !ok {
+			continue
+		}
+		fmt.Printf("Page %d (object %d): %s\n", i+1, ref.Number, page.Data())
+	}
+}
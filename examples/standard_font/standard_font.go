@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stackquest-hq/godyf/font"
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+func main() {
+	document := pdf.NewPDF()
+
+	helvetica, err := font.NewStandard("Helvetica")
+	if err != nil {
+		fmt.Printf("Error loading font: %v\n", err)
+		return
+	}
+	fontDictionary, err := helvetica.Dictionary(nil)
+	if err != nil {
+		fmt.Printf("Error building font: %v\n", err)
+		return
+	}
+	document.AddObject(fontDictionary)
+
+	// Center, right-align and kern lines of text
+	text := godyf.NewStream(nil, nil, false)
+	text.BeginText()
+	text.SetFontSize("F1", 20)
+	for i, line := range []string{"Centered line", "Right-aligned, déjà vu", "AVATAR, kerned"} {
+		var x float64
+		switch i {
+		case 0:
+			x = (595 - font.MeasureString(helvetica, 20, line)) / 2
+		case 1:
+			x = 585 - font.MeasureString(helvetica, 20, line)
+		case 2:
+			x = (595 - font.MeasureStringKerned(helvetica, 20, line)) / 2
+		}
+		text.SetTextMatrix(1, 0, 0, 1, x, float64(800-40*i))
+		if i == 2 {
+			kerned, err := helvetica.KernedText(line)
+			if err != nil {
+				fmt.Printf("Error encoding text: %v\n", err)
+				return
+			}
+			text.ShowText(kerned)
+		} else {
+			codes, err := helvetica.Encode(line, nil)
+			if err != nil {
+				fmt.Printf("Error encoding text: %v\n", err)
+				return
+			}
+			text.ShowText(string(godyf.NewByteString(codes).Data()))
+		}
+	}
+	text.EndText()
+	document.AddObject(text)
+
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
+		"MediaBox": godyf.NewArray(0, 0, 595, 842),
+		"Contents": text.Ref(),
+		"Resources": godyf.NewDictionary(map[string]interface{}{
+			"Font": godyf.NewDictionary(map[string]interface{}{
+				"F1": fontDictionary.Ref(),
+			}),
+		}),
+	}))
+
+	// Write the document to a PDF file
+	file, err := os.Create("standard_font.pdf")
+	if err != nil {
+		fmt.Printf("Error creating file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	err = document.Write(file, nil, nil, false)
+	if err != nil {
+		fmt.Printf("Error writing PDF: %v\n", err)
+		return
+	}
+
+	fmt.Println("PDF document written to standard_font.pdf")
+}
@@ -11,13 +11,13 @@ import (
 func main() {
 	document := pdf.NewPDF()
 	font := godyf.NewDictionary(map[string]interface{}{
-		"Type":    "/Font",
-		"Subtype": "/Type1",
-		"Name":    "/F1",
-		// "BaseFont": "/Helvetica",
-		// "Encoding": "/MacRomanEncoding",
-		"BaseFont": "/Times-Roman",
-		"Encoding": "/WinAnsiEncoding",
+		"Type":    godyf.Name("Font"),
+		"Subtype": godyf.Name("Type1"),
+		"Name":    godyf.Name("F1"),
+		// "BaseFont": godyf.Name("Helvetica"),
+		// "Encoding": godyf.Name("MacRomanEncoding"),
+		"BaseFont": godyf.Name("Times-Roman"),
+		"Encoding": godyf.Name("WinAnsiEncoding"),
 	})
 	document.AddObject(font)
 	text := godyf.NewStream(nil, nil, false)
@@ -28,14 +28,14 @@ func main() {
 	text.EndText()
 	document.AddObject(text)
 	document.AddPage(godyf.NewDictionary(map[string]interface{}{
-		"Type":     "/Page",
-		"Parent":   string(document.Pages.Reference()),
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
 		"MediaBox": godyf.NewArray(0, 0, 595, 842),
-		"Contents": text.Reference(),
+		"Contents": text.Ref(),
 		"Resources": godyf.NewDictionary(map[string]interface{}{
-			"ProcSet": godyf.NewArray("/PDF", "/Text"),
+			"ProcSet": godyf.NewArray(godyf.Name("PDF"), godyf.Name("Text")),
 			"Font": godyf.NewDictionary(map[string]interface{}{
-				"F1": font.Reference(),
+				"F1": font.Ref(),
 			}),
 		}),
 	}))
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stackquest-hq/godyf/font"
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+func main() {
+	document := pdf.NewPDF()
+
+	// Icons drawn with path operators, in a 1000 units per em glyph space
+	icons := font.NewType3(1000)
+	check, err := icons.AddGlyph('✓', 900)
+	if err != nil {
+		fmt.Printf("Error adding glyph: %v\n", err)
+		return
+	}
+	check.SetColorRGB(0, 0.6, 0, true)
+	check.SetLineWidth(120)
+	check.MoveTo(100, 350)
+	check.LineTo(350, 100)
+	check.LineTo(800, 650)
+	check.Stroke()
+
+	// Shape glyphs are painted with the color of the text
+	square, err := icons.AddShapeGlyph('■', 700, [4]float64{100, 0, 600, 500})
+	if err != nil {
+		fmt.Printf("Error adding glyph: %v\n", err)
+		return
+	}
+	square.Rectangle(100, 0, 500, 500)
+	square.Fill(false)
+	if _, err := icons.AddGlyph(' ', 250); err != nil {
+		fmt.Printf("Error adding glyph: %v\n", err)
+		return
+	}
+	iconsRef := document.AddResource(icons)
+
+	text := godyf.NewStream(nil, nil, true)
+	text.BeginText()
+	text.SetFontSize("Icons", 24)
+	text.SetTextMatrix(1, 0, 0, 1, 72, 770)
+	text.ShowText(godyf.EncodedText(icons, "✓ ✓"))
+	text.SetColorRGB(0.8, 0, 0, false)
+	text.ShowText(godyf.EncodedText(icons, " ■ ■"))
+	text.EndText()
+	document.AddObject(text)
+
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Page"),
+		"Parent":   document.Pages.Ref(),
+		"MediaBox": godyf.NewArray(0, 0, 595, 842),
+		"Contents": text.Ref(),
+		"Resources": godyf.NewDictionary(map[string]interface{}{
+			"Font": godyf.NewDictionary(map[string]interface{}{
+				"Icons": iconsRef,
+			}),
+		}),
+	}))
+
+	// Write the document to a PDF file
+	file, err := os.Create("type3_font.pdf")
+	if err != nil {
+		fmt.Printf("Error creating file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	err = document.Write(file, nil, nil, false)
+	if err != nil {
+		fmt.Printf("Error writing PDF: %v\n", err)
+		return
+	}
+
+	fmt.Println("PDF document written to type3_font.pdf")
+}
@@ -0,0 +1,256 @@
+package font
+
+import (
+	"unicode"
+)
+
+// bidiClass is a bidirectional character type of the Unicode bidirectional
+// algorithm
+type bidiClass int
+
+// Bidirectional character types
+const (
+	bidiL   bidiClass = iota // Left-to-right
+	bidiR                    // Right-to-left
+	bidiAL                   // Arabic letter
+	bidiEN                   // European number
+	bidiES                   // European separator
+	bidiET                   // European terminator
+	bidiAN                   // Arabic number
+	bidiCS                   // Common separator
+	bidiNSM                  // Nonspacing mark
+	bidiBN                   // Boundary neutral
+	bidiB                    // Paragraph separator
+	bidiS                    // Segment separator
+	bidiWS                   // Whitespace
+	bidiON                   // Other neutral
+)
+
+// bidiMirrors gives the mirrored glyphs of characters shown right-to-left
+var bidiMirrors = map[rune]rune{
+	'(': ')', ')': '(', '<': '>', '>': '<', '[': ']', ']': '[', '{': '}', '}': '{',
+	'«': '»', '»': '«', '‹': '›', '›': '‹', '⁅': '⁆', '⁆': '⁅', '≤': '≥', '≥': '≤',
+}
+
+// classOf returns the bidirectional type of r, derived from its block and
+// its general category
+func classOf(r rune) bidiClass {
+	switch {
+	case r >= '0' && r <= '9', r >= 0x06F0 && r <= 0x06F9:
+		return bidiEN
+	case r >= 0x0660 && r <= 0x0669, r == 0x066B, r == 0x066C:
+		return bidiAN
+	case r == '+' || r == '-':
+		return bidiES
+	case r == '#' || r == '%' || r == '°' || r == '±' || r == '‰' || unicode.Is(unicode.Sc, r):
+		return bidiET
+	case r == ',' || r == '.' || r == '/' || r == ':' || r == 0xA0:
+		return bidiCS
+	case r == '\n' || r == '\r' || r == 0x1C || r == 0x1D || r == 0x1E || r == 0x85 || r == 0x2029:
+		return bidiB
+	case r == '\t' || r == 0x0B || r == 0x1F:
+		return bidiS
+	case unicode.IsSpace(r):
+		return bidiWS
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return bidiNSM
+	case unicode.In(r, unicode.Cf, unicode.Cc):
+		return bidiBN
+	case r >= 0x0590 && r <= 0x05FF, r >= 0x07C0 && r <= 0x085F, r >= 0xFB1D && r <= 0xFB4F:
+		return bidiR
+	case r >= 0x0600 && r <= 0x07BF, r >= 0x0860 && r <= 0x08FF, r >= 0xFB50 && r <= 0xFDFF, r >= 0xFE70 && r <= 0xFEFF:
+		return bidiAL
+	case unicode.In(r, unicode.L, unicode.Mc, unicode.Nd, unicode.Nl, unicode.No):
+		return bidiL
+	}
+	return bidiON
+}
+
+// bidiLevels returns the embedding levels of the characters of a line of
+// text with the Unicode bidirectional algorithm, the paragraph direction
+// being given by the first strong character. Explicit embeddings, overrides
+// and isolates are ignored, and brackets aren't paired.
+func bidiLevels(runes []rune) []int {
+	classes := make([]bidiClass, len(runes))
+	for i, r := range runes {
+		classes[i] = classOf(r)
+	}
+	original := append([]bidiClass(nil), classes...)
+
+	// Paragraph level (P2, P3)
+	level := 0
+	for _, class := range classes {
+		if class == bidiL {
+			break
+		} else if class == bidiR || class == bidiAL {
+			level = 1
+			break
+		}
+	}
+	embedding := bidiL
+	if level == 1 {
+		embedding = bidiR
+	}
+
+	// Weak types (W1 to W7), boundary neutrals taking the type of the
+	// previous character
+	for i, class := range classes {
+		if class == bidiNSM || class == bidiBN {
+			if i == 0 {
+				classes[i] = embedding
+			} else {
+				classes[i] = classes[i-1]
+			}
+		}
+	}
+	strong := embedding
+	for i, class := range classes {
+		switch class {
+		case bidiL, bidiR, bidiAL:
+			strong = class
+		case bidiEN:
+			if strong == bidiAL {
+				classes[i] = bidiAN
+			}
+		}
+	}
+	for i, class := range classes {
+		if class == bidiAL {
+			classes[i] = bidiR
+		}
+	}
+	for i := 1; i < len(classes)-1; i++ {
+		previous, next := classes[i-1], classes[i+1]
+		if classes[i] == bidiES && previous == bidiEN && next == bidiEN {
+			classes[i] = bidiEN
+		} else if classes[i] == bidiCS && previous == next && (previous == bidiEN || previous == bidiAN) {
+			classes[i] = previous
+		}
+	}
+	for i := 0; i < len(classes); i++ {
+		if classes[i] != bidiET {
+			continue
+		}
+		end := i
+		for end < len(classes) && classes[end] == bidiET {
+			end++
+		}
+		if (i > 0 && classes[i-1] == bidiEN) || (end < len(classes) && classes[end] == bidiEN) {
+			for j := i; j < end; j++ {
+				classes[j] = bidiEN
+			}
+		}
+		i = end - 1
+	}
+	for i, class := range classes {
+		if class == bidiES || class == bidiET || class == bidiCS {
+			classes[i] = bidiON
+		}
+	}
+	strong = embedding
+	for i, class := range classes {
+		switch class {
+		case bidiL, bidiR:
+			strong = class
+		case bidiEN:
+			if strong == bidiL {
+				classes[i] = bidiL
+			}
+		}
+	}
+
+	// Neutral types (N1, N2), numbers acting as right-to-left characters
+	direction := func(i int) bidiClass {
+		if i < 0 || i >= len(classes) {
+			return embedding
+		}
+		if classes[i] == bidiL {
+			return bidiL
+		}
+		return bidiR
+	}
+	neutral := func(class bidiClass) bool {
+		return class == bidiB || class == bidiS || class == bidiWS || class == bidiON
+	}
+	for i := 0; i < len(classes); i++ {
+		if !neutral(classes[i]) {
+			continue
+		}
+		end := i
+		for end < len(classes) && neutral(classes[end]) {
+			end++
+		}
+		resolved := embedding
+		if before := direction(i - 1); before == direction(end) {
+			resolved = before
+		}
+		for j := i; j < end; j++ {
+			classes[j] = resolved
+		}
+		i = end - 1
+	}
+
+	// Implicit levels (I1, I2)
+	levels := make([]int, len(classes))
+	for i, class := range classes {
+		levels[i] = level
+		if level%2 == 0 && class == bidiR {
+			levels[i]++
+		} else if level%2 == 0 && (class == bidiAN || class == bidiEN) {
+			levels[i] += 2
+		} else if level%2 == 1 && (class == bidiL || class == bidiAN || class == bidiEN) {
+			levels[i]++
+		}
+	}
+
+	// Separators and trailing whitespace are reset to the paragraph level (L1)
+	trailing := true
+	for i := len(original) - 1; i >= 0; i-- {
+		switch original[i] {
+		case bidiB, bidiS:
+			levels[i] = level
+			trailing = true
+		case bidiWS, bidiBN:
+			if trailing {
+				levels[i] = level
+			}
+		default:
+			trailing = false
+		}
+	}
+	return levels
+}
+
+// bidiOrder returns the visual order of items with the given embedding
+// levels, reversing sequences from the highest level to the lowest odd
+// level (L2)
+func bidiOrder(levels []int) []int {
+	order := make([]int, len(levels))
+	highest, lowestOdd := 0, -1
+	for i, level := range levels {
+		order[i] = i
+		highest = max(highest, level)
+		if level%2 == 1 && (lowestOdd < 0 || level < lowestOdd) {
+			lowestOdd = level
+		}
+	}
+	if lowestOdd < 0 {
+		return order
+	}
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(order); i++ {
+			if levels[order[i]] < level {
+				continue
+			}
+			end := i
+			for end < len(order) && levels[order[end]] >= level {
+				end++
+			}
+			for a, b := i, end-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = end
+		}
+	}
+	return order
+}
@@ -0,0 +1,574 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cffFont is a font in the Compact Font Format, as found in the CFF table
+// of OpenType fonts with PostScript outlines
+type cffFont struct {
+	topDict     []cffEntry       // Top DICT of the font
+	strings     [][]byte         // Strings of the String INDEX
+	globalSubrs []byte           // Raw Global Subr INDEX
+	charStrings [][]byte         // Glyph outlines, by glyph ID
+	charset     []uint16         // String IDs of the glyph names, or CIDs, by glyph ID
+	cid         bool             // Whether the font is CID-keyed
+	fonts       []cffPrivateDict // Private DICTs, one by Font DICT for CID-keyed fonts
+	fdSelect    []byte           // Font DICT indices by glyph ID of CID-keyed fonts
+}
+
+// cffPrivateDict is a Private DICT with its subroutines, and the Font DICT
+// referencing it in CID-keyed fonts
+type cffPrivateDict struct {
+	fontDict   []cffEntry // Font DICT, without its Private operator
+	private    []cffEntry // Private DICT, without its Subrs operator
+	localSubrs []byte     // Raw local Subrs INDEX, nil if none
+}
+
+// cffEntry is an operator of a CFF DICT with its raw operands
+type cffEntry struct {
+	operator int // Operator, 1200 + second byte for escaped operators
+	operands [][]byte
+}
+
+// DICT operators
+const (
+	cffCharset        = 15
+	cffEncoding       = 16
+	cffCharStrings    = 17
+	cffPrivate        = 18
+	cffSubrs          = 19
+	cffUniqueID       = 13
+	cffXUID           = 14
+	cffCharstringType = 1206
+	cffROS            = 1230
+	cffCIDCount       = 1234
+	cffUIDBase        = 1235
+	cffFDArray        = 1236
+	cffFDSelect       = 1237
+)
+
+// cffIndex returns the items of the INDEX starting at offset, and the
+// offset following it
+func cffIndex(data []byte, offset int) ([][]byte, int, error) {
+	if offset+2 > len(data) {
+		return nil, 0, fmt.Errorf("CFF INDEX is truncated")
+	}
+	count := int(binary.BigEndian.Uint16(data[offset:]))
+	if count == 0 {
+		return nil, offset + 2, nil
+	}
+	if offset+3 > len(data) {
+		return nil, 0, fmt.Errorf("CFF INDEX is truncated")
+	}
+	size := int(data[offset+2])
+	if size < 1 || size > 4 || offset+3+(count+1)*size > len(data) {
+		return nil, 0, fmt.Errorf("invalid CFF INDEX")
+	}
+	offsets := make([]int, count+1)
+	for i := range offsets {
+		for _, b := range data[offset+3+i*size : offset+3+(i+1)*size] {
+			offsets[i] = offsets[i]<<8 | int(b)
+		}
+	}
+	base := offset + 3 + (count+1)*size - 1
+	items := make([][]byte, count)
+	for i := range items {
+		start, end := base+offsets[i], base+offsets[i+1]
+		if offsets[i] < 1 || start > end || end > len(data) {
+			return nil, 0, fmt.Errorf("invalid CFF INDEX offset")
+		}
+		items[i] = data[start:end]
+	}
+	return items, base + offsets[count], nil
+}
+
+// writeCFFIndex returns an INDEX made of items
+func writeCFFIndex(items [][]byte) []byte {
+	if len(items) == 0 {
+		return []byte{0, 0}
+	}
+	length := 1
+	for _, item := range items {
+		length += len(item)
+	}
+	size := 1
+	for length >= 1<<(8*size) {
+		size++
+	}
+	index := []byte{byte(len(items) >> 8), byte(len(items)), byte(size)}
+	offset := 1
+	for i := 0; i <= len(items); i++ {
+		for shift := 8 * (size - 1); shift >= 0; shift -= 8 {
+			index = append(index, byte(offset>>shift))
+		}
+		if i < len(items) {
+			offset += len(items[i])
+		}
+	}
+	for _, item := range items {
+		index = append(index, item...)
+	}
+	return index
+}
+
+// parseCFFDict returns the entries of a DICT
+func parseCFFDict(data []byte) ([]cffEntry, error) {
+	var entries []cffEntry
+	var operands [][]byte
+	for i := 0; i < len(data); {
+		b := data[i]
+		length := 0
+		switch {
+		case b <= 21:
+			operator := int(b)
+			i++
+			if b == 12 {
+				if i >= len(data) {
+					return nil, fmt.Errorf("CFF DICT is truncated")
+				}
+				operator = 1200 + int(data[i])
+				i++
+			}
+			entries = append(entries, cffEntry{operator, operands})
+			operands = nil
+			continue
+		case b == 28:
+			length = 3
+		case b == 29:
+			length = 5
+		case b == 30:
+			// Real numbers end with a 0xf nibble
+			for length = 1; ; length++ {
+				if i+length >= len(data) {
+					return nil, fmt.Errorf("CFF DICT is truncated")
+				}
+				if nibbles := data[i+length]; nibbles&0x0F == 0x0F || nibbles>>4 == 0x0F {
+					length++
+					break
+				}
+			}
+		case b >= 32 && b <= 246:
+			length = 1
+		case b >= 247 && b <= 254:
+			length = 2
+		default:
+			return nil, fmt.Errorf("invalid CFF DICT operand")
+		}
+		if i+length > len(data) {
+			return nil, fmt.Errorf("CFF DICT is truncated")
+		}
+		operands = append(operands, data[i:i+length])
+		i += length
+	}
+	return entries, nil
+}
+
+// cffInt returns the value of an integer operand, 0 for real numbers
+func cffInt(operand []byte) int {
+	switch b := operand[0]; {
+	case b == 28:
+		return int(int16(binary.BigEndian.Uint16(operand[1:])))
+	case b == 29:
+		return int(int32(binary.BigEndian.Uint32(operand[1:])))
+	case b >= 32 && b <= 246:
+		return int(b) - 139
+	case b >= 247 && b <= 250:
+		return (int(b)-247)*256 + int(operand[1]) + 108
+	case b >= 251 && b <= 254:
+		return -(int(b)-251)*256 - int(operand[1]) - 108
+	}
+	return 0
+}
+
+// cffOperand returns a 5-byte integer operand, whose length doesn't depend
+// on its value
+func cffOperand(value int) []byte {
+	operand := []byte{29, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(operand[1:], uint32(value))
+	return operand
+}
+
+// writeCFFDict returns a DICT made of entries
+func writeCFFDict(entries []cffEntry) []byte {
+	var dict []byte
+	for _, entry := range entries {
+		for _, operand := range entry.operands {
+			dict = append(dict, operand...)
+		}
+		if entry.operator >= 1200 {
+			dict = append(dict, 12, byte(entry.operator-1200))
+		} else {
+			dict = append(dict, byte(entry.operator))
+		}
+	}
+	return dict
+}
+
+// lookup returns the integer operands of operator in entries, nil if missing
+func lookup(entries []cffEntry, operator int) []int {
+	for _, entry := range entries {
+		if entry.operator == operator {
+			values := make([]int, len(entry.operands))
+			for i, operand := range entry.operands {
+				values[i] = cffInt(operand)
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+// parseCFF parses the first font of a CFF table
+func parseCFF(data []byte) (*cffFont, error) {
+	if len(data) < 4 || data[0] != 1 {
+		return nil, fmt.Errorf("unsupported CFF version")
+	}
+	_, offset, err := cffIndex(data, int(data[2]))
+	if err != nil {
+		return nil, err
+	}
+	topDicts, offset, err := cffIndex(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(topDicts) == 0 {
+		return nil, fmt.Errorf("CFF table has no font")
+	}
+	font := &cffFont{}
+	if font.strings, offset, err = cffIndex(data, offset); err != nil {
+		return nil, err
+	}
+	subrsStart := offset
+	if _, offset, err = cffIndex(data, offset); err != nil {
+		return nil, err
+	}
+	font.globalSubrs = data[subrsStart:offset]
+
+	if font.topDict, err = parseCFFDict(topDicts[0]); err != nil {
+		return nil, err
+	}
+	if kind := lookup(font.topDict, cffCharstringType); kind != nil && kind[0] != 2 {
+		return nil, fmt.Errorf("unsupported CFF charstring type %d", kind[0])
+	}
+	charStrings := lookup(font.topDict, cffCharStrings)
+	if len(charStrings) != 1 {
+		return nil, fmt.Errorf("CFF font has no charstrings")
+	}
+	if font.charStrings, _, err = cffIndex(data, charStrings[0]); err != nil {
+		return nil, err
+	}
+	if font.charset, err = parseCharset(data, lookup(font.topDict, cffCharset), len(font.charStrings)); err != nil {
+		return nil, err
+	}
+
+	if lookup(font.topDict, cffROS) == nil {
+		private, err := parsePrivate(data, font.topDict)
+		if err != nil {
+			return nil, err
+		}
+		font.fonts = []cffPrivateDict{private}
+		return font, nil
+	}
+
+	// CID-keyed fonts have a Private DICT by Font DICT
+	font.cid = true
+	fdArray, fdSelect := lookup(font.topDict, cffFDArray), lookup(font.topDict, cffFDSelect)
+	if len(fdArray) != 1 || len(fdSelect) != 1 {
+		return nil, fmt.Errorf("CID-keyed CFF font has no Font DICTs")
+	}
+	fontDicts, _, err := cffIndex(data, fdArray[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, fontDict := range fontDicts {
+		entries, err := parseCFFDict(fontDict)
+		if err != nil {
+			return nil, err
+		}
+		private, err := parsePrivate(data, entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.operator != cffPrivate {
+				private.fontDict = append(private.fontDict, entry)
+			}
+		}
+		font.fonts = append(font.fonts, private)
+	}
+	if font.fdSelect, err = parseFDSelect(data, fdSelect[0], len(font.charStrings), len(font.fonts)); err != nil {
+		return nil, err
+	}
+	return font, nil
+}
+
+// parsePrivate returns the Private DICT referenced by dict, with its
+// subroutines
+func parsePrivate(data []byte, dict []cffEntry) (cffPrivateDict, error) {
+	var private cffPrivateDict
+	offsets := lookup(dict, cffPrivate)
+	if len(offsets) != 2 {
+		return private, nil
+	}
+	size, start := offsets[0], offsets[1]
+	if size < 0 || start < 0 || start+size > len(data) {
+		return private, fmt.Errorf("invalid CFF Private DICT")
+	}
+	entries, err := parseCFFDict(data[start : start+size])
+	if err != nil {
+		return private, err
+	}
+	for _, entry := range entries {
+		if entry.operator != cffSubrs {
+			private.private = append(private.private, entry)
+		}
+	}
+	if subrs := lookup(entries, cffSubrs); len(subrs) == 1 {
+		_, end, err := cffIndex(data, start+subrs[0])
+		if err != nil {
+			return private, err
+		}
+		private.localSubrs = data[start+subrs[0] : end]
+	}
+	return private, nil
+}
+
+// parseFDSelect returns the Font DICT indices by glyph ID of the FDSelect
+// at offset
+func parseFDSelect(data []byte, offset, count, fonts int) ([]byte, error) {
+	if offset < 0 || offset >= len(data) {
+		return nil, fmt.Errorf("CFF FDSelect is truncated")
+	}
+	fdSelect := make([]byte, count)
+	switch data[offset] {
+	case 0:
+		if offset+1+count > len(data) {
+			return nil, fmt.Errorf("CFF FDSelect is truncated")
+		}
+		copy(fdSelect, data[offset+1:])
+	case 3:
+		if offset+3 > len(data) {
+			return nil, fmt.Errorf("CFF FDSelect is truncated")
+		}
+		ranges := int(binary.BigEndian.Uint16(data[offset+1:]))
+		if offset+5+3*ranges > len(data) {
+			return nil, fmt.Errorf("CFF FDSelect is truncated")
+		}
+		for i := 0; i < ranges; i++ {
+			first := int(binary.BigEndian.Uint16(data[offset+3+3*i:]))
+			next := int(binary.BigEndian.Uint16(data[offset+6+3*i:]))
+			for glyph := first; glyph < next && glyph < count; glyph++ {
+				fdSelect[glyph] = data[offset+5+3*i]
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown CFF FDSelect format %d", data[offset])
+	}
+	for _, fd := range fdSelect {
+		if int(fd) >= fonts {
+			return nil, fmt.Errorf("invalid CFF Font DICT index %d", fd)
+		}
+	}
+	return fdSelect, nil
+}
+
+// parseCharset returns the string IDs of the glyph names given by the
+// charset at offset, 0 for the ISOAdobe charset
+func parseCharset(data []byte, offset []int, count int) ([]uint16, error) {
+	charset := make([]uint16, count)
+	if len(offset) == 0 || offset[0] == 0 {
+		for glyph := range charset {
+			charset[glyph] = uint16(glyph)
+		}
+		return charset, nil
+	}
+	if offset[0] < 3 {
+		return nil, fmt.Errorf("expert CFF charsets are not supported")
+	}
+	position := offset[0]
+	if position >= len(data) {
+		return nil, fmt.Errorf("CFF charset is truncated")
+	}
+	format := data[position]
+	position++
+	for glyph := 1; glyph < count; {
+		switch format {
+		case 0:
+			if position+2 > len(data) {
+				return nil, fmt.Errorf("CFF charset is truncated")
+			}
+			charset[glyph] = binary.BigEndian.Uint16(data[position:])
+			position += 2
+			glyph++
+		case 1, 2:
+			size := 3 + int(format) - 1
+			if position+size > len(data) {
+				return nil, fmt.Errorf("CFF charset is truncated")
+			}
+			first := binary.BigEndian.Uint16(data[position:])
+			left := int(data[position+2])
+			if format == 2 {
+				left = int(binary.BigEndian.Uint16(data[position+2:]))
+			}
+			position += size
+			for i := 0; i <= left && glyph < count; i++ {
+				charset[glyph] = first + uint16(i)
+				glyph++
+			}
+		default:
+			return nil, fmt.Errorf("unknown CFF charset format %d", format)
+		}
+	}
+	return charset, nil
+}
+
+// write returns the Private DICT, whose subroutines directly follow it,
+// and the subroutines
+func (p cffPrivateDict) write() ([]byte, []byte) {
+	private := p.private
+	if p.localSubrs != nil {
+		private = append(private[:len(private):len(private)], cffEntry{cffSubrs, nil})
+		length := len(writeCFFDict(private)) + 5
+		private[len(private)-1].operands = [][]byte{cffOperand(length)}
+	}
+	return writeCFFDict(private), p.localSubrs
+}
+
+// topEntries returns the entries of the Top DICT, without the ones that
+// are written by subsets or don't apply to them anymore
+func (c *cffFont) topEntries() []cffEntry {
+	var entries []cffEntry
+	for _, entry := range c.topDict {
+		switch entry.operator {
+		case cffCharset, cffEncoding, cffCharStrings, cffPrivate, cffUniqueID, cffXUID,
+			cffROS, cffCIDCount, cffUIDBase, cffFDArray, cffFDSelect:
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// subset returns a CFF font named name, with the glyphs used, whose
+// built-in encoding maps the given codes to them. Subroutines are kept.
+func (c *cffFont) subset(name string, used []uint16, codes []int) ([]byte, error) {
+	charStrings := make([][]byte, len(used))
+	charset := []byte{0}
+	encoding := []byte{0, byte(len(used) - 1)}
+	for i, glyph := range used {
+		charStrings[i] = c.charStrings[glyph]
+		if i > 0 {
+			charset = append(charset, byte(c.charset[glyph]>>8), byte(c.charset[glyph]))
+			encoding = append(encoding, byte(codes[i]))
+		}
+	}
+	charStringsIndex := writeCFFIndex(charStrings)
+	privateDict, localSubrs := c.fonts[0].write()
+
+	// Top DICT, whose offsets are written once its length is known
+	top := append(c.topEntries(),
+		cffEntry{cffCharset, [][]byte{cffOperand(0)}},
+		cffEntry{cffEncoding, [][]byte{cffOperand(0)}},
+		cffEntry{cffCharStrings, [][]byte{cffOperand(0)}},
+		cffEntry{cffPrivate, [][]byte{cffOperand(0), cffOperand(0)}})
+	header := []byte{1, 0, 4, 4}
+	nameIndex := writeCFFIndex([][]byte{[]byte(name)})
+	stringIndex := writeCFFIndex(c.strings)
+	topLength := len(writeCFFIndex([][]byte{writeCFFDict(top)}))
+	offset := len(header) + len(nameIndex) + topLength + len(stringIndex) + len(c.globalSubrs)
+	entries := top[len(top)-4:]
+	entries[0].operands[0] = cffOperand(offset)
+	offset += len(charset)
+	entries[1].operands[0] = cffOperand(offset)
+	offset += len(encoding)
+	entries[2].operands[0] = cffOperand(offset)
+	offset += len(charStringsIndex)
+	entries[3].operands = [][]byte{cffOperand(len(privateDict)), cffOperand(offset)}
+
+	var output []byte
+	for _, part := range [][]byte{
+		header, nameIndex, writeCFFIndex([][]byte{writeCFFDict(top)}), stringIndex,
+		c.globalSubrs, charset, encoding, charStringsIndex, privateDict, localSubrs,
+	} {
+		output = append(output, part...)
+	}
+	return output, nil
+}
+
+// cidSubset returns a CID-keyed CFF font named name, with the sorted
+// glyphs used, whose CIDs are their original glyph IDs, using the
+// Adobe-Identity-0 character collection. Subroutines are kept.
+func (c *cffFont) cidSubset(name string, glyphs []uint16) ([]byte, error) {
+	charStrings := make([][]byte, len(glyphs))
+	charset := []byte{0}
+	fdSelect := []byte{0}
+	for i, glyph := range glyphs {
+		charStrings[i] = c.charStrings[glyph]
+		if i > 0 {
+			charset = append(charset, byte(glyph>>8), byte(glyph))
+		}
+		if c.fdSelect != nil {
+			fdSelect = append(fdSelect, c.fdSelect[glyph])
+		} else {
+			fdSelect = append(fdSelect, 0)
+		}
+	}
+	charStringsIndex := writeCFFIndex(charStrings)
+
+	// Registry and ordering strings are added after the original strings
+	strings := append(c.strings[:len(c.strings):len(c.strings)], []byte("Adobe"), []byte("Identity"))
+	stringIndex := writeCFFIndex(strings)
+	registry := 391 + len(c.strings)
+
+	privates := make([][]byte, len(c.fonts))
+	subrs := make([][]byte, len(c.fonts))
+	for i, font := range c.fonts {
+		privates[i], subrs[i] = font.write()
+	}
+	fdArray := func(offset int) []byte {
+		fontDicts := make([][]byte, len(c.fonts))
+		for i, font := range c.fonts {
+			entries := append(font.fontDict[:len(font.fontDict):len(font.fontDict)],
+				cffEntry{cffPrivate, [][]byte{cffOperand(len(privates[i])), cffOperand(offset)}})
+			fontDicts[i] = writeCFFDict(entries)
+			offset += len(privates[i]) + len(subrs[i])
+		}
+		return writeCFFIndex(fontDicts)
+	}
+
+	// Top DICT starting with ROS, whose offsets are written once its length
+	// is known
+	top := append([]cffEntry{{cffROS, [][]byte{cffOperand(registry), cffOperand(registry + 1), cffOperand(0)}}}, c.topEntries()...)
+	top = append(top,
+		cffEntry{cffCIDCount, [][]byte{cffOperand(int(glyphs[len(glyphs)-1]) + 1)}},
+		cffEntry{cffCharset, [][]byte{cffOperand(0)}},
+		cffEntry{cffFDSelect, [][]byte{cffOperand(0)}},
+		cffEntry{cffCharStrings, [][]byte{cffOperand(0)}},
+		cffEntry{cffFDArray, [][]byte{cffOperand(0)}})
+	header := []byte{1, 0, 4, 4}
+	nameIndex := writeCFFIndex([][]byte{[]byte(name)})
+	topLength := len(writeCFFIndex([][]byte{writeCFFDict(top)}))
+	offset := len(header) + len(nameIndex) + topLength + len(stringIndex) + len(c.globalSubrs)
+	entries := top[len(top)-4:]
+	for i, part := range [][]byte{charset, fdSelect, charStringsIndex} {
+		entries[i].operands[0] = cffOperand(offset)
+		offset += len(part)
+	}
+	entries[3].operands[0] = cffOperand(offset)
+	fdArrayIndex := fdArray(offset + len(fdArray(0)))
+
+	output := make([]byte, 0, offset)
+	for _, part := range [][]byte{
+		header, nameIndex, writeCFFIndex([][]byte{writeCFFDict(top)}), stringIndex,
+		c.globalSubrs, charset, fdSelect, charStringsIndex, fdArrayIndex,
+	} {
+		output = append(output, part...)
+	}
+	for i := range privates {
+		output = append(output, privates[i]...)
+		output = append(output, subrs[i]...)
+	}
+	return output, nil
+}
@@ -0,0 +1,81 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// finishComposite embeds the subset of a composite font made of the glyphs
+// used so far, and updates the font dictionaries accordingly. CIDs are the
+// glyph IDs of the original font file.
+func (f *TrueType) finishComposite() error {
+	cids := make([]uint16, 0, len(f.cids))
+	for cid := range f.cids {
+		cids = append(cids, cid)
+	}
+	sort.Slice(cids, func(i, j int) bool { return cids[i] < cids[j] })
+
+	name := subsetTag(cids) + "+" + f.Name
+	var subset []byte
+	var err error
+	subtype, fileType := "CIDFontType2", ""
+	if f.cff != nil {
+		subset, err = f.cff.cidSubset(name, cids)
+		subtype, fileType = "CIDFontType0", "CIDFontType0C"
+	} else {
+		var numbers map[uint16]uint16
+		if subset, numbers, err = f.subsetGlyf(cids, nil); err == nil {
+			// Glyphs are renumbered in the subset, CIDs are kept
+			cidToGID := make([]byte, 2*(int(cids[len(cids)-1])+1))
+			for _, cid := range cids {
+				binary.BigEndian.PutUint16(cidToGID[2*int(cid):], numbers[cid])
+			}
+			f.cidToGID.Stream = []interface{}{cidToGID}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to subset font %s: %w", f.Name, err)
+	}
+
+	f.dictionary.Set("BaseFont", godyf.Name(name))
+	f.dictionary.Set("DescendantFonts", godyf.NewArray(f.cidFont.Ref()))
+	f.dictionary.Set("ToUnicode", f.toUnicode.Ref())
+	f.toUnicode.Stream = []interface{}{toUnicodeCMap(f.text, 2)}
+
+	f.cidFont.Set("Subtype", godyf.Name(subtype))
+	f.cidFont.Set("BaseFont", godyf.Name(name))
+	f.cidFont.Set("CIDSystemInfo", godyf.NewDictionary(map[string]interface{}{
+		"Registry":   godyf.NewString("Adobe"),
+		"Ordering":   godyf.NewString("Identity"),
+		"Supplement": 0,
+	}))
+	f.cidFont.Set("FontDescriptor", f.descriptor.Ref())
+	f.cidFont.Set("W", f.cidWidths(cids))
+	if f.cidToGID != nil {
+		f.cidFont.Set("CIDToGIDMap", f.cidToGID.Ref())
+	}
+	f.finishDescriptor(name, subset, fileType)
+	return nil
+}
+
+// cidWidths returns the /W array giving the widths of the sorted CIDs,
+// consecutive CIDs being grouped
+func (f *TrueType) cidWidths(cids []uint16) *godyf.Array {
+	array := godyf.NewArray()
+	for start := 0; start < len(cids); {
+		end := start + 1
+		for end < len(cids) && cids[end] == cids[end-1]+1 {
+			end++
+		}
+		widths := godyf.NewArray()
+		for _, cid := range cids[start:end] {
+			widths.Elements = append(widths.Elements, f.width(cid))
+		}
+		array.Elements = append(array.Elements, int(cids[start]), widths)
+		start = end
+	}
+	return array
+}
@@ -0,0 +1,279 @@
+package font
+
+import (
+	"strings"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// Encoding maps single-byte character codes of simple fonts to glyph names
+// and Unicode characters
+type Encoding struct {
+	// Name of the encoding, used as /Encoding, empty for built-in encodings
+	Name   godyf.Name
+	glyphs [256]string   // Glyph names by code, empty for undefined codes
+	codes  map[rune]byte // Codes by character
+}
+
+// newEncoding returns an encoding whose glyph names, starting from code
+// first, are separated by spaces, "." standing for undefined codes.
+// Aliases give other characters displayed by the glyphs of some codes.
+func newEncoding(name godyf.Name, first int, glyphs string, runes func(code int, glyph string) rune, aliases map[rune]byte) *Encoding {
+	encoding := &Encoding{Name: name, codes: make(map[rune]byte)}
+	for i, glyph := range strings.Fields(glyphs) {
+		if glyph == "." {
+			continue
+		}
+		code := first + i
+		encoding.glyphs[code] = glyph
+		if r := runes(code, glyph); r != 0 {
+			if _, ok := encoding.codes[r]; !ok {
+				encoding.codes[r] = byte(code)
+			}
+		}
+	}
+	for r, code := range aliases {
+		encoding.codes[r] = code
+	}
+	return encoding
+}
+
+// glyphRune returns the character of a glyph from the glyph list
+func glyphRune(code int, glyph string) rune {
+	return glyphRunes[glyph]
+}
+
+// Glyph returns the name of the glyph displayed for code, empty if the
+// code is undefined
+func (e *Encoding) Glyph(code byte) string {
+	return e.glyphs[code]
+}
+
+// Code returns the code of the glyph displaying r, and whether r can be
+// encoded
+func (e *Encoding) Code(r rune) (byte, bool) {
+	code, ok := e.codes[r]
+	return code, ok
+}
+
+// asciiGlyphs are the glyph names of ASCII characters from 0x20 to 0x7E,
+// quotes excepted
+const (
+	asciiPunctuation = "space exclam quotedbl numbersign dollar percent ampersand"
+	asciiMiddle      = "parenleft parenright asterisk plus comma hyphen period slash " +
+		"zero one two three four five six seven eight nine colon semicolon less equal greater question at " +
+		"A B C D E F G H I J K L M N O P Q R S T U V W X Y Z bracketleft backslash bracketright asciicircum underscore"
+	asciiLetters = "a b c d e f g h i j k l m n o p q r s t u v w x y z braceleft bar braceright asciitilde"
+)
+
+// StandardEncoding is the built-in encoding of Latin Type 1 fonts
+var StandardEncoding = newEncoding("StandardEncoding", 32,
+	asciiPunctuation+" quoteright "+asciiMiddle+" quoteleft "+asciiLetters+
+		" "+strings.Repeat(". ", 34)+
+		"exclamdown cent sterling fraction yen florin section currency quotesingle quotedblleft "+
+		"guillemotleft guilsinglleft guilsinglright fi fl . endash dagger daggerdbl periodcentered . "+
+		"paragraph bullet quotesinglbase quotedblbase quotedblright guillemotright ellipsis perthousand . "+
+		"questiondown . grave acute circumflex tilde macron breve dotaccent dieresis . ring cedilla . "+
+		"hungarumlaut ogonek caron emdash "+strings.Repeat(". ", 16)+
+		"AE . ordfeminine . . . . Lslash Oslash OE ordmasculine . . . . . "+
+		"ae . . . dotlessi . . lslash oslash oe germandbls . . . .",
+	glyphRune, nil)
+
+// WinAnsiEncoding is the Windows code page 1252 encoding
+var WinAnsiEncoding = newEncoding("WinAnsiEncoding", 32,
+	asciiPunctuation+" quotesingle "+asciiMiddle+" grave "+asciiLetters+" . "+
+		"Euro . quotesinglbase florin quotedblbase ellipsis dagger daggerdbl circumflex perthousand "+
+		"Scaron guilsinglleft OE . Zcaron . . quoteleft quoteright quotedblleft quotedblright bullet "+
+		"endash emdash tilde trademark scaron guilsinglright oe . zcaron Ydieresis "+
+		"space exclamdown cent sterling currency yen brokenbar section dieresis copyright ordfeminine "+
+		"guillemotleft logicalnot hyphen registered macron degree plusminus twosuperior threesuperior "+
+		"acute mu paragraph periodcentered cedilla onesuperior ordmasculine guillemotright onequarter "+
+		"onehalf threequarters questiondown "+latin1Letters,
+	glyphRune, map[rune]byte{'\u00A0': 0xA0, '\u00AD': 0xAD})
+
+// MacRomanEncoding is the Mac OS standard Roman encoding, without the
+// mathematical characters missing from Latin text fonts
+var MacRomanEncoding = newEncoding("MacRomanEncoding", 32,
+	asciiPunctuation+" quotesingle "+asciiMiddle+" grave "+asciiLetters+" . "+
+		"Adieresis Aring Ccedilla Eacute Ntilde Odieresis Udieresis aacute agrave acircumflex "+
+		"adieresis atilde aring ccedilla eacute egrave ecircumflex edieresis iacute igrave icircumflex "+
+		"idieresis ntilde oacute ograve ocircumflex odieresis otilde uacute ugrave ucircumflex "+
+		"udieresis dagger degree cent sterling section bullet paragraph germandbls registered "+
+		"copyright trademark acute dieresis . AE Oslash . plusminus . . yen mu . . . . . "+
+		"ordfeminine ordmasculine . ae oslash questiondown exclamdown logicalnot . florin . . "+
+		"guillemotleft guillemotright ellipsis space Agrave Atilde Otilde OE oe endash emdash "+
+		"quotedblleft quotedblright quoteleft quoteright divide . ydieresis Ydieresis fraction "+
+		"currency guilsinglleft guilsinglright fi fl daggerdbl periodcentered quotesinglbase "+
+		"quotedblbase perthousand Acircumflex Ecircumflex Aacute Edieresis Egrave Iacute Icircumflex "+
+		"Idieresis Igrave Oacute Ocircumflex . Ograve Uacute Ucircumflex Ugrave dotlessi circumflex "+
+		"tilde macron breve dotaccent ring cedilla hungarumlaut ogonek caron",
+	glyphRune, map[rune]byte{'\u00A0': 0xCA})
+
+// latin1Letters are the glyph names of Latin-1 characters from 0xC0 to 0xFF
+const latin1Letters = "Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla Egrave Eacute " +
+	"Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis Eth Ntilde Ograve Oacute Ocircumflex " +
+	"Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls " +
+	"agrave aacute acircumflex atilde adieresis aring ae ccedilla egrave eacute ecircumflex edieresis " +
+	"igrave iacute icircumflex idieresis eth ntilde ograve oacute ocircumflex otilde odieresis divide " +
+	"oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis"
+
+// symbolEncoding is the built-in encoding of the Symbol font
+var symbolEncoding = newEncoding("", 32,
+	"space exclam universal numbersign existential percent ampersand suchthat parenleft parenright "+
+		"asteriskmath plus comma minus period slash zero one two three four five six seven eight nine "+
+		"colon semicolon less equal greater question congruent Alpha Beta Chi Delta Epsilon Phi Gamma "+
+		"Eta Iota theta1 Kappa Lambda Mu Nu Omicron Pi Theta Rho Sigma Tau Upsilon sigma1 Omega Xi Psi "+
+		"Zeta bracketleft therefore bracketright perpendicular underscore radicalex alpha beta chi delta "+
+		"epsilon phi gamma eta iota phi1 kappa lambda mu nu omicron pi theta rho sigma tau upsilon "+
+		"omega1 omega xi psi zeta braceleft bar braceright similar . "+strings.Repeat(". ", 32)+
+		"Euro Upsilon1 minute lessequal fraction infinity florin club diamond heart spade arrowboth "+
+		"arrowleft arrowup arrowright arrowdown degree plusminus second greaterequal multiply "+
+		"proportional partialdiff bullet divide notequal equivalence approxequal ellipsis arrowvertex "+
+		"arrowhorizex carriagereturn aleph Ifraktur Rfraktur weierstrass circlemultiply circleplus "+
+		"emptyset intersection union propersuperset reflexsuperset notsubset propersubset reflexsubset "+
+		"element notelement angle gradient registerserif copyrightserif trademarkserif product radical "+
+		"dotmath logicalnot logicaland logicalor arrowdblboth arrowdblleft arrowdblup arrowdblright "+
+		"arrowdbldown lozenge angleleft registersans copyrightsans trademarksans summation parenlefttp "+
+		"parenleftex parenleftbt bracketlefttp bracketleftex bracketleftbt bracelefttp braceleftmid "+
+		"braceleftbt braceex apple angleright integral integraltp integralex integralbt parenrighttp "+
+		"parenrightex parenrightbt bracketrighttp bracketrightex bracketrightbt bracerighttp "+
+		"bracerightmid bracerightbt .",
+	glyphRune, nil)
+
+// dingbatsEncoding is the built-in encoding of the ZapfDingbats font
+var dingbatsEncoding = newEncoding("", 32,
+	"space a1 a2 a202 a3 a4 a5 a119 a118 a117 a11 a12 a13 a14 a15 a16 a105 a17 a18 a19 a20 a21 a22 "+
+		"a23 a24 a25 a26 a27 a28 a6 a7 a8 a9 a10 a29 a30 a31 a32 a33 a34 a35 a36 a37 a38 a39 a40 a41 "+
+		"a42 a43 a44 a45 a46 a47 a48 a49 a50 a51 a52 a53 a54 a55 a56 a57 a58 a59 a60 a61 a62 a63 a64 "+
+		"a65 a66 a67 a68 a69 a70 a71 a72 a73 a74 a203 a75 a204 a76 a77 a78 a79 a81 a82 a83 a84 a97 a98 "+
+		"a99 a100 . a89 a90 a93 a94 a91 a92 a205 a85 a206 a86 a87 a88 a95 a96 "+strings.Repeat(". ", 19)+
+		"a101 a102 a103 a104 a106 a107 a108 a112 a111 a110 a109 a120 a121 a122 a123 a124 a125 a126 "+
+		"a127 a128 a129 a130 a131 a132 a133 a134 a135 a136 a137 a138 a139 a140 a141 a142 a143 a144 "+
+		"a145 a146 a147 a148 a149 a150 a151 a152 a153 a154 a155 a156 a157 a158 a159 a160 a161 a163 "+
+		"a164 a196 a165 a192 a166 a167 a168 a169 a170 a171 a172 a173 a162 a174 a175 a176 a177 a178 "+
+		"a179 a193 a180 a199 a181 a200 a182 . a201 a183 a184 a197 a185 a194 a198 a186 a195 a187 a188 "+
+		"a189 a190 a191 .",
+	dingbatRune, nil)
+
+// dingbatRune returns the character of a ZapfDingbats code, most of them
+// being in the Unicode Dingbats block in the same order
+func dingbatRune(code int, glyph string) rune {
+	if r, ok := dingbatExceptions[code]; ok {
+		return r
+	}
+	switch {
+	case code == 0x20:
+		return ' '
+	case code >= 0x21 && code <= 0x7E:
+		return rune(0x2700 + code - 0x20)
+	case code >= 0x80 && code <= 0x8D:
+		return rune(0x2768 + code - 0x80)
+	case code >= 0xA1 && code <= 0xFE:
+		return rune(0x2760 + code - 0xA0)
+	}
+	return 0
+}
+
+// dingbatExceptions are the ZapfDingbats characters encoded outside of the
+// Unicode Dingbats block
+var dingbatExceptions = map[int]rune{
+	0x25: '☎', 0x48: '★', 0x6C: '●', 0x6E: '■', 0x73: '▲',
+	0x74: '▼', 0x75: '◆', 0x77: '◗', 0xA8: '♣', 0xA9: '♦',
+	0xAA: '♥', 0xAB: '♠', 0xAC: '①', 0xAD: '②', 0xAE: '③',
+	0xAF: '④', 0xB0: '⑤', 0xB1: '⑥', 0xB2: '⑦', 0xB3: '⑧',
+	0xB4: '⑨', 0xB5: '⑩', 0xD5: '→', 0xD6: '↔', 0xD7: '↕',
+}
+
+// glyphRunes maps glyph names to characters, following the Adobe Glyph List
+var glyphRunes = map[string]rune{
+	// ASCII
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*',
+	"plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/', "zero": '0', "one": '1',
+	"two": '2', "three": '3', "four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8',
+	"nine": '9', "colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "A": 'A', "B": 'B', "C": 'C', "D": 'D', "E": 'E', "F": 'F', "G": 'G',
+	"H": 'H', "I": 'I', "J": 'J', "K": 'K', "L": 'L', "M": 'M', "N": 'N', "O": 'O', "P": 'P', "Q": 'Q',
+	"R": 'R', "S": 'S', "T": 'T', "U": 'U', "V": 'V', "W": 'W', "X": 'X', "Y": 'Y', "Z": 'Z',
+	"bracketleft": '[', "backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_',
+	"grave": '`', "a": 'a', "b": 'b', "c": 'c', "d": 'd', "e": 'e', "f": 'f', "g": 'g', "h": 'h',
+	"i": 'i', "j": 'j', "k": 'k', "l": 'l', "m": 'm', "n": 'n', "o": 'o', "p": 'p', "q": 'q', "r": 'r',
+	"s": 's', "t": 't', "u": 'u', "v": 'v', "w": 'w', "x": 'x', "y": 'y', "z": 'z', "braceleft": '{',
+	"bar": '|', "braceright": '}', "asciitilde": '~',
+
+	// Latin-1
+	"exclamdown": '¡', "cent": '¢', "sterling": '£', "currency": '¤',
+	"yen": '¥', "brokenbar": '¦', "section": '§', "dieresis": '¨',
+	"copyright": '©', "ordfeminine": 'ª', "guillemotleft": '«',
+	"logicalnot": '¬', "registered": '®', "macron": '¯', "degree": '°',
+	"plusminus": '±', "twosuperior": '²', "threesuperior": '³', "acute": '´',
+	"mu": 'µ', "paragraph": '¶', "periodcentered": '·', "cedilla": '¸',
+	"onesuperior": '¹', "ordmasculine": 'º', "guillemotright": '»',
+	"onequarter": '¼', "onehalf": '½', "threequarters": '¾', "questiondown": '¿',
+	"Agrave": 'À', "Aacute": 'Á', "Acircumflex": 'Â', "Atilde": 'Ã',
+	"Adieresis": 'Ä', "Aring": 'Å', "AE": 'Æ', "Ccedilla": 'Ç', "Egrave": 'È',
+	"Eacute": 'É', "Ecircumflex": 'Ê', "Edieresis": 'Ë', "Igrave": 'Ì',
+	"Iacute": 'Í', "Icircumflex": 'Î', "Idieresis": 'Ï', "Eth": 'Ð',
+	"Ntilde": 'Ñ', "Ograve": 'Ò', "Oacute": 'Ó', "Ocircumflex": 'Ô',
+	"Otilde": 'Õ', "Odieresis": 'Ö', "multiply": '×', "Oslash": 'Ø',
+	"Ugrave": 'Ù', "Uacute": 'Ú', "Ucircumflex": 'Û', "Udieresis": 'Ü',
+	"Yacute": 'Ý', "Thorn": 'Þ', "germandbls": 'ß', "agrave": 'à',
+	"aacute": 'á', "acircumflex": 'â', "atilde": 'ã', "adieresis": 'ä',
+	"aring": 'å', "ae": 'æ', "ccedilla": 'ç', "egrave": 'è', "eacute": 'é',
+	"ecircumflex": 'ê', "edieresis": 'ë', "igrave": 'ì', "iacute": 'í',
+	"icircumflex": 'î', "idieresis": 'ï', "eth": 'ð', "ntilde": 'ñ',
+	"ograve": 'ò', "oacute": 'ó', "ocircumflex": 'ô', "otilde": 'õ',
+	"odieresis": 'ö', "divide": '÷', "oslash": 'ø', "ugrave": 'ù',
+	"uacute": 'ú', "ucircumflex": 'û', "udieresis": 'ü', "yacute": 'ý',
+	"thorn": 'þ', "ydieresis": 'ÿ',
+
+	// Other Latin glyphs
+	"dotlessi": 'ı', "Lslash": 'Ł', "lslash": 'ł', "OE": 'Œ', "oe": 'œ',
+	"Scaron": 'Š', "scaron": 'š', "Ydieresis": 'Ÿ', "Zcaron": 'Ž',
+	"zcaron": 'ž', "florin": 'ƒ', "circumflex": 'ˆ', "caron": 'ˇ',
+	"breve": '˘', "dotaccent": '˙', "ring": '˚', "ogonek": '˛', "tilde": '˜',
+	"hungarumlaut": '˝', "endash": '–', "emdash": '—', "quoteleft": '‘',
+	"quoteright": '’', "quotesinglbase": '‚', "quotedblleft": '“',
+	"quotedblright": '”', "quotedblbase": '„', "dagger": '†', "daggerdbl": '‡',
+	"bullet": '•', "ellipsis": '…', "perthousand": '‰', "guilsinglleft": '‹',
+	"guilsinglright": '›', "fraction": '⁄', "Euro": '€', "trademark": '™',
+	"minus": '−', "fi": 'ﬁ', "fl": 'ﬂ', "partialdiff": '∂', "Delta": '∆',
+	"summation": '∑', "radical": '√', "notequal": '≠', "lessequal": '≤',
+	"greaterequal": '≥', "lozenge": '◊', "infinity": '∞', "product": '∏',
+	"integral": '∫', "approxequal": '≈', "Omega": 'Ω', "pi": 'π',
+
+	// Symbol glyphs
+	"registerserif": '®', "copyrightserif": '©', "trademarkserif": '™',
+	"registersans": '\uF8E8', "copyrightsans": '\uF8E9', "trademarksans": '\uF8EA',
+	"universal": '∀', "existential": '∃', "suchthat": '∋', "asteriskmath": '∗',
+	"congruent": '≅', "Alpha": 'Α', "Beta": 'Β', "Chi": 'Χ', "Epsilon": 'Ε',
+	"Phi": 'Φ', "Gamma": 'Γ', "Eta": 'Η', "Iota": 'Ι', "theta1": 'ϑ',
+	"Kappa": 'Κ', "Lambda": 'Λ', "Mu": 'Μ', "Nu": 'Ν', "Omicron": 'Ο',
+	"Pi": 'Π', "Theta": 'Θ', "Rho": 'Ρ', "Sigma": 'Σ', "Tau": 'Τ',
+	"Upsilon": 'Υ', "sigma1": 'ς', "Xi": 'Ξ', "Psi": 'Ψ', "Zeta": 'Ζ',
+	"therefore": '∴', "perpendicular": '⊥', "radicalex": '\uF8E5', "alpha": 'α',
+	"beta": 'β', "chi": 'χ', "delta": 'δ', "epsilon": 'ε', "phi": 'φ',
+	"gamma": 'γ', "eta": 'η', "iota": 'ι', "phi1": 'ϕ', "kappa": 'κ',
+	"lambda": 'λ', "nu": 'ν', "omicron": 'ο', "theta": 'θ', "rho": 'ρ',
+	"sigma": 'σ', "tau": 'τ', "upsilon": 'υ', "omega1": 'ϖ', "omega": 'ω',
+	"xi": 'ξ', "psi": 'ψ', "zeta": 'ζ', "similar": '∼', "Upsilon1": 'ϒ',
+	"minute": '′', "club": '♣', "diamond": '♦', "heart": '♥', "spade": '♠',
+	"arrowboth": '↔', "arrowleft": '←', "arrowup": '↑', "arrowright": '→',
+	"arrowdown": '↓', "second": '″', "proportional": '∝', "equivalence": '≡',
+	"arrowvertex": '\uF8E6', "arrowhorizex": '\uF8E7', "carriagereturn": '↵', "aleph": 'ℵ',
+	"Ifraktur": 'ℑ', "Rfraktur": 'ℜ', "weierstrass": '℘', "circlemultiply": '⊗',
+	"circleplus": '⊕', "emptyset": '∅', "intersection": '∩', "union": '∪',
+	"propersuperset": '⊃', "reflexsuperset": '⊇', "notsubset": '⊄',
+	"propersubset": '⊂', "reflexsubset": '⊆', "element": '∈', "notelement": '∉',
+	"angle": '∠', "gradient": '∇', "dotmath": '⋅', "logicaland": '∧',
+	"logicalor": '∨', "arrowdblboth": '⇔', "arrowdblleft": '⇐', "arrowdblup": '⇑',
+	"arrowdblright": '⇒', "arrowdbldown": '⇓', "angleleft": '〈',
+	"parenlefttp": '\uF8EB', "parenleftex": '\uF8EC', "parenleftbt": '\uF8ED',
+	"bracketlefttp": '\uF8EE', "bracketleftex": '\uF8EF', "bracketleftbt": '\uF8F0',
+	"bracelefttp": '\uF8F1', "braceleftmid": '\uF8F2', "braceleftbt": '\uF8F3', "braceex": '\uF8F4',
+	"angleright": '〉', "integraltp": '⌠', "integralex": '\uF8F5', "integralbt": '⌡',
+	"parenrighttp": '\uF8F6', "parenrightex": '\uF8F7', "parenrightbt": '\uF8F8',
+	"bracketrighttp": '\uF8F9', "bracketrightex": '\uF8FA', "bracketrightbt": '\uF8FB',
+	"bracerighttp": '\uF8FC', "bracerightmid": '\uF8FD', "bracerightbt": '\uF8FE',
+	"apple": '\uF8FF',
+}
@@ -0,0 +1,204 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// glyf holds the TrueType outlines of a font
+type glyf struct {
+	data    []byte // glyf table
+	offsets []int  // Offsets of the glyphs in data, from the loca table
+}
+
+// Flags of the components of composite glyphs
+const (
+	argsAreWords    = 0x0001
+	haveScale       = 0x0008
+	moreComponents  = 0x0020
+	haveXYScale     = 0x0040
+	haveTwoByTwo    = 0x0080
+	compositeHeader = 10
+)
+
+// newGlyf returns the outlines of a font with TrueType outlines
+func newGlyf(font *sfnt, numGlyphs int) (*glyf, error) {
+	head, err := font.table("head", 54)
+	if err != nil {
+		return nil, err
+	}
+	data, err := font.table("glyf", 0)
+	if err != nil {
+		return nil, err
+	}
+	long := binary.BigEndian.Uint16(head[50:]) != 0
+	size := 2
+	if long {
+		size = 4
+	}
+	loca, err := font.table("loca", size*(numGlyphs+1))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &glyf{data: data, offsets: make([]int, numGlyphs+1)}
+	for i := range g.offsets {
+		if long {
+			g.offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		} else {
+			g.offsets[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		}
+		if g.offsets[i] > len(data) || i > 0 && g.offsets[i] < g.offsets[i-1] {
+			return nil, fmt.Errorf("invalid glyph location")
+		}
+	}
+	return g, nil
+}
+
+// glyph returns the outline of a glyph
+func (g *glyf) glyph(id uint16) []byte {
+	return g.data[g.offsets[id]:g.offsets[id+1]]
+}
+
+// components returns the positions, in the outline of a composite glyph,
+// of the glyph IDs of its components, nil for simple glyphs
+func components(outline []byte) ([]int, error) {
+	if len(outline) < compositeHeader || int16(binary.BigEndian.Uint16(outline)) >= 0 {
+		return nil, nil
+	}
+	var positions []int
+	for position := compositeHeader; ; {
+		if position+4 > len(outline) {
+			return nil, fmt.Errorf("composite glyph is truncated")
+		}
+		flags := binary.BigEndian.Uint16(outline[position:])
+		positions = append(positions, position+2)
+		position += 4
+		if flags&argsAreWords != 0 {
+			position += 4
+		} else {
+			position += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			position += 2
+		case flags&haveXYScale != 0:
+			position += 4
+		case flags&haveTwoByTwo != 0:
+			position += 8
+		}
+		if flags&moreComponents == 0 {
+			return positions, nil
+		}
+	}
+}
+
+// subsetGlyf returns a font file with the glyphs used and the glyphs they
+// are composed of, and the new glyph IDs by original glyph ID. Glyphs are
+// renumbered in their original order. When codes are given, the character
+// map maps them to the new IDs of the used glyphs.
+func (f *TrueType) subsetGlyf(used []uint16, codes []int) ([]byte, map[uint16]uint16, error) {
+	outlines, err := newGlyf(f.font, len(f.advances))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Add the components of composite glyphs
+	kept := make(map[uint16]bool)
+	queue := append([]uint16(nil), used...)
+	for len(queue) > 0 {
+		glyph := queue[0]
+		queue = queue[1:]
+		if kept[glyph] {
+			continue
+		}
+		kept[glyph] = true
+		outline := outlines.glyph(glyph)
+		positions, err := components(outline)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, position := range positions {
+			component := binary.BigEndian.Uint16(outline[position:])
+			if int(component) >= len(f.advances) {
+				return nil, nil, fmt.Errorf("invalid component glyph %d", component)
+			}
+			queue = append(queue, component)
+		}
+	}
+	glyphs := make([]uint16, 0, len(kept))
+	for glyph := range kept {
+		glyphs = append(glyphs, glyph)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	numbers := make(map[uint16]uint16, len(glyphs))
+	for i, glyph := range glyphs {
+		numbers[glyph] = uint16(i)
+	}
+
+	// Outlines, with long offsets and renumbered components
+	metrics := int(binary.BigEndian.Uint16(f.font.tables["hhea"][34:]))
+	oldHmtx := f.font.tables["hmtx"]
+	var glyfTable []byte
+	loca := make([]byte, 4*(len(glyphs)+1))
+	newHmtx := make([]byte, 4*len(glyphs))
+	for i, glyph := range glyphs {
+		binary.BigEndian.PutUint32(loca[4*i:], uint32(len(glyfTable)))
+		outline := append([]byte(nil), outlines.glyph(glyph)...)
+		positions, _ := components(outline)
+		for _, position := range positions {
+			component := binary.BigEndian.Uint16(outline[position:])
+			binary.BigEndian.PutUint16(outline[position:], numbers[component])
+		}
+		glyfTable = append(glyfTable, outline...)
+		for len(glyfTable)%4 != 0 {
+			glyfTable = append(glyfTable, 0)
+		}
+
+		// Left side bearings follow the long metrics
+		binary.BigEndian.PutUint16(newHmtx[4*i:], f.advances[glyph])
+		bearing := 4*metrics + 2*(int(glyph)-metrics)
+		if int(glyph) < metrics {
+			bearing = 4*int(glyph) + 2
+		}
+		if bearing+2 <= len(oldHmtx) {
+			copy(newHmtx[4*i+2:], oldHmtx[bearing:bearing+2])
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*len(glyphs):], uint32(len(glyfTable)))
+
+	tables := map[string][]byte{
+		"glyf": glyfTable,
+		"loca": loca,
+		"hmtx": newHmtx,
+		"head": append([]byte(nil), f.font.tables["head"]...),
+		"hhea": append([]byte(nil), f.font.tables["hhea"]...),
+		"maxp": append([]byte(nil), f.font.tables["maxp"]...),
+	}
+	binary.BigEndian.PutUint16(tables["head"][50:], 1)
+	binary.BigEndian.PutUint16(tables["hhea"][34:], uint16(len(glyphs)))
+	binary.BigEndian.PutUint16(tables["maxp"][4:], uint16(len(glyphs)))
+
+	// Hinting programs and global metrics don't depend on glyph IDs
+	for _, tag := range []string{"cvt ", "fpgm", "prep", "OS/2"} {
+		if table, ok := f.font.tables[tag]; ok {
+			tables[tag] = table
+		}
+	}
+	if post, ok := f.font.tables["post"]; ok && len(post) >= 32 {
+		// Version 3 doesn't include glyph names
+		tables["post"] = append([]byte{0, 3, 0, 0}, post[4:32]...)
+	}
+
+	if codes != nil {
+		mapped := make(map[byte]uint16, len(codes))
+		for i, code := range codes {
+			if code != 0 {
+				mapped[byte(code)] = numbers[used[i]]
+			}
+		}
+		tables["cmap"] = symbolCmap(mapped)
+	}
+	return writeSFNT(0x00010000, tables), numbers, nil
+}
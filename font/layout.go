@@ -0,0 +1,145 @@
+package font
+
+import (
+	"sort"
+)
+
+// u16 returns the big-endian 16-bit integer at offset in data, 0 when out
+// of bounds, so that malformed layout tables can't make shaping fail
+func u16(data []byte, offset int) uint16 {
+	if offset < 0 || offset+2 > len(data) {
+		return 0
+	}
+	return uint16(data[offset])<<8 | uint16(data[offset+1])
+}
+
+// u32 returns the big-endian 32-bit integer at offset in data, 0 when out
+// of bounds
+func u32(data []byte, offset int) uint32 {
+	return uint32(u16(data, offset))<<16 | uint32(u16(data, offset+2))
+}
+
+// coverageIndex returns the index of glyph in the coverage table at offset,
+// -1 if the glyph isn't covered
+func coverageIndex(data []byte, offset int, glyph uint16) int {
+	count := int(u16(data, offset+2))
+	switch u16(data, offset) {
+	case 1:
+		i := sort.Search(count, func(i int) bool { return u16(data, offset+4+2*i) >= glyph })
+		if i < count && u16(data, offset+4+2*i) == glyph {
+			return i
+		}
+	case 2:
+		i := sort.Search(count, func(i int) bool { return u16(data, offset+4+6*i+2) >= glyph })
+		if i < count && u16(data, offset+4+6*i) <= glyph {
+			return int(u16(data, offset+4+6*i+4)) + int(glyph-u16(data, offset+4+6*i))
+		}
+	}
+	return -1
+}
+
+// glyphClass returns the class of glyph in the class definition table at
+// offset, 0 for glyphs that aren't listed
+func glyphClass(data []byte, offset int, glyph uint16) int {
+	switch u16(data, offset) {
+	case 1:
+		start := u16(data, offset+2)
+		if glyph >= start && int(glyph-start) < int(u16(data, offset+4)) {
+			return int(u16(data, offset+6+2*int(glyph-start)))
+		}
+	case 2:
+		count := int(u16(data, offset+2))
+		i := sort.Search(count, func(i int) bool { return u16(data, offset+4+6*i+2) >= glyph })
+		if i < count && u16(data, offset+4+6*i) <= glyph {
+			return int(u16(data, offset+4+6*i+4))
+		}
+	}
+	return 0
+}
+
+// layoutLookup is a lookup of a GSUB or GPOS table enabled by features
+type layoutLookup struct {
+	index    int             // Index in the lookup list
+	features map[string]bool // Tags of the features enabling the lookup
+}
+
+// layoutLookups returns the lookups of a GSUB or GPOS table enabled by the
+// given features for the default language of script, or of the default
+// script if script is missing, sorted by index
+func layoutLookups(table []byte, script string, features map[string]bool) []layoutLookup {
+	scripts := int(u16(table, 4))
+	langSys := 0
+	for _, tag := range []string{script, "DFLT", "latn"} {
+		for i := 0; i < int(u16(table, scripts)); i++ {
+			record := scripts + 2 + 6*i
+			if record+4 <= len(table) && string(table[record:record+4]) == tag {
+				scriptTable := scripts + int(u16(table, record+4))
+				if offset := int(u16(table, scriptTable)); offset != 0 {
+					langSys = scriptTable + offset
+				}
+				break
+			}
+		}
+		if langSys != 0 {
+			break
+		}
+	}
+	if langSys == 0 {
+		return nil
+	}
+
+	// Required feature first, followed by the listed features
+	indices := []int{int(u16(table, langSys+2))}
+	for i := 0; i < int(u16(table, langSys+4)); i++ {
+		indices = append(indices, int(u16(table, langSys+6+2*i)))
+	}
+	featureList := int(u16(table, 6))
+	enabled := make(map[int]map[string]bool)
+	for _, index := range indices {
+		record := featureList + 2 + 6*index
+		if index == 0xFFFF || index >= int(u16(table, featureList)) || record+4 > len(table) {
+			continue
+		}
+		tag := string(table[record : record+4])
+		if !features[tag] {
+			continue
+		}
+		feature := featureList + int(u16(table, record+4))
+		for i := 0; i < int(u16(table, feature+2)); i++ {
+			lookup := int(u16(table, feature+4+2*i))
+			if enabled[lookup] == nil {
+				enabled[lookup] = make(map[string]bool)
+			}
+			enabled[lookup][tag] = true
+		}
+	}
+	lookups := make([]layoutLookup, 0, len(enabled))
+	for index, tags := range enabled {
+		lookups = append(lookups, layoutLookup{index, tags})
+	}
+	sort.Slice(lookups, func(i, j int) bool { return lookups[i].index < lookups[j].index })
+	return lookups
+}
+
+// lookupSubtables returns the type, the flag and the offsets of the
+// subtables of a lookup, extension subtables being resolved
+func lookupSubtables(table []byte, index int, extension int) (int, uint16, []int) {
+	lookupList := int(u16(table, 8))
+	if index >= int(u16(table, lookupList)) {
+		return 0, 0, nil
+	}
+	lookup := lookupList + int(u16(table, lookupList+2+2*index))
+	kind := int(u16(table, lookup))
+	flag := u16(table, lookup+2)
+	subtables := make([]int, int(u16(table, lookup+4)))
+	for i := range subtables {
+		subtables[i] = lookup + int(u16(table, lookup+6+2*i))
+		if kind == extension {
+			subtables[i] += int(u32(table, subtables[i]+4))
+		}
+	}
+	if kind == extension && len(subtables) > 0 {
+		kind = int(u16(table, lookup+int(u16(table, lookup+6))+2))
+	}
+	return kind, flag, subtables
+}
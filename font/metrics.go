@@ -0,0 +1,63 @@
+package font
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metrics of the 14 standard fonts are read from the Adobe Core14 AFM files,
+// distributed unmodified with their MustRead.html notice. Widths and
+// kerning adjustments are given in thousandths of the font size.
+//
+//go:embed afm/*.afm
+var afmFiles embed.FS
+
+// parseAFM returns the widths by glyph name and the kerning adjustments by
+// pair of glyph names read from the AFM file of the standard font name
+func parseAFM(name string) (map[string]int, map[[2]string]int, error) {
+	data, err := afmFiles.ReadFile("afm/" + name + ".afm")
+	if err != nil {
+		return nil, nil, err
+	}
+	widths := make(map[string]int)
+	kerning := make(map[[2]string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "C "):
+			// C code ; WX width ; N name ; B llx lly urx ury ;
+			var glyph string
+			width := -1
+			for _, item := range strings.Split(line, ";") {
+				fields := strings.Fields(item)
+				if len(fields) != 2 {
+					continue
+				}
+				switch fields[0] {
+				case "WX":
+					width, _ = strconv.Atoi(fields[1])
+				case "N":
+					glyph = fields[1]
+				}
+			}
+			if glyph == "" || width < 0 {
+				return nil, nil, fmt.Errorf("invalid metrics %q in %s", line, name)
+			}
+			widths[glyph] = width
+		case strings.HasPrefix(line, "KPX "):
+			// KPX left right adjustment
+			fields := strings.Fields(line)
+			adjustment, err := strconv.Atoi(fields[len(fields)-1])
+			if len(fields) != 4 || err != nil {
+				return nil, nil, fmt.Errorf("invalid kerning pair %q in %s", line, name)
+			}
+			kerning[[2]string{fields[1], fields[2]}] = adjustment
+		}
+	}
+	return widths, kerning, scanner.Err()
+}
@@ -0,0 +1,310 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// sfnt is the table directory of a TrueType or OpenType font file
+type sfnt struct {
+	version uint32            // 0x00010000 or "true" for TrueType outlines, "OTTO" for CFF
+	tables  map[string][]byte // Table data by tag
+}
+
+// parseSFNT parses the table directory of a font file
+func parseSFNT(data []byte) (*sfnt, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font file is too short")
+	}
+	font := &sfnt{version: binary.BigEndian.Uint32(data), tables: make(map[string][]byte)}
+	switch font.version {
+	case 0x00010000, 0x74727565, 0x4F54544F: // 1.0, "true", "OTTO"
+	case 0x74746366: // "ttcf"
+		return nil, fmt.Errorf("font collections are not supported")
+	default:
+		return nil, fmt.Errorf("unknown font file version %08x", font.version)
+	}
+	count := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*count {
+		return nil, fmt.Errorf("font table directory is truncated")
+	}
+	for i := 0; i < count; i++ {
+		record := data[12+16*i:]
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("font table %q is truncated", record[:4])
+		}
+		font.tables[string(record[:4])] = data[offset : offset+length]
+	}
+	return font, nil
+}
+
+// table returns the table with the given tag, or an error if it is missing
+// or shorter than length
+func (f *sfnt) table(tag string, length int) ([]byte, error) {
+	table, ok := f.tables[tag]
+	if !ok {
+		return nil, fmt.Errorf("font table %q is missing", tag)
+	}
+	if len(table) < length {
+		return nil, fmt.Errorf("font table %q is truncated", tag)
+	}
+	return table, nil
+}
+
+// checksum returns the checksum of a font table
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// writeSFNT returns a font file made of tables, updating the checksum
+// adjustment of the head table
+func writeSFNT(version uint32, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	// Binary search parameters of the table directory
+	selector := 0
+	for 1<<(selector+1) <= len(tags) {
+		selector++
+	}
+	searchRange := 16 << selector
+
+	header := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(header, version)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(tags)))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:], uint16(selector))
+	binary.BigEndian.PutUint16(header[10:], uint16(16*len(tags)-searchRange))
+
+	output := header
+	headOffset := -1
+	for i, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			// The adjustment is computed once all the tables are written
+			table = append([]byte(nil), table...)
+			binary.BigEndian.PutUint32(table[8:], 0)
+			headOffset = len(output)
+		}
+		record := output[12+16*i:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(table))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(output)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+		output = append(output, table...)
+		for len(output)%4 != 0 {
+			output = append(output, 0)
+		}
+	}
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(output[headOffset+8:], 0xB1B0AFBA-checksum(output))
+	}
+	return output
+}
+
+// parseCmap returns the glyph IDs of the characters mapped by the best
+// Unicode subtable of a cmap table
+func parseCmap(table []byte) (map[rune]uint16, error) {
+	if len(table) < 4 {
+		return nil, fmt.Errorf("font table \"cmap\" is truncated")
+	}
+
+	// Rank the subtables, full Unicode coverage first
+	best, bestRank, symbol := -1, 0, false
+	count := int(binary.BigEndian.Uint16(table[2:]))
+	for i := 0; i < count && 4+8*i+8 <= len(table); i++ {
+		record := table[4+8*i:]
+		platform := binary.BigEndian.Uint16(record)
+		encoding := binary.BigEndian.Uint16(record[2:])
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		if offset+2 > len(table) {
+			continue
+		}
+		format := binary.BigEndian.Uint16(table[offset:])
+		rank := 0
+		switch {
+		case format == 12 && (platform == 3 && encoding == 10 || platform == 0):
+			rank = 4
+		case format == 4 && (platform == 3 && encoding == 1 || platform == 0):
+			rank = 3
+		case format == 4 && platform == 3 && encoding == 0:
+			rank = 2
+		}
+		if rank > bestRank {
+			best, bestRank, symbol = offset, rank, platform == 3 && encoding == 0
+		}
+	}
+	if best < 0 {
+		return nil, fmt.Errorf("font has no Unicode character map")
+	}
+
+	subtable := table[best:]
+	runes := make(map[rune]uint16)
+	if bestRank == 4 {
+		if len(subtable) < 16 {
+			return nil, fmt.Errorf("character map is truncated")
+		}
+		groups := int(binary.BigEndian.Uint32(subtable[12:]))
+		if len(subtable) < 16+12*groups {
+			return nil, fmt.Errorf("character map is truncated")
+		}
+		for i := 0; i < groups; i++ {
+			group := subtable[16+12*i:]
+			start := binary.BigEndian.Uint32(group)
+			end := binary.BigEndian.Uint32(group[4:])
+			glyph := binary.BigEndian.Uint32(group[8:])
+			if end < start || end > 0x10FFFF {
+				return nil, fmt.Errorf("invalid character map group")
+			}
+			for r := start; r <= end; r++ {
+				if glyph+r-start != 0 {
+					runes[rune(r)] = uint16(glyph + r - start)
+				}
+			}
+		}
+		return runes, nil
+	}
+
+	if len(subtable) < 14 {
+		return nil, fmt.Errorf("character map is truncated")
+	}
+	segments := int(binary.BigEndian.Uint16(subtable[6:])) / 2
+	if len(subtable) < 16+8*segments {
+		return nil, fmt.Errorf("character map is truncated")
+	}
+	ends := subtable[14:]
+	starts := subtable[16+2*segments:]
+	deltas := subtable[16+4*segments:]
+	rangeOffsets := subtable[16+6*segments:]
+	for i := 0; i < segments; i++ {
+		start := binary.BigEndian.Uint16(starts[2*i:])
+		end := binary.BigEndian.Uint16(ends[2*i:])
+		delta := binary.BigEndian.Uint16(deltas[2*i:])
+		rangeOffset := int(binary.BigEndian.Uint16(rangeOffsets[2*i:]))
+		for c := int(start); c <= int(end) && c != 0xFFFF; c++ {
+			glyph := uint16(c) + delta
+			if rangeOffset != 0 {
+				// The offset is relative to the position of the range offset itself
+				position := 16 + 6*segments + 2*i + rangeOffset + 2*(c-int(start))
+				if position+2 > len(subtable) {
+					return nil, fmt.Errorf("character map is truncated")
+				}
+				if glyph = binary.BigEndian.Uint16(subtable[position:]); glyph != 0 {
+					glyph += delta
+				}
+			}
+			if glyph == 0 {
+				continue
+			}
+			runes[rune(c)] = glyph
+			if symbol && c >= 0xF000 && c <= 0xF0FF {
+				// Symbol fonts map their characters to the private use area
+				if _, ok := runes[rune(c-0xF000)]; !ok {
+					runes[rune(c-0xF000)] = glyph
+				}
+			}
+		}
+	}
+	return runes, nil
+}
+
+// symbolCmap returns a cmap table with a single symbol subtable mapping the
+// codes of a simple font, offset by 0xF000, to glyph IDs
+func symbolCmap(glyphs map[byte]uint16) []byte {
+	codes := make([]int, 0, len(glyphs))
+	for code := range glyphs {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	// One segment by code, followed by the required final segment
+	segments := len(codes) + 1
+	subtable := make([]byte, 16+8*segments)
+	binary.BigEndian.PutUint16(subtable, 4)
+	binary.BigEndian.PutUint16(subtable[2:], uint16(len(subtable)))
+	binary.BigEndian.PutUint16(subtable[6:], uint16(2*segments))
+	selector := 0
+	for 1<<(selector+1) <= segments {
+		selector++
+	}
+	binary.BigEndian.PutUint16(subtable[8:], uint16(2<<selector))
+	binary.BigEndian.PutUint16(subtable[10:], uint16(selector))
+	binary.BigEndian.PutUint16(subtable[12:], uint16(2*segments-2<<selector))
+	ends := subtable[14:]
+	starts := subtable[16+2*segments:]
+	deltas := subtable[16+4*segments:]
+	for i, code := range append(codes, 0xFFFF-0xF000) {
+		c := uint16(0xF000 + code)
+		delta := uint16(1)
+		if i < len(codes) {
+			delta = glyphs[byte(code)] - c
+		}
+		binary.BigEndian.PutUint16(ends[2*i:], c)
+		binary.BigEndian.PutUint16(starts[2*i:], c)
+		binary.BigEndian.PutUint16(deltas[2*i:], delta)
+	}
+
+	header := []byte{0, 0, 0, 1, 0, 3, 0, 0, 0, 0, 0, 12}
+	return append(header, subtable...)
+}
+
+// parseName returns the PostScript name of a font from its name table,
+// without the characters forbidden in PDF names
+func parseName(table []byte) string {
+	if len(table) < 6 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint16(table[2:]))
+	storage := int(binary.BigEndian.Uint16(table[4:]))
+	for i := 0; i < count && 6+12*i+12 <= len(table); i++ {
+		record := table[6+12*i:]
+		platform := binary.BigEndian.Uint16(record)
+		id := binary.BigEndian.Uint16(record[6:])
+		length := int(binary.BigEndian.Uint16(record[8:]))
+		offset := storage + int(binary.BigEndian.Uint16(record[10:]))
+		if id != 6 || offset+length > len(table) || platform != 1 && platform != 3 {
+			continue
+		}
+		raw := table[offset : offset+length]
+		name := string(raw)
+		if platform == 3 {
+			units := make([]uint16, len(raw)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(raw[2*j:])
+			}
+			name = string(utf16.Decode(units))
+		}
+		var sanitized []rune
+		for _, r := range name {
+			if r > 32 && r < 127 && !isDelimiter(r) {
+				sanitized = append(sanitized, r)
+			}
+		}
+		if len(sanitized) > 0 {
+			return string(sanitized)
+		}
+	}
+	return ""
+}
+
+// isDelimiter returns whether r is a PDF delimiter character
+func isDelimiter(r rune) bool {
+	switch r {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%', '#':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package font
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"unicode"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// Glyph is a glyph of text shaped by TrueType.Shape
+type Glyph struct {
+	// Glyph ID in the font file
+	ID uint16
+	// Characters shown by the glyph, several for ligatures, none for glyphs
+	// added by substitutions or shown with the previous glyphs
+	Text string
+	// Horizontal advance, in thousandths of the font size
+	Advance float64
+	// Offsets of the glyph from the pen position, in thousandths of the
+	// font size
+	XOffset, YOffset float64
+}
+
+// Features applied to all runs of text, and to runs of Arabic text
+var (
+	substitutionFeatures = map[string]bool{"ccmp": true, "locl": true, "rlig": true, "liga": true, "clig": true, "calt": true}
+	positioningFeatures  = map[string]bool{"kern": true, "mark": true, "mkmk": true}
+	arabicForms          = map[string]bool{"isol": true, "init": true, "medi": true, "fina": true}
+)
+
+// Shape returns the glyphs showing a line of text, in visual order.
+// Characters are reordered with the Unicode bidirectional algorithm, then
+// each run of characters with the same direction gets the substitutions and
+// the positioning of the GSUB and GPOS tables of the font: ligatures,
+// contextual and Arabic forms, kerning and mark positioning.
+func (f *TrueType) Shape(text string) []Glyph {
+	runes := []rune(text)
+	levels := bidiLevels(runes)
+
+	// Runs are shaped separately, then ordered as their characters
+	var runs [][]Glyph
+	var runLevels []int
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && levels[end] == levels[start] {
+			end++
+		}
+		runs = append(runs, f.shapeRun(runes[start:end], levels[start]%2 == 1))
+		runLevels = append(runLevels, levels[start])
+		start = end
+	}
+	var glyphs []Glyph
+	for _, run := range bidiOrder(runLevels) {
+		glyphs = append(glyphs, runs[run]...)
+	}
+	return glyphs
+}
+
+// shapeRun returns the glyphs showing a run of characters with the same
+// direction, in visual order
+func (f *TrueType) shapeRun(runes []rune, rtl bool) []Glyph {
+	s := &shaper{font: f, gdef: f.font.tables["GDEF"]}
+	for _, r := range runes {
+		if mirror, ok := bidiMirrors[r]; ok && rtl {
+			r = mirror
+		}
+		s.glyphs = append(s.glyphs, s.newGlyph(f.cmap[r], string(r)))
+	}
+	script := runScript(runes)
+	if script == "arab" {
+		for i, form := range arabicJoining(runes) {
+			s.glyphs[i].form = form
+		}
+	}
+
+	substitutions := substitutionFeatures
+	if script == "arab" {
+		substitutions = make(map[string]bool)
+		for _, features := range []map[string]bool{substitutionFeatures, arabicForms} {
+			for tag := range features {
+				substitutions[tag] = true
+			}
+		}
+	}
+	if s.table = f.font.tables["GSUB"]; s.table != nil {
+		s.gsub = true
+		s.apply(layoutLookups(s.table, script, substitutions))
+	}
+	for i := range s.glyphs {
+		s.glyphs[i].advance = int(f.advances[s.glyphs[i].id])
+	}
+	if s.table = f.font.tables["GPOS"]; s.table != nil {
+		s.gsub = false
+		s.apply(layoutLookups(s.table, script, positioningFeatures))
+	}
+
+	// Attached marks don't advance
+	order := make([]int, len(s.glyphs))
+	for i := range s.glyphs {
+		if s.glyphs[i].base >= 0 {
+			s.glyphs[i].advance = 0
+		}
+		order[i] = i
+		if rtl {
+			order[i] = len(s.glyphs) - 1 - i
+		}
+	}
+	pens := make([]int, len(s.glyphs))
+	pen := 0
+	for _, i := range order {
+		pens[i] = pen
+		pen += s.glyphs[i].advance
+	}
+
+	glyphs := make([]Glyph, len(s.glyphs))
+	scale := func(value int) float64 { return float64(value) * 1000 / float64(f.unitsPerEm) }
+	for k, i := range order {
+		glyph := s.glyphs[i]
+		if base := glyph.base; base >= 0 {
+			glyph.xOffset = pens[base] + s.glyphs[base].xOffset + glyph.anchorX - pens[i]
+			glyph.yOffset = s.glyphs[base].yOffset + glyph.anchorY
+		}
+		glyphs[k] = Glyph{glyph.id, glyph.text, scale(glyph.advance), scale(glyph.xOffset), scale(glyph.yOffset)}
+	}
+	return glyphs
+}
+
+// runScript returns the OpenType tag of the script of a run of characters,
+// given by its first character of a supported script
+func runScript(runes []rune) string {
+	for _, r := range runes {
+		switch {
+		case unicode.Is(unicode.Arabic, r):
+			return "arab"
+		case unicode.Is(unicode.Hebrew, r):
+			return "hebr"
+		case unicode.Is(unicode.Latin, r):
+			return "latn"
+		}
+	}
+	return "DFLT"
+}
+
+// Arabic joining types
+const (
+	nonJoining = iota
+	rightJoining
+	dualJoining
+	transparent
+)
+
+// arabicRightJoining lists the Arabic letters only joining the previous
+// letter
+var arabicRightJoining = map[rune]bool{
+	0x0622: true, 0x0623: true, 0x0624: true, 0x0625: true, 0x0627: true, 0x0629: true,
+	0x062F: true, 0x0630: true, 0x0631: true, 0x0632: true, 0x0648: true, 0x0671: true,
+	0x0672: true, 0x0673: true, 0x0675: true, 0x0676: true, 0x0677: true, 0x06C0: true,
+	0x06C3: true, 0x06C4: true, 0x06C5: true, 0x06C6: true, 0x06C7: true, 0x06C8: true,
+	0x06C9: true, 0x06CA: true, 0x06CB: true, 0x06CD: true, 0x06CF: true, 0x06D2: true,
+	0x06D3: true, 0x06D5: true, 0x06EE: true, 0x06EF: true,
+}
+
+// joiningType returns the Arabic joining type of r
+func joiningType(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return transparent
+	case arabicRightJoining[r], r >= 0x0688 && r <= 0x0699:
+		return rightJoining
+	case r >= 0x0620 && r <= 0x064A && r != 0x0621, r == 0x066E, r == 0x066F,
+		r >= 0x0678 && r <= 0x06D3, r >= 0x06FA && r <= 0x06FF, r >= 0x0750 && r <= 0x077F:
+		return dualJoining
+	}
+	return nonJoining
+}
+
+// arabicJoining returns the forms of Arabic characters, given by the
+// joining types of their neighbours, transparent characters being skipped.
+// Characters that don't join have no form.
+func arabicJoining(runes []rune) []string {
+	forms := make([]string, len(runes))
+	previous := -1 // Index of the previous character that isn't transparent
+	for i, r := range runes {
+		kind := joiningType(r)
+		if kind == transparent {
+			continue
+		}
+		if kind != nonJoining {
+			forms[i] = "isol"
+		}
+		if previous >= 0 && joiningType(runes[previous]) == dualJoining && kind != nonJoining {
+			// Join the previous character
+			switch forms[previous] {
+			case "isol":
+				forms[previous] = "init"
+			case "fina":
+				forms[previous] = "medi"
+			}
+			forms[i] = "fina"
+		}
+		previous = i
+	}
+	return forms
+}
+
+// MeasureShapedString returns the width of text shaped by Shape and shown
+// with the font at the given size
+func (f *TrueType) MeasureShapedString(size float64, text string) float64 {
+	width := 0.0
+	for _, glyph := range f.Shape(text) {
+		width += glyph.Advance
+	}
+	return width * size / 1000
+}
+
+// ShowShapedText shows text shaped by Shape on stream, the current font
+// being f at the given size. Glyphs are shown by Stream.ShowText,
+// positioned with TJ adjustments, and their vertical offsets are given by
+// the text rise, reset to 0 afterwards.
+// The text position is moved at the end of the shaped text.
+func (f *TrueType) ShowShapedText(stream *godyf.Stream, size float64, text string) {
+	var array, codes bytes.Buffer
+	// adjust moves the next glyph by offset, in thousandths of the font size
+	adjust := func(offset float64) {
+		if math.Abs(offset) < 0.0005 {
+			return
+		}
+		if codes.Len() > 0 {
+			fmt.Fprintf(&array, "<%x> ", codes.Bytes())
+			codes.Reset()
+		}
+		array.Write(godyf.ToBytes(math.Round(-offset*1000) / 1000))
+		array.WriteByte(' ')
+	}
+	flush := func() {
+		if codes.Len() > 0 {
+			fmt.Fprintf(&array, "<%x>", codes.Bytes())
+			codes.Reset()
+		}
+		if content := bytes.TrimSpace(array.Bytes()); len(content) > 0 {
+			stream.ShowText(string(content))
+		}
+		array.Reset()
+	}
+
+	// Positions of the pen and of the text position, from the start
+	rise, pen, position := 0.0, 0.0, 0.0
+	for _, glyph := range f.Shape(text) {
+		if glyph.YOffset != rise {
+			flush()
+			rise = glyph.YOffset
+			stream.SetTextRise(rise * size / 1000)
+		}
+		adjust(pen + glyph.XOffset - position)
+		codes.Write(f.encodeGlyph(glyph.ID, glyph.Text))
+		position = pen + glyph.XOffset + float64(f.width(glyph.ID))
+		pen += glyph.Advance
+	}
+	adjust(pen - position)
+	flush()
+	if rise != 0 {
+		stream.SetTextRise(0)
+	}
+}
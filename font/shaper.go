@@ -0,0 +1,594 @@
+package font
+
+import (
+	"unicode"
+)
+
+// glyphInfo is a glyph of a run of text being shaped
+type glyphInfo struct {
+	id      uint16 // Glyph ID
+	text    string // Characters shown by the glyph, for the ToUnicode CMap
+	class   int    // GDEF glyph class: 1 for base glyphs, 2 for ligatures and 3 for marks
+	form    string // Arabic form feature applying to the glyph
+	advance int    // Horizontal advance, in font units
+	xOffset int    // Horizontal placement, in font units
+	yOffset int    // Vertical placement, in font units
+	base    int    // Index of the glyph a mark is attached to, -1 if not attached
+	anchorX int    // Horizontal position of an attached mark from its base, in font units
+	anchorY int    // Vertical position of an attached mark from its base, in font units
+}
+
+// shaper applies the GSUB and GPOS lookups of a font to a run of glyphs
+type shaper struct {
+	font   *TrueType
+	gdef   []byte
+	table  []byte // GSUB or GPOS table whose lookups are applied
+	gsub   bool   // Whether table is a GSUB table
+	glyphs []glyphInfo
+	depth  int // Nesting depth of contextual lookups
+}
+
+// Lookup flags
+const (
+	ignoreBaseGlyphs = 0x0002
+	ignoreLigatures  = 0x0004
+	ignoreMarks      = 0x0008
+)
+
+// newGlyph returns the glyph information of glyph showing text
+func (s *shaper) newGlyph(glyph uint16, text string) glyphInfo {
+	info := glyphInfo{id: glyph, text: text, class: 1, base: -1}
+	if classDef := int(u16(s.gdef, 4)); classDef != 0 {
+		if class := glyphClass(s.gdef, classDef, glyph); class != 0 {
+			info.class = class
+		}
+	} else if text != "" {
+		// No GDEF table, nonspacing marks are guessed from their characters
+		for _, r := range text {
+			if unicode.In(r, unicode.Mn, unicode.Me) {
+				info.class = 3
+			}
+			break
+		}
+	}
+	return info
+}
+
+// ignored returns whether glyph is skipped by lookups with flag
+func (s *shaper) ignored(glyph glyphInfo, flag uint16) bool {
+	switch glyph.class {
+	case 1:
+		return flag&ignoreBaseGlyphs != 0
+	case 2:
+		return flag&ignoreLigatures != 0
+	case 3:
+		if flag&ignoreMarks != 0 {
+			return true
+		}
+		if kind := int(flag >> 8); kind != 0 {
+			classDef := int(u16(s.gdef, 10))
+			return classDef == 0 || glyphClass(s.gdef, classDef, glyph.id) != kind
+		}
+	}
+	return false
+}
+
+// next returns the index of the glyph following i not ignored by flag, -1
+// if there's none
+func (s *shaper) next(i int, flag uint16) int {
+	for i++; i < len(s.glyphs); i++ {
+		if !s.ignored(s.glyphs[i], flag) {
+			return i
+		}
+	}
+	return -1
+}
+
+// previous returns the index of the glyph preceding i not ignored by flag,
+// -1 if there's none
+func (s *shaper) previous(i int, flag uint16) int {
+	for i--; i >= 0; i-- {
+		if !s.ignored(s.glyphs[i], flag) {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply applies the lookups to all the glyphs of the run, glyphs being
+// matched with their Arabic form for lookups enabled only by form features
+func (s *shaper) apply(lookups []layoutLookup) {
+	extension := 9
+	if s.gsub {
+		extension = 7
+	}
+	for _, lookup := range lookups {
+		kind, flag, subtables := lookupSubtables(s.table, lookup.index, extension)
+		global := false
+		for tag := range lookup.features {
+			if !arabicForms[tag] {
+				global = true
+			}
+		}
+		for i := 0; i < len(s.glyphs); i++ {
+			glyph := s.glyphs[i]
+			if (!global && !lookup.features[glyph.form]) || s.ignored(glyph, flag) {
+				continue
+			}
+			for _, subtable := range subtables {
+				if s.applySubtable(kind, flag, subtable, i) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// applyNested applies the lookup at index to the glyph at i, for
+// contextual lookups
+func (s *shaper) applyNested(index, i int) {
+	extension := 9
+	if s.gsub {
+		extension = 7
+	}
+	kind, flag, subtables := lookupSubtables(s.table, index, extension)
+	if i >= len(s.glyphs) || s.ignored(s.glyphs[i], flag) {
+		return
+	}
+	for _, subtable := range subtables {
+		if s.applySubtable(kind, flag, subtable, i) {
+			break
+		}
+	}
+}
+
+// applySubtable applies a lookup subtable to the glyph at i, returning
+// whether it applied
+func (s *shaper) applySubtable(kind int, flag uint16, subtable, i int) bool {
+	if s.gsub {
+		switch kind {
+		case 1:
+			return s.singleSubstitution(subtable, i)
+		case 2:
+			return s.multipleSubstitution(subtable, i)
+		case 4:
+			return s.ligatureSubstitution(flag, subtable, i)
+		case 5:
+			return s.context(flag, subtable, i, false)
+		case 6:
+			return s.context(flag, subtable, i, true)
+		}
+		return false
+	}
+	switch kind {
+	case 1:
+		return s.singlePositioning(subtable, i)
+	case 2:
+		return s.pairPositioning(flag, subtable, i)
+	case 4, 5, 6:
+		return s.markPositioning(kind, flag, subtable, i)
+	case 7:
+		return s.context(flag, subtable, i, false)
+	case 8:
+		return s.context(flag, subtable, i, true)
+	}
+	return false
+}
+
+// matchSequence returns the indices of the glyphs from i matching count
+// values with match, skipping the glyphs ignored by flag, going backwards
+// if backwards is set
+func (s *shaper) matchSequence(i, count int, flag uint16, backwards bool, match func(k int, glyph uint16) bool) ([]int, bool) {
+	indices := make([]int, 0, count)
+	for k := 0; k < count; k++ {
+		if backwards {
+			i = s.previous(i, flag)
+		} else {
+			i = s.next(i, flag)
+		}
+		if i < 0 || !match(k, s.glyphs[i].id) {
+			return nil, false
+		}
+		indices = append(indices, i)
+	}
+	return indices, true
+}
+
+// context applies a contextual or chained contextual subtable, of GSUB or
+// GPOS, to the glyph at i
+func (s *shaper) context(flag uint16, subtable, i int, chained bool) bool {
+	if s.depth > 8 {
+		return false
+	}
+	data := s.table
+	glyph := s.glyphs[i].id
+	format := u16(data, subtable)
+
+	// Rules are read as sequences of backtrack, input and lookahead values
+	// (glyph IDs, classes or coverage offsets) matched by functions
+	type rule struct {
+		backtrack, input, lookahead []int
+		records                     int // Offset of the lookup records
+		recordCount                 int
+	}
+	values := func(offset, count int) []int {
+		list := make([]int, max(count, 0))
+		for k := range list {
+			list[k] = int(u16(data, offset+2*k))
+		}
+		return list
+	}
+	// readRule reads a rule at offset, whose input doesn't include the first
+	// glyph unless first is set
+	readRule := func(offset int, first bool) rule {
+		var r rule
+		if chained {
+			r.backtrack = values(offset+2, int(u16(data, offset)))
+			offset += 2 + 2*len(r.backtrack)
+		}
+		count := int(u16(data, offset))
+		if !chained {
+			r.recordCount = int(u16(data, offset+2))
+			offset += 2
+		}
+		if first {
+			r.input = values(offset+2, count)
+		} else {
+			r.input = values(offset+2, count-1)
+		}
+		offset += 2 + 2*len(r.input)
+		if chained {
+			r.lookahead = values(offset+2, int(u16(data, offset)))
+			offset += 2 + 2*len(r.lookahead)
+			r.recordCount = int(u16(data, offset))
+			offset += 2
+		}
+		r.records = offset
+		return r
+	}
+
+	var rules []rule
+	var backtrackMatch, inputMatch, lookaheadMatch func(value int, glyph uint16) bool
+	first := 1 // Number of input glyphs matched before the rules
+	switch format {
+	case 1, 2:
+		index := coverageIndex(data, subtable+int(u16(data, subtable+2)), glyph)
+		if index < 0 {
+			return false
+		}
+		sets := subtable + 4
+		if format == 1 {
+			equal := func(value int, glyph uint16) bool { return uint16(value) == glyph }
+			backtrackMatch, inputMatch, lookaheadMatch = equal, equal, equal
+		} else {
+			classMatch := func(classDef int) func(int, uint16) bool {
+				return func(value int, glyph uint16) bool { return glyphClass(data, classDef, glyph) == value }
+			}
+			if chained {
+				backtrackMatch = classMatch(subtable + int(u16(data, subtable+4)))
+				inputMatch = classMatch(subtable + int(u16(data, subtable+6)))
+				lookaheadMatch = classMatch(subtable + int(u16(data, subtable+8)))
+				index = glyphClass(data, subtable+int(u16(data, subtable+6)), glyph)
+				sets = subtable + 10
+			} else {
+				inputMatch = classMatch(subtable + int(u16(data, subtable+4)))
+				index = glyphClass(data, subtable+int(u16(data, subtable+4)), glyph)
+				sets = subtable + 6
+			}
+		}
+		if index >= int(u16(data, sets)) {
+			return false
+		}
+		set := int(u16(data, sets+2+2*index))
+		if set == 0 {
+			return false
+		}
+		set += subtable
+		for k := 0; k < int(u16(data, set)); k++ {
+			rules = append(rules, readRule(set+int(u16(data, set+2+2*k)), false))
+		}
+	case 3:
+		covered := func(value int, glyph uint16) bool { return coverageIndex(data, subtable+value, glyph) >= 0 }
+		backtrackMatch, inputMatch, lookaheadMatch = covered, covered, covered
+		if chained {
+			rules = []rule{readRule(subtable+2, true)}
+		} else {
+			// Format 3 contexts have their counts first
+			count := int(u16(data, subtable+2))
+			r := rule{input: values(subtable+6, count), recordCount: int(u16(data, subtable+4))}
+			r.records = subtable + 6 + 2*count
+			rules = []rule{r}
+		}
+		first = 0
+	default:
+		return false
+	}
+
+	for _, r := range rules {
+		input := []int{i}
+		if first == 0 {
+			if len(r.input) == 0 || !inputMatch(r.input[0], glyph) {
+				continue
+			}
+			r.input = r.input[1:]
+		}
+		rest, ok := s.matchSequence(i, len(r.input), flag, false, func(k int, glyph uint16) bool { return inputMatch(r.input[k], glyph) })
+		if !ok {
+			continue
+		}
+		input = append(input, rest...)
+		if _, ok := s.matchSequence(i, len(r.backtrack), flag, true, func(k int, glyph uint16) bool { return backtrackMatch(r.backtrack[k], glyph) }); !ok {
+			continue
+		}
+		if _, ok := s.matchSequence(input[len(input)-1], len(r.lookahead), flag, false, func(k int, glyph uint16) bool { return lookaheadMatch(r.lookahead[k], glyph) }); !ok {
+			continue
+		}
+
+		// Nested lookups, positions being updated when the number of glyphs
+		// changes
+		s.depth++
+		for k := 0; k < r.recordCount; k++ {
+			sequence := int(u16(data, r.records+4*k))
+			if sequence >= len(input) {
+				continue
+			}
+			length := len(s.glyphs)
+			s.applyNested(int(u16(data, r.records+4*k+2)), input[sequence])
+			if delta := len(s.glyphs) - length; delta != 0 {
+				for l := range input {
+					if input[l] > input[sequence] {
+						input[l] += delta
+					}
+				}
+			}
+		}
+		s.depth--
+		return true
+	}
+	return false
+}
+
+// singleSubstitution applies a single substitution subtable
+func (s *shaper) singleSubstitution(subtable, i int) bool {
+	glyph := &s.glyphs[i]
+	index := coverageIndex(s.table, subtable+int(u16(s.table, subtable+2)), glyph.id)
+	if index < 0 {
+		return false
+	}
+	switch u16(s.table, subtable) {
+	case 1:
+		glyph.id += u16(s.table, subtable+4)
+	case 2:
+		if index >= int(u16(s.table, subtable+4)) {
+			return false
+		}
+		glyph.id = u16(s.table, subtable+6+2*index)
+	default:
+		return false
+	}
+	*glyph = s.substitute(*glyph, glyph.id)
+	return true
+}
+
+// substitute returns glyph replaced by id, keeping its text and its form
+func (s *shaper) substitute(glyph glyphInfo, id uint16) glyphInfo {
+	info := s.newGlyph(id, glyph.text)
+	if u16(s.gdef, 4) == 0 {
+		info.class = glyph.class
+	}
+	info.form = glyph.form
+	return info
+}
+
+// multipleSubstitution applies a multiple substitution subtable, the first
+// glyph of the sequence keeping the text of the replaced glyph
+func (s *shaper) multipleSubstitution(subtable, i int) bool {
+	glyph := s.glyphs[i]
+	index := coverageIndex(s.table, subtable+int(u16(s.table, subtable+2)), glyph.id)
+	if index < 0 || index >= int(u16(s.table, subtable+4)) {
+		return false
+	}
+	sequence := subtable + int(u16(s.table, subtable+6+2*index))
+	count := int(u16(s.table, sequence))
+	if count == 0 {
+		return false
+	}
+	replacement := make([]glyphInfo, count)
+	for k := range replacement {
+		replacement[k] = s.substitute(glyph, u16(s.table, sequence+2+2*k))
+		if k > 0 {
+			replacement[k].text = ""
+		}
+	}
+	s.glyphs = append(s.glyphs[:i], append(replacement, s.glyphs[i+1:]...)...)
+	return true
+}
+
+// ligatureSubstitution applies a ligature substitution subtable, the
+// ligature showing the text of its components
+func (s *shaper) ligatureSubstitution(flag uint16, subtable, i int) bool {
+	glyph := s.glyphs[i]
+	index := coverageIndex(s.table, subtable+int(u16(s.table, subtable+2)), glyph.id)
+	if index < 0 || index >= int(u16(s.table, subtable+4)) {
+		return false
+	}
+	set := subtable + int(u16(s.table, subtable+6+2*index))
+	for k := 0; k < int(u16(s.table, set)); k++ {
+		ligature := set + int(u16(s.table, set+2+2*k))
+		count := int(u16(s.table, ligature+2)) - 1
+		components, ok := s.matchSequence(i, count, flag, false, func(l int, glyph uint16) bool {
+			return u16(s.table, ligature+4+2*l) == glyph
+		})
+		if !ok {
+			continue
+		}
+		text := glyph.text
+		for _, component := range components {
+			text += s.glyphs[component].text
+		}
+		s.glyphs[i] = s.substitute(glyph, u16(s.table, ligature))
+		s.glyphs[i].text = text
+		if u16(s.gdef, 4) == 0 {
+			s.glyphs[i].class = 2
+		}
+		for l := len(components) - 1; l >= 0; l-- {
+			s.glyphs = append(s.glyphs[:components[l]], s.glyphs[components[l]+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+// valueRecord applies the value record with format at offset to glyph
+func (s *shaper) valueRecord(glyph *glyphInfo, format uint16, offset int) {
+	for bit := uint16(1); bit <= 8; bit <<= 1 {
+		if format&bit == 0 {
+			continue
+		}
+		value := int(int16(u16(s.table, offset)))
+		switch bit {
+		case 1:
+			glyph.xOffset += value
+		case 2:
+			glyph.yOffset += value
+		case 4:
+			glyph.advance += value
+		}
+		offset += 2
+	}
+}
+
+// valueSize returns the size of value records with format
+func valueSize(format uint16) int {
+	size := 0
+	for ; format != 0; format >>= 1 {
+		size += 2 * int(format&1)
+	}
+	return size
+}
+
+// singlePositioning applies a single adjustment positioning subtable
+func (s *shaper) singlePositioning(subtable, i int) bool {
+	index := coverageIndex(s.table, subtable+int(u16(s.table, subtable+2)), s.glyphs[i].id)
+	if index < 0 {
+		return false
+	}
+	format := u16(s.table, subtable+4)
+	switch u16(s.table, subtable) {
+	case 1:
+		s.valueRecord(&s.glyphs[i], format, subtable+6)
+	case 2:
+		if index >= int(u16(s.table, subtable+6)) {
+			return false
+		}
+		s.valueRecord(&s.glyphs[i], format, subtable+8+index*valueSize(format))
+	default:
+		return false
+	}
+	return true
+}
+
+// pairPositioning applies a pair adjustment positioning subtable to the
+// glyph at i and the following one
+func (s *shaper) pairPositioning(flag uint16, subtable, i int) bool {
+	index := coverageIndex(s.table, subtable+int(u16(s.table, subtable+2)), s.glyphs[i].id)
+	j := s.next(i, flag)
+	if index < 0 || j < 0 {
+		return false
+	}
+	format1, format2 := u16(s.table, subtable+4), u16(s.table, subtable+6)
+	size1, size2 := valueSize(format1), valueSize(format2)
+	second := s.glyphs[j].id
+	record := 0
+	switch u16(s.table, subtable) {
+	case 1:
+		if index >= int(u16(s.table, subtable+8)) {
+			return false
+		}
+		set := subtable + int(u16(s.table, subtable+10+2*index))
+		for k := 0; k < int(u16(s.table, set)); k++ {
+			offset := set + 2 + k*(2+size1+size2)
+			if u16(s.table, offset) == second {
+				record = offset + 2
+				break
+			}
+		}
+	case 2:
+		class1 := glyphClass(s.table, subtable+int(u16(s.table, subtable+8)), s.glyphs[i].id)
+		class2 := glyphClass(s.table, subtable+int(u16(s.table, subtable+10)), second)
+		count1, count2 := int(u16(s.table, subtable+12)), int(u16(s.table, subtable+14))
+		if class1 < count1 && class2 < count2 {
+			record = subtable + 16 + (class1*count2+class2)*(size1+size2)
+		}
+	}
+	if record == 0 {
+		return false
+	}
+	s.valueRecord(&s.glyphs[i], format1, record)
+	s.valueRecord(&s.glyphs[j], format2, record+size1)
+	return true
+}
+
+// anchor returns the coordinates of the anchor at offset
+func (s *shaper) anchor(offset int) (int, int) {
+	return int(int16(u16(s.table, offset+2))), int(int16(u16(s.table, offset+4)))
+}
+
+// markPositioning applies a mark-to-base, mark-to-ligature or mark-to-mark
+// attachment positioning subtable to the mark at i. Marks are attached to
+// the last component of ligatures.
+func (s *shaper) markPositioning(kind int, flag uint16, subtable, i int) bool {
+	mark := coverageIndex(s.table, subtable+int(u16(s.table, subtable+2)), s.glyphs[i].id)
+	if mark < 0 {
+		return false
+	}
+
+	// The base is the previous base glyph or ligature, or the previous
+	// glyph for mark-to-mark attachments
+	base := -1
+	if kind == 6 {
+		if base = s.previous(i, flag); base >= 0 && s.glyphs[base].class != 3 {
+			return false
+		}
+	} else {
+		for base = i - 1; base >= 0 && s.glyphs[base].class == 3; base-- {
+		}
+	}
+	if base < 0 {
+		return false
+	}
+	index := coverageIndex(s.table, subtable+int(u16(s.table, subtable+4)), s.glyphs[base].id)
+	classCount := int(u16(s.table, subtable+6))
+	markArray := subtable + int(u16(s.table, subtable+8))
+	baseArray := subtable + int(u16(s.table, subtable+10))
+	if index < 0 || mark >= int(u16(s.table, markArray)) || index >= int(u16(s.table, baseArray)) {
+		return false
+	}
+	class := int(u16(s.table, markArray+2+4*mark))
+	if class >= classCount {
+		return false
+	}
+	markX, markY := s.anchor(markArray + int(u16(s.table, markArray+2+4*mark+2)))
+
+	var anchor int
+	if kind == 5 {
+		attach := baseArray + int(u16(s.table, baseArray+2+2*index))
+		components := int(u16(s.table, attach))
+		if components == 0 {
+			return false
+		}
+		if offset := int(u16(s.table, attach+2+2*((components-1)*classCount+class))); offset != 0 {
+			anchor = attach + offset
+		}
+	} else if offset := int(u16(s.table, baseArray+2+2*(index*classCount+class))); offset != 0 {
+		anchor = baseArray + offset
+	}
+	if anchor == 0 {
+		return false
+	}
+	baseX, baseY := s.anchor(anchor)
+	glyph := &s.glyphs[i]
+	glyph.base = base
+	glyph.anchorX, glyph.anchorY = baseX-markX, baseY-markY
+	return true
+}
@@ -0,0 +1,283 @@
+// Package font provides font metrics and builds the PDF objects needed to
+// draw text with the standard fonts.
+package font
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// Standard is one of the 14 standard Type 1 fonts, that PDF readers can
+// display without embedding them
+type Standard struct {
+	// PostScript name of the font, used as /BaseFont
+	Name string
+	// Bounding box of the glyphs, in thousandths of the font size
+	BBox [4]int
+	// Ascender, descender, capital and lowercase heights, in thousandths
+	// of the font size, 0 for symbolic fonts
+	Ascent, Descent, CapHeight, XHeight int
+	// Italic angle, in degrees counterclockwise from the vertical
+	ItalicAngle float64
+	// Whether the font uses its own glyph set instead of the Latin one
+	Symbolic bool
+
+	widths   map[string]int    // Widths by glyph name
+	kerning  map[[2]string]int // Kerning adjustments by pair of glyph names
+	encoding *Encoding         // Default encoding
+}
+
+// standardMetrics holds the widths and kerning of a standard font, read
+// from its AFM file on first use
+type standardMetrics struct {
+	once    sync.Once
+	widths  map[string]int
+	kerning map[[2]string]int
+	err     error
+}
+
+// get returns the widths and kerning of the standard font name, reading
+// them on first use
+func (m *standardMetrics) get(name string) (map[string]int, map[[2]string]int, error) {
+	m.once.Do(func() {
+		m.widths, m.kerning, m.err = parseAFM(name)
+	})
+	return m.widths, m.kerning, m.err
+}
+
+// standardFonts describes the standard fonts by PostScript name
+var standardFonts = map[string]struct {
+	metrics                             *standardMetrics
+	bbox                                [4]int
+	ascent, descent, capHeight, xHeight int
+	italicAngle                         float64
+}{
+	"Helvetica":             {&standardMetrics{}, [4]int{-166, -225, 1000, 931}, 718, -207, 718, 523, 0},
+	"Helvetica-Bold":        {&standardMetrics{}, [4]int{-170, -228, 1003, 962}, 718, -207, 718, 532, 0},
+	"Helvetica-Oblique":     {&standardMetrics{}, [4]int{-170, -225, 1116, 931}, 718, -207, 718, 523, -12},
+	"Helvetica-BoldOblique": {&standardMetrics{}, [4]int{-174, -228, 1114, 962}, 718, -207, 718, 532, -12},
+	"Times-Roman":           {&standardMetrics{}, [4]int{-168, -218, 1000, 898}, 683, -217, 662, 450, 0},
+	"Times-Bold":            {&standardMetrics{}, [4]int{-168, -218, 1000, 935}, 683, -217, 676, 461, 0},
+	"Times-Italic":          {&standardMetrics{}, [4]int{-169, -217, 1010, 883}, 683, -217, 653, 441, -15.5},
+	"Times-BoldItalic":      {&standardMetrics{}, [4]int{-200, -218, 996, 921}, 683, -217, 669, 462, -15},
+	"Courier":               {&standardMetrics{}, [4]int{-23, -250, 715, 805}, 629, -157, 562, 426, 0},
+	"Courier-Bold":          {&standardMetrics{}, [4]int{-113, -250, 749, 801}, 629, -157, 562, 439, 0},
+	"Courier-Oblique":       {&standardMetrics{}, [4]int{-27, -250, 849, 805}, 629, -157, 562, 426, -12},
+	"Courier-BoldOblique":   {&standardMetrics{}, [4]int{-57, -250, 869, 801}, 629, -157, 562, 439, -12},
+	"Symbol":                {&standardMetrics{}, [4]int{-180, -293, 1090, 1010}, 0, 0, 0, 0, 0},
+	"ZapfDingbats":          {&standardMetrics{}, [4]int{-1, -143, 981, 820}, 0, 0, 0, 0, 0},
+}
+
+// StandardNames returns the PostScript names of the 14 standard fonts
+func StandardNames() []string {
+	return []string{
+		"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique",
+		"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic",
+		"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique",
+		"Symbol", "ZapfDingbats",
+	}
+}
+
+// NewStandard returns the standard font with the given PostScript name,
+// such as "Helvetica-Bold"
+func NewStandard(name string) (*Standard, error) {
+	description, ok := standardFonts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown standard font %q", name)
+	}
+	symbolic := name == "Symbol" || name == "ZapfDingbats"
+	widths, kerning, err := description.metrics.get(name)
+	if err != nil {
+		return nil, err
+	}
+	font := &Standard{
+		Name:        name,
+		BBox:        description.bbox,
+		Ascent:      description.ascent,
+		Descent:     description.descent,
+		CapHeight:   description.capHeight,
+		XHeight:     description.xHeight,
+		ItalicAngle: description.italicAngle,
+		Symbolic:    symbolic,
+		widths:      widths,
+		kerning:     kerning,
+		encoding:    WinAnsiEncoding,
+	}
+	switch name {
+	case "Symbol":
+		font.encoding = symbolEncoding
+	case "ZapfDingbats":
+		font.encoding = dingbatsEncoding
+	}
+	return font, nil
+}
+
+// Encoding returns the default encoding of the font, WinAnsiEncoding for
+// Latin fonts and the built-in encoding for symbolic fonts
+func (f *Standard) Encoding() *Encoding {
+	return f.encoding
+}
+
+// encodingOrDefault returns encoding, or the default encoding if nil
+func (f *Standard) encodingOrDefault(encoding *Encoding) (*Encoding, error) {
+	if encoding == nil {
+		return f.encoding, nil
+	}
+	if f.Symbolic && encoding != f.encoding {
+		return nil, fmt.Errorf("symbolic font %s only supports its built-in encoding", f.Name)
+	}
+	return encoding, nil
+}
+
+// Dictionary returns a /Font dictionary for the font using encoding, nil
+// for the default encoding
+func (f *Standard) Dictionary(encoding *Encoding) (*godyf.Dictionary, error) {
+	encoding, err := f.encodingOrDefault(encoding)
+	if err != nil {
+		return nil, err
+	}
+	dictionary := godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Font"),
+		"Subtype":  godyf.Name("Type1"),
+		"BaseFont": godyf.Name(f.Name),
+	})
+	if encoding.Name != "" {
+		dictionary.Set("Encoding", encoding.Name)
+	}
+	return dictionary, nil
+}
+
+// GlyphWidth returns the width of a glyph in thousandths of the font size,
+// 0 for glyphs missing from the font
+func (f *Standard) GlyphWidth(glyph string) int {
+	return f.widths[glyph]
+}
+
+// Kerning returns the adjustment added to the width of the left glyph when
+// followed by the right glyph, in thousandths of the font size
+func (f *Standard) Kerning(left, right string) int {
+	return f.kerning[[2]string{left, right}]
+}
+
+// KerningPairs returns the kerning adjustments of the font, by pair of
+// glyph names
+func (f *Standard) KerningPairs() map[[2]string]int {
+	pairs := make(map[[2]string]int, len(f.kerning))
+	for pair, adjustment := range f.kerning {
+		pairs[pair] = adjustment
+	}
+	return pairs
+}
+
+// Encode returns the codes of the characters of text in encoding, nil for
+// the default encoding. An error is returned for characters that can't be
+// encoded or whose glyph is missing from the font.
+func (f *Standard) Encode(text string, encoding *Encoding) ([]byte, error) {
+	encoding, err := f.encodingOrDefault(encoding)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]byte, 0, len(text))
+	for _, r := range text {
+		code, ok := encoding.Code(r)
+		if !ok {
+			return nil, fmt.Errorf("character %q can't be encoded in %s", r, f.Name)
+		}
+		if _, ok := f.widths[encoding.Glyph(code)]; !ok {
+			return nil, fmt.Errorf("character %q is missing from %s", r, f.Name)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// EncodeText returns the codes of the characters of text in the default
+// encoding, characters that can't be encoded being skipped, as measured by
+// MeasureString
+func (f *Standard) EncodeText(text string) []byte {
+	codes := make([]byte, 0, len(text))
+	for _, r := range text {
+		if code, ok := f.encoding.Code(r); ok {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// glyphs returns the glyph names of the characters of text in encoding,
+// characters that can't be encoded being skipped
+func (f *Standard) glyphs(text string, encoding *Encoding) []string {
+	glyphs := make([]string, 0, len(text))
+	for _, r := range text {
+		if code, ok := encoding.Code(r); ok {
+			glyphs = append(glyphs, encoding.Glyph(code))
+		}
+	}
+	return glyphs
+}
+
+// MeasureString returns the width of text shown with font at the given
+// size, without kerning, as drawn by Stream.ShowText with godyf.EncodedText
+// or by the codes of Encode with the default encoding. Characters that
+// can't be encoded are ignored. Stream.ShowTextString writes text strings,
+// whose bytes differ from these codes for non-ASCII text and are not
+// measured.
+func MeasureString(font *Standard, size float64, text string) float64 {
+	width, _ := MeasureStringWithEncoding(font, size, text, nil)
+	return width
+}
+
+// MeasureStringWithEncoding returns the width of text shown with font at
+// the given size, without kerning, as drawn by the codes of Encode with
+// encoding, nil for the default encoding. Characters that can't be encoded
+// are ignored. An error is returned for encodings the font doesn't support.
+func MeasureStringWithEncoding(font *Standard, size float64, text string, encoding *Encoding) (float64, error) {
+	encoding, err := font.encodingOrDefault(encoding)
+	if err != nil {
+		return 0, err
+	}
+	width := 0
+	for _, glyph := range font.glyphs(text, encoding) {
+		width += font.widths[glyph]
+	}
+	return float64(width) * size / 1000, nil
+}
+
+// MeasureStringKerned returns the width of text shown with font at the
+// given size, as drawn with the kerning of KernedText
+func MeasureStringKerned(font *Standard, size float64, text string) float64 {
+	glyphs := font.glyphs(text, font.encoding)
+	width := 0
+	for i, glyph := range glyphs {
+		width += font.widths[glyph]
+		if i+1 < len(glyphs) {
+			width += font.Kerning(glyph, glyphs[i+1])
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// KernedText returns the content of a TJ array showing text with kerning
+// in the default encoding, to be given to Stream.ShowText
+func (f *Standard) KernedText(text string) (string, error) {
+	codes, err := f.Encode(text, nil)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	start := 0
+	for i := 0; i+1 < len(codes); i++ {
+		adjustment := f.Kerning(f.encoding.Glyph(codes[i]), f.encoding.Glyph(codes[i+1]))
+		if adjustment == 0 {
+			continue
+		}
+		// Positive TJ numbers move the next glyph to the left
+		parts = append(parts, string(godyf.NewByteString(codes[start:i+1]).Data()), fmt.Sprint(-adjustment))
+		start = i + 1
+	}
+	parts = append(parts, string(godyf.NewByteString(codes[start:]).Data()))
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,40 @@
+package font
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// toUnicodeCMap returns a ToUnicode CMap mapping the character codes of
+// size bytes to their text
+func toUnicodeCMap(text map[int]string, size int) []byte {
+	codes := make([]int, 0, len(text))
+	for code := range text {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	var cmap bytes.Buffer
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	fmt.Fprintf(&cmap, "1 begincodespacerange\n<%0*x> <%0*x>\nendcodespacerange\n", 2*size, 0, 2*size, 1<<(8*size)-1)
+
+	// Mappings are given by blocks of at most 100 codes
+	for start := 0; start < len(codes); start += 100 {
+		block := codes[start:min(start+100, len(codes))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(block))
+		for _, code := range block {
+			var units []byte
+			for _, unit := range utf16.Encode([]rune(text[code])) {
+				units = append(units, byte(unit>>8), byte(unit))
+			}
+			fmt.Fprintf(&cmap, "<%0*x> <%x>\n", 2*size, code, units)
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMapResource defineresource pop\nend\nend")
+	return cmap.Bytes()
+}
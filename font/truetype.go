@@ -0,0 +1,438 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// TrueType is a TrueType or OpenType font read from a font file, embedded
+// in documents as a simple font, or as a composite font when created with
+// NewCompositeTrueType. Only the glyphs of the text encoded with EncodeText
+// or shown with ShowShapedText are embedded: the font is subset each time
+// the document is written. A ToUnicode CMap keeps the text extractable.
+//
+// A simple font shows at most 255 different glyphs, with 1-byte codes.
+// Characters missing from the font, and characters whose glyph doesn't fit
+// anymore, are drawn with the .notdef glyph. Composite fonts use 2-byte
+// codes, the glyph IDs of the font file, and show all its glyphs.
+type TrueType struct {
+	// PostScript name of the font, without the subset tag
+	Name string
+	// Bounding box of the glyphs, in thousandths of the font size
+	BBox [4]int
+	// Ascender, descender and capital height, in thousandths of the font size
+	Ascent, Descent, CapHeight int
+	// Italic angle, in degrees counterclockwise from the vertical
+	ItalicAngle float64
+
+	font       *sfnt
+	cff        *cffFont          // CFF outlines, nil for TrueType outlines
+	unitsPerEm int               // Number of font units in the em square
+	advances   []uint16          // Advance widths by glyph ID, in font units
+	cmap       map[rune]uint16   // Glyph IDs by character
+	flags      int               // Font descriptor flags, without the symbolic flag
+	stemV      int               // Estimated vertical stem width
+	composite  bool              // Whether the font is embedded as a Type0 font
+	codes      map[uint16]byte   // Character codes by glyph ID, for glyphs used by simple fonts
+	glyphs     map[byte]uint16   // Glyph IDs by character code, for glyphs used by simple fonts
+	cids       map[uint16]bool   // Glyph IDs used by composite fonts, also used as CIDs
+	text       map[int]string    // Text of the character codes, for the ToUnicode CMap
+	nextCode   int               // Next character code to assign, 0 when all are used
+	notdef     bool              // Whether text has been encoded with the .notdef glyph
+	dictionary *godyf.Dictionary // /Font dictionary, of Type0 for composite fonts
+	cidFont    *godyf.Dictionary // Descendant CIDFont dictionary of composite fonts
+	descriptor *godyf.Dictionary // /FontDescriptor dictionary
+	file       *godyf.Stream     // Embedded font file
+	cidToGID   *godyf.Stream     // CID to glyph ID map of composite fonts with TrueType outlines
+	toUnicode  *godyf.Stream     // ToUnicode CMap
+}
+
+// NewTrueType returns a simple font read from the data of a TrueType or
+// OpenType font file, with TrueType (glyf) or CFF outlines
+func NewTrueType(data []byte) (*TrueType, error) {
+	f, err := newTrueType(data)
+	if err != nil {
+		return nil, err
+	}
+	if f.cff != nil && f.cff.cid {
+		return nil, fmt.Errorf("CID-keyed CFF font %s can only be embedded as a composite font", f.Name)
+	}
+	f.dictionary = godyf.NewDictionary(map[string]interface{}{"Type": godyf.Name("Font")})
+	return f, nil
+}
+
+// NewCompositeTrueType returns a composite font read from the data of a
+// TrueType or OpenType font file, embedded as a Type0 font with a
+// CIDFontType2 descendant for TrueType outlines and a CIDFontType0
+// descendant for CFF outlines, using the Identity-H encoding
+func NewCompositeTrueType(data []byte) (*TrueType, error) {
+	f, err := newTrueType(data)
+	if err != nil {
+		return nil, err
+	}
+	f.composite = true
+	f.cids = map[uint16]bool{0: true}
+	f.dictionary = godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Font"),
+		"Subtype":  godyf.Name("Type0"),
+		"Encoding": godyf.Name("Identity-H"),
+	})
+	f.cidFont = godyf.NewDictionary(map[string]interface{}{"Type": godyf.Name("Font")})
+	if f.cff == nil {
+		f.cidToGID = godyf.NewStream(nil, nil, true)
+	}
+	return f, nil
+}
+
+// newTrueType returns a font read from the data of a font file, without
+// its font dictionaries
+func newTrueType(data []byte) (*TrueType, error) {
+	font, err := parseSFNT(data)
+	if err != nil {
+		return nil, err
+	}
+	head, err := font.table("head", 54)
+	if err != nil {
+		return nil, err
+	}
+	hhea, err := font.table("hhea", 36)
+	if err != nil {
+		return nil, err
+	}
+	maxp, err := font.table("maxp", 6)
+	if err != nil {
+		return nil, err
+	}
+	cmapTable, err := font.table("cmap", 4)
+	if err != nil {
+		return nil, err
+	}
+	cmap, err := parseCmap(cmapTable)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &TrueType{
+		Name:       parseName(font.tables["name"]),
+		font:       font,
+		unitsPerEm: int(binary.BigEndian.Uint16(head[18:])),
+		cmap:       cmap,
+		codes:      make(map[uint16]byte),
+		glyphs:     make(map[byte]uint16),
+		text:       make(map[int]string),
+		nextCode:   33,
+	}
+	if f.unitsPerEm == 0 {
+		return nil, fmt.Errorf("font has no units per em")
+	}
+	if f.Name == "" {
+		f.Name = "Font"
+	}
+
+	// Glyph advances, the last one being repeated for the remaining glyphs
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	metrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	hmtx, err := font.table("hmtx", 4*metrics)
+	if err != nil {
+		return nil, err
+	}
+	if metrics == 0 || metrics > numGlyphs {
+		return nil, fmt.Errorf("invalid number of horizontal metrics")
+	}
+	f.advances = make([]uint16, numGlyphs)
+	for glyph := range f.advances {
+		f.advances[glyph] = binary.BigEndian.Uint16(hmtx[4*min(glyph, metrics-1):])
+	}
+	for r, glyph := range f.cmap {
+		if int(glyph) >= numGlyphs {
+			delete(f.cmap, r)
+		}
+	}
+
+	// Outlines
+	if font.version == 0x4F54544F {
+		table, err := font.table("CFF ", 4)
+		if err != nil {
+			return nil, err
+		}
+		if f.cff, err = parseCFF(table); err != nil {
+			return nil, err
+		}
+		if len(f.cff.charStrings) != numGlyphs {
+			return nil, fmt.Errorf("CFF font doesn't have the glyph count of the font file")
+		}
+	} else {
+		if _, err := newGlyf(font, numGlyphs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Font descriptor values, in thousandths of the font size
+	f.BBox = [4]int{
+		f.scale(int16(binary.BigEndian.Uint16(head[36:]))),
+		f.scale(int16(binary.BigEndian.Uint16(head[38:]))),
+		f.scale(int16(binary.BigEndian.Uint16(head[40:]))),
+		f.scale(int16(binary.BigEndian.Uint16(head[42:]))),
+	}
+	f.Ascent = f.scale(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.Descent = f.scale(int16(binary.BigEndian.Uint16(hhea[6:])))
+	f.CapHeight = f.Ascent
+	weight := 400
+	if os2, ok := font.tables["OS/2"]; ok && len(os2) >= 78 {
+		weight = int(binary.BigEndian.Uint16(os2[4:]))
+		if binary.BigEndian.Uint16(os2[8:])&0x000F == 0x0002 {
+			return nil, fmt.Errorf("font license doesn't allow embedding")
+		}
+		if class := os2[30]; class >= 1 && class <= 7 {
+			f.flags |= 1 << 1 // Serif
+		}
+		f.Ascent = f.scale(int16(binary.BigEndian.Uint16(os2[68:])))
+		f.Descent = f.scale(int16(binary.BigEndian.Uint16(os2[70:])))
+		f.CapHeight = f.Ascent
+		if binary.BigEndian.Uint16(os2) >= 2 && len(os2) >= 90 && os2[88]|os2[89] != 0 {
+			f.CapHeight = f.scale(int16(binary.BigEndian.Uint16(os2[88:])))
+		}
+	}
+	f.stemV = 10 + 220*(max(weight, 50)-50)/900
+	if post, ok := font.tables["post"]; ok && len(post) >= 16 {
+		f.ItalicAngle = float64(int32(binary.BigEndian.Uint32(post[4:]))) / 65536
+		if binary.BigEndian.Uint32(post[12:]) != 0 {
+			f.flags |= 1 << 0 // FixedPitch
+		}
+	}
+	if f.ItalicAngle != 0 || binary.BigEndian.Uint16(head[44:])&0x2 != 0 {
+		f.flags |= 1 << 6 // Italic
+	}
+
+	f.descriptor = godyf.NewDictionary(map[string]interface{}{"Type": godyf.Name("FontDescriptor")})
+	f.file = godyf.NewStream(nil, nil, true)
+	f.toUnicode = godyf.NewStream(nil, nil, true)
+	return f, nil
+}
+
+// scale converts a length in font units to thousandths of the font size
+func (f *TrueType) scale(value int16) int {
+	return int(math.Round(float64(value) * 1000 / float64(f.unitsPerEm)))
+}
+
+// GlyphWidth returns the advance width of the glyph of r in thousandths of
+// the font size, the width of the .notdef glyph if r is missing
+func (f *TrueType) GlyphWidth(r rune) int {
+	return f.width(f.cmap[r])
+}
+
+// width returns the advance width of a glyph in thousandths of the font size
+func (f *TrueType) width(glyph uint16) int {
+	return int(math.Round(float64(f.advances[glyph]) * 1000 / float64(f.unitsPerEm)))
+}
+
+// MeasureString returns the width of text shown with the font at the given
+// size, as drawn by Stream.ShowText with godyf.EncodedText: each character
+// is measured with the glyph given by the cmap, without shaping. Text
+// shaped by Shape, whose ligatures and contextual forms change the glyphs,
+// is measured by MeasureShapedString. Simple fonts draw .notdef instead of
+// the glyphs used once all their codes are assigned, which are measured
+// anyway.
+func (f *TrueType) MeasureString(size float64, text string) float64 {
+	width := 0
+	for _, r := range text {
+		width += f.width(f.cmap[r])
+	}
+	return float64(width) * size / 1000
+}
+
+// EncodeText returns the character codes showing text with the font,
+// assigning codes to the glyphs used for the first time by simple fonts.
+// It makes TrueType a godyf.TextEncoder.
+func (f *TrueType) EncodeText(text string) []byte {
+	codes := make([]byte, 0, 2*len(text))
+	for _, r := range text {
+		codes = append(codes, f.encodeGlyph(f.cmap[r], string(r))...)
+	}
+	return codes
+}
+
+// encodeGlyph returns the character code showing glyph, recording text as
+// the characters it shows unless the code already has some
+func (f *TrueType) encodeGlyph(glyph uint16, text string) []byte {
+	if f.composite {
+		f.cids[glyph] = true
+		if _, ok := f.text[int(glyph)]; !ok && glyph != 0 && text != "" {
+			f.text[int(glyph)] = text
+		}
+		return []byte{byte(glyph >> 8), byte(glyph)}
+	}
+
+	code := f.code(glyph, text)
+	if code == 0 {
+		f.notdef = true
+	}
+	return []byte{code}
+}
+
+// code returns the character code of glyph for simple fonts, 0 for the
+// .notdef glyph
+func (f *TrueType) code(glyph uint16, text string) byte {
+	if glyph == 0 {
+		return 0
+	}
+	if code, ok := f.codes[glyph]; ok {
+		return code
+	}
+
+	// Space keeps its code so that word spacing applies to it, other
+	// glyphs get codes from 33 to 255, then from 1 to 31
+	var code byte
+	if text == " " {
+		code = ' '
+	} else {
+		if f.nextCode == 0 {
+			return 0
+		}
+		code = byte(f.nextCode)
+		switch f.nextCode {
+		case 255:
+			f.nextCode = 1
+		case 31:
+			f.nextCode = 0
+		default:
+			f.nextCode++
+		}
+	}
+	f.codes[glyph] = code
+	f.glyphs[code] = glyph
+	if text != "" {
+		f.text[int(code)] = text
+	}
+	return code
+}
+
+// Objects returns the objects of the font, to be added to a document with
+// pdf.PDF.AddResource: the /Font dictionary, the descendant CIDFont of
+// composite fonts, the /FontDescriptor dictionary, the font file, the CID to
+// glyph ID map of composite fonts with TrueType outlines and the ToUnicode
+// CMap
+func (f *TrueType) Objects() []godyf.PDFObject {
+	objects := []godyf.PDFObject{f.dictionary}
+	if f.cidFont != nil {
+		objects = append(objects, f.cidFont)
+	}
+	objects = append(objects, f.descriptor, f.file)
+	if f.cidToGID != nil {
+		objects = append(objects, f.cidToGID)
+	}
+	return append(objects, f.toUnicode)
+}
+
+// Finish embeds the subset of the font made of the glyphs used so far, and
+// updates the font dictionaries accordingly
+func (f *TrueType) Finish() error {
+	if f.composite {
+		return f.finishComposite()
+	}
+
+	// Used codes, with the .notdef glyph for code 0
+	codes := make([]int, 0, len(f.glyphs)+1)
+	codes = append(codes, 0)
+	for code := range f.glyphs {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	used := []uint16{0}
+	for _, code := range codes[1:] {
+		used = append(used, f.glyphs[byte(code)])
+	}
+
+	name := subsetTag(used) + "+" + f.Name
+	var subset []byte
+	var err error
+	subtype := "TrueType"
+	if f.cff != nil {
+		subset, err = f.cff.subset(name, used, codes)
+		subtype = "Type1"
+	} else {
+		subset, _, err = f.subsetGlyf(used, codes)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to subset font %s: %w", f.Name, err)
+	}
+
+	// Widths of the used codes, the .notdef glyph only being listed if shown
+	first, last := codes[0], codes[len(codes)-1]
+	if len(codes) > 1 && !f.notdef {
+		first = codes[1]
+	}
+	widths := godyf.NewArrayFromSlice(make([]interface{}, last-first+1))
+	for i := range widths.Elements {
+		widths.Elements[i] = 0
+	}
+	for i, code := range codes {
+		if code >= first {
+			widths.Elements[code-first] = f.width(used[i])
+		}
+	}
+	f.dictionary.Set("Subtype", godyf.Name(subtype))
+	f.dictionary.Set("BaseFont", godyf.Name(name))
+	f.dictionary.Set("FirstChar", first)
+	f.dictionary.Set("LastChar", last)
+	f.dictionary.Set("Widths", widths)
+	f.dictionary.Set("FontDescriptor", f.descriptor.Ref())
+	f.dictionary.Set("ToUnicode", f.toUnicode.Ref())
+	f.toUnicode.Stream = []interface{}{toUnicodeCMap(f.text, 1)}
+
+	fileType := "Type1C"
+	if f.cff == nil {
+		fileType = ""
+	}
+	f.finishDescriptor(name, subset, fileType)
+	return nil
+}
+
+// finishDescriptor updates the font descriptor of the font subset called
+// name, and its font file. The font file is given as /FontFile3 with the
+// given subtype if not empty, and as /FontFile2 otherwise.
+func (f *TrueType) finishDescriptor(name string, subset []byte, fileType string) {
+	bbox := godyf.NewArray()
+	for _, value := range f.BBox {
+		bbox.Elements = append(bbox.Elements, value)
+	}
+	f.descriptor.Set("FontName", godyf.Name(name))
+	f.descriptor.Set("Flags", f.flags|1<<2) // Symbolic, glyphs are found with the built-in encoding
+	f.descriptor.Set("FontBBox", bbox)
+	f.descriptor.Set("ItalicAngle", f.ItalicAngle)
+	f.descriptor.Set("Ascent", f.Ascent)
+	f.descriptor.Set("Descent", f.Descent)
+	f.descriptor.Set("CapHeight", f.CapHeight)
+	f.descriptor.Set("StemV", f.stemV)
+
+	f.file.Stream = []interface{}{subset}
+	f.file.Extra = make(map[string]interface{})
+	if fileType != "" {
+		f.descriptor.Set("FontFile3", f.file.Ref())
+		f.file.Extra["Subtype"] = godyf.Name(fileType)
+	} else {
+		f.descriptor.Set("FontFile2", f.file.Ref())
+		f.file.Extra["Length1"] = len(subset)
+	}
+}
+
+// subsetTag returns the tag prefixed to the name of a font subset, six
+// uppercase letters derived from its glyphs
+func subsetTag(glyphs []uint16) string {
+	hash := fnv.New64a()
+	for _, glyph := range glyphs {
+		hash.Write([]byte{byte(glyph >> 8), byte(glyph)})
+	}
+	sum := hash.Sum64()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = byte('A' + sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
@@ -0,0 +1,232 @@
+package font
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// Type3 is a Type 3 font whose glyphs are content streams drawn with the
+// path operators of godyf.Stream, such as icons or logos flowing in text.
+// Glyphs are added with AddGlyph before adding the font to a document with
+// pdf.PDF.AddResource, its dictionary being completed when the document is
+// written.
+//
+// Each glyph gets a 1-byte character code, so a font holds at most 255
+// glyphs. Glyph widths and bounding boxes are given in glyph space, whose
+// size is set by the number of units per em given to NewType3.
+type Type3 struct {
+	// Resources used by the glyph content streams, such as images or
+	// graphics states, nil if they use none
+	Resources *godyf.Dictionary
+
+	unitsPerEm float64
+	glyphs     map[rune]*type3Glyph // Glyphs by character
+	codes      map[byte]*type3Glyph // Glyphs by character code
+	nextCode   int                  // Next character code to assign, 0 when all are used
+	dictionary *godyf.Dictionary    // /Font dictionary
+	charProcs  []*godyf.Stream      // Glyph content streams, in order of addition
+	toUnicode  *godyf.Stream        // ToUnicode CMap
+}
+
+// type3Glyph is a glyph of a Type 3 font
+type type3Glyph struct {
+	r      rune
+	code   byte
+	width  float64
+	bbox   *[4]float64 // Bounding box of glyphs painted with the current color
+	stream *godyf.Stream
+}
+
+// NewType3 returns an empty Type 3 font whose glyph space has unitsPerEm
+// units per em, 1000 being the usual value
+func NewType3(unitsPerEm float64) *Type3 {
+	dictionary := godyf.NewDictionary(map[string]interface{}{
+		"Type":    godyf.Name("Font"),
+		"Subtype": godyf.Name("Type3"),
+	})
+	dictionary.Set("FontMatrix", godyf.NewArray(1/unitsPerEm, 0, 0, 1/unitsPerEm, 0, 0))
+	return &Type3{
+		unitsPerEm: unitsPerEm,
+		glyphs:     make(map[rune]*type3Glyph),
+		codes:      make(map[byte]*type3Glyph),
+		nextCode:   33,
+		dictionary: dictionary,
+		toUnicode:  godyf.NewStream(nil, nil, true),
+	}
+}
+
+// AddGlyph adds the glyph shown for r, with the given advance width in glyph
+// space, and returns its content stream starting with the d0 operator. The
+// glyph is drawn with its own colors.
+func (f *Type3) AddGlyph(r rune, width float64) (*godyf.Stream, error) {
+	glyph, err := f.addGlyph(r, width, nil)
+	if err != nil {
+		return nil, err
+	}
+	glyph.stream.SetGlyphWidth(width, 0)
+	return glyph.stream, nil
+}
+
+// AddShapeGlyph adds the glyph shown for r, with the given advance width and
+// bounding box in glyph space, and returns its content stream starting with
+// the d1 operator. The glyph is a shape painted with the current color of
+// the text, its content stream must not set colors.
+func (f *Type3) AddShapeGlyph(r rune, width float64, bbox [4]float64) (*godyf.Stream, error) {
+	glyph, err := f.addGlyph(r, width, &bbox)
+	if err != nil {
+		return nil, err
+	}
+	glyph.stream.SetGlyphWidthAndBoundingBox(width, 0, bbox[0], bbox[1], bbox[2], bbox[3])
+	return glyph.stream, nil
+}
+
+// addGlyph adds the glyph shown for r with an empty content stream
+func (f *Type3) addGlyph(r rune, width float64, bbox *[4]float64) (*type3Glyph, error) {
+	if _, ok := f.glyphs[r]; ok {
+		return nil, fmt.Errorf("font already has a glyph for %q", r)
+	}
+
+	// Space keeps its code so that word spacing applies to it, other
+	// glyphs get codes from 33 to 255, then from 1 to 31
+	var code byte
+	if r == ' ' {
+		code = ' '
+	} else {
+		if f.nextCode == 0 {
+			return nil, fmt.Errorf("font can't hold more than 255 glyphs")
+		}
+		code = byte(f.nextCode)
+		switch f.nextCode {
+		case 255:
+			f.nextCode = 1
+		case 31:
+			f.nextCode = 0
+		default:
+			f.nextCode++
+		}
+	}
+	glyph := &type3Glyph{r: r, code: code, width: width, bbox: bbox, stream: godyf.NewStream(nil, nil, true)}
+	f.glyphs[r] = glyph
+	f.codes[code] = glyph
+	f.charProcs = append(f.charProcs, glyph.stream)
+	return glyph, nil
+}
+
+// glyphName returns the name of the glyph of r in the font
+func glyphName(r rune) string {
+	if r <= 0xFFFF {
+		return fmt.Sprintf("uni%04X", r)
+	}
+	return fmt.Sprintf("u%X", r)
+}
+
+// GlyphWidth returns the advance width of the glyph of r in thousandths of
+// the font size, 0 if r has no glyph
+func (f *Type3) GlyphWidth(r rune) float64 {
+	if glyph, ok := f.glyphs[r]; ok {
+		return glyph.width * 1000 / f.unitsPerEm
+	}
+	return 0
+}
+
+// MeasureString returns the width of text shown with the font at the given
+// size, characters without glyph being skipped
+func (f *Type3) MeasureString(size float64, text string) float64 {
+	width := 0.0
+	for _, r := range text {
+		width += f.GlyphWidth(r)
+	}
+	return width * size / 1000
+}
+
+// EncodeText returns the character codes showing text with the font,
+// skipping characters without glyph. It makes Type3 a godyf.TextEncoder.
+func (f *Type3) EncodeText(text string) []byte {
+	codes := make([]byte, 0, len(text))
+	for _, r := range text {
+		if glyph, ok := f.glyphs[r]; ok {
+			codes = append(codes, glyph.code)
+		}
+	}
+	return codes
+}
+
+// Objects returns the objects of the font, to be added to a document with
+// pdf.PDF.AddResource: the /Font dictionary, the glyph content streams and
+// the ToUnicode CMap
+func (f *Type3) Objects() []godyf.PDFObject {
+	objects := []godyf.PDFObject{f.dictionary}
+	for _, stream := range f.charProcs {
+		objects = append(objects, stream)
+	}
+	return append(objects, f.toUnicode)
+}
+
+// Finish updates the font dictionary with the glyphs of the font: their
+// bounding box, content streams, encoding differences and widths
+func (f *Type3) Finish() error {
+	if len(f.codes) == 0 {
+		return fmt.Errorf("no glyphs in Type 3 font")
+	}
+	codes := make([]int, 0, len(f.codes))
+	for code := range f.codes {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	// The font bounding box is only known if all glyphs have one, all
+	// zeros meaning that it is unknown
+	bbox := [4]float64{}
+	for i, code := range codes {
+		glyph := f.codes[byte(code)]
+		if glyph.bbox == nil {
+			bbox = [4]float64{}
+			break
+		}
+		if i == 0 {
+			bbox = *glyph.bbox
+		} else {
+			bbox[0], bbox[1] = min(bbox[0], glyph.bbox[0]), min(bbox[1], glyph.bbox[1])
+			bbox[2], bbox[3] = max(bbox[2], glyph.bbox[2]), max(bbox[3], glyph.bbox[3])
+		}
+	}
+
+	// Consecutive codes share their first code in the differences
+	charProcs := godyf.NewDictionary(nil)
+	differences := godyf.NewArray()
+	first, last := codes[0], codes[len(codes)-1]
+	widths := godyf.NewArrayFromSlice(make([]interface{}, last-first+1))
+	for i := range widths.Elements {
+		widths.Elements[i] = 0
+	}
+	text := make(map[int]string, len(codes))
+	for i, code := range codes {
+		glyph := f.codes[byte(code)]
+		name := glyphName(glyph.r)
+		charProcs.Set(name, glyph.stream.Ref())
+		if i == 0 || codes[i-1] != code-1 {
+			differences.Elements = append(differences.Elements, code)
+		}
+		differences.Elements = append(differences.Elements, godyf.Name(name))
+		widths.Elements[code-first] = glyph.width
+		text[code] = string(glyph.r)
+	}
+
+	f.dictionary.Set("FontBBox", godyf.NewArray(bbox[0], bbox[1], bbox[2], bbox[3]))
+	f.dictionary.Set("CharProcs", charProcs)
+	f.dictionary.Set("Encoding", godyf.NewDictionary(map[string]interface{}{
+		"Type":        godyf.Name("Encoding"),
+		"Differences": differences,
+	}))
+	f.dictionary.Set("FirstChar", first)
+	f.dictionary.Set("LastChar", last)
+	f.dictionary.Set("Widths", widths)
+	if f.Resources != nil {
+		f.dictionary.Set("Resources", f.Resources)
+	}
+	f.dictionary.Set("ToUnicode", f.toUnicode.Ref())
+	f.toUnicode.Stream = []interface{}{toUnicodeCMap(text, 1)}
+	return nil
+}
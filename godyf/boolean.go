@@ -0,0 +1,12 @@
+package godyf
+
+// Bool represents a PDF Boolean object
+type Bool bool
+
+// Data returns the PDF representation of the boolean
+func (b Bool) Data() []byte {
+	if b {
+		return []byte("true")
+	}
+	return []byte("false")
+}
@@ -1,12 +1,20 @@
 package godyf
 
-import "bytes"
+import (
+	"bytes"
+	"sort"
+)
 
+// Dictionary represents a PDF Dictionary object
 type Dictionary struct {
 	Object // Embed the Object struct to inherit its properties
 	Values map[string]interface{}
+	order  []string // Keys in insertion order, as recorded by Set
 }
 
+// priorityKeys are always written first, in this order, when present
+var priorityKeys = []string{"Type", "Subtype"}
+
 // NewDictionary creates a new Dictionary object with optional initial values.
 func NewDictionary(values map[string]interface{}) *Dictionary {
 	if values == nil {
@@ -20,15 +28,75 @@ func NewDictionary(values map[string]interface{}) *Dictionary {
 	}
 }
 
+// Set sets the value for key, remembering the order in which keys were added
+func (d *Dictionary) Set(key string, value interface{}) {
+	if d.Values == nil {
+		d.Values = make(map[string]interface{})
+	}
+	if _, exists := d.Values[key]; !exists {
+		d.order = append(d.order, key)
+	}
+	d.Values[key] = value
+}
+
+// Get returns the value for key, or nil if the key is not present
+func (d *Dictionary) Get(key string) interface{} {
+	return d.Values[key]
+}
+
+// Delete removes key from the dictionary
+func (d *Dictionary) Delete(key string) {
+	delete(d.Values, key)
+	for i, k := range d.order {
+		if k == key {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the dictionary keys in serialization order.
+// /Type and /Subtype come first, followed by keys added with Set in insertion
+// order, followed by any other keys (map literals, direct Values writes)
+// sorted alphabetically. The order is stable across calls and runs.
+func (d *Dictionary) Keys() []string {
+	keys := make([]string, 0, len(d.Values))
+	seen := make(map[string]bool, len(d.Values))
+
+	for _, key := range priorityKeys {
+		if _, ok := d.Values[key]; ok {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	for _, key := range d.order {
+		if _, ok := d.Values[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	var rest []string
+	for key := range d.Values {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(keys, rest...)
+}
+
 // Data returns the PDF byte representation of the dictionary.
 func (d *Dictionary) Data() []byte {
 	var buf bytes.Buffer
 	buf.WriteString("<<")
-	for key, value := range d.Values {
+	for _, key := range d.Keys() {
 		buf.WriteString(" /")
 		buf.Write(ToBytes(key))
 		buf.WriteByte(' ')
-		buf.Write(ToBytes(value))
+		buf.Write(ToBytes(d.Values[key]))
 	}
 	buf.WriteString(" >>")
 	return buf.Bytes()
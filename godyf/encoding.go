@@ -0,0 +1,72 @@
+package godyf
+
+import (
+	"bytes"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+)
+
+// ASCII85Encode encodes data as ASCII base-85, terminated by the "~>" EOD marker
+func ASCII85Encode(data []byte) []byte {
+	encoded := make([]byte, ascii85.MaxEncodedLen(len(data)), ascii85.MaxEncodedLen(len(data))+2)
+	n := ascii85.Encode(encoded, data)
+	return append(encoded[:n], '~', '>')
+}
+
+// ASCII85Decode decodes ASCII base-85 data, ignoring whitespace, an optional
+// leading "<~" and everything after the "~>" EOD marker
+func ASCII85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimLeft(data, " \t\r\n\f\x00")
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+
+	decoded := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(decoded, data, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ASCII85 data: %w", err)
+	}
+	return decoded[:n], nil
+}
+
+// ASCIIHexEncode encodes data as hexadecimal digits, terminated by the ">" EOD marker
+func ASCIIHexEncode(data []byte) []byte {
+	encoded := make([]byte, hex.EncodedLen(len(data)), hex.EncodedLen(len(data))+1)
+	hex.Encode(encoded, data)
+	return append(encoded, '>')
+}
+
+// ASCIIHexDecode decodes hexadecimal data, ignoring whitespace and everything
+// after the ">" EOD marker. A final odd digit is treated as if followed by 0.
+func ASCIIHexDecode(data []byte) ([]byte, error) {
+	digits := make([]byte, 0, len(data)+1)
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isWhitespace(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	decoded := make([]byte, hex.DecodedLen(len(digits)))
+	if _, err := hex.Decode(decoded, digits); err != nil {
+		return nil, fmt.Errorf("invalid ASCIIHex data: %w", err)
+	}
+	return decoded, nil
+}
+
+// isWhitespace reports whether c is a PDF whitespace character
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,424 @@
+package godyf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Filter represents a PDF stream filter
+type Filter interface {
+	// Name returns the filter name written in the /Filter entry
+	Name() Name
+	// Params returns the /DecodeParms dictionary of the filter, or nil
+	Params() *Dictionary
+	// Encode encodes data so that decoding it with this filter gives it back
+	Encode(data []byte) []byte
+	// Decode decodes data encoded with this filter
+	Decode(data []byte) ([]byte, error)
+}
+
+// PredictorParams describes the predictor applied to data before Flate or LZW encoding
+type PredictorParams struct {
+	Predictor        int // 1 (or 0) for none, 2 for TIFF, 10 to 14 for a PNG filter type, 15 for per-row optimum
+	Colors           int // Color components per sample, defaults to 1
+	BitsPerComponent int // Bits per color component, defaults to 8
+	Columns          int // Samples per row, defaults to 1
+}
+
+// hasPredictor returns whether a predictor is applied
+func (p PredictorParams) hasPredictor() bool {
+	return p.Predictor > 1
+}
+
+// withDefaults returns the parameters with unset values replaced by PDF
+// defaults, negative values being left to be rejected by the predictor
+func (p PredictorParams) withDefaults() PredictorParams {
+	if p.Colors == 0 {
+		p.Colors = 1
+	}
+	if p.BitsPerComponent == 0 {
+		p.BitsPerComponent = 8
+	}
+	if p.Columns == 0 {
+		p.Columns = 1
+	}
+	return p
+}
+
+// check returns an error if the predictor parameters are invalid, so that
+// data isn't decompressed for nothing
+func (p PredictorParams) check() error {
+	if !p.hasPredictor() {
+		return nil
+	}
+	_, _, err := rowLayout(p.withDefaults(), 0)
+	return err
+}
+
+// setParams sets the predictor entries of a /DecodeParms dictionary
+func (p PredictorParams) setParams(params *Dictionary) {
+	p = p.withDefaults()
+	params.Set("Predictor", p.Predictor)
+	params.Set("Colors", p.Colors)
+	params.Set("BitsPerComponent", p.BitsPerComponent)
+	params.Set("Columns", p.Columns)
+}
+
+// FlateFilter compresses data with zlib/deflate
+type FlateFilter struct {
+	PredictorParams
+	Level int // zlib compression level from 1 to 9 or zlib.HuffmanOnly, 0 means zlib.DefaultCompression
+}
+
+// Name returns the filter name
+func (f *FlateFilter) Name() Name {
+	return "FlateDecode"
+}
+
+// Params returns the predictor parameters, if any
+func (f *FlateFilter) Params() *Dictionary {
+	if !f.hasPredictor() {
+		return nil
+	}
+	params := NewDictionary(nil)
+	f.setParams(params)
+	return params
+}
+
+// Encode applies the predictor and compresses data. It panics if the
+// predictor parameters are invalid or describe rows longer than data.
+func (f *FlateFilter) Encode(data []byte) []byte {
+	if f.hasPredictor() {
+		data = mustEncodePredictor(data, f.PredictorParams.withDefaults())
+	}
+
+	level := f.Level
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	writer, err := zlib.NewWriterLevel(&buf, level)
+	if err != nil {
+		writer = zlib.NewWriter(&buf)
+	}
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+// Decode decompresses data and removes the predictor
+func (f *FlateFilter) Decode(data []byte) ([]byte, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Flate data: %w", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil && len(decoded) == 0 {
+		return nil, fmt.Errorf("invalid Flate data: %w", err)
+	}
+	if f.hasPredictor() {
+		return decodePredictor(decoded, f.PredictorParams.withDefaults())
+	}
+	return decoded, nil
+}
+
+// LZWFilter compresses data with the LZW algorithm
+type LZWFilter struct {
+	PredictorParams
+	NoEarlyChange bool // Postpone code length increases by one code (/EarlyChange 0)
+}
+
+// Name returns the filter name
+func (f *LZWFilter) Name() Name {
+	return "LZWDecode"
+}
+
+// Params returns the predictor and early change parameters, if any
+func (f *LZWFilter) Params() *Dictionary {
+	if !f.hasPredictor() && !f.NoEarlyChange {
+		return nil
+	}
+	params := NewDictionary(nil)
+	if f.hasPredictor() {
+		f.setParams(params)
+	}
+	if f.NoEarlyChange {
+		params.Set("EarlyChange", 0)
+	}
+	return params
+}
+
+// Encode applies the predictor and compresses data. It panics if the
+// predictor parameters are invalid or describe rows longer than data.
+func (f *LZWFilter) Encode(data []byte) []byte {
+	if f.hasPredictor() {
+		data = mustEncodePredictor(data, f.PredictorParams.withDefaults())
+	}
+	return lzwEncode(data, !f.NoEarlyChange)
+}
+
+// Decode decompresses data and removes the predictor
+func (f *LZWFilter) Decode(data []byte) ([]byte, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	decoded, err := lzwDecode(data, !f.NoEarlyChange)
+	if err != nil {
+		return nil, err
+	}
+	if f.hasPredictor() {
+		return decodePredictor(decoded, f.PredictorParams.withDefaults())
+	}
+	return decoded, nil
+}
+
+// RunLengthFilter compresses data with byte-oriented run-length encoding
+type RunLengthFilter struct{}
+
+// Name returns the filter name
+func (RunLengthFilter) Name() Name {
+	return "RunLengthDecode"
+}
+
+// Params returns nil, the filter has no parameters
+func (RunLengthFilter) Params() *Dictionary {
+	return nil
+}
+
+// Encode compresses data
+func (RunLengthFilter) Encode(data []byte) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(data); {
+		// Count identical bytes starting at i
+		run := 1
+		for i+run < len(data) && run < 128 && data[i+run] == data[i] {
+			run++
+		}
+		if run > 1 {
+			buf.WriteByte(byte(257 - run))
+			buf.WriteByte(data[i])
+			i += run
+			continue
+		}
+
+		// Copy literal bytes until the next run of at least 3 identical bytes
+		start := i
+		for i < len(data) && i-start < 128 {
+			if i+2 < len(data) && data[i] == data[i+1] && data[i] == data[i+2] {
+				break
+			}
+			i++
+		}
+		buf.WriteByte(byte(i - start - 1))
+		buf.Write(data[start:i])
+	}
+	buf.WriteByte(128)
+	return buf.Bytes()
+}
+
+// Decode decompresses data
+func (RunLengthFilter) Decode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		i++
+		switch {
+		case length == 128:
+			return buf.Bytes(), nil
+		case length < 128:
+			if i+length+1 > len(data) {
+				return nil, fmt.Errorf("invalid RunLength data: truncated literal run")
+			}
+			buf.Write(data[i : i+length+1])
+			i += length + 1
+		default:
+			if i >= len(data) {
+				return nil, fmt.Errorf("invalid RunLength data: truncated repeated run")
+			}
+			buf.Write(bytes.Repeat(data[i:i+1], 257-length))
+			i++
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// ASCIIHexFilter encodes data as hexadecimal digits
+type ASCIIHexFilter struct{}
+
+// Name returns the filter name
+func (ASCIIHexFilter) Name() Name {
+	return "ASCIIHexDecode"
+}
+
+// Params returns nil, the filter has no parameters
+func (ASCIIHexFilter) Params() *Dictionary {
+	return nil
+}
+
+// Encode encodes data
+func (ASCIIHexFilter) Encode(data []byte) []byte {
+	return ASCIIHexEncode(data)
+}
+
+// Decode decodes data
+func (ASCIIHexFilter) Decode(data []byte) ([]byte, error) {
+	return ASCIIHexDecode(data)
+}
+
+// ASCII85Filter encodes data as ASCII base-85
+type ASCII85Filter struct{}
+
+// Name returns the filter name
+func (ASCII85Filter) Name() Name {
+	return "ASCII85Decode"
+}
+
+// Params returns nil, the filter has no parameters
+func (ASCII85Filter) Params() *Dictionary {
+	return nil
+}
+
+// Encode encodes data
+func (ASCII85Filter) Encode(data []byte) []byte {
+	return ASCII85Encode(data)
+}
+
+// Decode decodes data
+func (ASCII85Filter) Decode(data []byte) ([]byte, error) {
+	return ASCII85Decode(data)
+}
+
+// PassthroughFilter declares a filter for data that is already encoded,
+// such as DCTDecode (JPEG), JPXDecode (JPEG 2000), JBIG2Decode or CCITTFaxDecode
+type PassthroughFilter struct {
+	FilterName  Name        // Name of the filter, e.g. "DCTDecode"
+	DecodeParms *Dictionary // Optional /DecodeParms dictionary
+}
+
+// Name returns the filter name
+func (f *PassthroughFilter) Name() Name {
+	return f.FilterName
+}
+
+// Params returns the decode parameters given when creating the filter
+func (f *PassthroughFilter) Params() *Dictionary {
+	return f.DecodeParms
+}
+
+// Encode returns data unchanged, as it is already encoded
+func (f *PassthroughFilter) Encode(data []byte) []byte {
+	return data
+}
+
+// Decode returns data unchanged: decoding image formats is left to image libraries
+func (f *PassthroughFilter) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// filterNames maps abbreviated filter names, as used in inline images, to full names
+var filterNames = map[Name]Name{
+	"AHx": "ASCIIHexDecode",
+	"A85": "ASCII85Decode",
+	"LZW": "LZWDecode",
+	"Fl":  "FlateDecode",
+	"RL":  "RunLengthDecode",
+	"CCF": "CCITTFaxDecode",
+	"DCT": "DCTDecode",
+}
+
+// NewFilter returns the filter with the given name, configured with the
+// given /DecodeParms dictionary that may be nil
+func NewFilter(name Name, params *Dictionary) (Filter, error) {
+	if fullName, ok := filterNames[name]; ok {
+		name = fullName
+	}
+
+	switch name {
+	case "FlateDecode":
+		return &FlateFilter{PredictorParams: predictorFromParams(params)}, nil
+	case "LZWDecode":
+		filter := &LZWFilter{PredictorParams: predictorFromParams(params)}
+		if params != nil {
+			filter.NoEarlyChange = intValue(params.Get("EarlyChange"), 1) == 0
+		}
+		return filter, nil
+	case "RunLengthDecode":
+		return RunLengthFilter{}, nil
+	case "ASCIIHexDecode":
+		return ASCIIHexFilter{}, nil
+	case "ASCII85Decode":
+		return ASCII85Filter{}, nil
+	case "DCTDecode", "JPXDecode", "JBIG2Decode", "CCITTFaxDecode", "Crypt":
+		return &PassthroughFilter{FilterName: name, DecodeParms: params}, nil
+	}
+	return nil, fmt.Errorf("unsupported filter /%s", name)
+}
+
+// FiltersFromEntries returns the filter chain described by the values of the
+// /Filter and /DecodeParms entries of a stream dictionary, either of which may be nil
+func FiltersFromEntries(filter, decodeParms interface{}) ([]Filter, error) {
+	var names, params []interface{}
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case Name:
+		names = []interface{}{f}
+		params = []interface{}{decodeParms}
+	case *Array:
+		names = f.Elements
+		if p, ok := decodeParms.(*Array); ok {
+			params = p.Elements
+		}
+	default:
+		return nil, fmt.Errorf("invalid /Filter value %s", ToBytes(filter))
+	}
+
+	filters := make([]Filter, len(names))
+	for i, name := range names {
+		filterName, ok := name.(Name)
+		if !ok {
+			return nil, fmt.Errorf("invalid filter name %s", ToBytes(name))
+		}
+		var dictionary *Dictionary
+		if i < len(params) {
+			dictionary, _ = params[i].(*Dictionary)
+		}
+		var err error
+		if filters[i], err = NewFilter(filterName, dictionary); err != nil {
+			return nil, err
+		}
+	}
+	return filters, nil
+}
+
+// predictorFromParams reads the predictor entries of a /DecodeParms dictionary
+func predictorFromParams(params *Dictionary) PredictorParams {
+	if params == nil {
+		return PredictorParams{}
+	}
+	return PredictorParams{
+		Predictor:        intValue(params.Get("Predictor"), 1),
+		Colors:           intValue(params.Get("Colors"), 1),
+		BitsPerComponent: intValue(params.Get("BitsPerComponent"), 8),
+		Columns:          intValue(params.Get("Columns"), 1),
+	}
+}
+
+// intValue returns value as an int, or fallback if it is not a number
+func intValue(value interface{}, fallback int) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return fallback
+}
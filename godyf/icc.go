@@ -0,0 +1,71 @@
+package godyf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ICCBased is an ICC-based color space, defined by an embedded ICC profile
+type ICCBased struct {
+	// Profile stream, to be added to documents with pdf.PDF.AddObject
+	Stream *Stream
+	// Number of color components, read from the profile header
+	Components int
+}
+
+// NewICCBased returns an ICC-based color space embedding profile. The
+// number of components and the alternate device color space are read from
+// the color space of the profile header: gray, RGB or CMYK.
+func NewICCBased(profile []byte) (*ICCBased, error) {
+	if len(profile) < 128 || string(profile[36:40]) != "acsp" {
+		return nil, fmt.Errorf("invalid ICC profile header")
+	}
+	if size := binary.BigEndian.Uint32(profile); int64(size) != int64(len(profile)) {
+		return nil, fmt.Errorf("invalid ICC profile size %d for %d bytes", size, len(profile))
+	}
+	switch class := string(profile[12:16]); class {
+	case "scnr", "mntr", "prtr", "spac":
+	default:
+		return nil, fmt.Errorf("unsupported ICC profile class %q", class)
+	}
+
+	var components int
+	var alternate Name
+	switch space := string(profile[16:20]); space {
+	case "GRAY":
+		components, alternate = 1, "DeviceGray"
+	case "RGB ":
+		components, alternate = 3, "DeviceRGB"
+	case "CMYK":
+		components, alternate = 4, "DeviceCMYK"
+	default:
+		return nil, fmt.Errorf("unsupported ICC profile color space %q", space)
+	}
+	stream := NewStream([]interface{}{profile}, map[string]interface{}{
+		"N":         components,
+		"Alternate": alternate,
+	}, true)
+	return &ICCBased{Stream: stream, Components: components}, nil
+}
+
+// ColorSpace returns the color space array referencing the profile stream,
+// to be used in /ColorSpace resource dictionaries and image dictionaries.
+// The profile stream must have been added to the document.
+func (c *ICCBased) ColorSpace() *Array {
+	return NewArray(Name("ICCBased"), c.Stream.Ref())
+}
+
+// SetColor sets the color space called name in the resources, that must be
+// this color space, and the color given by its components
+func (c *ICCBased) SetColor(stream *Stream, name string, stroke bool, components ...float64) error {
+	if len(components) != c.Components {
+		return fmt.Errorf("%d components given for a color space of %d components", len(components), c.Components)
+	}
+	operands := make([]interface{}, len(components))
+	for i, component := range components {
+		operands[i] = component
+	}
+	stream.SetColorSpace(name, stroke)
+	stream.SetColorSpecial("", stroke, operands...)
+	return nil
+}
@@ -0,0 +1,151 @@
+package godyf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	lzwClearTable = 256
+	lzwEOD        = 257
+	lzwFirstCode  = 258
+	lzwMaxCodes   = 4096
+)
+
+// lzwBitWriter writes variable-length codes most significant bit first
+type lzwBitWriter struct {
+	buf   bytes.Buffer
+	bits  uint32
+	nBits uint
+}
+
+func (w *lzwBitWriter) write(code int, width uint) {
+	w.bits = w.bits<<width | uint32(code)
+	w.nBits += width
+	for w.nBits >= 8 {
+		w.nBits -= 8
+		w.buf.WriteByte(byte(w.bits >> w.nBits))
+	}
+}
+
+func (w *lzwBitWriter) flush() []byte {
+	if w.nBits > 0 {
+		w.buf.WriteByte(byte(w.bits << (8 - w.nBits)))
+		w.nBits = 0
+	}
+	return w.buf.Bytes()
+}
+
+// lzwEncode compresses data with PDF (and TIFF) flavoured LZW.
+// With earlyChange, code widths increase one code early, as in /EarlyChange 1.
+func lzwEncode(data []byte, earlyChange bool) []byte {
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+
+	var writer lzwBitWriter
+	table := make(map[uint32]int)
+	next := lzwFirstCode
+	width := uint(9)
+	writer.write(lzwClearTable, width)
+
+	if len(data) == 0 {
+		writer.write(lzwEOD, width)
+		return writer.flush()
+	}
+
+	prefix := int(data[0])
+	for _, c := range data[1:] {
+		key := uint32(prefix)<<8 | uint32(c)
+		if code, ok := table[key]; ok {
+			prefix = code
+			continue
+		}
+
+		writer.write(prefix, width)
+		table[key] = next
+		next++
+		// The decoder adds its entries one code late, hence the - 1
+		if next-1+early >= 1<<width && width < 12 {
+			width++
+		}
+		if next >= lzwMaxCodes-1 {
+			writer.write(lzwClearTable, width)
+			table = make(map[uint32]int)
+			next = lzwFirstCode
+			width = 9
+		}
+		prefix = int(c)
+	}
+	writer.write(prefix, width)
+
+	// The decoder adds an entry when reading the last code, which may widen the EOD code
+	if next+early >= 1<<width && width < 12 {
+		width++
+	}
+	writer.write(lzwEOD, width)
+	return writer.flush()
+}
+
+// lzwDecode decompresses PDF (and TIFF) flavoured LZW data
+func lzwDecode(data []byte, earlyChange bool) ([]byte, error) {
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+
+	var out bytes.Buffer
+	table := make([][]byte, lzwFirstCode, lzwMaxCodes)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	width := uint(9)
+	var previous []byte
+
+	var bits uint32
+	var nBits uint
+	position := 0
+	for {
+		for nBits < width && position < len(data) {
+			bits = bits<<8 | uint32(data[position])
+			nBits += 8
+			position++
+		}
+		if nBits < width {
+			// Missing EOD marker, accept what has been decoded
+			return out.Bytes(), nil
+		}
+		nBits -= width
+		code := int(bits>>nBits) & (1<<width - 1)
+
+		switch {
+		case code == lzwClearTable:
+			table = table[:lzwFirstCode]
+			width = 9
+			previous = nil
+			continue
+		case code == lzwEOD:
+			return out.Bytes(), nil
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table):
+			entry = table[code]
+		case code == len(table) && previous != nil:
+			entry = append(append([]byte{}, previous...), previous[0])
+		default:
+			return nil, fmt.Errorf("invalid LZW data: unexpected code %d", code)
+		}
+		out.Write(entry)
+
+		if previous != nil && len(table) < lzwMaxCodes {
+			table = append(table, append(append([]byte{}, previous...), entry[0]))
+			if len(table)+early >= 1<<width && width < 12 {
+				width++
+			}
+		}
+		previous = entry
+	}
+}
@@ -0,0 +1,37 @@
+package godyf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Name represents a PDF Name object, stored without its leading slash
+type Name string
+
+// Data returns the PDF representation of the name, escaping delimiters,
+// '#' and characters outside the regular range as #xx
+func (n Name) Data() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if isRegularNameChar(c) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "#%02X", c)
+		}
+	}
+	return buf.Bytes()
+}
+
+// isRegularNameChar reports whether c can appear unescaped in a name
+func isRegularNameChar(c byte) bool {
+	if c < '!' || c > '~' {
+		return false
+	}
+	switch c {
+	case '#', '/', '%', '(', ')', '<', '>', '[', ']', '{', '}':
+		return false
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+package godyf
+
+// Null represents the PDF null object
+type Null struct{}
+
+// Data returns the PDF representation of null
+func (Null) Data() []byte {
+	return []byte("null")
+}
@@ -44,6 +44,11 @@ func (o *Object) Reference() []byte {
 	return []byte(fmt.Sprintf("%d %d R", o.Number, o.Generation))
 }
 
+// Ref returns an indirect reference to the object
+func (o *Object) Ref() Ref {
+	return Ref{Number: o.Number, Generation: o.Generation}
+}
+
 // Compressible returns whether the object can be included in an object stream
 func (o *Object) Compressible(obj interface{}) bool {
 	if o.Generation != 0 {
@@ -0,0 +1,241 @@
+package godyf
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxPredictorColors is the maximum number of color components per sample
+const maxPredictorColors = 32
+
+// rowLayout returns the number of bytes per pixel (at least 1) and per row
+// of length bytes of data predicted with p. An error is returned if the
+// parameters are invalid or if rows are longer than the data.
+func rowLayout(p PredictorParams, length int) (int, int, error) {
+	if p.Colors < 1 || p.Colors > maxPredictorColors {
+		return 0, 0, fmt.Errorf("invalid predictor colors %d", p.Colors)
+	}
+	switch p.BitsPerComponent {
+	case 1, 2, 4, 8, 16:
+	default:
+		return 0, 0, fmt.Errorf("invalid predictor bits per component %d", p.BitsPerComponent)
+	}
+	bitsPerPixel := p.Colors * p.BitsPerComponent
+	if p.Columns < 1 || p.Columns > (math.MaxInt-7)/bitsPerPixel {
+		return 0, 0, fmt.Errorf("invalid predictor columns %d", p.Columns)
+	}
+	bytesPerRow := (bitsPerPixel*p.Columns + 7) / 8
+	// Empty data has no rows, PNG rows start with a filter type byte
+	if length > 0 && bytesPerRow > length+1 {
+		return 0, 0, fmt.Errorf("predictor rows of %d bytes are longer than %d bytes of data", bytesPerRow, length)
+	}
+	return (bitsPerPixel + 7) / 8, bytesPerRow, nil
+}
+
+// encodePredictor applies a TIFF or PNG predictor to data
+func encodePredictor(data []byte, p PredictorParams) ([]byte, error) {
+	bytesPerPixel, bytesPerRow, err := rowLayout(p, len(data))
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+
+	if p.Predictor == 2 {
+		encoded := make([]byte, 0, len(data))
+		for start := 0; start < len(data); start += bytesPerRow {
+			end := min(start+bytesPerRow, len(data))
+			encoded = append(encoded, tiffRow(data[start:end], p.Columns*p.Colors, p, false)...)
+		}
+		return encoded, nil
+	}
+
+	encoded := make([]byte, 0, len(data)+len(data)/bytesPerRow+1)
+	previous := make([]byte, bytesPerRow)
+	filtered := make([]byte, bytesPerRow)
+	for start := 0; start < len(data); start += bytesPerRow {
+		row := make([]byte, bytesPerRow)
+		copy(row, data[start:])
+
+		filterType := byte(p.Predictor - 10)
+		if p.Predictor == 15 {
+			// Choose the filter type giving the smallest sum of absolute values
+			bestSum := -1
+			for candidate := byte(0); candidate <= 4; candidate++ {
+				pngFilterRow(filtered, row, previous, bytesPerPixel, candidate)
+				sum := 0
+				for _, b := range filtered {
+					sum += absInt(int(int8(b)))
+				}
+				if bestSum < 0 || sum < bestSum {
+					bestSum, filterType = sum, candidate
+				}
+			}
+		}
+
+		pngFilterRow(filtered, row, previous, bytesPerPixel, filterType)
+		encoded = append(encoded, filterType)
+		encoded = append(encoded, filtered...)
+		previous = row
+	}
+	return encoded, nil
+}
+
+// mustEncodePredictor applies a TIFF or PNG predictor to data, panicking
+// if the parameters are invalid: encoding parameters are set by the caller
+// and filters can't return errors when encoding
+func mustEncodePredictor(data []byte, p PredictorParams) []byte {
+	encoded, err := encodePredictor(data, p)
+	if err != nil {
+		panic(err)
+	}
+	return encoded
+}
+
+// decodePredictor removes a TIFF or PNG predictor from data
+func decodePredictor(data []byte, p PredictorParams) ([]byte, error) {
+	if p.Predictor != 2 && (p.Predictor < 10 || p.Predictor > 15) {
+		return nil, fmt.Errorf("unsupported predictor %d", p.Predictor)
+	}
+	bytesPerPixel, bytesPerRow, err := rowLayout(p, len(data))
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+
+	if p.Predictor == 2 {
+		decoded := make([]byte, 0, len(data))
+		for start := 0; start < len(data); start += bytesPerRow {
+			end := min(start+bytesPerRow, len(data))
+			decoded = append(decoded, tiffRow(data[start:end], p.Columns*p.Colors, p, true)...)
+		}
+		return decoded, nil
+	}
+
+	decoded := make([]byte, 0, len(data))
+	previous := make([]byte, bytesPerRow)
+	for start := 0; start < len(data); start += bytesPerRow + 1 {
+		filterType := data[start]
+		row := make([]byte, bytesPerRow)
+		copy(row, data[start+1:])
+		if err := pngUnfilterRow(row, previous, bytesPerPixel, filterType); err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, row...)
+		previous = row
+	}
+	return decoded, nil
+}
+
+// pngFilterRow writes into dst the row filtered with the given PNG filter type
+func pngFilterRow(dst, row, previous []byte, bytesPerPixel int, filterType byte) {
+	for i := range row {
+		var left, up, upLeft byte
+		if i >= bytesPerPixel {
+			left = row[i-bytesPerPixel]
+			upLeft = previous[i-bytesPerPixel]
+		}
+		up = previous[i]
+
+		switch filterType {
+		case 0:
+			dst[i] = row[i]
+		case 1:
+			dst[i] = row[i] - left
+		case 2:
+			dst[i] = row[i] - up
+		case 3:
+			dst[i] = row[i] - byte((int(left)+int(up))/2)
+		case 4:
+			dst[i] = row[i] - paeth(left, up, upLeft)
+		}
+	}
+}
+
+// pngUnfilterRow reverts in place the PNG filter applied to row
+func pngUnfilterRow(row, previous []byte, bytesPerPixel int, filterType byte) error {
+	if filterType > 4 {
+		return fmt.Errorf("invalid PNG predictor filter type %d", filterType)
+	}
+	for i := range row {
+		var left, up, upLeft byte
+		if i >= bytesPerPixel {
+			left = row[i-bytesPerPixel]
+			upLeft = previous[i-bytesPerPixel]
+		}
+		up = previous[i]
+
+		switch filterType {
+		case 1:
+			row[i] += left
+		case 2:
+			row[i] += up
+		case 3:
+			row[i] += byte((int(left) + int(up)) / 2)
+		case 4:
+			row[i] += paeth(left, up, upLeft)
+		}
+	}
+	return nil
+}
+
+// paeth returns the Paeth predictor of a pixel from its neighbours
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+// tiffRow applies (or reverts when decode is true) TIFF horizontal
+// differencing to a row of at most components samples, p having been
+// checked by rowLayout
+func tiffRow(row []byte, components int, p PredictorParams, decode bool) []byte {
+	bpc := uint(p.BitsPerComponent)
+	count := min(len(row)*8/int(bpc), components)
+
+	// Unpack components, MSB first
+	samples := make([]uint32, count)
+	for i := range samples {
+		var value uint32
+		for bit := uint(0); bit < bpc; bit++ {
+			position := uint(i)*bpc + bit
+			value = value<<1 | uint32(row[position/8]>>(7-position%8)&1)
+		}
+		samples[i] = value
+	}
+
+	mask := uint32(1)<<bpc - 1
+	if decode {
+		for i := p.Colors; i < count; i++ {
+			samples[i] = (samples[i] + samples[i-p.Colors]) & mask
+		}
+	} else {
+		for i := count - 1; i >= p.Colors; i-- {
+			samples[i] = (samples[i] - samples[i-p.Colors]) & mask
+		}
+	}
+
+	// Repack components, keeping padding bits of the original row
+	result := make([]byte, len(row))
+	copy(result, row)
+	for i, value := range samples {
+		for bit := uint(0); bit < bpc; bit++ {
+			position := uint(i)*bpc + bit
+			shift := 7 - position%8
+			result[position/8] &^= 1 << shift
+			result[position/8] |= byte(value>>(bpc-1-bit)&1) << shift
+		}
+	}
+	return result
+}
+
+// absInt returns the absolute value of x
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
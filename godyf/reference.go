@@ -0,0 +1,14 @@
+package godyf
+
+import "fmt"
+
+// Ref represents an indirect reference to a PDF object
+type Ref struct {
+	Number     int
+	Generation int
+}
+
+// Data returns the PDF representation of the reference
+func (r Ref) Data() []byte {
+	return []byte(fmt.Sprintf("%d %d R", r.Number, r.Generation))
+}
@@ -0,0 +1,114 @@
+package godyf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// srgbProfile is the profile returned by SRGBProfile, built once
+var srgbProfile = sync.OnceValue(buildSRGBProfile)
+
+// SRGBProfile returns a version 2 ICC profile of the sRGB IEC61966-2.1
+// color space, built without external files. Its primaries are adapted to
+// the D50 illuminant of the profile connection space, and its tone curves
+// are tables of 1024 values.
+func SRGBProfile() []byte {
+	return bytes.Clone(srgbProfile())
+}
+
+// NewSRGB returns an ICC-based color space embedding SRGBProfile
+func NewSRGB() *ICCBased {
+	icc, err := NewICCBased(SRGBProfile())
+	if err != nil {
+		panic(err) // The bundled profile is valid
+	}
+	return icc
+}
+
+// buildSRGBProfile returns the data of the sRGB profile
+func buildSRGBProfile() []byte {
+	// s15Fixed16 returns the ICC fixed-point representation of values
+	s15Fixed16 := func(values ...float64) []byte {
+		var data []byte
+		for _, value := range values {
+			data = binary.BigEndian.AppendUint32(data, uint32(int32(math.Round(value*65536))))
+		}
+		return data
+	}
+	// xyz returns an XYZ tag
+	xyz := func(x, y, z float64) []byte {
+		return append([]byte("XYZ \x00\x00\x00\x00"), s15Fixed16(x, y, z)...)
+	}
+
+	description := "sRGB IEC61966-2.1\x00"
+	desc := []byte("desc\x00\x00\x00\x00")
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(description)))
+	desc = append(desc, description...)
+	// Empty Unicode and ScriptCode descriptions
+	desc = append(desc, make([]byte, 4+4+2+1+67)...)
+
+	// sRGB transfer function, from encoded values to linear values
+	trc := []byte("curv\x00\x00\x00\x00")
+	const points = 1024
+	trc = binary.BigEndian.AppendUint32(trc, points)
+	for i := 0; i < points; i++ {
+		value := float64(i) / (points - 1)
+		if value <= 0.04045 {
+			value /= 12.92
+		} else {
+			value = math.Pow((value+0.055)/1.055, 2.4)
+		}
+		trc = binary.BigEndian.AppendUint16(trc, uint16(math.Round(value*65535)))
+	}
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", desc},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // Version 2.1
+	copy(header[12:], "mntrRGB XYZ ")
+	for i, value := range []uint16{2024, 1, 1} { // Creation date
+		binary.BigEndian.PutUint16(header[24+2*i:], value)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], s15Fixed16(0.9642, 1, 0.8249)) // D50 illuminant
+
+	// Tag table, followed by tag data aligned on 4 bytes, identical data
+	// being shared
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	offset := len(header) + 4 + 12*len(tags)
+	var data []byte
+	offsets := make(map[string]int)
+	for _, tag := range tags {
+		start, ok := offsets[string(tag.data)]
+		if !ok {
+			start = offset + len(data)
+			offsets[string(tag.data)] = start
+			data = append(data, tag.data...)
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+		}
+		table = append(table, tag.signature...)
+		table = binary.BigEndian.AppendUint32(table, uint32(start))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+	}
+
+	profile := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
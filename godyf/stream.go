@@ -2,8 +2,6 @@ package godyf
 
 import (
 	"bytes"
-	"compress/zlib"
-	"encoding/base64"
 	"fmt"
 )
 
@@ -12,7 +10,9 @@ type Stream struct {
 	Object
 	Stream   []interface{}          // Array of data composing stream
 	Extra    map[string]interface{} // Metadata containing at least the length of the Stream
-	Compress bool                   // Compress the stream data if set to true
+	Compress bool                   // Compress the stream data with a default FlateFilter if set to true
+	ASCII85  bool                   // ASCII85-encode the stream data for 7-bit clean output if set to true
+	Filters  []Filter               // Additional filters, in /Filter order, applied after Compress and ASCII85
 }
 
 // NewStream creates a new Stream object
@@ -39,6 +39,13 @@ func (s *Stream) Compressible() bool {
 
 // Data returns the PDF representation of the stream
 func (s *Stream) Data() []byte {
+	return s.DataWithLevel(0)
+}
+
+// DataWithLevel returns the PDF representation of the stream, compressed
+// with the given zlib level when Compress is set. As for FlateFilter, 0
+// means zlib.DefaultCompression.
+func (s *Stream) DataWithLevel(level int) []byte {
 	// Join all stream elements with newlines
 	var streamData bytes.Buffer
 	for i, item := range s.Stream {
@@ -56,14 +63,17 @@ func (s *Stream) Data() []byte {
 		extra[k] = v
 	}
 
-	// Compress if requested
-	if s.Compress {
-		extra["Filter"] = "/FlateDecode"
-		var buf bytes.Buffer
-		writer := zlib.NewWriter(&buf)
-		writer.Write(stream)
-		writer.Close()
-		stream = buf.Bytes()
+	// Encode with the filter chain, the last filter being applied first
+	filters := s.filters(level)
+	for i := len(filters) - 1; i >= 0; i-- {
+		stream = filters[i].Encode(stream)
+	}
+	if len(filters) > 0 {
+		filter, params := filterEntries(filters)
+		extra["Filter"] = filter
+		if params != nil {
+			extra["DecodeParms"] = params
+		}
 	}
 
 	// Set length
@@ -82,6 +92,72 @@ func (s *Stream) Data() []byte {
 	return result.Bytes()
 }
 
+// DecodedData returns the stream content decoded with the filters listed in
+// its /Filter extra entry. This is how streams read from existing documents,
+// whose content is kept encoded, are decoded.
+func (s *Stream) DecodedData() ([]byte, error) {
+	var content bytes.Buffer
+	for i, item := range s.Stream {
+		if i > 0 {
+			content.WriteByte('\n')
+		}
+		content.Write(ToBytes(item))
+	}
+
+	filters, err := FiltersFromEntries(s.Extra["Filter"], s.Extra["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+	data := content.Bytes()
+	for _, filter := range filters {
+		if data, err = filter.Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// filters returns the filter chain of the stream, in /Filter order, level
+// being the compression level of the default FlateFilter
+func (s *Stream) filters(level int) []Filter {
+	var filters []Filter
+	if s.ASCII85 {
+		filters = append(filters, ASCII85Filter{})
+	}
+	if s.Compress {
+		filters = append(filters, &FlateFilter{Level: level})
+	}
+	return append(filters, s.Filters...)
+}
+
+// filterEntries returns the /Filter and /DecodeParms values for a filter chain.
+// The /DecodeParms value is nil when no filter has parameters.
+func filterEntries(filters []Filter) (interface{}, interface{}) {
+	if len(filters) == 1 {
+		if params := filters[0].Params(); params != nil {
+			return filters[0].Name(), params
+		}
+		return filters[0].Name(), nil
+	}
+
+	names := NewArray()
+	params := NewArray()
+	hasParams := false
+	for _, filter := range filters {
+		names.Add(filter.Name())
+		if p := filter.Params(); p != nil {
+			params.Add(p)
+			hasParams = true
+		} else {
+			params.Add(Null{})
+		}
+	}
+	if !hasParams {
+		return names, nil
+	}
+	return names, params
+}
+
 // BeginMarkedContent begins marked-content sequence
 func (s *Stream) BeginMarkedContent(tag string, propertyList interface{}) {
 	s.Stream = append(s.Stream, "/"+tag)
@@ -184,19 +260,13 @@ func (s *Stream) GetObject() *Object {
 
 // InlineImage adds an inline image
 func (s *Stream) InlineImage(width, height int, colorSpace string, bpc int, rawData []byte) {
-	var data []byte
+	data := rawData
 	if s.Compress {
-		var buf bytes.Buffer
-		writer := zlib.NewWriter(&buf)
-		writer.Write(rawData)
-		writer.Close()
-		data = buf.Bytes()
-	} else {
-		data = rawData
+		data = (&FlateFilter{}).Encode(data)
 	}
 
 	// ASCII85 encode the data
-	a85Data := base64.StdEncoding.EncodeToString(data) + "~>"
+	a85Data := ASCII85Filter{}.Encode(data)
 
 	var filter string
 	if s.Compress {
@@ -312,6 +382,19 @@ func (s *Stream) SetFontSize(font string, size float64) {
 	s.Stream = append(s.Stream, fmt.Sprintf("/%s %s Tf", font, ToBytes(size)))
 }
 
+// SetGlyphWidth sets the width of a Type 3 glyph drawing its own colors,
+// at the start of its content stream
+func (s *Stream) SetGlyphWidth(wx, wy float64) {
+	s.Stream = append(s.Stream, fmt.Sprintf("%s %s d0", ToBytes(wx), ToBytes(wy)))
+}
+
+// SetGlyphWidthAndBoundingBox sets the width and the bounding box of a Type
+// 3 glyph painted with the current color, at the start of its content stream
+func (s *Stream) SetGlyphWidthAndBoundingBox(wx, wy, llx, lly, urx, ury float64) {
+	s.Stream = append(s.Stream, fmt.Sprintf("%s %s %s %s %s %s d1",
+		ToBytes(wx), ToBytes(wy), ToBytes(llx), ToBytes(lly), ToBytes(urx), ToBytes(ury)))
+}
+
 // SetTextRendering sets text rendering mode
 func (s *Stream) SetTextRendering(mode int) {
 	s.Stream = append(s.Stream, fmt.Sprintf("%d Tr", mode))
@@ -359,11 +442,27 @@ func (s *Stream) SetTextMatrix(a, b, c, d, e, f float64) {
 		ToBytes(a), ToBytes(b), ToBytes(c), ToBytes(d), ToBytes(e), ToBytes(f)))
 }
 
-// ShowText shows text strings with individual glyph positioning
+// ShowText shows text strings with individual glyph positioning. Text is
+// the content of the TJ array, such as the strings of EncodedText separated
+// by glyph position adjustments.
 func (s *Stream) ShowText(text string) {
 	s.Stream = append(s.Stream, fmt.Sprintf("[%s] TJ", ToBytes(text)))
 }
 
+// TextEncoder is implemented by fonts that encode text for text-showing
+// operators, such as fonts embedded from font files
+type TextEncoder interface {
+	// EncodeText returns the character codes showing text with the font
+	EncodeText(text string) []byte
+}
+
+// EncodedText returns text encoded by font as a hexadecimal string, two
+// bytes per glyph for composite fonts, to be shown by ShowText when font is
+// the current font
+func EncodedText(font TextEncoder, text string) string {
+	return fmt.Sprintf("<%x>", font.EncodeText(text))
+}
+
 // ShowTextString shows single text string
 func (s *Stream) ShowTextString(text string) {
 	str := NewString(text)
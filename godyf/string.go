@@ -7,10 +7,18 @@ import (
 	"unicode/utf16"
 )
 
-// String represents a PDF String object
+// String represents a PDF String object.
+//
+// Strings read from existing documents keep their original bytes in Raw,
+// written as long as String is left unchanged: assigning String writes the
+// new text instead, and assigning Raw writes the new bytes. Strings created
+// otherwise should set only one of String and Raw.
 type String struct {
 	Object
 	String string // Unicode string content
+	Raw    []byte // Raw byte content, written instead of String when not nil and String is unchanged
+
+	rawString string // Value of String when Raw was set by NewByteString
 }
 
 // NewString creates a new String object with the given string content
@@ -21,8 +29,62 @@ func NewString(s string) *String {
 	}
 }
 
+// NewByteString creates a new String object holding raw bytes, as read from
+// an existing document. String is set to the bytes decoded as a text string.
+func NewByteString(raw []byte) *String {
+	decoded := DecodeTextString(raw)
+	return &String{
+		Object:    *NewObject(),
+		String:    decoded,
+		Raw:       raw,
+		rawString: decoded,
+	}
+}
+
+// DecodeTextString decodes the bytes of a PDF text string, encoded either in
+// UTF-16BE or UTF-8 with a byte order mark, or in PDFDocEncoding
+func DecodeTextString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2-1)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(raw) >= 3 && raw[0] == 0xEF && raw[1] == 0xBB && raw[2] == 0xBF {
+		return string(raw[3:])
+	}
+
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		if r, ok := pdfDocEncoding[b]; ok {
+			runes[i] = r
+		} else {
+			runes[i] = rune(b)
+		}
+	}
+	return string(runes)
+}
+
+// pdfDocEncoding maps PDFDocEncoding bytes that differ from Latin-1 to runes
+var pdfDocEncoding = map[byte]rune{
+	0x18: '\u02D8', 0x19: '\u02C7', 0x1A: '\u02C6', 0x1B: '\u02D9',
+	0x1C: '\u02DD', 0x1D: '\u02DB', 0x1E: '\u02DA', 0x1F: '\u02DC',
+	0x80: '\u2022', 0x81: '\u2020', 0x82: '\u2021', 0x83: '\u2026',
+	0x84: '\u2014', 0x85: '\u2013', 0x86: '\u0192', 0x87: '\u2044',
+	0x88: '\u2039', 0x89: '\u203A', 0x8A: '\u2212', 0x8B: '\u2030',
+	0x8C: '\u201E', 0x8D: '\u201C', 0x8E: '\u201D', 0x8F: '\u2018',
+	0x90: '\u2019', 0x91: '\u201A', 0x92: '\u2122', 0x93: '\uFB01',
+	0x94: '\uFB02', 0x95: '\u0141', 0x96: '\u0152', 0x97: '\u0160',
+	0x98: '\u0178', 0x99: '\u017D', 0x9A: '\u0131', 0x9B: '\u0142',
+	0x9C: '\u0153', 0x9D: '\u0161', 0x9E: '\u017E', 0xA0: '\u20AC',
+}
+
 // Data returns the PDF representation of the string
 func (s *String) Data() []byte {
+	if s.Raw != nil && s.String == s.rawString {
+		return s.rawData()
+	}
 	// Try literal string encoding first (like Python's try-except approach)
 	if s.canBeLiteralString() {
 		return s.literalStringData()
@@ -83,6 +145,31 @@ func (s *String) hexStringData() []byte {
 	return buf.Bytes()
 }
 
+// rawData returns the representation of the raw bytes, as a literal string
+// when they are all printable ASCII characters and as a hex string otherwise
+func (s *String) rawData() []byte {
+	for _, b := range s.Raw {
+		if b < 32 || b > 126 {
+			var buf bytes.Buffer
+			buf.WriteByte('<')
+			buf.WriteString(hex.EncodeToString(s.Raw))
+			buf.WriteByte('>')
+			return buf.Bytes()
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, b := range s.Raw {
+		if b == '\\' || b == '(' || b == ')' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(b)
+	}
+	buf.WriteByte(')')
+	return buf.Bytes()
+}
+
 // GetObject returns the underlying Object struct
 func (s *String) GetObject() *Object {
 	return &s.Object
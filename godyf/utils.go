@@ -12,6 +12,10 @@ type ByteData interface {
 
 func ToBytes(item interface{}) []byte {
 	switch v := item.(type) {
+	case nil:
+		return Null{}.Data()
+	case bool:
+		return Bool(v).Data()
 	case []byte:
 		return v
 	case string:
@@ -0,0 +1,157 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// NewImageFromBMP returns an image read from uncompressed BMP data.
+//
+// Images of 1, 4 and 8 bits per pixel keep their rows of indices with an
+// /Indexed color space made of their palette. Images of 24 and 32 bits per
+// pixel use RGB, the alpha channel of 32-bit images with an alpha mask
+// being split into a soft mask. Bottom-up and top-down images are
+// supported.
+func NewImageFromBMP(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 26 || !bytes.HasPrefix(data, []byte("BM")) {
+		return nil, fmt.Errorf("invalid BMP signature")
+	}
+	dataOffset := int(binary.LittleEndian.Uint32(data[10:]))
+	headerSize := int(binary.LittleEndian.Uint32(data[14:]))
+	if headerSize < 12 || 14+headerSize > len(data) {
+		return nil, fmt.Errorf("truncated BMP header")
+	}
+	header := data[14 : 14+headerSize]
+
+	// Core headers have 16-bit sizes and 3-byte palette entries
+	var width, height, depth, compression, colors int
+	entrySize := 4
+	if headerSize == 12 {
+		width = int(binary.LittleEndian.Uint16(header[4:]))
+		height = int(binary.LittleEndian.Uint16(header[6:]))
+		depth = int(binary.LittleEndian.Uint16(header[10:]))
+		entrySize = 3
+	} else {
+		if headerSize < 40 {
+			return nil, fmt.Errorf("invalid BMP header size %d", headerSize)
+		}
+		width = int(int32(binary.LittleEndian.Uint32(header[4:])))
+		height = int(int32(binary.LittleEndian.Uint32(header[8:])))
+		depth = int(binary.LittleEndian.Uint16(header[14:]))
+		compression = int(binary.LittleEndian.Uint32(header[16:]))
+		colors = int(binary.LittleEndian.Uint32(header[32:]))
+	}
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid BMP size %dx%d", width, height)
+	}
+
+	// Masks of the red, green, blue and alpha channels of 32-bit pixels,
+	// following info headers or included in larger headers
+	masks := [4]uint32{0xFF0000, 0xFF00, 0xFF, 0}
+	switch {
+	case compression == 3 && depth == 32:
+		fields := header[40:]
+		if headerSize == 40 {
+			if 14+headerSize+12 > len(data) {
+				return nil, fmt.Errorf("truncated BMP header")
+			}
+			fields = data[14+headerSize : 14+headerSize+12]
+		} else if len(fields) < 12 {
+			return nil, fmt.Errorf("invalid BMP header size %d", headerSize)
+		}
+		for i := 0; i < 3 || (i < 4 && len(fields) >= 16); i++ {
+			masks[i] = binary.LittleEndian.Uint32(fields[4*i:])
+		}
+	case compression != 0:
+		return nil, fmt.Errorf("unsupported BMP compression %d", compression)
+	}
+
+	rowSize := (width*depth + 31) / 32 * 4
+	if rowSize > len(data) || height > len(data) || dataOffset < 14+headerSize || dataOffset+rowSize*height > len(data) {
+		return nil, fmt.Errorf("truncated BMP data")
+	}
+	// row returns the pixels of the row at y from the top
+	row := func(y int) []byte {
+		if !topDown {
+			y = height - 1 - y
+		}
+		return data[dataOffset+y*rowSize : dataOffset+(y+1)*rowSize]
+	}
+
+	img := &Image{Width: width, Height: height}
+	switch depth {
+	case 1, 4, 8:
+		// Palette entries are stored as blue, green, red and padding bytes
+		if colors <= 0 || colors > 1<<depth {
+			colors = 1 << depth
+		}
+		start := 14 + headerSize
+		colors = min(colors, (dataOffset-start)/entrySize)
+		palette := make([]byte, 0, 3*colors)
+		for i := 0; i < colors; i++ {
+			entry := data[start+entrySize*i:]
+			palette = append(palette, entry[2], entry[1], entry[0])
+		}
+		packedSize := (width*depth + 7) / 8
+		rows := make([]byte, 0, packedSize*height)
+		for y := 0; y < height; y++ {
+			rows = append(rows, row(y)[:packedSize]...)
+		}
+		img.Stream = indexedImage(width, height, palette, depth, rows)
+	case 24, 32:
+		samples := make([]byte, 0, 3*width*height)
+		alpha := make([]byte, 0, width*height)
+		opaque := true
+		for y := 0; y < height; y++ {
+			pixels := row(y)
+			for x := 0; x < width; x++ {
+				if depth == 24 {
+					samples = append(samples, pixels[3*x+2], pixels[3*x+1], pixels[3*x])
+					continue
+				}
+				pixel := binary.LittleEndian.Uint32(pixels[4*x:])
+				for _, mask := range masks[:3] {
+					samples = append(samples, maskedValue(pixel, mask))
+				}
+				if masks[3] != 0 {
+					value := maskedValue(pixel, masks[3])
+					alpha = append(alpha, value)
+					opaque = opaque && value == 0xFF
+				}
+			}
+		}
+		img.Stream = sampledImage(width, height, godyf.Name("DeviceRGB"), 3, 8, samples)
+		if !opaque {
+			img.SMask = sampledImage(width, height, godyf.Name("DeviceGray"), 1, 8, alpha)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported BMP depth of %d bits", depth)
+	}
+	return img, nil
+}
+
+// maskedValue returns the bits of pixel selected by mask, scaled to 8 bits
+func maskedValue(pixel, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	size := bits.OnesCount32(mask)
+	value := (pixel & mask) >> bits.TrailingZeros32(mask)
+	if size >= 8 {
+		return byte(value >> (size - 8))
+	}
+	return byte(value * 0xFF / (1<<size - 1))
+}
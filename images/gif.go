@@ -0,0 +1,51 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// NewImageFromGIF returns an image made of the first frame of GIF data.
+// The palette gives an /Indexed color space of the smallest depth for its
+// size, and the transparent color gives a /Mask color key.
+func NewImageFromGIF(r io.Reader) (*Image, error) {
+	decoded, err := gif.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	paletted, ok := decoded.(*image.Paletted)
+	if !ok {
+		return nil, fmt.Errorf("unsupported GIF image type %T", decoded)
+	}
+	bounds := paletted.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("invalid GIF size %dx%d", width, height)
+	}
+
+	palette := make([]byte, 0, 3*len(paletted.Palette))
+	transparent := -1
+	for i, c := range paletted.Palette {
+		nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+		palette = append(palette, nrgba.R, nrgba.G, nrgba.B)
+		if nrgba.A == 0 && transparent < 0 {
+			transparent = i
+		}
+	}
+	indices := make([]byte, 0, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		indices = append(indices, paletted.Pix[paletted.PixOffset(bounds.Min.X, y):paletted.PixOffset(bounds.Max.X, y)]...)
+	}
+	rows, bits := packIndices(indices, width, len(paletted.Palette))
+
+	img := &Image{Width: width, Height: height, Stream: indexedImage(width, height, palette, bits, rows)}
+	if transparent >= 0 {
+		img.Stream.Extra["Mask"] = godyf.NewArray(transparent, transparent)
+	}
+	return img, nil
+}
@@ -0,0 +1,355 @@
+// Package images builds image XObjects from image files and Go images, to
+// be drawn on pages with godyf.Stream.DrawXObject.
+package images
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// Image is an image XObject, with the soft mask giving its transparency.
+// It is added to documents with pdf.PDF.AddResource, whose returned
+// reference is the image XObject.
+type Image struct {
+	// Size of the image, in pixels
+	Width, Height int
+	// EXIF orientation of the image, from 1 for upright images to 8, 0
+	// being the same as 1
+	Orientation int
+	// Image XObject
+	Stream *godyf.Stream
+	// Soft mask image XObject, nil for opaque images
+	SMask *godyf.Stream
+}
+
+// Options are the options used to build images from Go images
+type Options struct {
+	// Size of the image once drawn, in points, used with DPI to downsample
+	// the image. Each dimension is kept if 0.
+	Width, Height float64
+	// Maximum resolution of the image once drawn, in dots per inch, 0 to
+	// keep all the pixels
+	DPI float64
+}
+
+// Objects returns the objects of the image: the image XObject, followed by
+// its soft mask if any
+func (i *Image) Objects() []godyf.PDFObject {
+	if i.SMask == nil {
+		return []godyf.PDFObject{i.Stream}
+	}
+	return []godyf.PDFObject{i.Stream, i.SMask}
+}
+
+// Finish references the soft mask from the image XObject
+func (i *Image) Finish() error {
+	if i.SMask != nil {
+		i.Stream.Extra["SMask"] = i.SMask.Ref()
+	}
+	return nil
+}
+
+// DisplaySize returns the size of the image in pixels once drawn upright,
+// the width and the height being swapped for rotated orientations
+func (i *Image) DisplaySize() (int, int) {
+	if i.Orientation >= 5 && i.Orientation <= 8 {
+		return i.Height, i.Width
+	}
+	return i.Width, i.Height
+}
+
+// Matrix returns the transformation matrix drawing the image upright in the
+// rectangle of the given position and size, to be given to
+// godyf.Stream.SetMatrix before drawing the image XObject
+func (i *Image) Matrix(x, y, width, height float64) [6]float64 {
+	switch i.Orientation {
+	case 2: // Mirrored horizontally
+		return [6]float64{-width, 0, 0, height, x + width, y}
+	case 3: // Rotated by 180°
+		return [6]float64{-width, 0, 0, -height, x + width, y + height}
+	case 4: // Mirrored vertically
+		return [6]float64{width, 0, 0, -height, x, y + height}
+	case 5: // Transposed
+		return [6]float64{0, -height, -width, 0, x + width, y + height}
+	case 6: // Rotated by 90° clockwise
+		return [6]float64{0, -height, width, 0, x, y + height}
+	case 7: // Transversed
+		return [6]float64{0, height, width, 0, x, y}
+	case 8: // Rotated by 90° counterclockwise
+		return [6]float64{0, height, -width, 0, x + width, y}
+	}
+	return [6]float64{width, 0, 0, height, x, y}
+}
+
+// Draw draws the image XObject called name in the resources upright in the
+// rectangle of the given position and size
+func (i *Image) Draw(stream *godyf.Stream, name string, x, y, width, height float64) {
+	matrix := i.Matrix(x, y, width, height)
+	stream.PushState()
+	stream.SetMatrix(matrix[0], matrix[1], matrix[2], matrix[3], matrix[4], matrix[5])
+	stream.DrawXObject(name)
+	stream.PopState()
+}
+
+// NewImage returns an image made of the pixels of img.
+//
+// Grayscale and CMYK images keep their color space, paletted images keep
+// their palette as an /Indexed color space, and other images use RGB.
+// Images of 16 bits per component keep their depth, other images use 8
+// bits. Samples are compressed with Flate and the PNG predictor, and a soft
+// mask is added if the image isn't opaque.
+//
+// Images with more pixels than needed by options are downsampled, averaging
+// the colors of the merged pixels, or keeping one of them for paletted
+// images.
+func NewImage(img image.Image, options Options) *Image {
+	bits := 8
+	switch img.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		bits = 16
+	}
+	model := img.ColorModel()
+	gray := model == color.GrayModel || model == color.Gray16Model
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if options.DPI > 0 && options.Width > 0 {
+		width = min(width, int(math.Ceil(options.Width*options.DPI/72)))
+	}
+	if options.DPI > 0 && options.Height > 0 {
+		height = min(height, int(math.Ceil(options.Height*options.DPI/72)))
+	}
+	if width != bounds.Dx() || height != bounds.Dy() {
+		img = downsample(img, max(width, 1), max(height, 1))
+	}
+
+	if cmyk, ok := img.(*image.CMYK); ok {
+		bounds := cmyk.Bounds()
+		samples := make([]byte, 0, 4*bounds.Dx()*bounds.Dy())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			samples = append(samples, cmyk.Pix[cmyk.PixOffset(bounds.Min.X, y):cmyk.PixOffset(bounds.Max.X, y)]...)
+		}
+		return &Image{
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			Stream: sampledImage(bounds.Dx(), bounds.Dy(), godyf.Name("DeviceCMYK"), 4, 8, samples),
+		}
+	}
+	return newImage(img, gray, bits)
+}
+
+// downsample returns img scaled down to the given size. Paletted images
+// keep the nearest pixel, CMYK images average their components, and other
+// images average their premultiplied colors.
+func downsample(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	rectangle := image.Rect(0, 0, width, height)
+	// area returns the source rectangle covered by the pixel at x, y
+	area := func(x, y int) image.Rectangle {
+		x0 := bounds.Min.X + x*bounds.Dx()/width
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		return image.Rect(x0, y0, x1, y1)
+	}
+
+	switch source := img.(type) {
+	case *image.Paletted:
+		result := image.NewPaletted(rectangle, source.Palette)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				center := area(x, y)
+				result.SetColorIndex(x, y, source.ColorIndexAt((center.Min.X+center.Max.X-1)/2, (center.Min.Y+center.Max.Y-1)/2))
+			}
+		}
+		return result
+	case *image.CMYK:
+		result := image.NewCMYK(rectangle)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				var sum [4]int
+				pixels := area(x, y)
+				for sy := pixels.Min.Y; sy < pixels.Max.Y; sy++ {
+					for sx := pixels.Min.X; sx < pixels.Max.X; sx++ {
+						c := source.CMYKAt(sx, sy)
+						sum[0] += int(c.C)
+						sum[1] += int(c.M)
+						sum[2] += int(c.Y)
+						sum[3] += int(c.K)
+					}
+				}
+				count := pixels.Dx() * pixels.Dy()
+				result.SetCMYK(x, y, color.CMYK{
+					C: uint8((sum[0] + count/2) / count),
+					M: uint8((sum[1] + count/2) / count),
+					Y: uint8((sum[2] + count/2) / count),
+					K: uint8((sum[3] + count/2) / count),
+				})
+			}
+		}
+		return result
+	}
+
+	result := image.NewRGBA64(rectangle)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]int
+			pixels := area(x, y)
+			for sy := pixels.Min.Y; sy < pixels.Max.Y; sy++ {
+				for sx := pixels.Min.X; sx < pixels.Max.X; sx++ {
+					r, g, b, a := img.At(sx, sy).RGBA()
+					sum[0] += int(r)
+					sum[1] += int(g)
+					sum[2] += int(b)
+					sum[3] += int(a)
+				}
+			}
+			count := pixels.Dx() * pixels.Dy()
+			result.SetRGBA64(x, y, color.RGBA64{
+				R: uint16((sum[0] + count/2) / count),
+				G: uint16((sum[1] + count/2) / count),
+				B: uint16((sum[2] + count/2) / count),
+				A: uint16((sum[3] + count/2) / count),
+			})
+		}
+	}
+	return result
+}
+
+// imageStream returns an image XObject without data, of the given size,
+// color space and depth
+func imageStream(width, height int, colorSpace interface{}, bits int) *godyf.Stream {
+	return godyf.NewStream(nil, map[string]interface{}{
+		"Type":             godyf.Name("XObject"),
+		"Subtype":          godyf.Name("Image"),
+		"Width":            width,
+		"Height":           height,
+		"ColorSpace":       colorSpace,
+		"BitsPerComponent": bits,
+	}, false)
+}
+
+// sampledImage returns an image XObject made of samples with colors
+// components of bits each, compressed with Flate and the PNG predictor
+func sampledImage(width, height int, colorSpace interface{}, colors, bits int, samples []byte) *godyf.Stream {
+	stream := imageStream(width, height, colorSpace, bits)
+	stream.Stream = []interface{}{samples}
+	stream.Filters = []godyf.Filter{&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{
+		Predictor:        15,
+		Colors:           colors,
+		BitsPerComponent: bits,
+		Columns:          width,
+	}}}
+	return stream
+}
+
+// indexedImage returns an image XObject with an /Indexed color space made
+// of palette, RGB values for at most 256 colors, and of rows of packed
+// indices of bits each. The palette is padded with black to cover all the
+// indices.
+func indexedImage(width, height int, palette []byte, bits int, rows []byte) *godyf.Stream {
+	if len(palette) < 3<<bits {
+		palette = append(palette[:len(palette):len(palette)], make([]byte, 3<<bits-len(palette))...)
+	}
+	colorSpace := godyf.NewArray(godyf.Name("Indexed"), godyf.Name("DeviceRGB"), len(palette)/3-1, godyf.NewByteString(palette))
+	return sampledImage(width, height, colorSpace, 1, bits, rows)
+}
+
+// packIndices returns rows of indices of one byte packed with bits per
+// index, the smallest depth covering colors indices
+func packIndices(indices []byte, width, colors int) ([]byte, int) {
+	bits := 1
+	for 1<<bits < colors {
+		bits *= 2
+	}
+	if bits == 8 {
+		return indices, bits
+	}
+	rowSize := (width*bits + 7) / 8
+	rows := make([]byte, rowSize*(len(indices)/width))
+	for i, index := range indices {
+		x, y := i%width, i/width
+		position := x * bits
+		rows[y*rowSize+position/8] |= index << (8 - bits - position%8)
+	}
+	return rows, bits
+}
+
+// newImage returns an image made of the pixels of img, with gray or RGB
+// samples of 8 or 16 bits, paletted images keeping their palette as an
+// /Indexed color space. A soft mask of the same depth is added if img isn't
+// opaque.
+func newImage(img image.Image, gray bool, bits int) *Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	result := &Image{Width: width, Height: height}
+	var alpha []byte
+	opaque := true
+
+	if paletted, ok := img.(*image.Paletted); ok {
+		// Indices are kept, with the colors and the alpha of the palette
+		palette := make([]byte, 0, 3*len(paletted.Palette))
+		alphas := make([]byte, len(paletted.Palette))
+		for i, c := range paletted.Palette {
+			nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+			palette = append(palette, nrgba.R, nrgba.G, nrgba.B)
+			alphas[i] = nrgba.A
+		}
+		indices := make([]byte, 0, width*height)
+		alpha = make([]byte, 0, width*height)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			row := paletted.Pix[paletted.PixOffset(bounds.Min.X, y):paletted.PixOffset(bounds.Max.X, y)]
+			indices = append(indices, row...)
+			for _, index := range row {
+				value := byte(0)
+				if int(index) < len(alphas) {
+					value = alphas[index]
+				}
+				alpha = append(alpha, value)
+				opaque = opaque && value == 0xFF
+			}
+		}
+		colorSpace := godyf.NewArray(godyf.Name("Indexed"), godyf.Name("DeviceRGB"), max(len(paletted.Palette)-1, 0), godyf.NewByteString(palette))
+		result.Stream = sampledImage(width, height, colorSpace, 1, 8, indices)
+		bits = 8
+	} else {
+		colors, colorSpace := 3, godyf.Name("DeviceRGB")
+		if gray {
+			colors, colorSpace = 1, godyf.Name("DeviceGray")
+		}
+		size := bits / 8
+		samples := make([]byte, 0, width*height*colors*size)
+		alpha = make([]byte, 0, width*height*size)
+		// appendValue appends a 16-bit value with the image depth
+		appendValue := func(data []byte, value uint16) []byte {
+			if size == 2 {
+				return append(data, byte(value>>8), byte(value))
+			}
+			return append(data, byte(value>>8))
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+				if gray {
+					opaqueColor := color.NRGBA64{R: c.R, G: c.G, B: c.B, A: 0xFFFF}
+					samples = appendValue(samples, color.Gray16Model.Convert(opaqueColor).(color.Gray16).Y)
+				} else {
+					samples = appendValue(samples, c.R)
+					samples = appendValue(samples, c.G)
+					samples = appendValue(samples, c.B)
+				}
+				alpha = appendValue(alpha, c.A)
+				opaque = opaque && c.A>>(16-bits) == 1<<bits-1
+			}
+		}
+		result.Stream = sampledImage(width, height, colorSpace, colors, bits, samples)
+	}
+
+	if !opaque {
+		result.SMask = sampledImage(width, height, godyf.Name("DeviceGray"), 1, bits, alpha)
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// NewImageFromJPEG returns an image read from JPEG data, embedded unchanged
+// with the DCTDecode filter. Its size and color space are read from the
+// frame header: grayscale, RGB or CMYK, CMYK images written by Adobe
+// applications being inverted with /Decode. The EXIF orientation is kept,
+// to be applied by Matrix and Draw.
+func NewImageFromJPEG(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return nil, fmt.Errorf("invalid JPEG signature")
+	}
+
+	img := &Image{Orientation: 1}
+	components, precision := 0, 0
+	adobe := false
+	for offset := 2; components == 0; {
+		// Markers may be preceded by fill bytes
+		start := offset
+		for offset < len(data) && data[offset] == 0xFF {
+			offset++
+		}
+		if offset == start || offset >= len(data) {
+			return nil, fmt.Errorf("invalid JPEG marker")
+		}
+		marker := data[offset]
+		offset++
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue // Standalone markers
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			return nil, fmt.Errorf("JPEG data has no frame header")
+		}
+		if offset+2 > len(data) {
+			return nil, fmt.Errorf("truncated JPEG data")
+		}
+		length := int(binary.BigEndian.Uint16(data[offset:]))
+		if length < 2 || offset+length > len(data) {
+			return nil, fmt.Errorf("truncated JPEG data")
+		}
+		segment := data[offset+2 : offset+length]
+		offset += length
+
+		switch {
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			// Start of frame
+			if len(segment) < 6 {
+				return nil, fmt.Errorf("invalid JPEG frame header")
+			}
+			precision = int(segment[0])
+			img.Height = int(binary.BigEndian.Uint16(segment[1:]))
+			img.Width = int(binary.BigEndian.Uint16(segment[3:]))
+			components = int(segment[5])
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			if orientation := exifOrientation(segment[6:]); orientation >= 1 && orientation <= 8 {
+				img.Orientation = orientation
+			}
+		case marker == 0xEE && bytes.HasPrefix(segment, []byte("Adobe")):
+			adobe = true
+		}
+	}
+	if precision != 8 {
+		return nil, fmt.Errorf("unsupported JPEG precision of %d bits", precision)
+	}
+	if img.Width == 0 || img.Height == 0 {
+		return nil, fmt.Errorf("invalid JPEG size %dx%d", img.Width, img.Height)
+	}
+
+	var colorSpace godyf.Name
+	switch components {
+	case 1:
+		colorSpace = "DeviceGray"
+	case 3:
+		colorSpace = "DeviceRGB"
+	case 4:
+		colorSpace = "DeviceCMYK"
+	default:
+		return nil, fmt.Errorf("unsupported JPEG with %d components", components)
+	}
+	img.Stream = imageStream(img.Width, img.Height, colorSpace, precision)
+	img.Stream.Stream = []interface{}{data}
+	img.Stream.Filters = []godyf.Filter{&godyf.PassthroughFilter{FilterName: "DCTDecode"}}
+	if adobe && components == 4 {
+		img.Stream.Extra["Decode"] = godyf.NewArray(1, 0, 1, 0, 1, 0, 1, 0)
+	}
+	return img, nil
+}
+
+// exifOrientation returns the orientation tag of the first image file
+// directory of EXIF data, 0 if missing
+func exifOrientation(data []byte) int {
+	if len(data) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	directory := int(order.Uint32(data[4:]))
+	if directory < 8 || directory+2 > len(data) {
+		return 0
+	}
+	count := int(order.Uint16(data[directory:]))
+	for i := 0; i < count; i++ {
+		entry := directory + 2 + 12*i
+		if entry+12 > len(data) {
+			break
+		}
+		if order.Uint16(data[entry:]) == 0x0112 {
+			return int(order.Uint16(data[entry+8:]))
+		}
+	}
+	return 0
+}
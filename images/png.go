@@ -0,0 +1,126 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image/png"
+	"io"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// pngSignature starts PNG files
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// NewImageFromPNG returns an image read from PNG data.
+//
+// The compressed data of non-interlaced grayscale, RGB and palette images is
+// embedded unchanged with the PNG predictor, palettes giving /Indexed color
+// spaces and transparent colors giving /Mask color keys. Other images, with
+// an alpha channel, a transparent palette or interlacing, are decoded and
+// compressed again, their alpha channel being split into a soft mask.
+// Images of 16 bits per component keep their depth.
+func NewImageFromPNG(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, fmt.Errorf("invalid PNG signature")
+	}
+
+	var header, palette, transparency []byte
+	var idat bytes.Buffer
+	for offset := len(pngSignature); ; {
+		if offset+12 > len(data) {
+			return nil, fmt.Errorf("truncated PNG data")
+		}
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		if length < 0 || offset+12+length > len(data) {
+			return nil, fmt.Errorf("truncated PNG data")
+		}
+		kind := string(data[offset+4 : offset+8])
+		chunk := data[offset+8 : offset+8+length]
+		if crc32.ChecksumIEEE(data[offset+4:offset+8+length]) != binary.BigEndian.Uint32(data[offset+8+length:]) {
+			return nil, fmt.Errorf("invalid checksum for PNG chunk %s", kind)
+		}
+		offset += 12 + length
+
+		switch kind {
+		case "IHDR":
+			header = chunk
+		case "PLTE":
+			palette = chunk
+		case "tRNS":
+			transparency = chunk
+		case "IDAT":
+			idat.Write(chunk)
+		}
+		if kind == "IEND" {
+			break
+		}
+	}
+	if len(header) != 13 {
+		return nil, fmt.Errorf("invalid PNG header")
+	}
+	if idat.Len() == 0 {
+		return nil, fmt.Errorf("PNG image has no data")
+	}
+	width := int(binary.BigEndian.Uint32(header))
+	height := int(binary.BigEndian.Uint32(header[4:]))
+	bits, colorType, interlaced := int(header[8]), header[9], header[12] != 0
+
+	// Components and color space of the samples, -1 for the alpha types
+	colors := -1
+	var colorSpace interface{}
+	switch colorType {
+	case 0:
+		colors, colorSpace = 1, godyf.Name("DeviceGray")
+	case 2:
+		colors, colorSpace = 3, godyf.Name("DeviceRGB")
+	case 3:
+		if len(palette) == 0 || len(palette)%3 != 0 {
+			return nil, fmt.Errorf("invalid PNG palette")
+		}
+		colors = 1
+		colorSpace = godyf.NewArray(godyf.Name("Indexed"), godyf.Name("DeviceRGB"), len(palette)/3-1, godyf.NewByteString(palette))
+	case 4, 6:
+	default:
+		return nil, fmt.Errorf("invalid PNG color type %d", colorType)
+	}
+
+	if colors > 0 && !interlaced && (colorType != 3 || transparency == nil) {
+		stream := imageStream(width, height, colorSpace, bits)
+		stream.Stream = []interface{}{idat.Bytes()}
+		predictor := &godyf.FlateFilter{PredictorParams: godyf.PredictorParams{
+			Predictor:        15,
+			Colors:           colors,
+			BitsPerComponent: bits,
+			Columns:          width,
+		}}
+		stream.Filters = []godyf.Filter{&godyf.PassthroughFilter{FilterName: predictor.Name(), DecodeParms: predictor.Params()}}
+
+		// The transparent color is given as ranges of one value
+		if len(transparency) >= 2*colors {
+			mask := godyf.NewArray()
+			for i := 0; i < colors; i++ {
+				value := int(binary.BigEndian.Uint16(transparency[2*i:])) & (1<<bits - 1)
+				mask.Elements = append(mask.Elements, value, value)
+			}
+			stream.Extra["Mask"] = mask
+		}
+		return &Image{Width: width, Height: height, Stream: stream}, nil
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	depth := 8
+	if bits == 16 {
+		depth = 16
+	}
+	return newImage(img, colorType == 0 || colorType == 4, depth), nil
+}
@@ -0,0 +1,464 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+// TIFF tags used to read images
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffFillOrder       = 266
+	tiffStripOffsets    = 273
+	tiffOrientation     = 274
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffPlanarConfig    = 284
+	tiffT4Options       = 292
+	tiffResolutionUnit  = 296
+	tiffPredictor       = 317
+	tiffColorMap        = 320
+	tiffTileWidth       = 322
+	tiffExtraSamples    = 338
+	tiffSampleFormat    = 339
+)
+
+// tiffMaxDirectoryTags is the maximum number of tags read in an image file
+// directory
+const tiffMaxDirectoryTags = 4096
+
+// tiffFrame is an image read from a TIFF image file directory, with its
+// resolution in dots per inch
+type tiffFrame struct {
+	image                    *Image
+	xResolution, yResolution float64
+}
+
+// NewImagesFromTIFF returns the images of the frames of TIFF data.
+//
+// Bilevel images compressed with CCITT Group 3 or Group 4 are embedded
+// unchanged with the CCITTFaxDecode filter. Other images, uncompressed or
+// compressed with LZW or Deflate, are decoded and compressed again with
+// Flate, their alpha channel being split into a soft mask. Grayscale, RGB,
+// palette and CMYK images are supported, with their orientation.
+func NewImagesFromTIFF(r io.Reader) ([]*Image, error) {
+	frames, err := readTIFF(r)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]*Image, len(frames))
+	for i, frame := range frames {
+		images[i] = frame.image
+	}
+	return images, nil
+}
+
+// AddTIFFPages adds a page to document for each frame of TIFF data, drawing
+// the frame upright on the whole page. The size of the page is given by the
+// resolution of the frame, 72 dots per inch if unknown.
+func AddTIFFPages(document *pdf.PDF, r io.Reader) error {
+	frames, err := readTIFF(r)
+	if err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		img := frame.image
+		width := float64(img.Width) / frame.xResolution * 72
+		height := float64(img.Height) / frame.yResolution * 72
+		if img.Orientation >= 5 && img.Orientation <= 8 {
+			width, height = height, width
+		}
+		imageRef := document.AddResource(img)
+		draw := godyf.NewStream(nil, nil, false)
+		img.Draw(draw, "Im1", 0, 0, width, height)
+		document.AddObject(draw)
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":     godyf.Name("Page"),
+			"Parent":   document.Pages.Ref(),
+			"MediaBox": godyf.NewArray(0, 0, width, height),
+			"Resources": godyf.NewDictionary(map[string]interface{}{
+				"XObject": godyf.NewDictionary(map[string]interface{}{"Im1": imageRef}),
+			}),
+			"Contents": draw.Ref(),
+		}))
+	}
+	return nil
+}
+
+// readTIFF returns the frames of TIFF data, in image file directory order
+func readTIFF(r io.Reader) ([]tiffFrame, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("invalid TIFF signature")
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II\x2A\x00":
+		order = binary.LittleEndian
+	case "MM\x00\x2A":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid TIFF signature")
+	}
+
+	var frames []tiffFrame
+	visited := make(map[int]bool)
+	for offset := int(order.Uint32(data[4:])); offset != 0; {
+		if visited[offset] {
+			return nil, fmt.Errorf("loop in TIFF image file directories")
+		}
+		visited[offset] = true
+		tags, next, err := tiffDirectory(data, order, offset)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := tiffImage(data, order, tags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIFF frame %d: %w", len(frames)+1, err)
+		}
+		frames = append(frames, frame)
+		offset = next
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("TIFF data has no images")
+	}
+	return frames, nil
+}
+
+// tiffDirectory returns the values of the tags of the image file directory
+// at offset, rationals being given as numerators followed by denominators,
+// and the offset of the next directory
+func tiffDirectory(data []byte, order binary.ByteOrder, offset int) (map[uint16][]uint32, int, error) {
+	if offset+2 > len(data) {
+		return nil, 0, fmt.Errorf("truncated TIFF data")
+	}
+	count := int(order.Uint16(data[offset:]))
+	if count > tiffMaxDirectoryTags || offset+2+12*count+4 > len(data) {
+		return nil, 0, fmt.Errorf("truncated TIFF data")
+	}
+	tags := make(map[uint16][]uint32, count)
+	for i := 0; i < count; i++ {
+		entry := data[offset+2+12*i:]
+		tag, kind, number := order.Uint16(entry), order.Uint16(entry[2:]), int(order.Uint32(entry[4:]))
+
+		// Values are stored in the entry when they fit in 4 bytes
+		size := map[uint16]int{1: 1, 3: 2, 4: 4, 5: 8}[kind]
+		if size == 0 {
+			continue // Types not used by images
+		}
+		if number < 0 || number > len(data)/size {
+			return nil, 0, fmt.Errorf("truncated TIFF data")
+		}
+		values := entry[8:12]
+		if size*number > 4 {
+			start := int(order.Uint32(entry[8:]))
+			if start < 0 || start+size*number > len(data) {
+				return nil, 0, fmt.Errorf("truncated TIFF data")
+			}
+			values = data[start : start+size*number]
+		}
+		result := make([]uint32, number)
+		for j := range result {
+			switch kind {
+			case 1:
+				result[j] = uint32(values[j])
+			case 3:
+				result[j] = uint32(order.Uint16(values[2*j:]))
+			case 4:
+				result[j] = order.Uint32(values[4*j:])
+			case 5:
+				result[j] = order.Uint32(values[8*j:])
+			}
+		}
+		if kind == 5 {
+			for j := 0; j < number; j++ {
+				result = append(result, order.Uint32(values[8*j+4:]))
+			}
+		}
+		tags[tag] = result
+	}
+	return tags, int(order.Uint32(data[offset+2+12*count:])), nil
+}
+
+// tiffImage returns the frame described by the tags of an image file
+// directory
+func tiffImage(data []byte, order binary.ByteOrder, tags map[uint16][]uint32) (tiffFrame, error) {
+	// value returns the first value of tag, or fallback if missing
+	value := func(tag uint16, fallback int) int {
+		if values := tags[tag]; len(values) > 0 {
+			return int(values[0])
+		}
+		return fallback
+	}
+	// resolution returns a resolution in dots per inch, 72 if unknown
+	resolution := func(tag uint16) float64 {
+		values := tags[tag]
+		if len(values) != 2 || values[0] == 0 || values[1] == 0 {
+			return 72
+		}
+		switch value(tiffResolutionUnit, 2) {
+		case 2:
+			return float64(values[0]) / float64(values[1])
+		case 3:
+			return float64(values[0]) / float64(values[1]) * 2.54
+		}
+		return 72
+	}
+
+	width, height := value(tiffImageWidth, 0), value(tiffImageLength, 0)
+	if width <= 0 || height <= 0 {
+		return tiffFrame{}, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+	if _, ok := tags[tiffTileWidth]; ok {
+		return tiffFrame{}, fmt.Errorf("tiled images are not supported")
+	}
+	if value(tiffPlanarConfig, 1) != 1 {
+		return tiffFrame{}, fmt.Errorf("planar images are not supported")
+	}
+	if value(tiffSampleFormat, 1) != 1 {
+		return tiffFrame{}, fmt.Errorf("only unsigned integer samples are supported")
+	}
+	samplesPerPixel := value(tiffSamplesPerPixel, 1)
+	bitsPerSample := value(tiffBitsPerSample, 1)
+	for _, depth := range tags[tiffBitsPerSample] {
+		if int(depth) != bitsPerSample {
+			return tiffFrame{}, fmt.Errorf("samples of different depths are not supported")
+		}
+	}
+	if samplesPerPixel < 1 || samplesPerPixel > 8 {
+		return tiffFrame{}, fmt.Errorf("invalid number of samples per pixel %d", samplesPerPixel)
+	}
+	switch bitsPerSample {
+	case 1, 2, 4, 8, 16:
+	default:
+		return tiffFrame{}, fmt.Errorf("unsupported depth of %d bits", bitsPerSample)
+	}
+
+	offsets, counts := tags[tiffStripOffsets], tags[tiffStripByteCounts]
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return tiffFrame{}, fmt.Errorf("invalid strips")
+	}
+	strips := make([][]byte, len(offsets))
+	for i, offset := range offsets {
+		if int(offset)+int(counts[i]) > len(data) || int(offset)+int(counts[i]) < int(offset) {
+			return tiffFrame{}, fmt.Errorf("truncated strip")
+		}
+		strips[i] = data[offset : offset+counts[i]]
+	}
+	if value(tiffFillOrder, 1) == 2 {
+		for i, strip := range strips {
+			reversed := make([]byte, len(strip))
+			for j, b := range strip {
+				reversed[j] = bits.Reverse8(b)
+			}
+			strips[i] = reversed
+		}
+	}
+
+	frame := tiffFrame{
+		image:       &Image{Width: width, Height: height, Orientation: 1},
+		xResolution: resolution(tiffXResolution),
+		yResolution: resolution(tiffYResolution),
+	}
+	if orientation := value(tiffOrientation, 1); orientation >= 1 && orientation <= 8 {
+		frame.image.Orientation = orientation
+	}
+	photometric := value(tiffPhotometric, -1)
+	rowsPerStrip := min(value(tiffRowsPerStrip, height), height)
+
+	switch compression := value(tiffCompression, 1); compression {
+	case 2, 3, 4:
+		if bitsPerSample != 1 || samplesPerPixel != 1 {
+			return tiffFrame{}, fmt.Errorf("CCITT images must be bilevel")
+		}
+		stream, err := ccittImage(width, height, compression, value(tiffT4Options, 0), photometric == 1, strips)
+		if err != nil {
+			return tiffFrame{}, err
+		}
+		frame.image.Stream = stream
+	case 1, 5, 8, 32946:
+		rowSize := (width*samplesPerPixel*bitsPerSample + 7) / 8
+		samples := make([]byte, 0, rowSize*height)
+		for i, strip := range strips {
+			var err error
+			switch compression {
+			case 5:
+				strip, err = (&godyf.LZWFilter{}).Decode(strip)
+			case 8, 32946:
+				strip, err = (&godyf.FlateFilter{}).Decode(strip)
+			}
+			if err != nil {
+				return tiffFrame{}, err
+			}
+			rows := min(rowsPerStrip, height-i*rowsPerStrip)
+			if rows <= 0 {
+				break
+			}
+			if len(strip) < rows*rowSize {
+				return tiffFrame{}, fmt.Errorf("truncated strip")
+			}
+			samples = append(samples, strip[:rows*rowSize]...)
+		}
+		if len(samples) != rowSize*height {
+			return tiffFrame{}, fmt.Errorf("missing strips")
+		}
+		if bitsPerSample == 16 && order == binary.LittleEndian {
+			for i := 0; i+1 < len(samples); i += 2 {
+				samples[i], samples[i+1] = samples[i+1], samples[i]
+			}
+		}
+		if value(tiffPredictor, 1) == 2 {
+			if bitsPerSample < 8 {
+				return tiffFrame{}, fmt.Errorf("horizontal differencing needs 8 or 16 bits per sample")
+			}
+			size := bitsPerSample / 8
+			for row := 0; row < height; row++ {
+				line := samples[row*rowSize : (row+1)*rowSize]
+				for i := samplesPerPixel * size; i+size <= len(line); i += size {
+					if size == 1 {
+						line[i] += line[i-samplesPerPixel]
+					} else {
+						sum := binary.BigEndian.Uint16(line[i:]) + binary.BigEndian.Uint16(line[i-2*samplesPerPixel:])
+						binary.BigEndian.PutUint16(line[i:], sum)
+					}
+				}
+			}
+		}
+		if err := sampledTIFFImage(frame.image, photometric, samplesPerPixel, bitsPerSample, tags, samples); err != nil {
+			return tiffFrame{}, err
+		}
+	default:
+		return tiffFrame{}, fmt.Errorf("unsupported compression %d", compression)
+	}
+	return frame, nil
+}
+
+// ccittImage returns an image XObject made of CCITT strips, the compression
+// being 2 for modified Huffman, 3 for Group 3 and 4 for Group 4
+func ccittImage(width, height, compression, t4Options int, blackIs1 bool, strips [][]byte) (*godyf.Stream, error) {
+	// Rows of Group 4 strips depend on previous rows, restarting in each
+	// strip, other rows start with a 1D-coded row after end-of-line codes
+	if compression == 4 && len(strips) > 1 {
+		return nil, fmt.Errorf("CCITT Group 4 images of several strips are not supported")
+	}
+	k, byteAlign := 0, false
+	switch compression {
+	case 2:
+		byteAlign = true
+	case 3:
+		if t4Options&1 != 0 {
+			k = 1
+		}
+		byteAlign = t4Options&4 != 0
+	case 4:
+		k = -1
+	}
+	parameters := godyf.NewDictionary(nil)
+	parameters.Set("K", k)
+	parameters.Set("Columns", width)
+	parameters.Set("Rows", height)
+	parameters.Set("BlackIs1", blackIs1)
+	if byteAlign {
+		parameters.Set("EncodedByteAlign", true)
+	}
+	stream := imageStream(width, height, godyf.Name("DeviceGray"), 1)
+	stream.Stream = []interface{}{bytes.Join(strips, nil)}
+	stream.Filters = []godyf.Filter{&godyf.PassthroughFilter{FilterName: "CCITTFaxDecode", DecodeParms: parameters}}
+	return stream, nil
+}
+
+// sampledTIFFImage sets the image XObject and the soft mask of img from
+// decoded TIFF samples, with big-endian 16-bit values
+func sampledTIFFImage(img *Image, photometric, samplesPerPixel, bits int, tags map[uint16][]uint32, samples []byte) error {
+	var colorSpace interface{}
+	var decode *godyf.Array
+	colors := 0
+	switch photometric {
+	case 0, 1:
+		colors, colorSpace = 1, godyf.Name("DeviceGray")
+		if photometric == 0 {
+			decode = godyf.NewArray(1, 0)
+		}
+	case 2:
+		colors, colorSpace = 3, godyf.Name("DeviceRGB")
+	case 3:
+		// Color maps give the 16-bit red, green and blue values of each index
+		colorMap := tags[tiffColorMap]
+		entries := 1 << bits
+		if bits > 8 || len(colorMap) != 3*entries {
+			return fmt.Errorf("invalid color map")
+		}
+		palette := make([]byte, 0, 3*entries)
+		for i := 0; i < entries; i++ {
+			palette = append(palette, byte(colorMap[i]>>8), byte(colorMap[entries+i]>>8), byte(colorMap[2*entries+i]>>8))
+		}
+		colors = 1
+		colorSpace = godyf.NewArray(godyf.Name("Indexed"), godyf.Name("DeviceRGB"), entries-1, godyf.NewByteString(palette))
+	case 5:
+		colors, colorSpace = 4, godyf.Name("DeviceCMYK")
+	default:
+		return fmt.Errorf("unsupported photometric interpretation %d", photometric)
+	}
+	if samplesPerPixel < colors {
+		return fmt.Errorf("%d samples per pixel for %d colors", samplesPerPixel, colors)
+	}
+
+	// Extra samples are removed, the first one being used as soft mask if
+	// it is an alpha channel
+	var alpha []byte
+	if samplesPerPixel > colors {
+		if bits < 8 {
+			return fmt.Errorf("extra samples need 8 or 16 bits per sample")
+		}
+		size := bits / 8
+		extra := tags[tiffExtraSamples]
+		hasAlpha := len(extra) > 0 && (extra[0] == 1 || extra[0] == 2)
+		pixels := make([]byte, 0, len(samples)/samplesPerPixel*colors)
+		opaque := true
+		for i := 0; i+samplesPerPixel*size <= len(samples); i += samplesPerPixel * size {
+			pixels = append(pixels, samples[i:i+colors*size]...)
+			if hasAlpha {
+				value := samples[i+colors*size : i+(colors+1)*size]
+				alpha = append(alpha, value...)
+				opaque = opaque && bytes.Count(value, []byte{0xFF}) == size
+			}
+		}
+		samples = pixels
+		if opaque {
+			alpha = nil
+		}
+		if alpha != nil {
+			img.SMask = sampledImage(img.Width, img.Height, godyf.Name("DeviceGray"), 1, bits, alpha)
+			if extra[0] == 1 {
+				// Associated alpha means colors premultiplied by black
+				matte := godyf.NewArray()
+				for i := 0; i < colors; i++ {
+					matte.Elements = append(matte.Elements, 0)
+				}
+				img.SMask.Extra["Matte"] = matte
+			}
+		}
+	}
+
+	img.Stream = sampledImage(img.Width, img.Height, colorSpace, colors, bits, samples)
+	if decode != nil {
+		img.Stream.Extra["Decode"] = decode
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package pdf
+
+import (
+	"crypto/sha256"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// duplicateStreams returns the numbers of the streams added with AddObject
+// that are identical to previous ones, with references to the streams
+// written instead, nil if NoDeduplication is set. Streams are compared with
+// their references to duplicates replaced, so that streams referencing
+// identical streams, such as images whose soft masks are identical, are
+// found identical too.
+func (p *PDF) duplicateStreams() map[int]godyf.Ref {
+	if p.NoDeduplication {
+		return nil
+	}
+	duplicates := make(map[int]godyf.Ref)
+	for {
+		// Streams are only serialized when others have the same raw size
+		sizes := make(map[int][]int)
+		var order []int
+		for _, number := range p.streams {
+			stream, ok := p.Objects[number].(*godyf.Stream)
+			if _, duplicate := duplicates[number]; !ok || duplicate || stream.Free == 'f' {
+				continue
+			}
+			size := len(stream.Stream)
+			for _, item := range stream.Stream {
+				size += len(godyf.ToBytes(item))
+			}
+			if sizes[size] == nil {
+				order = append(order, size)
+			}
+			sizes[size] = append(sizes[size], number)
+		}
+		found := make(map[int]godyf.Ref)
+		for _, size := range order {
+			if len(sizes[size]) < 2 {
+				continue
+			}
+			kept := make(map[[sha256.Size]byte]int)
+			for _, number := range sizes[size] {
+				digest := sha256.Sum256(replaceDuplicates(p.Objects[number], duplicates).Data())
+				if original, ok := kept[digest]; ok {
+					found[number] = p.Objects[original].GetObject().Ref()
+				} else {
+					kept[digest] = number
+				}
+			}
+		}
+		if len(found) == 0 {
+			return duplicates
+		}
+
+		for duplicate, original := range duplicates {
+			if kept, ok := found[original.Number]; ok {
+				duplicates[duplicate] = kept
+			}
+		}
+		for duplicate, original := range found {
+			duplicates[duplicate] = original
+		}
+	}
+}
+
+// deduplicated calls write with p.Objects holding the objects to write:
+// streams identical to previous ones are replaced by free objects, and
+// objects referencing them by copies referencing the streams kept. The
+// objects of the document and the values they hold are left untouched:
+// p.Objects is restored once write returns, keeping the objects added by
+// write and the offsets it set.
+func (p *PDF) deduplicated(write func() error) error {
+	duplicates := p.duplicateStreams()
+	if len(duplicates) == 0 {
+		return write()
+	}
+
+	objects := p.Objects
+	p.Objects = make([]godyf.PDFObject, len(objects))
+	for number, obj := range objects {
+		if _, ok := duplicates[number]; ok {
+			free := godyf.NewObject()
+			free.Number = number
+			free.Generation = obj.GetObject().Generation + 1
+			free.Free = 'f'
+			p.Objects[number] = &ObjectWrapper{free}
+		} else {
+			p.Objects[number] = replaceDuplicates(obj, duplicates)
+		}
+	}
+	defer func() {
+		for number, obj := range objects {
+			if _, ok := duplicates[number]; !ok {
+				obj.GetObject().Offset = p.Objects[number].GetObject().Offset
+			}
+		}
+		p.Objects = append(objects, p.Objects[len(objects):]...)
+	}()
+	return write()
+}
+
+// replaceDuplicates returns obj, or a copy of obj whose references to
+// duplicate streams are replaced by references to the streams kept if it
+// has some
+func replaceDuplicates(obj godyf.PDFObject, duplicates map[int]godyf.Ref) godyf.PDFObject {
+	found := false
+	references(obj, func(number int) {
+		_, duplicate := duplicates[number]
+		found = found || duplicate
+	})
+	if !found {
+		return obj
+	}
+
+	replace := func(value interface{}) interface{} {
+		return mapReferences(value, func(ref godyf.Ref) interface{} {
+			if kept, ok := duplicates[ref.Number]; ok {
+				return kept
+			}
+			return ref
+		})
+	}
+	switch o := obj.(type) {
+	case *godyf.Stream:
+		stream := *o
+		stream.Extra = replace(o.Extra).(map[string]interface{})
+		return &stream
+	case *godyf.Dictionary:
+		dictionary := replace(o).(*godyf.Dictionary)
+		dictionary.Object = o.Object
+		return dictionary
+	case *godyf.Array:
+		array := replace(o).(*godyf.Array)
+		array.Object = o.Object
+		return array
+	case *IndirectValue:
+		return &IndirectValue{Object: o.Object, Value: replace(o.Value)}
+	}
+	return obj
+}
@@ -0,0 +1,527 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// bitWriter writes big-endian bit fields
+type bitWriter struct {
+	buf     bytes.Buffer
+	current byte
+	count   int
+}
+
+// write writes the bits lowest bits of value
+func (w *bitWriter) write(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		w.current = w.current<<1 | byte(value>>i&1)
+		w.count++
+		if w.count == 8 {
+			w.buf.WriteByte(w.current)
+			w.current, w.count = 0, 0
+		}
+	}
+}
+
+// align pads the data with zero bits up to the next byte boundary
+func (w *bitWriter) align() {
+	if w.count > 0 {
+		w.write(0, 8-w.count)
+	}
+}
+
+// bitReader reads big-endian bit fields
+type bitReader struct {
+	data     []byte
+	position int // Position in bits
+	err      error
+}
+
+// read reads a value of the given number of bits
+func (r *bitReader) read(bits int) int {
+	value := 0
+	for i := 0; i < bits; i++ {
+		if r.position >= len(r.data)*8 {
+			r.err = fmt.Errorf("hint table truncated")
+			return 0
+		}
+		bit := r.data[r.position/8] >> (7 - r.position%8) & 1
+		value = value<<1 | int(bit)
+		r.position++
+	}
+	return value
+}
+
+// align skips the bits up to the next byte boundary
+func (r *bitReader) align() {
+	r.position = (r.position + 7) / 8 * 8
+}
+
+// bitsFor returns the number of bits needed to represent value
+func bitsFor(value int) int {
+	bits := 0
+	for ; value > 0; value >>= 1 {
+		bits++
+	}
+	return bits
+}
+
+// pageHint is the entry of a page in the page offset hint table
+type pageHint struct {
+	objects       int   // Number of objects of the page
+	length        int   // Length of the page in bytes
+	shared        []int // Identifiers of the shared objects used by the page
+	contentOffset int   // Offset of the content stream relative to the page
+	contentLength int   // Length of the content stream
+}
+
+// pageOffsetHints is the page offset hint table
+type pageOffsetHints struct {
+	firstPageOffset int // Offset of the first page object
+	pages           []pageHint
+}
+
+// sharedObjectHints is the shared object hint table, with one object per group
+type sharedObjectHints struct {
+	firstObject      int   // Number of the first object of the shared objects section
+	firstOffset      int   // Offset of the first object of the shared objects section
+	firstPageEntries int   // Number of groups in the first page section
+	groups           []int // Lengths of the groups
+	objects          []int // Number of objects of the groups
+}
+
+// leastAndBits returns the least of values and the number of bits needed
+// to represent the difference between the greatest and the least
+func leastAndBits(values []int) (int, int) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	least, greatest := values[0], values[0]
+	for _, value := range values {
+		least, greatest = min(least, value), max(greatest, value)
+	}
+	return least, bitsFor(greatest - least)
+}
+
+// writeItems writes each value minus least on bits, followed by alignment
+func writeItems(w *bitWriter, values []int, least, bits int) {
+	for _, value := range values {
+		w.write(value-least, bits)
+	}
+	w.align()
+}
+
+// readItems reads count values of bits plus least, followed by alignment
+func readItems(r *bitReader, count, least, bits int) []int {
+	values := make([]int, count)
+	for i := range values {
+		values[i] = least + r.read(bits)
+	}
+	r.align()
+	return values
+}
+
+// encodePageOffsetHints writes the page offset hint table. Items are written
+// for all pages one after the other, each one starting at a byte boundary.
+func encodePageOffsetHints(w *bitWriter, firstPageOffset int, pages []pageHint) {
+	var objects, lengths, sharedCounts, contentOffsets, contentLengths []int
+	greatestShared := 0
+	for _, page := range pages {
+		objects = append(objects, page.objects)
+		lengths = append(lengths, page.length)
+		sharedCounts = append(sharedCounts, len(page.shared))
+		contentOffsets = append(contentOffsets, page.contentOffset)
+		contentLengths = append(contentLengths, page.contentLength)
+		for _, identifier := range page.shared {
+			greatestShared = max(greatestShared, identifier)
+		}
+	}
+	leastObjects, objectsBits := leastAndBits(objects)
+	leastLength, lengthBits := leastAndBits(lengths)
+	leastContentOffset, contentOffsetBits := leastAndBits(contentOffsets)
+	leastContentLength, contentLengthBits := leastAndBits(contentLengths)
+	_, sharedCountBits := leastAndBits(append(sharedCounts, 0))
+	sharedBits := bitsFor(greatestShared)
+
+	for _, field := range [][2]int{
+		{leastObjects, 32}, {firstPageOffset, 32}, {objectsBits, 16},
+		{leastLength, 32}, {lengthBits, 16},
+		{leastContentOffset, 32}, {contentOffsetBits, 16},
+		{leastContentLength, 32}, {contentLengthBits, 16},
+		{sharedCountBits, 16}, {sharedBits, 16},
+		{0, 16}, {1, 16}, // Fractional positions of shared objects are not used
+	} {
+		w.write(field[0], field[1])
+	}
+
+	writeItems(w, objects, leastObjects, objectsBits)
+	writeItems(w, lengths, leastLength, lengthBits)
+	writeItems(w, sharedCounts, 0, sharedCountBits)
+	for _, page := range pages {
+		for _, identifier := range page.shared {
+			w.write(identifier, sharedBits)
+		}
+	}
+	w.align()
+	w.align() // Numerators of fractional positions, on 0 bits
+	writeItems(w, contentOffsets, leastContentOffset, contentOffsetBits)
+	writeItems(w, contentLengths, leastContentLength, contentLengthBits)
+}
+
+// decodePageOffsetHints reads the page offset hint table of pages pages
+func decodePageOffsetHints(data []byte, pages int) (*pageOffsetHints, error) {
+	r := &bitReader{data: data}
+	leastObjects, firstPageOffset, objectsBits := r.read(32), r.read(32), r.read(16)
+	leastLength, lengthBits := r.read(32), r.read(16)
+	leastContentOffset, contentOffsetBits := r.read(32), r.read(16)
+	leastContentLength, contentLengthBits := r.read(32), r.read(16)
+	sharedCountBits, sharedBits, numeratorBits := r.read(16), r.read(16), r.read(16)
+	r.read(16)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	hints := &pageOffsetHints{firstPageOffset: firstPageOffset, pages: make([]pageHint, pages)}
+	objects := readItems(r, pages, leastObjects, objectsBits)
+	lengths := readItems(r, pages, leastLength, lengthBits)
+	sharedCounts := readItems(r, pages, 0, sharedCountBits)
+	for i := range hints.pages {
+		hints.pages[i].objects = objects[i]
+		hints.pages[i].length = lengths[i]
+		hints.pages[i].shared = make([]int, sharedCounts[i])
+		for j := range hints.pages[i].shared {
+			hints.pages[i].shared[j] = r.read(sharedBits)
+		}
+	}
+	r.align()
+	for _, count := range sharedCounts {
+		for j := 0; j < count; j++ {
+			r.read(numeratorBits)
+		}
+	}
+	r.align()
+	contentOffsets := readItems(r, pages, leastContentOffset, contentOffsetBits)
+	contentLengths := readItems(r, pages, leastContentLength, contentLengthBits)
+	for i := range hints.pages {
+		hints.pages[i].contentOffset = contentOffsets[i]
+		hints.pages[i].contentLength = contentLengths[i]
+	}
+	return hints, r.err
+}
+
+// encodeSharedObjectHints writes the shared object hint table with one object per group
+func encodeSharedObjectHints(w *bitWriter, firstObject, firstOffset, firstPageEntries int, groups []int) {
+	leastLength, lengthBits := leastAndBits(groups)
+	for _, field := range [][2]int{
+		{firstObject, 32}, {firstOffset, 32}, {firstPageEntries, 32}, {len(groups), 32},
+		{0, 16}, // Groups have a single object
+		{leastLength, 32}, {lengthBits, 16},
+	} {
+		w.write(field[0], field[1])
+	}
+	writeItems(w, groups, leastLength, lengthBits)
+	writeItems(w, make([]int, len(groups)), 0, 1) // No MD5 signatures
+	w.align()                                     // Numbers of objects minus one, on 0 bits
+}
+
+// decodeSharedObjectHints reads the shared object hint table
+func decodeSharedObjectHints(data []byte) (*sharedObjectHints, error) {
+	r := &bitReader{data: data}
+	hints := &sharedObjectHints{firstObject: r.read(32), firstOffset: r.read(32), firstPageEntries: r.read(32)}
+	count, objectsBits := r.read(32), r.read(16)
+	leastLength, lengthBits := r.read(32), r.read(16)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count > len(data)*8 {
+		return nil, fmt.Errorf("invalid number of shared object groups %d", count)
+	}
+	hints.groups = readItems(r, count, leastLength, lengthBits)
+	signatures := readItems(r, count, 0, 1)
+	for _, signature := range signatures {
+		if signature != 0 {
+			r.read(128)
+		}
+	}
+	r.align()
+	hints.objects = readItems(r, count, 1, objectsBits)
+	return hints, r.err
+}
+
+// CheckLinearization checks that the size bytes of r are a linearized PDF
+// file whose linearization dictionary and hint tables match the objects of
+// the file, returning the first inconsistency found
+func CheckLinearization(r io.ReaderAt, size int64) error {
+	rd := newReader(r, size, ReadOptions{})
+	if err := rd.readHeader(); err != nil {
+		return err
+	}
+	if err := rd.readXRefs(); err != nil {
+		return err
+	}
+	document, err := rd.document()
+	if err != nil {
+		return err
+	}
+	pages, nodes := document.pageTree()
+	if len(pages) == 0 {
+		return fmt.Errorf("document has no pages")
+	}
+
+	// Object and section offsets, to compute the length of objects
+	mainXRef, _ := rd.trailer.Get("Prev").(int)
+	boundaries := []int64{rd.startXRef, int64(mainXRef), size}
+	offsetOf := make(map[int]int64)
+	for number, entry := range rd.xref {
+		if entry.kind == 1 {
+			offsetOf[number] = entry.offset
+			boundaries = append(boundaries, entry.offset)
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i] < boundaries[j] })
+	span := func(offset int64) int {
+		index := sort.Search(len(boundaries), func(i int) bool { return boundaries[i] > offset })
+		if index == len(boundaries) {
+			return 0
+		}
+		return int(boundaries[index] - offset)
+	}
+
+	// The linearization dictionary is the first object of the file
+	first := int64(-1)
+	linearizedNumber := 0
+	for number, offset := range offsetOf {
+		if first < 0 || offset < first {
+			first, linearizedNumber = offset, number
+		}
+	}
+	linearized, ok := document.Resolve(godyf.Ref{Number: linearizedNumber}).(*godyf.Dictionary)
+	if !ok || linearized.Get("Linearized") == nil {
+		return fmt.Errorf("missing linearization dictionary")
+	}
+	parameter := func(key string) int {
+		value, _ := linearized.Get(key).(int)
+		return value
+	}
+	if parameter("L") != int(size) {
+		return fmt.Errorf("/L is %d, file length is %d", parameter("L"), size)
+	}
+	if parameter("N") != len(pages) {
+		return fmt.Errorf("/N is %d, document has %d pages", parameter("N"), len(pages))
+	}
+	if parameter("O") != pages[0] {
+		return fmt.Errorf("/O is %d, first page is object %d", parameter("O"), pages[0])
+	}
+	if err := checkMainXRef(rd, int64(parameter("T")), int64(mainXRef)); err != nil {
+		return err
+	}
+
+	// Read the hint streams, the overflow stream continuing the primary one
+	hintArray, _ := linearized.Get("H").(*godyf.Array)
+	if hintArray == nil || (hintArray.Len() != 2 && hintArray.Len() != 4) {
+		return fmt.Errorf("invalid /H")
+	}
+	var hintData []byte
+	sharedOffset := -1
+	for i := 0; i < hintArray.Len(); i += 2 {
+		offset, _ := hintArray.Get(i).(int)
+		length, _ := hintArray.Get(i + 1).(int)
+		if span(int64(offset)) != length {
+			return fmt.Errorf("hint stream at offset %d has length %d, not %d", offset, span(int64(offset)), length)
+		}
+		_, _, value, err := rd.parser.parseIndirect(int64(offset))
+		if err != nil {
+			return fmt.Errorf("hint stream: %w", err)
+		}
+		stream, ok := value.(*godyf.Stream)
+		if !ok {
+			return fmt.Errorf("no hint stream at offset %d", offset)
+		}
+		data, err := stream.DecodedData()
+		if err != nil {
+			return fmt.Errorf("hint stream: %w", err)
+		}
+		if i == 0 {
+			if sharedOffset, ok = stream.Extra["S"].(int); !ok {
+				return fmt.Errorf("missing /S in primary hint stream")
+			}
+		}
+		hintData = append(hintData, data...)
+	}
+	if sharedOffset < 0 || sharedOffset > len(hintData) {
+		return fmt.Errorf("invalid shared object hint table offset %d", sharedOffset)
+	}
+
+	// Offsets in hint tables are computed as if the primary hint stream was missing
+	hintOffset, _ := hintArray.Get(0).(int)
+	hintLength, _ := hintArray.Get(1).(int)
+	adjust := func(offset int64) int {
+		if offset >= int64(hintOffset) {
+			return int(offset) - hintLength
+		}
+		return int(offset)
+	}
+
+	pageHints, err := decodePageOffsetHints(hintData[:sharedOffset], len(pages))
+	if err != nil {
+		return fmt.Errorf("page offset hint table: %w", err)
+	}
+	sharedHints, err := decodeSharedObjectHints(hintData[sharedOffset:])
+	if err != nil {
+		return fmt.Errorf("shared object hint table: %w", err)
+	}
+
+	// Shared object groups are in the first page section, then in the shared objects section
+	var groupObjects [][]int
+	checkGroups := func(groups, objects []int, number int, position int) error {
+		for i, length := range groups {
+			var numbers []int
+			groupLength := 0
+			for j := 0; j < objects[i]; j++ {
+				offset, ok := offsetOf[number]
+				if !ok || adjust(offset) != position+groupLength {
+					return fmt.Errorf("shared object group %d: object %d is not at offset %d", len(groupObjects), number, position+groupLength)
+				}
+				groupLength += span(offset)
+				numbers = append(numbers, number)
+				number++
+			}
+			if groupLength != length {
+				return fmt.Errorf("shared object group %d has length %d, not %d", len(groupObjects), groupLength, length)
+			}
+			groupObjects = append(groupObjects, numbers)
+			position += length
+		}
+		return nil
+	}
+	firstEntries := sharedHints.firstPageEntries
+	if firstEntries > len(sharedHints.groups) {
+		return fmt.Errorf("invalid number of first page shared object groups %d", firstEntries)
+	}
+	if err := checkGroups(sharedHints.groups[:firstEntries], sharedHints.objects, pages[0], adjust(offsetOf[pages[0]])); err != nil {
+		return err
+	}
+	if err := checkGroups(sharedHints.groups[firstEntries:], sharedHints.objects[firstEntries:], sharedHints.firstObject, sharedHints.firstOffset); err != nil {
+		return err
+	}
+
+	// Check the objects of each page
+	if adjust(offsetOf[pages[0]]) != pageHints.firstPageOffset {
+		return fmt.Errorf("first page object is at offset %d, not %d", adjust(offsetOf[pages[0]]), pageHints.firstPageOffset)
+	}
+	isPage := make(map[int]bool)
+	for _, number := range pages {
+		isPage[number] = true
+	}
+	catalog := document.Catalog.GetObject().Number
+	for i, page := range pages {
+		hint := pageHints.pages[i]
+		start := adjust(offsetOf[page])
+		if i > 0 {
+			if expected := adjust(offsetOf[pages[i-1]]) + pageHints.pages[i-1].length; start != expected {
+				return fmt.Errorf("page %d starts at offset %d, not %d", i+1, start, expected)
+			}
+		}
+		if i == 0 && int64(parameter("E")) != offsetOf[page]+int64(hint.length) {
+			return fmt.Errorf("/E is %d, first page ends at %d", parameter("E"), offsetOf[page]+int64(hint.length))
+		}
+
+		// Objects of the page are numbered consecutively from the page object
+		inPage := func(number int) bool {
+			return number >= page && number < page+hint.objects
+		}
+		for number := page; number < page+hint.objects; number++ {
+			entry := rd.xref[number]
+			switch {
+			case entry.kind == 1 && (adjust(entry.offset) < start || adjust(entry.offset)+span(entry.offset) > start+hint.length):
+				return fmt.Errorf("page %d: object %d is outside of the page", i+1, number)
+			case entry.kind == 2 && !inPage(int(entry.offset)):
+				return fmt.Errorf("page %d: object %d is in an object stream outside of the page", i+1, number)
+			case entry.kind == 0:
+				return fmt.Errorf("page %d: object %d is free", i+1, number)
+			}
+		}
+
+		// The first content stream is located relative to the page
+		contentOffset, contentLength := 0, 0
+		pageDictionary, _ := document.Resolve(godyf.Ref{Number: page}).(*godyf.Dictionary)
+		if pageDictionary != nil {
+			contents := pageDictionary.Get("Contents")
+			if array, ok := contents.(*godyf.Array); ok {
+				contents = array.Get(0)
+			}
+			if ref, ok := contents.(godyf.Ref); ok && inPage(ref.Number) && rd.xref[ref.Number].kind == 1 {
+				contentOffset = adjust(offsetOf[ref.Number]) - start
+				contentLength = span(offsetOf[ref.Number])
+			}
+		}
+		if contentOffset != hint.contentOffset || contentLength != hint.contentLength {
+			return fmt.Errorf("page %d: content stream at %d with length %d, not %d with length %d",
+				i+1, contentOffset, contentLength, hint.contentOffset, hint.contentLength)
+		}
+
+		// Objects needed by the page are in the page or in its shared objects
+		available := make(map[int]bool)
+		for _, identifier := range hint.shared {
+			if identifier >= len(groupObjects) {
+				return fmt.Errorf("page %d: invalid shared object identifier %d", i+1, identifier)
+			}
+			for _, number := range groupObjects[identifier] {
+				available[number] = true
+			}
+		}
+		graph := func(number int) []int {
+			var found []int
+			value, err := rd.load(number)
+			if err == nil {
+				references(value, func(reference int) { found = append(found, reference) })
+			}
+			return found
+		}
+		needed := []int{page}
+		visited := map[int]bool{page: true}
+		for j := 0; j < len(needed); j++ {
+			for _, number := range graph(needed[j]) {
+				if visited[number] || isPage[number] || nodes[number] || number == catalog {
+					continue
+				}
+				visited[number] = true
+				if !inPage(number) && !available[number] {
+					return fmt.Errorf("page %d: object %d is neither in the page nor in its shared objects", i+1, number)
+				}
+				needed = append(needed, number)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMainXRef checks that the /T linearization parameter points to the
+// first entry of the main cross-reference table, or to the main
+// cross-reference stream
+func checkMainXRef(rd *reader, t, mainXRef int64) error {
+	if rd.xrefStream {
+		if t != mainXRef {
+			return fmt.Errorf("/T is %d, main cross-reference stream is at %d", t, mainXRef)
+		}
+		return nil
+	}
+	data, err := rd.lex.readAt(t, 21)
+	if err != nil || t < mainXRef || !isWhitespace(data[0]) {
+		return fmt.Errorf("/T is %d, not before the first entry of the main cross-reference table", t)
+	}
+	entry := data[1:]
+	valid := entry[10] == ' ' && entry[16] == ' ' && (entry[17] == 'n' || entry[17] == 'f')
+	for _, c := range append(entry[:10:10], entry[11:16]...) {
+		valid = valid && c >= '0' && c <= '9'
+	}
+	if !valid {
+		return fmt.Errorf("/T is %d, not before the first entry of the main cross-reference table", t)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// sourceFile describes the file an opened document was read from
+type sourceFile struct {
+	size       int64                     // Size of the file, where updates start
+	endsInEOL  bool                      // Whether the file ends with an end-of-line marker
+	startXRef  int64                     // Offset of the newest cross-reference section
+	xrefStream bool                      // Whether the newest cross-reference section is a stream
+	repaired   bool                      // Whether the cross-reference table was rebuilt in recovery mode
+	digests    map[int][sha256.Size]byte // Digests of the objects as last written
+	free       []int                     // Free object numbers as last written, from object 0
+}
+
+// objectDigest returns a digest of the number, generation, status and data of an object
+func objectDigest(obj godyf.PDFObject) [sha256.Size]byte {
+	base := obj.GetObject()
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%d %d %c\n", base.Number, base.Generation, base.Free)
+	hasher.Write(obj.Data())
+	var digest [sha256.Size]byte
+	copy(digest[:], hasher.Sum(nil))
+	return digest
+}
+
+// snapshot records the current state of the objects, to detect later changes
+func (s *sourceFile) snapshot(objects []godyf.PDFObject) {
+	s.digests = make(map[int][sha256.Size]byte, len(objects))
+	for number, obj := range objects {
+		s.digests[number] = objectDigest(obj)
+	}
+	s.free = freeNumbers(objects)
+}
+
+// freeNumbers returns the numbers of the free objects in increasing order,
+// starting with object 0 that is the head of the list of free objects
+func freeNumbers(objects []godyf.PDFObject) []int {
+	free := []int{0}
+	for number, obj := range objects {
+		if number > 0 && obj.GetObject().Free == 'f' {
+			free = append(free, number)
+		}
+	}
+	return free
+}
+
+// WriteIncremental writes an incremental update of a document read with
+// Open: new and modified objects followed by a cross-reference section of
+// the same kind as the newest one of the file, linked to it with /Prev.
+// The output must be appended to the original file, whose bytes are left
+// untouched, so that earlier signatures stay valid. Objects are freed by
+// setting their Free status to 'f' and incrementing their generation.
+// Further updates can be written after this one.
+func (p *PDF) WriteIncremental(output io.Writer) error {
+	source := p.source
+	if source == nil {
+		return fmt.Errorf("incremental updates require a document read with Open")
+	}
+	if source.repaired {
+		return fmt.Errorf("incremental updates can't be written on top of a repaired cross-reference table")
+	}
+	if err := p.finishResources(); err != nil {
+		return err
+	}
+	return p.deduplicated(func() error {
+		return p.writeUpdate(output)
+	})
+}
+
+// writeUpdate writes the objects changed since the last written version
+// and a cross-reference section listing them
+func (p *PDF) writeUpdate(output io.Writer) error {
+	source := p.source
+	p.CurrentPosition = int(source.size)
+	if !source.endsInEOL {
+		if _, err := output.Write([]byte("\n")); err != nil {
+			return err
+		}
+		p.CurrentPosition++
+	}
+
+	// Write objects that are new or differ from the last written version
+	var changed []godyf.PDFObject
+	hasher := md5.New()
+	for number, obj := range p.Objects {
+		if digest, ok := source.digests[number]; ok && digest == objectDigest(obj) {
+			continue
+		}
+		changed = append(changed, obj)
+		objBase := obj.GetObject()
+		if objBase.Free == 'f' {
+			continue
+		}
+		objBase.Offset = p.CurrentPosition
+		data := obj.Data()
+		hasher.Write(data)
+		if err := p.WriteLine(objBase.Indirect(data), output); err != nil {
+			return err
+		}
+	}
+
+	// Free entries form a linked list, each one giving the number of the
+	// next free object, the last one giving 0. When free objects change,
+	// all the entries of the list are written again.
+	free := freeNumbers(p.Objects)
+	if !slices.Equal(free, source.free) {
+		for _, number := range free {
+			if !slices.Contains(changed, p.Objects[number]) {
+				changed = append(changed, p.Objects[number])
+			}
+		}
+		slices.SortFunc(changed, func(a, b godyf.PDFObject) int {
+			return a.GetObject().Number - b.GetObject().Number
+		})
+	}
+	next := make(map[int]int, len(free))
+	for i, number := range free {
+		next[number] = free[(i+1)%len(free)]
+	}
+
+	trailer := map[string]interface{}{
+		"Root": p.Catalog.Ref(),
+		"Prev": int(source.startXRef),
+	}
+	if p.Info != nil {
+		trailer["Info"] = p.Info.Ref()
+	}
+
+	// The first identifier is permanent, the second one changes with each update
+	if id, ok := p.Trailer.Get("ID").(*godyf.Array); ok && id.Len() == 2 {
+		trailer["ID"] = godyf.NewArray(id.Get(0), godyf.NewString(hex.EncodeToString(hasher.Sum(nil))))
+	}
+
+	var err error
+	if source.xrefStream {
+		err = p.writeIncrementalXRefStream(output, changed, next, trailer)
+	} else {
+		err = p.writeIncrementalXRefTable(output, changed, next, trailer)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Chain further updates to this one
+	p.Trailer = godyf.NewDictionary(trailer)
+	source.size = int64(p.CurrentPosition)
+	source.endsInEOL = true
+	source.startXRef = int64(p.XRefPosition)
+	source.snapshot(p.Objects)
+	return nil
+}
+
+// writeIncrementalXRefTable writes a cross-reference table listing the
+// changed objects, followed by the trailer. Next gives the next free
+// object of free objects.
+func (p *PDF) writeIncrementalXRefTable(output io.Writer, changed []godyf.PDFObject, next map[int]int, trailer map[string]interface{}) error {
+	p.XRefPosition = p.CurrentPosition
+	if err := p.WriteLine([]byte("xref"), output); err != nil {
+		return err
+	}
+
+	// Consecutive objects are grouped in subsections
+	for start := 0; start < len(changed); {
+		end := start + 1
+		for end < len(changed) && changed[end].GetObject().Number == changed[end-1].GetObject().Number+1 {
+			end++
+		}
+		header := fmt.Sprintf("%d %d", changed[start].GetObject().Number, end-start)
+		if err := p.WriteLine([]byte(header), output); err != nil {
+			return err
+		}
+		for _, obj := range changed[start:end] {
+			objBase := obj.GetObject()
+			offset := objBase.Offset
+			if objBase.Free == 'f' {
+				offset = next[objBase.Number]
+			}
+			entry := fmt.Sprintf("%010d %05d %c ", offset, objBase.Generation, objBase.Free)
+			if err := p.WriteLine([]byte(entry), output); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+
+	trailer["Size"] = len(p.Objects)
+	if err := p.WriteLine([]byte("trailer"), output); err != nil {
+		return err
+	}
+	if err := p.WriteLine(godyf.NewDictionary(trailer).Data(), output); err != nil {
+		return err
+	}
+	return p.writeStartXRef(output)
+}
+
+// writeIncrementalXRefStream writes a cross-reference stream listing the
+// changed objects and the stream itself. Next gives the next free object
+// of free objects.
+func (p *PDF) writeIncrementalXRefStream(output io.Writer, changed []godyf.PDFObject, next map[int]int, trailer map[string]interface{}) error {
+	xrefStream := godyf.NewStream(nil, nil, true)
+	p.addObject(xrefStream)
+	p.XRefPosition = p.CurrentPosition
+	xrefStream.GetObject().Offset = p.CurrentPosition
+	changed = append(changed, xrefStream)
+
+	var entries [][3]int
+	var index []interface{}
+	maxOffset, maxGeneration := 0, 0
+	for i, obj := range changed {
+		objBase := obj.GetObject()
+		if i == 0 || objBase.Number != changed[i-1].GetObject().Number+1 {
+			index = append(index, objBase.Number, 0)
+		}
+		index[len(index)-1] = index[len(index)-1].(int) + 1
+		if objBase.Free == 'f' {
+			entries = append(entries, [3]int{0, next[objBase.Number], objBase.Generation})
+		} else {
+			entries = append(entries, [3]int{1, objBase.Offset, objBase.Generation})
+		}
+		maxOffset = max(maxOffset, entries[len(entries)-1][1])
+		maxGeneration = max(maxGeneration, objBase.Generation)
+	}
+
+	widths := [3]int{1, fieldWidth(maxOffset), fieldWidth(maxGeneration)}
+	var data bytes.Buffer
+	for _, entry := range entries {
+		for i, value := range entry {
+			for shift := (widths[i] - 1) * 8; shift >= 0; shift -= 8 {
+				data.WriteByte(byte(value >> shift))
+			}
+		}
+	}
+
+	trailer["Size"] = len(p.Objects)
+	extra := map[string]interface{}{
+		"Type":  godyf.Name("XRef"),
+		"Index": godyf.NewArray(index...),
+		"W":     godyf.NewArray(widths[0], widths[1], widths[2]),
+	}
+	for key, value := range trailer {
+		extra[key] = value
+	}
+	xrefStream.Stream = []interface{}{data.Bytes()}
+	xrefStream.Extra = extra
+
+	indirect := xrefStream.GetObject().Indirect(xrefStream.Data())
+	if err := p.WriteLine(indirect, output); err != nil {
+		return err
+	}
+	return p.writeStartXRef(output)
+}
+
+// writeStartXRef writes the startxref section ending the file
+func (p *PDF) writeStartXRef(output io.Writer) error {
+	if err := p.WriteLine([]byte("startxref"), output); err != nil {
+		return err
+	}
+	if err := p.WriteLine([]byte(fmt.Sprintf("%d", p.XRefPosition)), output); err != nil {
+		return err
+	}
+	return p.WriteLine([]byte("%%EOF"), output)
+}
+
+// fieldWidth returns the number of bytes needed to store value in a
+// cross-reference stream field, at least 1
+func fieldWidth(value int) int {
+	width := 1
+	for value > 0xff {
+		value >>= 8
+		width++
+	}
+	return width
+}
@@ -0,0 +1,38 @@
+package pdf
+
+import (
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// AddOutputIntent adds an output intent to the /OutputIntents array of the
+// catalog, describing the output condition the document is intended for,
+// and returns its reference. Subtype is "GTS_PDFA1" for PDF/A or
+// "GTS_PDFX" for PDF/X, identifier names the output condition, such as
+// "sRGB IEC61966-2.1" or "FOGRA39", and info describes it. The profile
+// stream is added to the document if needed, profile being nil for
+// registered output conditions.
+func (p *PDF) AddOutputIntent(subtype, identifier, info string, profile *godyf.ICCBased) godyf.Ref {
+	intent := godyf.NewDictionary(nil)
+	intent.Set("Type", godyf.Name("OutputIntent"))
+	intent.Set("S", godyf.Name(subtype))
+	intent.Set("OutputConditionIdentifier", godyf.NewString(identifier))
+	if info != "" {
+		intent.Set("Info", godyf.NewString(info))
+	}
+	if profile != nil {
+		number := profile.Stream.GetObject().Number
+		if number <= 0 || number >= len(p.Objects) || p.Objects[number] != godyf.PDFObject(profile.Stream) {
+			p.AddObject(profile.Stream)
+		}
+		intent.Set("DestOutputProfile", profile.Stream.Ref())
+	}
+	p.AddObject(intent)
+
+	intents, ok := p.Resolve(p.Catalog.Get("OutputIntents")).(*godyf.Array)
+	if !ok {
+		intents = godyf.NewArray()
+		p.Catalog.Set("OutputIntents", intents)
+	}
+	intents.Add(intent.Ref())
+	return intent.Ref()
+}
@@ -0,0 +1,423 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// tokenKind identifies the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenInteger
+	tokenReal
+	tokenName
+	tokenString
+	tokenArrayStart
+	tokenArrayEnd
+	tokenDictStart
+	tokenDictEnd
+	tokenKeyword
+)
+
+// token is a lexical token of a PDF file
+type token struct {
+	kind   tokenKind
+	offset int64  // Offset of the token in the input
+	text   string // Keyword, number literal or decoded name
+	data   []byte // Decoded string content
+}
+
+// integer returns the value of an integer token
+func (t token) integer() int {
+	value, _ := strconv.ParseInt(t.text, 10, 64)
+	return int(value)
+}
+
+// real returns the value of a numeric token
+func (t token) real() float64 {
+	value, _ := strconv.ParseFloat(t.text, 64)
+	return value
+}
+
+// is returns whether the token is the given keyword
+func (t token) is(keyword string) bool {
+	return t.kind == tokenKeyword && t.text == keyword
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenName:
+		return "/" + t.text
+	case tokenString:
+		return fmt.Sprintf("string %q", t.data)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexerBufferSize is the size of the window read at once from the input
+const lexerBufferSize = 4096
+
+// lexer splits PDF input read from an io.ReaderAt into tokens
+type lexer struct {
+	r        io.ReaderAt
+	size     int64
+	pos      int64   // Offset of the next byte to read
+	buf      []byte  // Window of the input
+	bufStart int64   // Offset of buf[0] in the input
+	pushed   []token // Tokens pushed back, read before the input
+}
+
+// newLexer returns a lexer reading size bytes from r
+func newLexer(r io.ReaderAt, size int64) *lexer {
+	return &lexer{r: r, size: size}
+}
+
+// seek moves the lexer to offset, discarding pushed back tokens
+func (l *lexer) seek(offset int64) {
+	l.pos = offset
+	l.pushed = l.pushed[:0]
+}
+
+// position returns the offset of the next token or byte to read
+func (l *lexer) position() int64 {
+	if len(l.pushed) > 0 {
+		return l.pushed[len(l.pushed)-1].offset
+	}
+	return l.pos
+}
+
+// peekByte returns the next byte without consuming it
+func (l *lexer) peekByte() (byte, bool) {
+	if l.pos >= l.size || l.pos < 0 {
+		return 0, false
+	}
+	if l.pos < l.bufStart || l.pos >= l.bufStart+int64(len(l.buf)) {
+		length := int64(lexerBufferSize)
+		if l.size-l.pos < length {
+			length = l.size - l.pos
+		}
+		if cap(l.buf) < int(length) {
+			l.buf = make([]byte, length)
+		}
+		l.buf = l.buf[:length]
+		n, err := l.r.ReadAt(l.buf, l.pos)
+		l.buf = l.buf[:n]
+		l.bufStart = l.pos
+		if n == 0 && err != nil {
+			return 0, false
+		}
+	}
+	return l.buf[l.pos-l.bufStart], true
+}
+
+// readByte consumes and returns the next byte
+func (l *lexer) readByte() (byte, bool) {
+	c, ok := l.peekByte()
+	if ok {
+		l.pos++
+	}
+	return c, ok
+}
+
+// readAt reads length bytes at offset, bypassing the token stream
+func (l *lexer) readAt(offset int64, length int) ([]byte, error) {
+	if offset < 0 || length < 0 || offset+int64(length) > l.size {
+		return nil, fmt.Errorf("read of %d bytes at offset %d out of bounds", length, offset)
+	}
+	data := make([]byte, length)
+	if _, err := l.r.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unread pushes back a token, that will be returned by the next call to next
+func (l *lexer) unread(t token) {
+	l.pushed = append(l.pushed, t)
+}
+
+// skipSpace skips whitespace and comments
+func (l *lexer) skipSpace() {
+	for {
+		c, ok := l.peekByte()
+		if !ok {
+			return
+		}
+		if c == '%' {
+			for {
+				c, ok = l.readByte()
+				if !ok || c == '\r' || c == '\n' {
+					break
+				}
+			}
+			continue
+		}
+		if !isWhitespace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// skipEOL skips the end-of-line marker following the stream keyword
+func (l *lexer) skipEOL() {
+	c, ok := l.peekByte()
+	if !ok {
+		return
+	}
+	if c == '\r' {
+		l.pos++
+		c, ok = l.peekByte()
+	}
+	if ok && c == '\n' {
+		l.pos++
+	}
+}
+
+// next returns the next token
+func (l *lexer) next() (token, error) {
+	if n := len(l.pushed); n > 0 {
+		t := l.pushed[n-1]
+		l.pushed = l.pushed[:n-1]
+		return t, nil
+	}
+
+	l.skipSpace()
+	offset := l.pos
+	c, ok := l.readByte()
+	if !ok {
+		return token{kind: tokenEOF, offset: offset}, nil
+	}
+
+	switch c {
+	case '[':
+		return token{kind: tokenArrayStart, offset: offset, text: "["}, nil
+	case ']':
+		return token{kind: tokenArrayEnd, offset: offset, text: "]"}, nil
+	case '{', '}':
+		return token{kind: tokenKeyword, offset: offset, text: string(c)}, nil
+	case '/':
+		return token{kind: tokenName, offset: offset, text: l.readName()}, nil
+	case '(':
+		data, err := l.readLiteralString()
+		return token{kind: tokenString, offset: offset, data: data}, err
+	case '<':
+		if next, _ := l.peekByte(); next == '<' {
+			l.pos++
+			return token{kind: tokenDictStart, offset: offset, text: "<<"}, nil
+		}
+		data, err := l.readHexString()
+		return token{kind: tokenString, offset: offset, data: data}, err
+	case '>':
+		if next, _ := l.peekByte(); next == '>' {
+			l.pos++
+			return token{kind: tokenDictEnd, offset: offset, text: ">>"}, nil
+		}
+		return token{}, fmt.Errorf("unexpected '>' at offset %d", offset)
+	case ')':
+		return token{}, fmt.Errorf("unexpected ')' at offset %d", offset)
+	}
+
+	// Numbers and keywords are sequences of regular characters
+	text := []byte{c}
+	for {
+		next, ok := l.peekByte()
+		if !ok || isWhitespace(next) || isDelimiter(next) {
+			break
+		}
+		text = append(text, next)
+		l.pos++
+	}
+	return token{kind: numberKind(text), offset: offset, text: string(text)}, nil
+}
+
+// numberKind returns the kind of a regular character sequence
+func numberKind(text []byte) tokenKind {
+	digits, dots := 0, 0
+	for i, c := range text {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.':
+			dots++
+		case (c == '+' || c == '-') && i == 0:
+		default:
+			return tokenKeyword
+		}
+	}
+	if digits == 0 || dots > 1 {
+		return tokenKeyword
+	}
+	if dots == 1 {
+		return tokenReal
+	}
+	return tokenInteger
+}
+
+// readName reads a name after its slash, decoding #xx escapes
+func (l *lexer) readName() string {
+	var name []byte
+	for {
+		c, ok := l.peekByte()
+		if !ok || isWhitespace(c) || isDelimiter(c) {
+			break
+		}
+		l.pos++
+		if c == '#' {
+			if high, ok := l.peekHexDigit(0); ok {
+				if low, ok := l.peekHexDigit(1); ok {
+					l.pos += 2
+					name = append(name, high<<4|low)
+					continue
+				}
+			}
+		}
+		name = append(name, c)
+	}
+	return string(name)
+}
+
+// peekHexDigit returns the value of the hexadecimal digit at the given
+// distance from the current position
+func (l *lexer) peekHexDigit(distance int64) (byte, bool) {
+	l.pos += distance
+	c, ok := l.peekByte()
+	l.pos -= distance
+	if !ok {
+		return 0, false
+	}
+	return hexValue(c)
+}
+
+// readLiteralString reads a literal string after its opening parenthesis
+func (l *lexer) readLiteralString() ([]byte, error) {
+	var data []byte
+	depth := 1
+	for {
+		c, ok := l.readByte()
+		if !ok {
+			return data, fmt.Errorf("unterminated literal string")
+		}
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return data, nil
+			}
+		case '\r':
+			// End-of-line markers are read as a single line feed
+			if next, _ := l.peekByte(); next == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			c, ok = l.readByte()
+			if !ok {
+				return data, fmt.Errorf("unterminated literal string")
+			}
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// Line continuation
+				if next, _ := l.peekByte(); c == '\r' && next == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					value := c - '0'
+					for i := 0; i < 2; i++ {
+						next, ok := l.peekByte()
+						if !ok || next < '0' || next > '7' {
+							break
+						}
+						l.pos++
+						value = value<<3 | (next - '0')
+					}
+					c = value
+				}
+			}
+		}
+		data = append(data, c)
+	}
+}
+
+// readHexString reads a hexadecimal string after its opening bracket
+func (l *lexer) readHexString() ([]byte, error) {
+	var data []byte
+	var high byte
+	odd := false
+	for {
+		c, ok := l.readByte()
+		if !ok {
+			return data, fmt.Errorf("unterminated hexadecimal string")
+		}
+		if c == '>' {
+			break
+		}
+		if isWhitespace(c) {
+			continue
+		}
+		value, ok := hexValue(c)
+		if !ok {
+			return data, fmt.Errorf("invalid character %q in hexadecimal string", c)
+		}
+		if odd {
+			data = append(data, high<<4|value)
+		} else {
+			high = value
+		}
+		odd = !odd
+	}
+	if odd {
+		data = append(data, high<<4)
+	}
+	return data, nil
+}
+
+// hexValue returns the value of a hexadecimal digit
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// isWhitespace reports whether c is a PDF whitespace character
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// isDelimiter reports whether c is a PDF delimiter character
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,808 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// LinearizeOptions configures linearized output
+type LinearizeOptions struct {
+	// Options used as for WriteWithOptions. Object streams require a
+	// cross-reference stream, hybrid cross-reference sections and object
+	// stream limits are not supported.
+	WriteOptions
+	// PrimaryHintLimit, when positive, is the maximum size in bytes of the
+	// hint table data stored in the primary hint stream. The rest of the
+	// data is stored in an overflow hint stream written before the main
+	// cross-reference section.
+	PrimaryHintLimit int
+}
+
+// Validate returns an error if options are invalid, inconsistent or not
+// supported by linearized output
+func (o LinearizeOptions) Validate() error {
+	if err := o.WriteOptions.Validate(); err != nil {
+		return err
+	}
+	switch {
+	case o.XRef == XRefHybrid:
+		return fmt.Errorf("hybrid cross-reference sections are not supported in linearized files")
+	case o.XRef == XRefStream && !o.ObjectStreams:
+		return fmt.Errorf("cross-reference streams require object streams in linearized files")
+	case o.MaxObjectsPerStream > 0 || o.MaxObjectStreamBytes > 0 || o.GroupObjectStreamsByPage:
+		return fmt.Errorf("object stream limits are not supported in linearized files")
+	case o.PrimaryHintLimit < 0:
+		return fmt.Errorf("invalid primary hint limit %d", o.PrimaryHintLimit)
+	}
+	return nil
+}
+
+// referencePattern matches indirect references in raw PDF syntax given as strings
+var referencePattern = regexp.MustCompile(`\b(\d+)\s+(\d+)\s+R\b`)
+
+// references calls add with the number of each object referenced by value
+func references(value interface{}, add func(int)) {
+	switch v := value.(type) {
+	case godyf.Ref:
+		add(v.Number)
+	case string:
+		for _, match := range referencePattern.FindAllStringSubmatch(v, -1) {
+			number, _ := strconv.Atoi(match[1])
+			add(number)
+		}
+	case []byte:
+		references(string(v), add)
+	case *godyf.Dictionary:
+		for _, key := range v.Keys() {
+			references(v.Values[key], add)
+		}
+	case map[string]interface{}:
+		references(godyf.NewDictionary(v), add)
+	case *godyf.Array:
+		references(v.Elements, add)
+	case []interface{}:
+		for _, element := range v {
+			references(element, add)
+		}
+	case *godyf.Stream:
+		references(v.Extra, add)
+	case *IndirectValue:
+		references(v.Value, add)
+	}
+}
+
+// renumber returns a copy of value whose references use the new object
+// numbers. References to objects missing from numbers become null.
+func renumber(value interface{}, numbers map[int]int) interface{} {
+	return mapReferences(value, func(ref godyf.Ref) interface{} {
+		if number, ok := numbers[ref.Number]; ok {
+			return godyf.Ref{Number: number}
+		}
+		return godyf.Null{}
+	})
+}
+
+// mapReferences returns a copy of value whose references are replaced by
+// the values returned by replace
+func mapReferences(value interface{}, replace func(godyf.Ref) interface{}) interface{} {
+	switch v := value.(type) {
+	case godyf.Ref:
+		return replace(v)
+	case string:
+		return referencePattern.ReplaceAllStringFunc(v, func(reference string) string {
+			fields := strings.Fields(reference)
+			number, _ := strconv.Atoi(fields[0])
+			generation, _ := strconv.Atoi(fields[1])
+			return string(godyf.ToBytes(replace(godyf.Ref{Number: number, Generation: generation})))
+		})
+	case []byte:
+		return []byte(mapReferences(string(v), replace).(string))
+	case *godyf.Dictionary:
+		dictionary := godyf.NewDictionary(nil)
+		for _, key := range v.Keys() {
+			dictionary.Set(key, mapReferences(v.Values[key], replace))
+		}
+		return dictionary
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			values[key] = mapReferences(element, replace)
+		}
+		return values
+	case *godyf.Array:
+		return godyf.NewArrayFromSlice(mapReferences(v.Elements, replace).([]interface{}))
+	case []interface{}:
+		elements := make([]interface{}, len(v))
+		for i, element := range v {
+			elements[i] = mapReferences(element, replace)
+		}
+		return elements
+	}
+	return value
+}
+
+// renumberedData returns the serialized value of obj, with references
+// using the new object numbers and streams compressed with level
+func renumberedData(obj godyf.PDFObject, numbers map[int]int, level int) []byte {
+	switch o := obj.(type) {
+	case *godyf.Stream:
+		stream := *o
+		stream.Extra = renumber(o.Extra, numbers).(map[string]interface{})
+		return stream.DataWithLevel(level)
+	case *IndirectValue:
+		return godyf.ToBytes(renumber(o.Value, numbers))
+	case *godyf.Dictionary, *godyf.Array:
+		return renumber(o, numbers).(godyf.PDFObject).Data()
+	}
+	return obj.Data()
+}
+
+// pageTree returns the numbers of the page objects in document order and
+// of the page tree nodes
+func (p *PDF) pageTree() ([]int, map[int]bool) {
+	var pages []int
+	nodes := make(map[int]bool)
+	var walk func(node *godyf.Dictionary)
+	walk = func(node *godyf.Dictionary) {
+		nodes[node.GetObject().Number] = true
+		kids, _ := node.Get("Kids").(*godyf.Array)
+		if kids == nil {
+			return
+		}
+		for _, kid := range kids.Elements {
+			ref, ok := kid.(godyf.Ref)
+			if !ok || nodes[ref.Number] {
+				continue
+			}
+			dictionary, ok := p.Resolve(ref).(*godyf.Dictionary)
+			if !ok {
+				continue
+			}
+			if dictionary.Get("Type") == godyf.Name("Pages") {
+				walk(dictionary)
+			} else {
+				pages = append(pages, ref.Number)
+			}
+		}
+	}
+	walk(p.Pages)
+	return pages, nodes
+}
+
+// referenceGraph returns the objects in use and the graph of references
+// between them, by object number
+func (p *PDF) referenceGraph() (map[int]bool, map[int][]int) {
+	inUse := make(map[int]bool)
+	for number, obj := range p.Objects {
+		if number > 0 && obj.GetObject().Free != 'f' {
+			inUse[number] = true
+		}
+	}
+	graph := make(map[int][]int)
+	for number := range inUse {
+		references(p.Objects[number], func(reference int) {
+			if inUse[reference] {
+				graph[number] = append(graph[number], reference)
+			}
+		})
+	}
+	return inUse, graph
+}
+
+// closure returns start followed by the objects it references directly or
+// indirectly, in discovery order, without visiting objects for which skip
+// returns true
+func closure(start int, graph map[int][]int, skip func(int) bool) []int {
+	result := []int{start}
+	visited := map[int]bool{start: true}
+	for i := 0; i < len(result); i++ {
+		for _, number := range graph[result[i]] {
+			if !visited[number] && !skip(number) {
+				visited[number] = true
+				result = append(result, number)
+			}
+		}
+	}
+	return result
+}
+
+// linearUnit is a block of a linearized file written on its own line,
+// usually an indirect object
+type linearUnit struct {
+	number int    // Object number, 0 for blocks that aren't objects
+	data   []byte // Written bytes, without the end-of-line marker
+	offset int    // Offset in the file
+}
+
+// length returns the number of bytes taken by the unit in the file
+func (u *linearUnit) length() int {
+	return len(u.data) + 1
+}
+
+// linearSection is a group of objects written together in a linearized file
+type linearSection struct {
+	objects []int // Old numbers of the objects written directly, in file order
+	packed  []int // Old numbers of the objects stored in the object stream of the section
+	stream  int   // New number of the object stream, 0 if none
+	first   int   // New number of the first object
+	count   int   // Number of object numbers used, including objects in the object stream
+	units   []*linearUnit
+	content int   // For pages, new number of the first content stream, 0 if none
+	shared  []int // For pages, identifiers of the shared objects used
+}
+
+// length returns the number of bytes taken by the section in the file
+func (s *linearSection) length() int {
+	length := 0
+	for _, unit := range s.units {
+		length += unit.length()
+	}
+	return length
+}
+
+// linearizer lays out the objects of a document for linearized output
+type linearizer struct {
+	p          *PDF
+	compress   bool
+	options    LinearizeOptions
+	identifier *godyf.Array
+
+	numbers    map[int]int       // New numbers of the document objects
+	compressed map[int]xrefEntry // Entries of the objects in object streams, by new number
+	offsets    map[int]int       // Offsets of the objects not in object streams, by new number
+
+	document *linearSection   // Catalog and document-level objects
+	pages    []*linearSection // Page objects, the first page section coming first
+	shared   *linearSection   // Objects shared by pages other than the first one
+	other    *linearSection   // Objects not needed by pages
+
+	mainSize         int // Size of the main cross-reference section
+	size             int // Size of the whole cross-reference table
+	linearizedNumber int
+	firstXRefNumber  int
+	hintNumber       int
+	overflowNumber   int
+	mainXRefNumber   int
+}
+
+// WriteLinearized writes the PDF to the output as a linearized file,
+// letting viewers display the first page before the rest of the file is
+// downloaded. Objects are reordered and renumbered: the first page and the
+// objects it needs come first, followed by the other pages, the objects
+// they share and the remaining objects. References must be godyf.Ref
+// values, or "N G R" in raw strings. Options are validated before anything
+// is written; object streams are stored with cross-reference streams, when
+// ObjectStreams is set with XRefStream. The hash of the identifier is the
+// hash of the objects as written.
+func (p *PDF) WriteLinearized(output io.Writer, options LinearizeOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	identifier, err := options.identifier()
+	if err != nil {
+		return err
+	}
+	l := &linearizer{
+		p:          p,
+		compress:   options.ObjectStreams,
+		options:    options,
+		numbers:    make(map[int]int),
+		compressed: make(map[int]xrefEntry),
+		offsets:    make(map[int]int),
+	}
+	if err := p.finishResources(); err != nil {
+		return err
+	}
+	return p.deduplicated(func() error {
+		if err := l.layout(); err != nil {
+			return err
+		}
+		if identifier != nil {
+			id, err := identifierArray(identifier, l.dataHash())
+			if err != nil {
+				return err
+			}
+			l.identifier = id
+		}
+
+		p.CurrentPosition = 0
+		header := append([]byte("%PDF-"), options.version()...)
+		for _, line := range [][]byte{header, []byte("%\xf0\x9f\x96\xa4")} {
+			if err := p.WriteLine(line, output); err != nil {
+				return err
+			}
+		}
+		return l.write(output)
+	})
+}
+
+// layout assigns the objects to the sections of the file and numbers them
+func (l *linearizer) layout() error {
+	p := l.p
+	pages, nodes := p.pageTree()
+	if len(pages) == 0 {
+		return fmt.Errorf("linearized documents need at least one page")
+	}
+
+	inUse, graph := p.referenceGraph()
+
+	// Pages are reached from the page tree only, not from other pages
+	isPage := make(map[int]bool)
+	for _, number := range pages {
+		isPage[number] = true
+	}
+	catalog := p.Catalog.GetObject().Number
+	assigned := make(map[int]bool)
+	structural := func(number int) bool {
+		return isPage[number] || nodes[number] || number == catalog
+	}
+	skip := func(number int) bool {
+		return structural(number) || assigned[number]
+	}
+
+	// The first page section holds all the objects needed by the first page
+	l.pages = []*linearSection{{objects: closure(pages[0], graph, skip)}}
+	for _, number := range l.pages[0].objects {
+		assigned[number] = true
+	}
+
+	// Objects needed by only one of the other pages go with this page,
+	// the other ones are shared
+	needed := make([][]int, len(pages))
+	owners := make(map[int]int)
+	for i, page := range pages[1:] {
+		needed[i+1] = closure(page, graph, skip)
+		for _, number := range needed[i+1] {
+			owners[number]++
+		}
+	}
+	l.shared = &linearSection{}
+	for i := range pages[1:] {
+		page := &linearSection{}
+		for _, number := range needed[i+1] {
+			if owners[number] == 1 {
+				page.objects = append(page.objects, number)
+			} else if !assigned[number] {
+				l.shared.objects = append(l.shared.objects, number)
+			}
+			assigned[number] = true
+		}
+		l.pages = append(l.pages, page)
+	}
+
+	// Document-level objects needed to open the document go with the catalog
+	l.document = &linearSection{objects: []int{catalog}}
+	assigned[catalog] = true
+	for _, key := range []string{"ViewerPreferences", "PageMode", "Threads", "OpenAction", "AcroForm", "Encrypt"} {
+		references(p.Catalog.Get(key), func(reference int) {
+			if inUse[reference] && !skip(reference) {
+				for _, number := range closure(reference, graph, skip) {
+					assigned[number] = true
+					l.document.objects = append(l.document.objects, number)
+				}
+			}
+		})
+	}
+
+	l.other = &linearSection{}
+	for number := 1; number < len(p.Objects); number++ {
+		if inUse[number] && !assigned[number] {
+			l.other.objects = append(l.other.objects, number)
+		}
+	}
+
+	// Objects of the other pages (except page objects) and other objects
+	// can be stored in object streams, shared objects stay out so that each
+	// one is a group of the shared object hint table
+	if l.compress {
+		for _, section := range append(l.pages[1:], l.other) {
+			var objects []int
+			for i, number := range section.objects {
+				if p.Objects[number].Compressible() && (section == l.other || i > 0) {
+					section.packed = append(section.packed, number)
+				} else {
+					objects = append(objects, number)
+				}
+			}
+			section.objects = objects
+		}
+	}
+
+	// Number the main section: other pages, shared objects, other objects,
+	// followed by the overflow hint stream and the cross-reference stream
+	next := 1
+	for _, section := range append(append(l.pages[1:], l.shared), l.other) {
+		next = l.number(section, next)
+	}
+	if l.options.PrimaryHintLimit > 0 {
+		l.overflowNumber, next = next, next+1
+	}
+	if l.compress {
+		l.mainXRefNumber, next = next, next+1
+	}
+	l.mainSize = next
+
+	// Number the first-page section: linearization dictionary, cross-reference
+	// stream, document-level objects, hint stream and first page
+	l.linearizedNumber, next = next, next+1
+	if l.compress {
+		l.firstXRefNumber, next = next, next+1
+	}
+	next = l.number(l.document, next)
+	l.hintNumber, next = next, next+1
+	l.size = l.number(l.pages[0], next)
+
+	// Serialize the objects now that all the numbers are known
+	for _, section := range l.sections() {
+		l.serialize(section)
+	}
+
+	// Record the content streams and the shared objects used by pages
+	identifiers := make(map[int]int)
+	for i, number := range l.pages[0].objects {
+		identifiers[number] = i
+	}
+	for i, number := range l.shared.objects {
+		identifiers[number] = len(l.pages[0].objects) + i
+	}
+	for i, page := range pages {
+		if dictionary, ok := p.Objects[page].(*godyf.Dictionary); ok {
+			contents := dictionary.Get("Contents")
+			if array, ok := contents.(*godyf.Array); ok {
+				contents = array.Get(0)
+			}
+			references(contents, func(reference int) {
+				if l.pages[i].content == 0 && inUse[reference] {
+					l.pages[i].content = l.numbers[reference]
+				}
+			})
+		}
+		if i == 0 {
+			continue
+		}
+		for _, number := range closure(page, graph, structural) {
+			if identifier, ok := identifiers[number]; ok {
+				l.pages[i].shared = append(l.pages[i].shared, identifier)
+			}
+		}
+		sort.Ints(l.pages[i].shared)
+	}
+	return nil
+}
+
+// sections returns the sections of objects, in file order
+func (l *linearizer) sections() []*linearSection {
+	return append(append(append([]*linearSection{l.document}, l.pages...), l.shared), l.other)
+}
+
+// dataHash returns the hexadecimal MD5 hash of the serialized objects, in
+// file order
+func (l *linearizer) dataHash() string {
+	hasher := md5.New()
+	for _, section := range l.sections() {
+		for _, unit := range section.units {
+			hasher.Write(unit.data)
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// number gives consecutive numbers starting at next to the objects of
+// section, returning the next available number
+func (l *linearizer) number(section *linearSection, next int) int {
+	section.first = next
+	for _, number := range section.objects {
+		l.numbers[number], next = next, next+1
+	}
+	if len(section.packed) > 0 {
+		section.stream, next = next, next+1
+		for _, number := range section.packed {
+			l.numbers[number], next = next, next+1
+		}
+	}
+	section.count = next - section.first
+	return next
+}
+
+// serialize builds the units of a section
+func (l *linearizer) serialize(section *linearSection) {
+	for _, number := range section.objects {
+		object := godyf.Object{Number: l.numbers[number]}
+		data := object.Indirect(renumberedData(l.p.Objects[number], l.numbers, l.options.CompressionLevel))
+		section.units = append(section.units, &linearUnit{number: object.Number, data: data})
+	}
+	if section.stream == 0 {
+		return
+	}
+	numbers := make([]int, len(section.packed))
+	data := make([][]byte, len(section.packed))
+	for i, number := range section.packed {
+		numbers[i] = l.numbers[number]
+		data[i] = renumberedData(l.p.Objects[number], l.numbers, l.options.CompressionLevel)
+		l.compressed[numbers[i]] = xrefEntry{kind: 2, offset: int64(section.stream), generation: i}
+	}
+	stream := newObjectStream(numbers, data, true)
+	stream.Number = section.stream
+	section.units = append(section.units, &linearUnit{number: stream.Number, data: stream.Indirect(stream.DataWithLevel(l.options.CompressionLevel))})
+}
+
+// place sets the offsets of units starting at position, returning the
+// position following them
+func (l *linearizer) place(units []*linearUnit, position int) int {
+	for _, unit := range units {
+		unit.offset = position
+		if unit.number > 0 {
+			l.offsets[unit.number] = position
+		}
+		position += unit.length()
+	}
+	return position
+}
+
+// write writes the objects and cross-reference sections after the header.
+// The linearization dictionary, the first-page cross-reference section and
+// the primary hint stream depend on the offsets of the objects following
+// them: the layout is computed again with more space reserved for them
+// until they fit, and they are padded with spaces.
+func (l *linearizer) write(output io.Writer) error {
+	p := l.p
+	var reserved [3]int
+	for pass := 0; pass < 16; pass++ {
+		// Place the units in file order
+		position := p.CurrentPosition
+		linearizedOffset := position
+		position += reserved[0]
+		firstXRefOffset := position
+		position += reserved[1]
+		position = l.place(l.document.units, position)
+		hintOffset := position
+		position += reserved[2]
+		l.offsets[l.linearizedNumber] = linearizedOffset
+		l.offsets[l.hintNumber] = hintOffset
+		if l.firstXRefNumber > 0 {
+			l.offsets[l.firstXRefNumber] = firstXRefOffset
+		}
+		for _, section := range append(append(l.pages, l.shared), l.other) {
+			position = l.place(section.units, position)
+		}
+		firstPageEnd := hintOffset + reserved[2] + l.pages[0].length()
+
+		// Build the hint streams, offsets in the hint tables ignore the primary hint stream
+		hints, sharedOffset := l.hintTables(reserved[2])
+		primary := hints
+		var tail []*linearUnit
+		overflowOffset, overflowLength := 0, 0
+		if l.overflowNumber > 0 {
+			if len(hints) > l.options.PrimaryHintLimit {
+				primary = hints[:l.options.PrimaryHintLimit]
+			}
+			overflow := l.hintStream(l.overflowNumber, hints[len(primary):], nil, 0)
+			overflowOffset, overflowLength = position, overflow.length()
+			tail = append(tail, overflow)
+		}
+		position = l.place(tail, position)
+
+		// Build the main cross-reference section
+		mainXRefOffset := position
+		mainXRef, mainEntry := l.mainXRef(mainXRefOffset, firstXRefOffset)
+		position = l.place([]*linearUnit{mainXRef}, position)
+		fileLength := position
+
+		linearized := func(padding int) *linearUnit {
+			dictionary := godyf.NewDictionary(nil)
+			dictionary.Set("Linearized", 1)
+			dictionary.Set("L", fileLength)
+			hint := godyf.NewArray(hintOffset, reserved[2])
+			if l.overflowNumber > 0 {
+				hint.Add(overflowOffset)
+				hint.Add(overflowLength)
+			}
+			dictionary.Set("H", hint)
+			dictionary.Set("O", l.pages[0].first)
+			dictionary.Set("E", firstPageEnd)
+			dictionary.Set("N", len(l.pages))
+			dictionary.Set("T", mainEntry)
+			object := godyf.Object{Number: l.linearizedNumber}
+			data := append(dictionary.Data(), bytes.Repeat([]byte(" "), padding)...)
+			return &linearUnit{number: object.Number, data: object.Indirect(data), offset: linearizedOffset}
+		}
+		firstXRef := func(padding int) *linearUnit {
+			return l.firstXRef(firstXRefOffset, mainXRefOffset, padding)
+		}
+		hint := func(padding int) *linearUnit {
+			return l.hintStream(l.hintNumber, primary, map[string]interface{}{"S": sharedOffset}, padding)
+		}
+
+		// Grow the reserved space until everything fits
+		builders := []func(int) *linearUnit{linearized, firstXRef, hint}
+		fits := true
+		for i, build := range builders {
+			if length := build(0).length(); length > reserved[i] {
+				reserved[i] = length
+				fits = false
+			}
+		}
+		if !fits {
+			continue
+		}
+
+		units := []*linearUnit{
+			linearized(reserved[0] - linearized(0).length()),
+			firstXRef(reserved[1] - firstXRef(0).length()),
+		}
+		units = append(units, l.document.units...)
+		units = append(units, hint(reserved[2]-hint(0).length()))
+		for _, section := range append(append(l.pages, l.shared), l.other) {
+			units = append(units, section.units...)
+		}
+		units = append(units, tail...)
+		units = append(units, mainXRef)
+		for _, unit := range units {
+			if err := p.WriteLine(unit.data, output); err != nil {
+				return err
+			}
+		}
+		p.XRefPosition = firstXRefOffset
+		return nil
+	}
+	return fmt.Errorf("linearized layout doesn't converge")
+}
+
+// hintStream returns the unit of a hint stream holding data
+func (l *linearizer) hintStream(number int, data []byte, extra map[string]interface{}, padding int) *linearUnit {
+	stream := godyf.NewStream([]interface{}{data}, extra, l.compress)
+	stream.Number = number
+	streamData := append(stream.DataWithLevel(l.options.CompressionLevel), bytes.Repeat([]byte(" "), padding)...)
+	return &linearUnit{number: number, data: stream.Indirect(streamData)}
+}
+
+// trailer returns the entries of the first-page trailer
+func (l *linearizer) trailer(mainXRefOffset int) map[string]interface{} {
+	trailer := map[string]interface{}{
+		"Size": l.size,
+		"Root": godyf.Ref{Number: l.numbers[l.p.Catalog.GetObject().Number]},
+		"Prev": mainXRefOffset,
+	}
+	if l.p.Info != nil {
+		if number, ok := l.numbers[l.p.Info.GetObject().Number]; ok {
+			trailer["Info"] = godyf.Ref{Number: number}
+		}
+	}
+	if l.identifier != nil {
+		trailer["ID"] = l.identifier
+	}
+	return trailer
+}
+
+// firstXRef returns the unit of the first-page cross-reference section and
+// trailer, whose startxref is ignored by readers
+func (l *linearizer) firstXRef(offset, mainXRefOffset, padding int) *linearUnit {
+	spaces := bytes.Repeat([]byte(" "), padding)
+	trailer := l.trailer(mainXRefOffset)
+	end := []byte("\nstartxref\n0\n%%EOF")
+
+	if l.compress {
+		var entries [][3]int
+		for number := l.mainSize; number < l.size; number++ {
+			entries = append(entries, [3]int{1, l.offsets[number], 0})
+		}
+		trailer["Index"] = godyf.NewArray(l.mainSize, l.size-l.mainSize)
+		stream := xrefStream(l.firstXRefNumber, entries, trailer)
+		data := stream.Indirect(append(stream.DataWithLevel(l.options.CompressionLevel), spaces...))
+		return &linearUnit{number: l.firstXRefNumber, data: append(data, end...)}
+	}
+
+	var section bytes.Buffer
+	fmt.Fprintf(&section, "xref\n%d %d\n", l.mainSize, l.size-l.mainSize)
+	for number := l.mainSize; number < l.size; number++ {
+		fmt.Fprintf(&section, "%010d 00000 n \n", l.offsets[number])
+	}
+	section.WriteString("trailer\n")
+	section.Write(godyf.NewDictionary(trailer).Data())
+	section.Write(spaces)
+	section.Write(end)
+	return &linearUnit{data: section.Bytes()}
+}
+
+// mainXRef returns the unit of the main cross-reference section and the
+// offset of its first entry, or of the stream
+func (l *linearizer) mainXRef(offset, firstXRefOffset int) (*linearUnit, int) {
+	end := []byte(fmt.Sprintf("\nstartxref\n%d\n%%%%EOF", firstXRefOffset))
+
+	if l.compress {
+		l.offsets[l.mainXRefNumber] = offset
+		entries := [][3]int{{0, 0, 65535}}
+		for number := 1; number < l.mainSize; number++ {
+			if entry, ok := l.compressed[number]; ok {
+				entries = append(entries, [3]int{2, int(entry.offset), entry.generation})
+			} else {
+				entries = append(entries, [3]int{1, l.offsets[number], 0})
+			}
+		}
+		stream := xrefStream(l.mainXRefNumber, entries, map[string]interface{}{"Size": l.mainSize})
+		data := append(stream.Indirect(stream.DataWithLevel(l.options.CompressionLevel)), end...)
+		return &linearUnit{number: l.mainXRefNumber, data: data}, offset
+	}
+
+	var section bytes.Buffer
+	header := fmt.Sprintf("xref\n0 %d", l.mainSize)
+	section.WriteString(header)
+	section.WriteString("\n0000000000 65535 f \n")
+	for number := 1; number < l.mainSize; number++ {
+		fmt.Fprintf(&section, "%010d 00000 n \n", l.offsets[number])
+	}
+	fmt.Fprintf(&section, "trailer\n<< /Size %d >>", l.mainSize)
+	section.Write(end)
+	return &linearUnit{data: section.Bytes()}, offset + len(header)
+}
+
+// xrefStream returns a compressed cross-reference stream holding entries,
+// with the given extra entries
+func xrefStream(number int, entries [][3]int, extra map[string]interface{}) *godyf.Stream {
+	maxOffset, maxGeneration := 0, 0
+	for _, entry := range entries {
+		maxOffset = max(maxOffset, entry[1])
+		maxGeneration = max(maxGeneration, entry[2])
+	}
+	widths := [3]int{1, fieldWidth(maxOffset), fieldWidth(maxGeneration)}
+	var data bytes.Buffer
+	for _, entry := range entries {
+		for i, value := range entry {
+			for shift := (widths[i] - 1) * 8; shift >= 0; shift -= 8 {
+				data.WriteByte(byte(value >> shift))
+			}
+		}
+	}
+
+	extra["Type"] = godyf.Name("XRef")
+	extra["W"] = godyf.NewArray(widths[0], widths[1], widths[2])
+	stream := godyf.NewStream([]interface{}{data.Bytes()}, extra, true)
+	stream.Number = number
+	return stream
+}
+
+// hintTables returns the page offset and shared object hint tables, and
+// the offset of the shared object hint table
+func (l *linearizer) hintTables(hintLength int) ([]byte, int) {
+	adjust := func(offset int) int {
+		return offset - hintLength
+	}
+
+	pages := make([]pageHint, len(l.pages))
+	for i, section := range l.pages {
+		start := section.units[0].offset
+		pages[i] = pageHint{objects: section.count, length: section.length(), shared: section.shared}
+		for _, unit := range section.units {
+			if unit.number == section.content {
+				pages[i].contentOffset = unit.offset - start
+				pages[i].contentLength = unit.length()
+			}
+		}
+	}
+	var w bitWriter
+	encodePageOffsetHints(&w, adjust(l.pages[0].units[0].offset), pages)
+	sharedOffset := w.buf.Len()
+
+	var groups []int
+	for _, unit := range l.pages[0].units {
+		groups = append(groups, unit.length())
+	}
+	firstObject, firstOffset := 0, 0
+	if len(l.shared.units) > 0 {
+		firstObject, firstOffset = l.shared.first, adjust(l.shared.units[0].offset)
+	}
+	for _, unit := range l.shared.units {
+		groups = append(groups, unit.length())
+	}
+	encodeSharedObjectHints(&w, firstObject, firstOffset, len(l.pages[0].units), groups)
+	return w.buf.Bytes(), sharedOffset
+}
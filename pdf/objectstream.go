@@ -0,0 +1,106 @@
+package pdf
+
+import (
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// DefaultMaxObjectsPerStream is the maximum number of objects stored in an
+// object stream when WriteOptions.MaxObjectsPerStream is 0
+const DefaultMaxObjectsPerStream = 100
+
+// objectStreamChunks splits the objects stored in object streams into
+// chunks, one per object stream, honoring the limits given in options
+func (p *PDF) objectStreamChunks(objects []godyf.PDFObject, data [][]byte, options WriteOptions) [][]godyf.PDFObject {
+	groups := [][]godyf.PDFObject{objects}
+	if options.GroupObjectStreamsByPage {
+		groups = p.pageGroups(objects)
+	}
+
+	maxObjects := options.MaxObjectsPerStream
+	if maxObjects == 0 {
+		maxObjects = DefaultMaxObjectsPerStream
+	}
+	var chunks [][]godyf.PDFObject
+	for _, group := range groups {
+		var chunk []godyf.PDFObject
+		size := 0
+		for _, obj := range group {
+			// Objects are separated by an end-of-line marker
+			objectSize := len(data[obj.GetObject().Number]) + 1
+			full := len(chunk) == maxObjects ||
+				(options.MaxObjectStreamBytes > 0 && size+objectSize > options.MaxObjectStreamBytes)
+			if len(chunk) > 0 && full {
+				chunks = append(chunks, chunk)
+				chunk, size = nil, 0
+			}
+			chunk = append(chunk, obj)
+			size += objectSize
+		}
+		if len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// pageGroups groups objects by the first page needing them, in page
+// order, followed by the objects needed by no page
+func (p *PDF) pageGroups(objects []godyf.PDFObject) [][]godyf.PDFObject {
+	pages, nodes := p.pageTree()
+	_, graph := p.referenceGraph()
+	isPage := make(map[int]bool)
+	for _, number := range pages {
+		isPage[number] = true
+	}
+
+	// Other pages and the page tree are reached from the page tree only
+	catalog := p.Catalog.GetObject().Number
+	group := make(map[int]int) // Index of the group by object number
+	skip := func(number int) bool {
+		_, grouped := group[number]
+		return grouped || isPage[number] || nodes[number] || number == catalog
+	}
+	for i, page := range pages {
+		if _, grouped := group[page]; grouped {
+			continue
+		}
+		for _, number := range closure(page, graph, skip) {
+			group[number] = i
+		}
+	}
+
+	groups := make([][]godyf.PDFObject, len(pages)+1)
+	for _, obj := range objects {
+		if i, ok := group[obj.GetObject().Number]; ok {
+			groups[i] = append(groups[i], obj)
+		} else {
+			groups[len(pages)] = append(groups[len(pages)], obj)
+		}
+	}
+	return groups
+}
+
+// classicObjects returns the numbers of the objects written directly in
+// hybrid files, so that readers ignoring cross-reference streams find the
+// document structure in the cross-reference table: the catalog, the
+// information dictionary, the page tree nodes, the pages, and the objects
+// they reference directly
+func (p *PDF) classicObjects() map[int]bool {
+	pages, nodes := p.pageTree()
+	roots := append([]int{p.Catalog.GetObject().Number}, pages...)
+	if p.Info != nil {
+		roots = append(roots, p.Info.GetObject().Number)
+	}
+	for number := range nodes {
+		roots = append(roots, number)
+	}
+
+	classic := make(map[int]bool)
+	for _, number := range roots {
+		classic[number] = true
+		references(p.Objects[number], func(reference int) {
+			classic[reference] = true
+		})
+	}
+	return classic
+}
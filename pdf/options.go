@@ -0,0 +1,159 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// IdentifierPolicy defines how the /ID entry of the trailer is generated
+type IdentifierPolicy int
+
+const (
+	// IdentifierNone writes no identifier
+	IdentifierNone IdentifierPolicy = iota
+	// IdentifierContentHash uses the MD5 hash of the objects data
+	IdentifierContentHash
+	// IdentifierFixed uses WriteOptions.FixedIdentifier
+	IdentifierFixed
+	// IdentifierRandom uses 16 random bytes, hex-encoded
+	IdentifierRandom
+)
+
+// XRefStyle defines how the cross-reference section is written
+type XRefStyle int
+
+const (
+	// XRefTable writes a cross-reference table and a trailer dictionary
+	XRefTable XRefStyle = iota
+	// XRefStream writes a cross-reference stream, from PDF 1.5
+	XRefStream
+	// XRefHybrid writes a cross-reference table completed by a stream
+	// referenced by /XRefStm, readable by PDF 1.4 readers. The catalog,
+	// the information dictionary, the page tree and the objects they
+	// reference directly are kept out of object streams.
+	XRefHybrid
+)
+
+// WriteOptions configures how a document is written by WriteWithOptions.
+// The zero value writes a PDF 1.7 document without identifier, with a
+// cross-reference table.
+type WriteOptions struct {
+	// PDF version written in the header, such as "1.7", "1.7" if nil
+	Version []byte
+	// Policy used to generate the first element of the /ID array, the
+	// second one being always the hash of the objects data
+	Identifier IdentifierPolicy
+	// Identifier used with IdentifierFixed
+	FixedIdentifier []byte
+	// Store objects in object streams, requires a cross-reference stream
+	ObjectStreams bool
+	// Kind of cross-reference section
+	XRef XRefStyle
+	// zlib level used for compressed streams, from zlib.HuffmanOnly to
+	// zlib.BestCompression, 0 for zlib.DefaultCompression
+	CompressionLevel int
+	// Maximum number of objects per object stream, 0 for
+	// DefaultMaxObjectsPerStream
+	MaxObjectsPerStream int
+	// Maximum size in bytes of the objects stored in an object stream,
+	// before compression, 0 for no limit. Larger objects get their own
+	// object stream.
+	MaxObjectStreamBytes int
+	// Store objects needed by the same page in the same object streams, so
+	// that readers load fewer streams to display a page
+	GroupObjectStreamsByPage bool
+	// Reject options making the output depend on anything else than the
+	// document, such as random identifiers
+	Deterministic bool
+	// Number of workers serializing and compressing objects concurrently,
+	// runtime.GOMAXPROCS(0) if 0 or less. Output doesn't depend on it.
+	Parallelism int
+}
+
+// versionPattern matches valid PDF versions
+var versionPattern = regexp.MustCompile(`^[12]\.[0-9]$`)
+
+// version returns the PDF version, defaulting to "1.7"
+func (o WriteOptions) version() []byte {
+	if o.Version == nil {
+		return []byte("1.7")
+	}
+	return o.Version
+}
+
+// Validate returns an error if options are invalid or inconsistent
+func (o WriteOptions) Validate() error {
+	version := o.version()
+	if !versionPattern.Match(version) {
+		return fmt.Errorf("invalid PDF version %q", version)
+	}
+	modern := bytes.Compare(version, []byte("1.5")) >= 0
+
+	switch o.XRef {
+	case XRefTable:
+		if o.ObjectStreams {
+			return fmt.Errorf("object streams require a cross-reference stream")
+		}
+	case XRefStream, XRefHybrid:
+		if !modern {
+			return fmt.Errorf("cross-reference streams require PDF 1.5 or later, got %s", version)
+		}
+		if o.XRef == XRefHybrid && !o.ObjectStreams {
+			return fmt.Errorf("hybrid cross-reference sections require object streams")
+		}
+	default:
+		return fmt.Errorf("invalid cross-reference style %d", o.XRef)
+	}
+
+	switch o.Identifier {
+	case IdentifierNone, IdentifierContentHash, IdentifierRandom:
+		if o.FixedIdentifier != nil {
+			return fmt.Errorf("fixed identifier given without IdentifierFixed policy")
+		}
+		if o.Identifier == IdentifierRandom && o.Deterministic {
+			return fmt.Errorf("random identifiers can't be used in deterministic mode")
+		}
+	case IdentifierFixed:
+		if len(o.FixedIdentifier) == 0 {
+			return fmt.Errorf("IdentifierFixed policy requires a fixed identifier")
+		}
+	default:
+		return fmt.Errorf("invalid identifier policy %d", o.Identifier)
+	}
+
+	if o.CompressionLevel < zlib.HuffmanOnly || o.CompressionLevel > zlib.BestCompression {
+		return fmt.Errorf("invalid compression level %d", o.CompressionLevel)
+	}
+	if o.MaxObjectsPerStream < 0 {
+		return fmt.Errorf("invalid maximum number of objects per object stream %d", o.MaxObjectsPerStream)
+	}
+	if o.MaxObjectStreamBytes < 0 {
+		return fmt.Errorf("invalid maximum size of object streams %d", o.MaxObjectStreamBytes)
+	}
+	if (o.MaxObjectsPerStream > 0 || o.MaxObjectStreamBytes > 0 || o.GroupObjectStreamsByPage) && !o.ObjectStreams {
+		return fmt.Errorf("object stream limits given without object streams")
+	}
+	return nil
+}
+
+// identifier returns the identifier as accepted by identifierArray, nil
+// for no identifier
+func (o WriteOptions) identifier() (interface{}, error) {
+	switch o.Identifier {
+	case IdentifierContentHash:
+		return true, nil
+	case IdentifierFixed:
+		return o.FixedIdentifier, nil
+	case IdentifierRandom:
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		return []byte(hex.EncodeToString(random)), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+package pdf
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// leveledObject is implemented by objects whose data can be compressed
+// with a given zlib level, such as streams
+type leveledObject interface {
+	DataWithLevel(level int) []byte
+}
+
+// objectData returns the data of obj, compressed with level if possible
+func objectData(obj godyf.PDFObject, level int) []byte {
+	if leveled, ok := obj.(leveledObject); ok {
+		return leveled.DataWithLevel(level)
+	}
+	return obj.Data()
+}
+
+// serializeObjects returns the data of the objects in use, indexed by object
+// number, nil for free objects. Objects are serialized, and their streams
+// compressed with level, by a pool of at most parallelism workers,
+// GOMAXPROCS if parallelism is 0 or less.
+func serializeObjects(objects []godyf.PDFObject, parallelism, level int) [][]byte {
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	data := make([][]byte, len(objects))
+	if parallelism == 1 {
+		for number, obj := range objects {
+			if obj.GetObject().Free != 'f' {
+				data[number] = objectData(obj, level)
+			}
+		}
+		return data
+	}
+
+	numbers := make(chan int)
+	var workers sync.WaitGroup
+	for range min(parallelism, len(objects)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			// Each worker writes distinct items of data
+			for number := range numbers {
+				data[number] = objectData(objects[number], level)
+			}
+		}()
+	}
+	for number, obj := range objects {
+		if obj.GetObject().Free != 'f' {
+			numbers <- number
+		}
+	}
+	close(numbers)
+	workers.Wait()
+	return data
+}
@@ -0,0 +1,216 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// maxNesting is the maximum depth of nested arrays and dictionaries
+const maxNesting = 256
+
+// parser builds godyf objects from the tokens of a lexer
+type parser struct {
+	lex *lexer
+	// streamLength resolves the /Length of a stream, which may be an indirect reference
+	streamLength func(length interface{}) (int, bool)
+	// streamEnd finds the end of the data of a stream starting at offset when
+	// its /Length is unusable, returning -1 if it can't be found
+	streamEnd func(offset int64) int64
+}
+
+// newParser returns a parser reading tokens from lex
+func newParser(lex *lexer) *parser {
+	return &parser{lex: lex}
+}
+
+// parseIndirect parses an indirect object "N G obj ... endobj" at offset,
+// returning its number, generation and value
+func (p *parser) parseIndirect(offset int64) (int, int, interface{}, error) {
+	p.lex.seek(offset)
+	number, err := p.lex.next()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	generation, err := p.lex.next()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	keyword, err := p.lex.next()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if number.kind != tokenInteger || generation.kind != tokenInteger || !keyword.is("obj") {
+		return 0, 0, nil, fmt.Errorf("expected object header at offset %d, found %s", offset, number)
+	}
+
+	value, err := p.parseObject(0)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("object %d %d: %w", number.integer(), generation.integer(), err)
+	}
+
+	next, err := p.lex.next()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if dictionary, ok := value.(*godyf.Dictionary); ok && next.is("stream") {
+		stream, err := p.parseStream(dictionary)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("object %d %d: %w", number.integer(), generation.integer(), err)
+		}
+		value = stream
+	} else if !next.is("endobj") {
+		// A missing endobj is tolerated
+		p.lex.unread(next)
+	}
+
+	return number.integer(), generation.integer(), value, nil
+}
+
+// parseStream reads the data of a stream whose dictionary has just been parsed
+func (p *parser) parseStream(dictionary *godyf.Dictionary) (*godyf.Stream, error) {
+	p.lex.skipEOL()
+	start := p.lex.pos
+
+	length, ok := -1, false
+	if p.streamLength != nil {
+		length, ok = p.streamLength(dictionary.Get("Length"))
+	} else if value, isInt := dictionary.Get("Length").(int); isInt {
+		length, ok = value, true
+	}
+
+	if !ok || !p.endstreamAt(start+int64(length)) {
+		end := int64(-1)
+		if p.streamEnd != nil {
+			end = p.streamEnd(start)
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("invalid stream length at offset %d", start)
+		}
+		length = int(end - start)
+	}
+
+	data, err := p.lex.readAt(start, length)
+	if err != nil {
+		return nil, err
+	}
+	p.lex.seek(start + int64(length))
+	if end, err := p.lex.next(); err == nil && !end.is("endstream") {
+		p.lex.unread(end)
+	}
+
+	extra := dictionary.Values
+	delete(extra, "Length")
+	return godyf.NewStream([]interface{}{data}, extra, false), nil
+}
+
+// endstreamAt returns whether the endstream keyword follows offset, after optional whitespace
+func (p *parser) endstreamAt(offset int64) bool {
+	if offset < 0 || offset > p.lex.size {
+		return false
+	}
+	length := min(int64(len("endstream")+4), p.lex.size-offset)
+	data, err := p.lex.readAt(offset, int(length))
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(data, "\r\n \t\f\x00"), []byte("endstream"))
+}
+
+// parseObject parses a direct object, or an indirect reference
+func (p *parser) parseObject(depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, fmt.Errorf("objects nested too deeply at offset %d", p.lex.position())
+	}
+
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.kind {
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of file")
+	case tokenInteger:
+		return p.parseIntegerOrReference(t)
+	case tokenReal:
+		return t.real(), nil
+	case tokenName:
+		return godyf.Name(t.text), nil
+	case tokenString:
+		return godyf.NewByteString(t.data), nil
+	case tokenArrayStart:
+		array := godyf.NewArray()
+		for {
+			next, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if next.kind == tokenArrayEnd {
+				return array, nil
+			}
+			if next.kind == tokenEOF {
+				return nil, fmt.Errorf("unterminated array at offset %d", t.offset)
+			}
+			p.lex.unread(next)
+			element, err := p.parseObject(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array.Add(element)
+		}
+	case tokenDictStart:
+		dictionary := godyf.NewDictionary(nil)
+		for {
+			key, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if key.kind == tokenDictEnd {
+				return dictionary, nil
+			}
+			if key.kind != tokenName {
+				return nil, fmt.Errorf("expected dictionary key at offset %d, found %s", key.offset, key)
+			}
+			value, err := p.parseObject(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			// Null values are equivalent to missing entries
+			if _, isNull := value.(godyf.Null); !isNull {
+				dictionary.Set(key.text, value)
+			}
+		}
+	case tokenKeyword:
+		switch t.text {
+		case "true":
+			return godyf.Bool(true), nil
+		case "false":
+			return godyf.Bool(false), nil
+		case "null":
+			return godyf.Null{}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", t, t.offset)
+}
+
+// parseIntegerOrReference parses an integer, or a "N G R" reference starting with it
+func (p *parser) parseIntegerOrReference(number token) (interface{}, error) {
+	generation, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if generation.kind == tokenInteger {
+		keyword, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if keyword.is("R") {
+			return godyf.Ref{Number: number.integer(), Generation: generation.integer()}, nil
+		}
+		p.lex.unread(keyword)
+	}
+	p.lex.unread(generation)
+	return number.integer(), nil
+}
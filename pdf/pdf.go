@@ -51,6 +51,19 @@ type PDF struct {
 	CurrentPosition int
 	// Position of the cross reference table
 	XRefPosition int
+	// Version read from the header of an opened document
+	Version []byte
+	// Trailer dictionary of an opened document
+	Trailer *godyf.Dictionary
+	// Repairs made while opening a damaged document in recovery mode
+	Warnings []Warning
+	// Write identical streams added with AddObject as many times as they
+	// are added, instead of once
+	NoDeduplication bool
+
+	source    *sourceFile
+	resources []Resource // Resources finished before each write
+	streams   []int      // Numbers of the streams added with AddObject
 }
 
 // NewPDF creates a new PDF document
@@ -68,7 +81,7 @@ func NewPDF() *PDF {
 
 	// Create Pages dictionary
 	pdf.Pages = godyf.NewDictionary(map[string]interface{}{
-		"Type":  "/Pages",
+		"Type":  godyf.Name("Pages"),
 		"Kids":  godyf.NewArray(),
 		"Count": 0,
 	})
@@ -80,8 +93,8 @@ func NewPDF() *PDF {
 
 	// Create Catalog dictionary
 	pdf.Catalog = godyf.NewDictionary(map[string]interface{}{
-		"Type":  "/Catalog",
-		"Pages": pdf.Pages.GetObject().Reference(),
+		"Type":  godyf.Name("Catalog"),
+		"Pages": pdf.Pages.Ref(),
 	})
 	pdf.AddObject(pdf.Catalog)
 
@@ -98,34 +111,61 @@ func (p *PDF) AddPage(page *godyf.Dictionary) {
 
 	// Add page reference to Kids array
 	kids := p.Pages.Values["Kids"].(*godyf.Array)
-	kids.Elements = append(kids.Elements, page.GetObject().Number)
-	kids.Elements = append(kids.Elements, 0)
-	kids.Elements = append(kids.Elements, "R")
+	kids.Elements = append(kids.Elements, page.Ref())
 }
 
-// AddObject adds an object to the PDF
+// AddObject adds an object to the PDF. Streams identical to previous ones
+// when the document is written are stored once, unless NoDeduplication is
+// set.
 func (p *PDF) AddObject(obj godyf.PDFObject) {
+	p.addObject(obj)
+	if _, ok := obj.(*godyf.Stream); ok {
+		p.streams = append(p.streams, obj.GetObject().Number)
+	}
+}
+
+// addObject adds an object created while writing the PDF, such as an
+// object stream or a cross-reference stream, that is never deduplicated
+func (p *PDF) addObject(obj godyf.PDFObject) {
 	objBase := obj.GetObject()
 	objBase.Number = len(p.Objects)
 	p.Objects = append(p.Objects, obj)
 }
 
 // PageReferences returns the page references
-func (p *PDF) PageReferences() [][]byte {
+func (p *PDF) PageReferences() []godyf.Ref {
 	kids := p.Pages.Values["Kids"].(*godyf.Array)
-	var references [][]byte
+	var references []godyf.Ref
 
-	// Extract every third element (object numbers)
-	for i := 0; i < len(kids.Elements); i += 3 {
-		if objNum, ok := kids.Elements[i].(int); ok {
-			ref := fmt.Sprintf("%d 0 R", objNum)
-			references = append(references, []byte(ref))
+	for _, kid := range kids.Elements {
+		if ref, ok := kid.(godyf.Ref); ok {
+			references = append(references, ref)
 		}
 	}
 
 	return references
 }
 
+// Resolve returns the object referenced by value if it is a reference,
+// and value itself otherwise. Free or missing objects resolve to nil.
+func (p *PDF) Resolve(value interface{}) interface{} {
+	ref, ok := value.(godyf.Ref)
+	if !ok {
+		return value
+	}
+	if ref.Number <= 0 || ref.Number >= len(p.Objects) {
+		return nil
+	}
+	obj := p.Objects[ref.Number]
+	if base := obj.GetObject(); base.Free == 'f' || base.Generation != ref.Generation {
+		return nil
+	}
+	if indirect, ok := obj.(*IndirectValue); ok {
+		return indirect.Value
+	}
+	return obj
+}
+
 // WriteLine writes a line to the output and updates current position
 func (p *PDF) WriteLine(content []byte, output io.Writer) error {
 	p.CurrentPosition += len(content) + 1
@@ -137,15 +177,66 @@ func (p *PDF) WriteLine(content []byte, output io.Writer) error {
 	return err
 }
 
-// Write writes the PDF to the output
+// Write writes the PDF to the output. Identifier is nil or false for no
+// identifier, true for an identifier computed from the content, or a
+// string or []byte. Compress writes objects in object streams with a
+// cross-reference stream, and is ignored before version 1.5. Use
+// WriteWithOptions for more control.
 func (p *PDF) Write(output io.Writer, version []byte, identifier interface{}, compress bool) error {
-	// Convert version to bytes, default to "1.7"
-	if version == nil {
-		version = []byte("1.7")
+	options := WriteOptions{Version: version}
+	switch identifier := identifier.(type) {
+	case nil:
+	case bool:
+		if identifier {
+			options.Identifier = IdentifierContentHash
+		}
+	case string:
+		options.Identifier = IdentifierFixed
+		options.FixedIdentifier = []byte(identifier)
+	case []byte:
+		options.Identifier = IdentifierFixed
+		options.FixedIdentifier = identifier
+	default:
+		return fmt.Errorf("invalid identifier type")
+	}
+	if compress && bytes.Compare(options.version(), []byte("1.5")) >= 0 {
+		options.ObjectStreams = true
+		options.XRef = XRefStream
+	}
+	return p.WriteWithOptions(output, options)
+}
+
+// WriteWithOptions writes the PDF to the output. Options are validated
+// before anything is written. Objects are serialized concurrently, then
+// written in object order. Object streams and cross-reference streams
+// created while writing are removed afterwards, so that the document can be
+// written again.
+func (p *PDF) WriteWithOptions(output io.Writer, options WriteOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
 	}
+	identifier, err := options.identifier()
+	if err != nil {
+		return err
+	}
+	if err := p.finishResources(); err != nil {
+		return err
+	}
+	count := len(p.Objects)
+	defer func() {
+		clear(p.Objects[count:])
+		p.Objects = p.Objects[:count]
+	}()
+	p.CurrentPosition = 0
+	return p.deduplicated(func() error {
+		return p.write(output, identifier, options)
+	})
+}
 
+// write writes the header, the objects and the cross-reference section
+func (p *PDF) write(output io.Writer, identifier interface{}, options WriteOptions) error {
 	// Write header
-	header := append([]byte("%PDF-"), version...)
+	header := append([]byte("%PDF-"), options.version()...)
 	if err := p.WriteLine(header, output); err != nil {
 		return err
 	}
@@ -155,15 +246,15 @@ func (p *PDF) Write(output io.Writer, version []byte, identifier interface{}, co
 		return err
 	}
 
-	if bytes.Compare(version, []byte("1.5")) >= 0 && compress {
-		return p.writeCompressed(output, identifier)
-	} else {
-		return p.writeUncompressed(output, identifier)
+	data := serializeObjects(p.Objects, options.Parallelism, options.CompressionLevel)
+	if options.XRef != XRefTable {
+		return p.writeCompressed(output, identifier, data, options)
 	}
+	return p.writeUncompressed(output, identifier, data)
 }
 
 // writeUncompressed writes PDF without compression
-func (p *PDF) writeUncompressed(output io.Writer, identifier interface{}) error {
+func (p *PDF) writeUncompressed(output io.Writer, identifier interface{}, data [][]byte) error {
 	// Write all non-free PDF objects
 	for _, obj := range p.Objects {
 		objBase := obj.GetObject()
@@ -171,30 +262,47 @@ func (p *PDF) writeUncompressed(output io.Writer, identifier interface{}) error
 			continue
 		}
 		objBase.Offset = p.CurrentPosition
-		indirect := objBase.Indirect(obj.Data())
+		indirect := objBase.Indirect(data[objBase.Number])
 		if err := p.WriteLine(indirect, output); err != nil {
 			return err
 		}
 	}
 
+	return p.writeXRefTable(output, identifier, data, nil, 0)
+}
+
+// writeXRefTable writes a cross-reference table and the trailer. Objects
+// in hidden are left out of the table, and xrefStream is the offset of the
+// cross-reference stream listing them, 0 if none.
+func (p *PDF) writeXRefTable(output io.Writer, identifier interface{}, data [][]byte, hidden map[int]bool, xrefStream int) error {
 	// Write cross-reference table
 	p.XRefPosition = p.CurrentPosition
 	if err := p.WriteLine([]byte("xref"), output); err != nil {
 		return err
 	}
 
-	xrefHeader := fmt.Sprintf("0 %d", len(p.Objects))
-	if err := p.WriteLine([]byte(xrefHeader), output); err != nil {
-		return err
-	}
-
-	// Write xref entries
-	for _, obj := range p.Objects {
-		objBase := obj.GetObject()
-		entry := fmt.Sprintf("%010d %05d %c ", objBase.Offset, objBase.Generation, objBase.Free)
-		if err := p.WriteLine([]byte(entry), output); err != nil {
+	// Write xref entries, in subsections of consecutive visible objects
+	for start := 0; start < len(p.Objects); {
+		if hidden[start] {
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(p.Objects) && !hidden[end] {
+			end++
+		}
+		xrefHeader := fmt.Sprintf("%d %d", start, end-start)
+		if err := p.WriteLine([]byte(xrefHeader), output); err != nil {
 			return err
 		}
+		for _, obj := range p.Objects[start:end] {
+			objBase := obj.GetObject()
+			entry := fmt.Sprintf("%010d %05d %c ", objBase.Offset, objBase.Generation, objBase.Free)
+			if err := p.WriteLine([]byte(entry), output); err != nil {
+				return err
+			}
+		}
+		start = end
 	}
 
 	// Write trailer
@@ -210,19 +318,28 @@ func (p *PDF) writeUncompressed(output io.Writer, identifier interface{}) error
 		return err
 	}
 
-	rootEntry := append([]byte("/Root "), p.Catalog.GetObject().Reference()...)
+	rootEntry := append([]byte("/Root "), p.Catalog.Ref().Data()...)
 	if err := p.WriteLine(rootEntry, output); err != nil {
 		return err
 	}
 
-	infoEntry := append([]byte("/Info "), p.Info.GetObject().Reference()...)
-	if err := p.WriteLine(infoEntry, output); err != nil {
-		return err
+	if p.Info != nil {
+		infoEntry := append([]byte("/Info "), p.Info.Ref().Data()...)
+		if err := p.WriteLine(infoEntry, output); err != nil {
+			return err
+		}
+	}
+
+	if xrefStream > 0 {
+		xrefStreamEntry := fmt.Sprintf("/XRefStm %d", xrefStream)
+		if err := p.WriteLine([]byte(xrefStreamEntry), output); err != nil {
+			return err
+		}
 	}
 
 	// Handle identifier if provided
 	if identifier != nil {
-		if err := p.writeIdentifier(output, identifier); err != nil {
+		if err := p.writeIdentifier(output, identifier, data); err != nil {
 			return err
 		}
 	}
@@ -231,23 +348,18 @@ func (p *PDF) writeUncompressed(output io.Writer, identifier interface{}) error
 		return err
 	}
 
-	// Write startxref
-	if err := p.WriteLine([]byte("startxref"), output); err != nil {
-		return err
-	}
-
-	xrefPos := fmt.Sprintf("%d", p.XRefPosition)
-	if err := p.WriteLine([]byte(xrefPos), output); err != nil {
-		return err
-	}
-
-	return p.WriteLine([]byte("%%EOF"), output)
+	return p.writeStartXRef(output)
 }
 
-// writeCompressed writes PDF with compression
-func (p *PDF) writeCompressed(output io.Writer, identifier interface{}) error {
+// writeCompressed writes PDF with a cross-reference stream, objects being
+// stored in object streams if options.ObjectStreams is set
+func (p *PDF) writeCompressed(output io.Writer, identifier interface{}, data [][]byte, options WriteOptions) error {
 	// Store compressed objects for later and write other ones in PDF
 	var compressedObjects []godyf.PDFObject
+	var classic map[int]bool
+	if options.XRef == XRefHybrid {
+		classic = p.classicObjects()
+	}
 
 	for _, obj := range p.Objects {
 		objBase := obj.GetObject()
@@ -255,74 +367,57 @@ func (p *PDF) writeCompressed(output io.Writer, identifier interface{}) error {
 			continue
 		}
 
-		if obj.Compressible() {
+		if options.ObjectStreams && obj.Compressible() && !classic[objBase.Number] {
 			compressedObjects = append(compressedObjects, obj)
 		} else {
 			objBase.Offset = p.CurrentPosition
-			indirect := objBase.Indirect(obj.Data())
+			indirect := objBase.Indirect(data[objBase.Number])
 			if err := p.WriteLine(indirect, output); err != nil {
 				return err
 			}
 		}
 	}
 
-	// Write compressed objects in object stream
-	var stream []interface{}
-	var offsetsAndNumbers []interface{}
-	position := 0
-
-	for _, obj := range compressedObjects {
-		data := obj.Data()
-		stream = append(stream, data)
-		offsetsAndNumbers = append(offsetsAndNumbers, obj.GetObject().Number)
-		offsetsAndNumbers = append(offsetsAndNumbers, position)
-		position += len(data) + 1
-	}
-
-	// Create the first entry with object numbers and positions
-	var firstEntry strings.Builder
-	for i, item := range offsetsAndNumbers {
-		if i > 0 {
-			firstEntry.WriteString(" ")
+	// Write compressed objects in bounded object streams
+	containers := make(map[int][2]int) // Object stream number and index by object number
+	maxIndex := 0
+	for _, chunk := range p.objectStreamChunks(compressedObjects, data, options) {
+		numbers := make([]int, len(chunk))
+		compressedData := make([][]byte, len(chunk))
+		for i, obj := range chunk {
+			numbers[i] = obj.GetObject().Number
+			compressedData[i] = data[numbers[i]]
 		}
-		firstEntry.WriteString(fmt.Sprintf("%v", item))
-	}
-
-	// Insert the first entry at the beginning
-	streamData := make([]interface{}, 0, len(stream)+1)
-	streamData = append(streamData, firstEntry.String())
-	streamData = append(streamData, stream...)
+		objectStream := newObjectStream(numbers, compressedData, true)
+		objectStream.GetObject().Offset = p.CurrentPosition
+		p.addObject(objectStream)
+		data = append(data, objectStream.DataWithLevel(options.CompressionLevel))
+		for i, number := range numbers {
+			containers[number] = [2]int{objectStream.GetObject().Number, i}
+		}
+		maxIndex = max(maxIndex, len(chunk))
 
-	extra := map[string]interface{}{
-		"Type":  "/ObjStm",
-		"N":     len(compressedObjects),
-		"First": len(firstEntry.String()) + 1,
+		indirect := objectStream.GetObject().Indirect(data[objectStream.GetObject().Number])
+		if err := p.WriteLine(indirect, output); err != nil {
+			return err
+		}
 	}
 
-	objectStream := godyf.NewStream(streamData, extra, true)
-	objectStream.GetObject().Offset = p.CurrentPosition
-	p.AddObject(objectStream)
-
-	indirect := objectStream.GetObject().Indirect(objectStream.Data())
-	if err := p.WriteLine(indirect, output); err != nil {
-		return err
+	if options.XRef == XRefHybrid {
+		return p.writeHybridXRef(output, identifier, data, containers, options.CompressionLevel)
 	}
 
 	// Write cross-reference stream
 	var xref [][]int
-	dictIndex := 0
 
 	for _, obj := range p.Objects {
 		objBase := obj.GetObject()
-		if obj.Compressible() {
-			xref = append(xref, []int{2, objectStream.GetObject().Number, dictIndex})
-			dictIndex++
+		if objBase.Free == 'f' {
+			xref = append(xref, []int{0, 0, objBase.Generation})
+		} else if container, ok := containers[objBase.Number]; ok {
+			xref = append(xref, []int{2, container[0], container[1]})
 		} else {
-			xref = append(xref, []int{
-				boolToInt(objBase.Number != 0),
-				objBase.Offset,
-				objBase.Generation,
-			})
+			xref = append(xref, []int{1, objBase.Offset, objBase.Generation})
 		}
 	}
 
@@ -337,10 +432,7 @@ func (p *PDF) writeCompressed(output io.Writer, identifier interface{}) error {
 			maxGeneration = obj.GetObject().Generation
 		}
 	}
-	maxValue := maxGeneration
-	if len(compressedObjects) > maxValue {
-		maxValue = len(compressedObjects)
-	}
+	maxValue := max(maxGeneration, maxIndex)
 	field3Size := int(math.Ceil(math.Log(float64(maxValue+1)) / math.Log(256)))
 
 	xrefLengths := []int{1, field2Size, field3Size}
@@ -360,17 +452,19 @@ func (p *PDF) writeCompressed(output io.Writer, identifier interface{}) error {
 		}
 	}
 
-	extra = map[string]interface{}{
-		"Type":  "/XRef",
+	extra := map[string]interface{}{
+		"Type":  godyf.Name("XRef"),
 		"Index": godyf.NewArray(0, len(p.Objects)+1),
 		"W":     godyf.NewArray(xrefLengths[0], xrefLengths[1], xrefLengths[2]),
 		"Size":  len(p.Objects) + 1,
-		"Root":  string(p.Catalog.GetObject().Reference()),
-		"Info":  string(p.Info.GetObject().Reference()),
+		"Root":  p.Catalog.Ref(),
+	}
+	if p.Info != nil {
+		extra["Info"] = p.Info.Ref()
 	}
 
 	if identifier != nil {
-		if err := p.addIdentifierToExtra(extra, identifier); err != nil {
+		if err := p.addIdentifierToExtra(extra, identifier, data); err != nil {
 			return err
 		}
 	}
@@ -378,9 +472,9 @@ func (p *PDF) writeCompressed(output io.Writer, identifier interface{}) error {
 	dictStream := godyf.NewStream([]interface{}{xrefStream.Bytes()}, extra, true)
 	p.XRefPosition = p.CurrentPosition
 	dictStream.GetObject().Offset = p.CurrentPosition
-	p.AddObject(dictStream)
+	p.addObject(dictStream)
 
-	indirect = dictStream.GetObject().Indirect(dictStream.Data())
+	indirect := dictStream.GetObject().Indirect(dictStream.DataWithLevel(options.CompressionLevel))
 	if err := p.WriteLine(indirect, output); err != nil {
 		return err
 	}
@@ -398,78 +492,118 @@ func (p *PDF) writeCompressed(output io.Writer, identifier interface{}) error {
 	return p.WriteLine([]byte("%%EOF"), output)
 }
 
-// boolToInt converts boolean to int (1 for true, 0 for false)
-func boolToInt(b bool) int {
-	if b {
-		return 1
+// writeHybridXRef writes a cross-reference stream listing the objects
+// stored in object streams, then a cross-reference table listing the other
+// objects and referencing the stream with /XRefStm, for readers that don't
+// support cross-reference streams. The objects given by classicObjects
+// must have been kept out of object streams.
+func (p *PDF) writeHybridXRef(output io.Writer, identifier interface{}, data [][]byte, containers map[int][2]int, level int) error {
+	hidden := make(map[int]bool, len(containers))
+	var entries [][3]int
+	var index []interface{}
+	for number := range p.Objects {
+		container, ok := containers[number]
+		if !ok {
+			continue
+		}
+		if !hidden[number-1] {
+			index = append(index, number, 0)
+		}
+		index[len(index)-1] = index[len(index)-1].(int) + 1
+		hidden[number] = true
+		entries = append(entries, [3]int{2, container[0], container[1]})
 	}
-	return 0
-}
 
-// addIdentifierToExtra adds identifier to the extra dictionary
-func (p *PDF) addIdentifierToExtra(extra map[string]interface{}, identifier interface{}) error {
-	// Calculate data hash
-	var data bytes.Buffer
-	for _, obj := range p.Objects {
-		objBase := obj.GetObject()
-		if objBase.Free != 'f' {
-			data.Write(obj.Data())
-		}
+	stream := xrefStream(len(p.Objects), entries, map[string]interface{}{
+		"Index": godyf.NewArray(index...),
+		"Size":  len(p.Objects) + 1,
+	})
+	p.addObject(stream)
+	stream.GetObject().Offset = p.CurrentPosition
+	data = append(data, stream.DataWithLevel(level))
+	indirect := stream.GetObject().Indirect(data[stream.GetObject().Number])
+	if err := p.WriteLine(indirect, output); err != nil {
+		return err
 	}
 
-	hasher := md5.New()
-	hasher.Write(data.Bytes())
-	dataHash := hex.EncodeToString(hasher.Sum(nil))
+	return p.writeXRefTable(output, identifier, data, hidden, stream.GetObject().Offset)
+}
 
-	var idBytes []byte
-	if identifier == true {
-		idBytes = []byte(dataHash)
-	} else if idStr, ok := identifier.(string); ok {
-		idBytes = []byte(idStr)
-	} else if idBytes, ok = identifier.([]byte); !ok {
-		return fmt.Errorf("invalid identifier type")
+// newObjectStream returns an object stream holding the given serialized objects
+func newObjectStream(numbers []int, data [][]byte, compress bool) *godyf.Stream {
+	var stream []interface{}
+	var offsetsAndNumbers []string
+	position := 0
+
+	for i, objectData := range data {
+		stream = append(stream, objectData)
+		offsetsAndNumbers = append(offsetsAndNumbers, fmt.Sprintf("%d %d", numbers[i], position))
+		position += len(objectData) + 1
 	}
 
-	idString1 := godyf.NewString(string(idBytes))
-	idString2 := godyf.NewString(dataHash)
+	// Insert the entry with object numbers and positions at the beginning
+	firstEntry := strings.Join(offsetsAndNumbers, " ")
+	streamData := make([]interface{}, 0, len(stream)+1)
+	streamData = append(streamData, firstEntry)
+	streamData = append(streamData, stream...)
+
+	extra := map[string]interface{}{
+		"Type":  godyf.Name("ObjStm"),
+		"N":     len(data),
+		"First": len(firstEntry) + 1,
+	}
+	return godyf.NewStream(streamData, extra, compress)
+}
 
-	extra["ID"] = godyf.NewArray(string(idString1.Data()), string(idString2.Data()))
+// addIdentifierToExtra adds identifier to the extra dictionary, data
+// holding the serialized objects as in dataHash
+func (p *PDF) addIdentifierToExtra(extra map[string]interface{}, identifier interface{}, data [][]byte) error {
+	id, err := identifierArray(identifier, p.dataHash(data))
+	if err != nil {
+		return err
+	}
+	extra["ID"] = id
 	return nil
 }
 
 // writeIdentifier writes the PDF identifier
-func (p *PDF) writeIdentifier(output io.Writer, identifier interface{}) error {
-	// Calculate data hash
-	var data bytes.Buffer
-	for _, obj := range p.Objects {
-		objBase := obj.GetObject()
-		if objBase.Free != 'f' {
-			data.Write(obj.Data())
-		}
+func (p *PDF) writeIdentifier(output io.Writer, identifier interface{}, data [][]byte) error {
+	id, err := identifierArray(identifier, p.dataHash(data))
+	if err != nil {
+		return err
 	}
+	return p.WriteLine(append([]byte("/ID "), id.Data()...), output)
+}
 
+// dataHash returns the hexadecimal MD5 hash of the data of objects in use.
+// Data holds objects already serialized, by number, other objects are
+// serialized again.
+func (p *PDF) dataHash(data [][]byte) string {
 	hasher := md5.New()
-	hasher.Write(data.Bytes())
-	dataHash := hex.EncodeToString(hasher.Sum(nil))
+	for number, obj := range p.Objects {
+		objBase := obj.GetObject()
+		if objBase.Free == 'f' {
+			continue
+		}
+		if number < len(data) && data[number] != nil {
+			hasher.Write(data[number])
+		} else {
+			hasher.Write(obj.Data())
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
 
+// identifierArray returns the /ID array for identifier, which is true to use
+// the hash of the document data, or a string or []byte given by the user
+func identifierArray(identifier interface{}, dataHash string) (*godyf.Array, error) {
 	var idBytes []byte
 	if identifier == true {
 		idBytes = []byte(dataHash)
 	} else if idStr, ok := identifier.(string); ok {
 		idBytes = []byte(idStr)
 	} else if idBytes, ok = identifier.([]byte); !ok {
-		return fmt.Errorf("invalid identifier type")
+		return nil, fmt.Errorf("invalid identifier type")
 	}
-
-	idString1 := godyf.NewString(string(idBytes))
-	idString2 := godyf.NewString(dataHash)
-
-	var idLine bytes.Buffer
-	idLine.WriteString("/ID [")
-	idLine.Write(idString1.Data())
-	idLine.WriteString(" ")
-	idLine.Write(idString2.Data())
-	idLine.WriteString("]")
-
-	return p.WriteLine(idLine.Bytes(), output)
+	return godyf.NewArray(godyf.NewString(string(idBytes)), godyf.NewString(dataHash)), nil
 }
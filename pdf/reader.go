@@ -0,0 +1,579 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// IndirectValue wraps a value read as an indirect object that is not a
+// dictionary, an array, a string or a stream, such as a number or a name
+type IndirectValue struct {
+	godyf.Object
+	Value interface{}
+}
+
+// Data returns the PDF representation of the wrapped value
+func (v *IndirectValue) Data() []byte {
+	return godyf.ToBytes(v.Value)
+}
+
+// GetObject returns the underlying Object struct
+func (v *IndirectValue) GetObject() *godyf.Object {
+	return &v.Object
+}
+
+// SetObject sets the underlying Object struct
+func (v *IndirectValue) SetObject(obj *godyf.Object) {
+	v.Object = *obj
+}
+
+// Compressible returns whether the value can be included in an object stream
+func (v *IndirectValue) Compressible() bool {
+	return v.Object.Generation == 0
+}
+
+// xrefEntry is an entry of a cross-reference table or stream
+type xrefEntry struct {
+	kind       int   // 0 for free objects, 1 for objects in use, 2 for objects in object streams
+	offset     int64 // Byte offset (kind 1), or number of the object stream (kind 2)
+	generation int   // Generation number (kinds 0 and 1), or index in the object stream (kind 2)
+}
+
+// objectStream holds the decoded content of an /ObjStm object stream
+type objectStream struct {
+	parser  *parser
+	numbers []int   // Object numbers, in stream order
+	offsets []int64 // Object offsets in the decoded data, in stream order
+}
+
+// reader reads the objects of an existing PDF document
+type reader struct {
+	lex           *lexer
+	parser        *parser
+	size          int64
+	version       []byte
+	xref          map[int]xrefEntry
+	trailer       *godyf.Dictionary
+	startXRef     int64                 // Offset of the newest cross-reference section
+	xrefStream    bool                  // Whether the newest cross-reference section is a stream
+	values        map[int]interface{}   // Values of loaded objects
+	loading       map[int]bool          // Objects being loaded, to detect reference cycles
+	objectStreams map[int]*objectStream // Decoded object streams
+	options       ReadOptions
+	warnings      []Warning // Repairs made in recovery mode
+	rebuilt       bool      // Whether the cross-reference table has been rebuilt by scanning
+}
+
+// newReader returns a reader for the size bytes of r
+func newReader(r io.ReaderAt, size int64, options ReadOptions) *reader {
+	lex := newLexer(r, size)
+	rd := &reader{
+		lex:           lex,
+		parser:        newParser(lex),
+		size:          size,
+		xref:          make(map[int]xrefEntry),
+		values:        make(map[int]interface{}),
+		loading:       make(map[int]bool),
+		objectStreams: make(map[int]*objectStream),
+		options:       options,
+	}
+	rd.parser.streamLength = rd.streamLength
+	if options.Recover {
+		rd.parser.streamEnd = rd.findEndstream
+	}
+	return rd
+}
+
+// Open reads an existing PDF document of size bytes from r.
+// Objects keep their original numbers and generations, so that
+// p.Objects[n] is the object number n; free and missing objects are
+// represented by free objects.
+func Open(r io.ReaderAt, size int64) (*PDF, error) {
+	return OpenWithOptions(r, size, ReadOptions{})
+}
+
+// OpenWithOptions reads an existing PDF document of size bytes from r,
+// as Open does, with the given options
+func OpenWithOptions(r io.ReaderAt, size int64, options ReadOptions) (*PDF, error) {
+	rd := newReader(r, size, options)
+	if err := rd.readHeader(); err != nil {
+		if !options.Recover {
+			return nil, err
+		}
+		rd.warn(WarningHeader, 0, 0, "%v", err)
+	}
+	if err := rd.readXRefs(); err != nil {
+		if !options.Recover {
+			return nil, err
+		}
+		if err := rd.rebuild(err); err != nil {
+			return nil, err
+		}
+	}
+	return rd.document()
+}
+
+// readHeader reads the version from the %PDF-x.y header
+func (r *reader) readHeader() error {
+	data, err := r.lex.readAt(0, int(min(1024, r.size)))
+	if err != nil {
+		return err
+	}
+	start := bytes.Index(data, []byte("%PDF-"))
+	if start < 0 {
+		return fmt.Errorf("missing PDF header")
+	}
+	version := data[start+len("%PDF-"):]
+	end := 0
+	for end < len(version) && (version[end] == '.' || (version[end] >= '0' && version[end] <= '9')) {
+		end++
+	}
+	r.version = version[:end]
+	return nil
+}
+
+// findStartXRef returns the offset given after the last startxref keyword
+func (r *reader) findStartXRef() (int64, error) {
+	tailSize := min(2048, r.size)
+	tail, err := r.lex.readAt(r.size-tailSize, int(tailSize))
+	if err != nil {
+		return 0, err
+	}
+	index := bytes.LastIndex(tail, []byte("startxref"))
+	if index < 0 {
+		return 0, fmt.Errorf("missing startxref")
+	}
+	fields := bytes.Fields(tail[index+len("startxref"):])
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("missing startxref offset")
+	}
+	offset, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil || offset < 0 || offset >= r.size {
+		return 0, fmt.Errorf("invalid startxref offset %q", fields[0])
+	}
+	return offset, nil
+}
+
+// readXRefs reads the chain of cross-reference sections, newest first
+func (r *reader) readXRefs() error {
+	offset, err := r.findStartXRef()
+	if err != nil {
+		return err
+	}
+	r.startXRef = offset
+
+	visited := make(map[int64]bool)
+	for !visited[offset] {
+		visited[offset] = true
+		trailer, isStream, err := r.readXRefSection(offset)
+		if err != nil {
+			return err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+			r.xrefStream = isStream
+		}
+		prev, ok := trailer.Get("Prev").(int)
+		if !ok {
+			break
+		}
+		offset = int64(prev)
+	}
+	return nil
+}
+
+// readXRefSection reads the cross-reference table or stream at offset,
+// returning its trailer dictionary and whether it is a stream
+func (r *reader) readXRefSection(offset int64) (*godyf.Dictionary, bool, error) {
+	r.lex.seek(offset)
+	t, err := r.lex.next()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if t.is("xref") {
+		trailer, err := r.readXRefTable()
+		if err != nil {
+			return nil, false, err
+		}
+		// Hybrid-reference files list compressed objects in an extra stream
+		if stream, ok := trailer.Get("XRefStm").(int); ok {
+			if _, err := r.readXRefStream(int64(stream)); err != nil {
+				return nil, false, err
+			}
+		}
+		return trailer, false, nil
+	}
+
+	if t.kind == tokenInteger {
+		trailer, err := r.readXRefStream(offset)
+		return trailer, true, err
+	}
+	return nil, false, fmt.Errorf("expected cross-reference section at offset %d, found %s", offset, t)
+}
+
+// validNumber returns whether number can be the number of an object of
+// the file. Numbers are bounded by the file length, so that hostile files
+// can't make the document allocate more objects than they have bytes.
+func (r *reader) validNumber(number int) bool {
+	return number >= 0 && int64(number) < r.size
+}
+
+// setEntry records an entry, unless a newer section already defined the object
+func (r *reader) setEntry(number int, entry xrefEntry) error {
+	if !r.validNumber(number) {
+		return fmt.Errorf("invalid object number %d in cross-reference section", number)
+	}
+	if _, ok := r.xref[number]; !ok {
+		r.xref[number] = entry
+	}
+	return nil
+}
+
+// readXRefTable reads a classic cross-reference table after its xref keyword
+func (r *reader) readXRefTable() (*godyf.Dictionary, error) {
+	for {
+		t, err := r.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.is("trailer") {
+			value, err := r.parser.parseObject(0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trailer: %w", err)
+			}
+			trailer, ok := value.(*godyf.Dictionary)
+			if !ok {
+				return nil, fmt.Errorf("invalid trailer at offset %d", t.offset)
+			}
+			return trailer, nil
+		}
+
+		count, err := r.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind != tokenInteger || count.kind != tokenInteger {
+			return nil, fmt.Errorf("invalid cross-reference subsection at offset %d", t.offset)
+		}
+
+		start := t.integer()
+		for i := 0; i < count.integer(); i++ {
+			offset, _ := r.lex.next()
+			generation, _ := r.lex.next()
+			kind, err := r.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if offset.kind != tokenInteger || generation.kind != tokenInteger || !(kind.is("n") || kind.is("f")) {
+				return nil, fmt.Errorf("invalid cross-reference entry at offset %d", offset.offset)
+			}
+			entry := xrefEntry{offset: int64(offset.integer()), generation: generation.integer()}
+			if kind.is("n") {
+				entry.kind = 1
+			}
+			if err := r.setEntry(start+i, entry); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readXRefStream reads the cross-reference stream at offset, returning its dictionary
+func (r *reader) readXRefStream(offset int64) (*godyf.Dictionary, error) {
+	_, _, value, err := r.parser.parseIndirect(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := value.(*godyf.Stream)
+	if !ok || stream.Extra["Type"] != godyf.Name("XRef") {
+		return nil, fmt.Errorf("expected cross-reference stream at offset %d", offset)
+	}
+	dictionary := godyf.NewDictionary(stream.Extra)
+
+	data, err := stream.DecodedData()
+	if err != nil {
+		return nil, fmt.Errorf("cross-reference stream at offset %d: %w", offset, err)
+	}
+
+	widths, ok := dictionary.Get("W").(*godyf.Array)
+	if !ok || widths.Len() != 3 {
+		return nil, fmt.Errorf("invalid /W in cross-reference stream at offset %d", offset)
+	}
+	var w [3]int
+	entrySize := 0
+	for i := range w {
+		w[i], ok = widths.Get(i).(int)
+		if !ok || w[i] < 0 || w[i] > 8 {
+			return nil, fmt.Errorf("invalid /W in cross-reference stream at offset %d", offset)
+		}
+		entrySize += w[i]
+	}
+	if entrySize == 0 {
+		return nil, fmt.Errorf("invalid /W in cross-reference stream at offset %d", offset)
+	}
+
+	index := []interface{}{0, dictionary.Get("Size")}
+	if array, ok := dictionary.Get("Index").(*godyf.Array); ok {
+		index = array.Elements
+	}
+
+	position := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int)
+		count, ok2 := index[i+1].(int)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid /Index in cross-reference stream at offset %d", offset)
+		}
+		for j := 0; j < count && position+entrySize <= len(data); j++ {
+			var fields [3]int64
+			for k := range fields {
+				for _, b := range data[position : position+w[k]] {
+					fields[k] = fields[k]<<8 | int64(b)
+				}
+				position += w[k]
+			}
+			if w[0] == 0 {
+				// The type field defaults to 1 when absent
+				fields[0] = 1
+			}
+			if fields[0] <= 2 {
+				entry := xrefEntry{kind: int(fields[0]), offset: fields[1], generation: int(fields[2])}
+				if err := r.setEntry(start+j, entry); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return dictionary, nil
+}
+
+// streamLength resolves the /Length value of a stream
+func (r *reader) streamLength(length interface{}) (int, bool) {
+	if ref, ok := length.(godyf.Ref); ok {
+		value, err := r.load(ref.Number)
+		if err != nil {
+			return 0, false
+		}
+		length = value
+	}
+	value, ok := length.(int)
+	return value, ok && value >= 0
+}
+
+// load returns the value of the object with the given number, or null
+// if the object is free or missing
+func (r *reader) load(number int) (interface{}, error) {
+	if value, ok := r.values[number]; ok {
+		return value, nil
+	}
+	entry, ok := r.xref[number]
+	if !ok || entry.kind == 0 {
+		return godyf.Null{}, nil
+	}
+	if r.loading[number] {
+		return nil, fmt.Errorf("object %d references itself", number)
+	}
+	r.loading[number] = true
+	defer delete(r.loading, number)
+
+	var value interface{}
+	var err error
+	if entry.kind == 1 {
+		var found int
+		found, _, value, err = r.parser.parseIndirect(entry.offset)
+		if err == nil && found != number {
+			err = fmt.Errorf("expected object %d at offset %d, found object %d", number, entry.offset, found)
+		}
+	} else {
+		value, err = r.loadCompressed(number, int(entry.offset), entry.generation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.values[number] = value
+	return value, nil
+}
+
+// loadCompressed returns the value of an object stored in an object stream
+func (r *reader) loadCompressed(number, streamNumber, index int) (interface{}, error) {
+	stream, err := r.objectStream(streamNumber)
+	if err != nil {
+		return nil, err
+	}
+	if index >= len(stream.numbers) || stream.numbers[index] != number {
+		// Fall back to a search when the index is wrong
+		index = -1
+		for i, n := range stream.numbers {
+			if n == number {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("object %d not found in object stream %d", number, streamNumber)
+		}
+	}
+	stream.parser.lex.seek(stream.offsets[index])
+	value, err := stream.parser.parseObject(0)
+	if err != nil {
+		return nil, fmt.Errorf("object %d in object stream %d: %w", number, streamNumber, err)
+	}
+	return value, nil
+}
+
+// objectStream returns the decoded object stream with the given number
+func (r *reader) objectStream(number int) (*objectStream, error) {
+	if stream, ok := r.objectStreams[number]; ok {
+		return stream, nil
+	}
+	if entry, ok := r.xref[number]; !ok || entry.kind != 1 {
+		return nil, fmt.Errorf("object stream %d not found", number)
+	}
+
+	value, err := r.load(number)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := value.(*godyf.Stream)
+	if !ok || stream.Extra["Type"] != godyf.Name("ObjStm") {
+		return nil, fmt.Errorf("object %d is not an object stream", number)
+	}
+	data, err := stream.DecodedData()
+	if err != nil {
+		return nil, fmt.Errorf("object stream %d: %w", number, err)
+	}
+	count, ok1 := stream.Extra["N"].(int)
+	first, ok2 := stream.Extra["First"].(int)
+	if !ok1 || !ok2 || first < 0 || first > len(data) {
+		return nil, fmt.Errorf("invalid object stream %d", number)
+	}
+
+	lex := newLexer(bytes.NewReader(data), int64(len(data)))
+	result := &objectStream{parser: newParser(lex)}
+	for i := 0; i < count; i++ {
+		objectNumber, _ := lex.next()
+		offset, err := lex.next()
+		if err != nil || objectNumber.kind != tokenInteger || offset.kind != tokenInteger {
+			return nil, fmt.Errorf("invalid header in object stream %d", number)
+		}
+		result.numbers = append(result.numbers, objectNumber.integer())
+		result.offsets = append(result.offsets, int64(first+offset.integer()))
+	}
+	r.objectStreams[number] = result
+	return result, nil
+}
+
+// document builds a PDF from the objects of the file
+func (r *reader) document() (*PDF, error) {
+	// Offsets that don't match objects usually mean that the whole table is wrong
+	if r.options.Recover && !r.rebuilt {
+		if err := r.loadAll(); err != nil {
+			if err := r.rebuild(err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r.trailer.Get("Encrypt") != nil {
+		return nil, fmt.Errorf("encrypted documents are not supported")
+	}
+
+	// The size given by the trailer is only checked, objects past the
+	// last entry being missing anyway
+	if value := r.trailer.Get("Size"); value != nil {
+		if size, ok := value.(int); !ok || size < 0 {
+			if !r.options.Recover {
+				return nil, fmt.Errorf("invalid trailer /Size %s", godyf.ToBytes(value))
+			}
+			r.warn(WarningTrailerRebuilt, 0, -1, "invalid /Size %s ignored", godyf.ToBytes(value))
+		}
+	}
+	size := 0
+	for number := range r.xref {
+		size = max(size, number+1)
+	}
+
+	p := &PDF{
+		Objects: make([]godyf.PDFObject, size),
+		Version: r.version,
+		Trailer: r.trailer,
+	}
+	for number := 0; number < size; number++ {
+		entry, ok := r.xref[number]
+		if number == 0 || !ok || entry.kind == 0 {
+			free := godyf.NewObject()
+			free.Number = number
+			free.Free = 'f'
+			if number == 0 {
+				free.Generation = 65535
+			} else if ok {
+				free.Generation = entry.generation
+			}
+			p.Objects[number] = &ObjectWrapper{free}
+			continue
+		}
+
+		value, err := r.load(number)
+		if err != nil {
+			if !r.options.Recover {
+				return nil, err
+			}
+			r.warn(WarningObjectDropped, number, -1, "%v", err)
+			free := godyf.NewObject()
+			free.Number = number
+			free.Free = 'f'
+			p.Objects[number] = &ObjectWrapper{free}
+			continue
+		}
+		obj := toPDFObject(value)
+		base := obj.GetObject()
+		base.Number = number
+		base.Free = 'n'
+		if entry.kind == 1 {
+			base.Generation = entry.generation
+		}
+		p.Objects[number] = obj
+	}
+
+	var ok bool
+	if p.Catalog, ok = p.Resolve(r.trailer.Get("Root")).(*godyf.Dictionary); !ok {
+		return nil, fmt.Errorf("missing document catalog")
+	}
+	if p.Pages, ok = p.Resolve(p.Catalog.Get("Pages")).(*godyf.Dictionary); !ok {
+		return nil, fmt.Errorf("missing page tree")
+	}
+	p.Info, _ = p.Resolve(r.trailer.Get("Info")).(*godyf.Dictionary)
+	p.Warnings = r.warnings
+
+	p.source = &sourceFile{
+		size:       r.size,
+		startXRef:  r.startXRef,
+		xrefStream: r.xrefStream,
+		repaired:   r.rebuilt,
+	}
+	if last, err := r.lex.readAt(r.size-1, 1); err == nil {
+		p.source.endsInEOL = last[0] == '\n' || last[0] == '\r'
+	}
+	p.source.snapshot(p.Objects)
+	return p, nil
+}
+
+// toPDFObject wraps a value read from a file into a PDF object
+func toPDFObject(value interface{}) godyf.PDFObject {
+	switch v := value.(type) {
+	case *godyf.Dictionary:
+		return v
+	case *godyf.Array:
+		return v
+	case *godyf.String:
+		return v
+	case *godyf.Stream:
+		return v
+	}
+	return &IndirectValue{Object: *godyf.NewObject(), Value: value}
+}
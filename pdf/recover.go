@@ -0,0 +1,270 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// ReadOptions configures how existing documents are read
+type ReadOptions struct {
+	// Recover repairs damaged documents instead of failing: the
+	// cross-reference table is rebuilt by scanning the file when it is
+	// unusable, stream lengths are fixed by searching for endstream and
+	// unreadable objects are dropped. Repairs are listed in PDF.Warnings.
+	Recover bool
+}
+
+// WarningKind identifies the kind of repair made while reading a document
+type WarningKind int
+
+const (
+	// WarningXRefRebuilt is reported when the cross-reference table is rebuilt by scanning the file
+	WarningXRefRebuilt WarningKind = iota
+	// WarningTrailerRebuilt is reported when trailer entries are recovered from other sources
+	WarningTrailerRebuilt
+	// WarningStreamLength is reported when a stream /Length is replaced by the position of endstream
+	WarningStreamLength
+	// WarningObjectDropped is reported when an unreadable object is replaced by a free object
+	WarningObjectDropped
+	// WarningHeader is reported when the %PDF header is missing
+	WarningHeader
+)
+
+// String returns a short description of the warning kind
+func (k WarningKind) String() string {
+	switch k {
+	case WarningXRefRebuilt:
+		return "cross-reference rebuilt"
+	case WarningTrailerRebuilt:
+		return "trailer rebuilt"
+	case WarningStreamLength:
+		return "stream length fixed"
+	case WarningObjectDropped:
+		return "object dropped"
+	case WarningHeader:
+		return "missing header"
+	}
+	return "unknown"
+}
+
+// Warning describes a repair made while reading a damaged document
+type Warning struct {
+	Kind    WarningKind
+	Object  int   // Number of the object concerned, 0 if none
+	Offset  int64 // Offset in the file concerned, -1 if none
+	Message string
+}
+
+// String returns a description of the warning
+func (w Warning) String() string {
+	description := w.Kind.String()
+	if w.Object > 0 {
+		description += fmt.Sprintf(", object %d", w.Object)
+	}
+	if w.Offset >= 0 {
+		description += fmt.Sprintf(", offset %d", w.Offset)
+	}
+	return description + ": " + w.Message
+}
+
+// warn records a repair
+func (r *reader) warn(kind WarningKind, object int, offset int64, format string, args ...interface{}) {
+	r.warnings = append(r.warnings, Warning{
+		Kind:    kind,
+		Object:  object,
+		Offset:  offset,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// objectHeader matches "N G obj" object headers
+var objectHeader = regexp.MustCompile(`(\d{1,10})[\x00\t\n\f\r ]+(\d{1,5})[\x00\t\n\f\r ]+obj`)
+
+// trailerKeyword matches trailer keywords followed by a dictionary
+var trailerKeyword = regexp.MustCompile(`trailer[\x00\t\n\f\r ]*<<`)
+
+// isBoundary returns whether the byte at index of data, if any, separates tokens
+func isBoundary(data []byte, index int) bool {
+	return index < 0 || index >= len(data) || isWhitespace(data[index]) || isDelimiter(data[index])
+}
+
+// findEndstream returns the end of the data of a stream starting at offset,
+// found by searching for the endstream keyword, or -1
+func (r *reader) findEndstream(offset int64) int64 {
+	const chunkSize = 64 * 1024
+	keyword := []byte("endstream")
+	for start := offset; start < r.size; start += chunkSize {
+		length := min(chunkSize+int64(len(keyword)), r.size-start)
+		chunk, err := r.lex.readAt(start, int(length))
+		if err != nil {
+			return -1
+		}
+		index := bytes.Index(chunk, keyword)
+		if index < 0 {
+			continue
+		}
+
+		// The end-of-line marker before endstream is not part of the data
+		end := start + int64(index)
+		if index >= 2 && chunk[index-2] == '\r' && chunk[index-1] == '\n' && end-2 >= offset {
+			end -= 2
+		} else if index >= 1 && (chunk[index-1] == '\n' || chunk[index-1] == '\r') && end-1 >= offset {
+			end--
+		}
+		r.warn(WarningStreamLength, 0, offset, "stream data ends at offset %d", end)
+		return end
+	}
+	return -1
+}
+
+// rebuild rebuilds the cross-reference table and the trailer by scanning
+// the whole file for object headers and trailer dictionaries
+func (r *reader) rebuild(cause error) error {
+	data, err := r.lex.readAt(0, int(r.size))
+	if err != nil {
+		return err
+	}
+
+	// Later definitions of an object override earlier ones, as in incremental updates
+	xref := make(map[int]xrefEntry)
+	for _, match := range objectHeader.FindAllSubmatchIndex(data, -1) {
+		if !isBoundary(data, match[0]-1) || !isBoundary(data, match[1]) {
+			continue
+		}
+		number, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		generation, _ := strconv.Atoi(string(data[match[4]:match[5]]))
+		if !r.validNumber(number) {
+			continue
+		}
+		xref[number] = xrefEntry{kind: 1, offset: int64(match[0]), generation: generation}
+	}
+	if len(xref) == 0 {
+		return fmt.Errorf("no objects found while repairing document: %w", cause)
+	}
+
+	previousTrailer := r.trailer
+	r.xref = xref
+	r.values = make(map[int]interface{})
+	r.objectStreams = make(map[int]*objectStream)
+	r.rebuilt = true
+	r.warn(WarningXRefRebuilt, 0, -1, "found %d objects after error: %v", len(xref), cause)
+
+	numbers := make([]int, 0, len(xref))
+	for number := range xref {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	// Collect trailer candidates in file order: trailer dictionaries and
+	// cross-reference stream dictionaries
+	type candidate struct {
+		offset     int64
+		dictionary *godyf.Dictionary
+	}
+	var candidates []candidate
+	for _, match := range trailerKeyword.FindAllIndex(data, -1) {
+		r.lex.seek(int64(match[0] + len("trailer")))
+		if value, err := r.parser.parseObject(0); err == nil {
+			if dictionary, ok := value.(*godyf.Dictionary); ok {
+				candidates = append(candidates, candidate{int64(match[0]), dictionary})
+			}
+		}
+	}
+
+	// Register objects stored in object streams that are not defined elsewhere
+	for _, number := range numbers {
+		value, err := r.load(number)
+		if err != nil {
+			continue
+		}
+		stream, ok := value.(*godyf.Stream)
+		if !ok {
+			continue
+		}
+		switch stream.Extra["Type"] {
+		case godyf.Name("ObjStm"):
+			decoded, err := r.objectStream(number)
+			if err != nil {
+				continue
+			}
+			for index, compressed := range decoded.numbers {
+				if _, ok := r.xref[compressed]; !ok && r.validNumber(compressed) {
+					r.xref[compressed] = xrefEntry{kind: 2, offset: int64(number), generation: index}
+				}
+			}
+		case godyf.Name("XRef"):
+			candidates = append(candidates, candidate{xref[number].offset, godyf.NewDictionary(stream.Extra)})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].offset < candidates[j].offset })
+
+	trailer := godyf.NewDictionary(nil)
+	sources := candidates
+	if previousTrailer != nil {
+		sources = append(sources, candidate{r.size, previousTrailer})
+	}
+	for _, source := range sources {
+		for _, key := range []string{"Root", "Info", "ID", "Encrypt"} {
+			if value := source.dictionary.Get(key); value != nil {
+				trailer.Set(key, value)
+			}
+		}
+	}
+
+	size := 0
+	for number := range r.xref {
+		size = max(size, number+1)
+	}
+
+	// Look for the catalog, with the highest number, when no trailer gives a usable one
+	root, _ := trailer.Get("Root").(godyf.Ref)
+	if catalog, err := r.load(root.Number); err != nil || !isCatalog(catalog) {
+		found := false
+		for number := size - 1; number > 0 && !found; number-- {
+			if catalog, err := r.load(number); err == nil && isCatalog(catalog) {
+				generation := 0
+				if entry := r.xref[number]; entry.kind == 1 {
+					generation = entry.generation
+				}
+				trailer.Set("Root", godyf.Ref{Number: number, Generation: generation})
+				r.warn(WarningTrailerRebuilt, number, -1, "document catalog found by scanning")
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no document catalog found while repairing document: %w", cause)
+		}
+	}
+
+	trailer.Set("Size", size)
+	r.trailer = trailer
+	return nil
+}
+
+// isCatalog returns whether value is a document catalog
+func isCatalog(value interface{}) bool {
+	dictionary, ok := value.(*godyf.Dictionary)
+	return ok && dictionary.Get("Type") == godyf.Name("Catalog")
+}
+
+// loadAll loads all the objects in use, returning the first error
+func (r *reader) loadAll() error {
+	for number, entry := range r.xref {
+		if entry.kind == 0 || number == 0 {
+			continue
+		}
+		if _, err := r.load(number); err != nil {
+			return err
+		}
+	}
+	root, _ := r.trailer.Get("Root").(godyf.Ref)
+	if catalog, _ := r.load(root.Number); !isCatalog(catalog) {
+		return fmt.Errorf("missing document catalog")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package pdf
+
+import (
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// Resource is a group of objects added together to a document whose content
+// is completed when the document is written, such as an embedded font that
+// only includes the glyphs used by the pages
+type Resource interface {
+	// Objects returns the objects of the resource, the first one being the
+	// object referenced by resource dictionaries
+	Objects() []godyf.PDFObject
+	// Finish completes the objects of the resource, once they have their
+	// object numbers. It is called each time the document is written.
+	Finish() error
+}
+
+// AddResource adds the objects of resource to the PDF, and returns a
+// reference to its first object. The resource is finished each time the
+// document is written with Write, WriteWithOptions, WriteLinearized or
+// WriteIncremental.
+func (p *PDF) AddResource(resource Resource) godyf.Ref {
+	objects := resource.Objects()
+	for _, obj := range objects {
+		p.AddObject(obj)
+	}
+	p.resources = append(p.resources, resource)
+	return objects[0].GetObject().Ref()
+}
+
+// finishResources finishes the resources of the PDF, before its objects are
+// serialized
+func (p *PDF) finishResources() error {
+	for _, resource := range p.resources {
+		if err := resource.Finish(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
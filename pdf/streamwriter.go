@@ -0,0 +1,236 @@
+package pdf
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/stackquest-hq/godyf/godyf"
+)
+
+// StreamWriter writes a PDF document to an io.Writer as objects are added,
+// keeping only their offsets in memory. It is meant for large documents:
+// objects can be released once written. The page tree, the catalog and the
+// Info dictionary are written last by Close, and can be changed until then.
+type StreamWriter struct {
+	// Pages dictionary containing the PDF's pages, its number is reserved
+	// so that pages can reference it
+	Pages *godyf.Dictionary
+	// Info dictionary containing the PDF's metadata
+	Info *godyf.Dictionary
+	// Catalog dictionary containing references to other objects
+	Catalog *godyf.Dictionary
+
+	output   io.Writer
+	position int
+	offsets  []int // Offsets of the objects by number, 0 for objects not written yet
+	kids     *godyf.Array
+	hasher   hash.Hash // Hash of the data of the written objects
+	closed   bool      // Whether the trailer has been written
+	err      error     // Error of a failed write, the output being unusable
+}
+
+// NewStreamWriter writes the header of a PDF document of the given version,
+// defaulting to "1.7", and returns a writer for its objects
+func NewStreamWriter(output io.Writer, version []byte) (*StreamWriter, error) {
+	if version == nil {
+		version = []byte("1.7")
+	}
+	w := &StreamWriter{
+		output:  output,
+		offsets: []int{0},
+		kids:    godyf.NewArray(),
+		hasher:  md5.New(),
+		Info:    godyf.NewDictionary(map[string]interface{}{}),
+	}
+	w.Pages = godyf.NewDictionary(map[string]interface{}{
+		"Type": godyf.Name("Pages"),
+	})
+	w.Pages.Number = w.Reserve().Number
+	w.Catalog = godyf.NewDictionary(map[string]interface{}{
+		"Type":  godyf.Name("Catalog"),
+		"Pages": w.Pages.Ref(),
+	})
+
+	if err := w.writeLine(append([]byte("%PDF-"), version...)); err != nil {
+		return nil, err
+	}
+	if err := w.writeLine([]byte("%\xf0\x9f\x96\xa4")); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// writeLine writes a line to the output and updates the current position.
+// Write errors are kept and returned by later calls, as the output is then
+// truncated.
+func (w *StreamWriter) writeLine(content []byte) error {
+	if _, err := w.output.Write(content); err != nil {
+		w.err = err
+		return err
+	}
+	if _, err := w.output.Write([]byte("\n")); err != nil {
+		w.err = err
+		return err
+	}
+	w.position += len(content) + 1
+	return nil
+}
+
+// check returns an error if the writer is closed or failed
+func (w *StreamWriter) check() error {
+	if w.err != nil {
+		return fmt.Errorf("stream writer failed: %w", w.err)
+	}
+	if w.closed {
+		return fmt.Errorf("stream writer is closed")
+	}
+	return nil
+}
+
+// Reserve returns a reference to a new object number, for objects that
+// are referenced before being written. The object is then written by
+// WriteObject after setting its number.
+func (w *StreamWriter) Reserve() godyf.Ref {
+	w.offsets = append(w.offsets, 0)
+	return godyf.Ref{Number: len(w.offsets) - 1}
+}
+
+// WriteObject writes obj to the output. Objects whose number was
+// reserved keep it, other objects get a new number. Objects are written
+// with generation 0, an error is returned for other generations.
+func (w *StreamWriter) WriteObject(obj godyf.PDFObject) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	objBase := obj.GetObject()
+	if objBase.Generation != 0 {
+		return fmt.Errorf("object %d has generation %d, only generation 0 can be written", objBase.Number, objBase.Generation)
+	}
+	if objBase.Number <= 0 || objBase.Number >= len(w.offsets) {
+		objBase.Number = w.Reserve().Number
+	} else if w.offsets[objBase.Number] != 0 {
+		return fmt.Errorf("object %d has already been written", objBase.Number)
+	}
+	objBase.Free = 'n'
+	objBase.Offset = w.position
+
+	data := obj.Data()
+	w.hasher.Write(data)
+	w.offsets[objBase.Number] = w.position
+	return w.writeLine(objBase.Indirect(data))
+}
+
+// AddPage writes a page and adds it to the page tree. The /Parent entry is
+// set to the page tree if missing.
+func (w *StreamWriter) AddPage(page *godyf.Dictionary) error {
+	if page.Get("Parent") == nil {
+		page.Set("Parent", w.Pages.Ref())
+	}
+	if err := w.WriteObject(page); err != nil {
+		return err
+	}
+	w.kids.Add(page.Ref())
+	return nil
+}
+
+// PageReferences returns the references of the pages written so far
+func (w *StreamWriter) PageReferences() []godyf.Ref {
+	references := make([]godyf.Ref, 0, w.kids.Len())
+	for _, kid := range w.kids.Elements {
+		references = append(references, kid.(godyf.Ref))
+	}
+	return references
+}
+
+// Close writes the page tree, the catalog, the Info dictionary, the
+// cross-reference table and the trailer. Identifier is handled as in
+// PDF.Write, the hash being computed from the written objects.
+//
+// Nothing is written when reserved objects are missing, when the page
+// tree, the catalog or the Info dictionary have already been written or
+// have a non-zero generation, or when the identifier is invalid, so that
+// Close can be called again once fixed. The writer is closed once the
+// trailer is written; if writing fails, the output is truncated and later
+// calls return the error.
+func (w *StreamWriter) Close(identifier interface{}) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	objects := []godyf.PDFObject{w.Pages, w.Catalog}
+	if w.Info != nil {
+		objects = append(objects, w.Info)
+	}
+	closing := make(map[int]bool)
+	for _, obj := range objects {
+		if generation := obj.GetObject().Generation; generation != 0 {
+			return fmt.Errorf("object %d has generation %d, only generation 0 can be written", obj.GetObject().Number, generation)
+		}
+		if number := obj.GetObject().Number; number > 0 && number < len(w.offsets) {
+			if w.offsets[number] != 0 {
+				return fmt.Errorf("object %d has already been written", number)
+			}
+			closing[number] = true
+		}
+	}
+	for number, offset := range w.offsets[1:] {
+		if offset == 0 && !closing[number+1] {
+			return fmt.Errorf("object %d is reserved but has not been written", number+1)
+		}
+	}
+	if identifier != nil {
+		if _, err := identifierArray(identifier, ""); err != nil {
+			return err
+		}
+	}
+
+	w.Pages.Set("Kids", w.kids)
+	w.Pages.Set("Count", w.kids.Len())
+	for _, obj := range objects {
+		if err := w.WriteObject(obj); err != nil {
+			return err
+		}
+	}
+
+	xrefPosition := w.position
+	if err := w.writeLine([]byte("xref")); err != nil {
+		return err
+	}
+	if err := w.writeLine([]byte(fmt.Sprintf("0 %d", len(w.offsets)))); err != nil {
+		return err
+	}
+	if err := w.writeLine([]byte("0000000000 65535 f ")); err != nil {
+		return err
+	}
+	for _, offset := range w.offsets[1:] {
+		if err := w.writeLine([]byte(fmt.Sprintf("%010d 00000 n ", offset))); err != nil {
+			return err
+		}
+	}
+
+	trailer := godyf.NewDictionary(nil)
+	trailer.Set("Size", len(w.offsets))
+	trailer.Set("Root", w.Catalog.Ref())
+	if w.Info != nil {
+		trailer.Set("Info", w.Info.Ref())
+	}
+	if identifier != nil {
+		id, err := identifierArray(identifier, hex.EncodeToString(w.hasher.Sum(nil)))
+		if err != nil {
+			return err
+		}
+		trailer.Set("ID", id)
+	}
+	for _, line := range [][]byte{
+		[]byte("trailer"), trailer.Data(),
+		[]byte("startxref"), []byte(fmt.Sprintf("%d", xrefPosition)), []byte("%%EOF"),
+	} {
+		if err := w.writeLine(line); err != nil {
+			return err
+		}
+	}
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,1023 @@
+package godyf_tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/stackquest-hq/godyf/font"
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+// standardFont returns the standard font with the given name
+func standardFont(t *testing.T, name string) *font.Standard {
+	t.Helper()
+	standard, err := font.NewStandard(name)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", name, err)
+	}
+	return standard
+}
+
+func TestStandardFonts(t *testing.T) {
+	for _, name := range font.StandardNames() {
+		standard := standardFont(t, name)
+		if standard.GlyphWidth("space") == 0 {
+			t.Fatalf("Missing space width in %s", name)
+		}
+		dictionary, err := standard.Dictionary(nil)
+		if err != nil {
+			t.Fatalf("Failed to build dictionary for %s: %v", name, err)
+		}
+		if dictionary.Get("BaseFont") != godyf.Name(name) || dictionary.Get("Subtype") != godyf.Name("Type1") {
+			t.Fatalf("Unexpected dictionary %s", dictionary.Data())
+		}
+		if _, ok := dictionary.Values["Encoding"]; ok == standard.Symbolic {
+			t.Fatalf("Unexpected encoding in %s", dictionary.Data())
+		}
+	}
+	if _, err := font.NewStandard("Arial"); err == nil {
+		t.Fatal("Expected an error for a font that isn't standard")
+	}
+}
+
+func TestMeasureString(t *testing.T) {
+	helvetica := standardFont(t, "Helvetica")
+	for _, test := range []struct {
+		font  *font.Standard
+		text  string
+		width float64
+	}{
+		{helvetica, "Hello", 22.78},
+		{helvetica, "Héllo", 22.78},
+		{helvetica, "ïi", 5},
+		{standardFont(t, "Helvetica-Oblique"), "Hello", 22.78},
+		{standardFont(t, "Times-Roman"), "Hello, World!", 56.1},
+		{standardFont(t, "Times-BoldItalic"), "AV", 13.34},
+		{standardFont(t, "Courier-Bold"), "Wide € text", 66},
+		{standardFont(t, "Symbol"), "αβ≤", 17.29},
+		{standardFont(t, "ZapfDingbats"), "✈", 7.91},
+	} {
+		if width := font.MeasureString(test.font, 10, test.text); math.Abs(width-test.width) > 1e-9 {
+			t.Fatalf("Unexpected width %v for %q in %s, expected %v", width, test.text, test.font.Name, test.width)
+		}
+	}
+
+	// Kerning moves V closer to A
+	if width := font.MeasureStringKerned(helvetica, 10, "AVA"); math.Abs(width-18.51) > 1e-9 {
+		t.Fatalf("Unexpected kerned width %v", width)
+	}
+	if helvetica.Kerning("A", "V") != -70 || helvetica.KerningPairs()[[2]string{"T", "o"}] != -120 {
+		t.Fatal("Unexpected kerning pairs")
+	}
+	text, err := helvetica.KernedText("AVAx")
+	if err != nil || text != "(A) 70 (V) 80 (Ax)" {
+		t.Fatalf("Unexpected kerned text %q (%v)", text, err)
+	}
+
+	// Metrics are the ones of the AFM files, for all their glyphs
+	courier := standardFont(t, "Courier-Oblique")
+	for _, test := range []struct {
+		font  *font.Standard
+		glyph string
+		width int
+	}{
+		{helvetica, "dcaron", 643},
+		{helvetica, "lcaron", 299},
+		{standardFont(t, "Times-Italic"), "Lcaron", 611},
+		{courier, "dcaron", 600},
+		{courier, "Euro", 600},
+		{courier, "unknown", 0},
+	} {
+		if width := test.font.GlyphWidth(test.glyph); width != test.width {
+			t.Fatalf("Unexpected width %d for %s in %s, expected %d", width, test.glyph, test.font.Name, test.width)
+		}
+	}
+	if helvetica.Kerning("Aacute", "T") != -120 || helvetica.Kerning("Y", "v") != 0 || courier.Kerning("A", "T") != 0 {
+		t.Fatal("Unexpected kerning of accented or unknown pairs")
+	}
+
+	// Text is measured with the glyphs of the given encoding
+	times := standardFont(t, "Times-Roman")
+	for _, test := range []struct {
+		encoding *font.Encoding
+		width    float64
+	}{
+		{nil, 10},
+		{font.WinAnsiEncoding, 10},
+		{font.MacRomanEncoding, 15.56},
+		{font.StandardEncoding, 15.56},
+	} {
+		width, err := font.MeasureStringWithEncoding(times, 10, "ﬁ…", test.encoding)
+		if err != nil || math.Abs(width-test.width) > 1e-9 {
+			t.Fatalf("Unexpected width %v (%v) with %v, expected %v", width, err, test.encoding, test.width)
+		}
+	}
+	if _, err := font.MeasureStringWithEncoding(standardFont(t, "Symbol"), 10, "α", font.WinAnsiEncoding); err == nil {
+		t.Fatal("Expected an error for an unsupported encoding")
+	}
+}
+
+func TestStandardEncodings(t *testing.T) {
+	times := standardFont(t, "Times-Roman")
+	for _, test := range []struct {
+		encoding *font.Encoding
+		text     string
+		codes    string
+	}{
+		{nil, "Año €", "A\xf1o \x80"},
+		{font.WinAnsiEncoding, "“fi”", "\x93fi\x94"},
+		{font.MacRomanEncoding, "Año ﬁ", "A\x96o \xde"},
+		{font.StandardEncoding, "’Æ", "'\xe1"},
+	} {
+		codes, err := times.Encode(test.text, test.encoding)
+		if err != nil || string(codes) != test.codes {
+			t.Fatalf("Unexpected codes %q for %q (%v)", codes, test.text, err)
+		}
+	}
+	if _, err := times.Encode("€", font.MacRomanEncoding); err == nil {
+		t.Fatal("Expected an error for a character missing from the encoding")
+	}
+	if _, err := times.Encode("α", nil); err == nil {
+		t.Fatal("Expected an error for a character missing from the font")
+	}
+
+	symbol := standardFont(t, "Symbol")
+	if codes, err := symbol.Encode("α∑", nil); err != nil || string(codes) != "a\xe5" {
+		t.Fatalf("Unexpected Symbol codes %q (%v)", codes, err)
+	}
+	if _, err := symbol.Dictionary(font.WinAnsiEncoding); err == nil {
+		t.Fatal("Expected an error for a symbolic font with a Latin encoding")
+	}
+	dictionary, _ := times.Dictionary(font.MacRomanEncoding)
+	if dictionary.Get("Encoding") != godyf.Name("MacRomanEncoding") {
+		t.Fatalf("Unexpected dictionary %s", dictionary.Data())
+	}
+	if codes := times.EncodeText("Aé✈"); string(codes) != "A\xe9" {
+		t.Fatalf("Unexpected codes %q", codes)
+	}
+}
+
+// trueTypeFont returns the font read from data
+func trueTypeFont(t *testing.T, data []byte) *font.TrueType {
+	t.Helper()
+	embedded, err := font.NewTrueType(data)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	return embedded
+}
+
+// openedDocument is the document opened by writeEmbeddedFont
+var openedDocument *pdf.PDF
+
+// decodedStream returns the decoded data of the stream referenced by
+// reference in openedDocument
+func decodedStream(t *testing.T, reference interface{}) []byte {
+	t.Helper()
+	decoded, err := openedDocument.Resolve(reference).(*godyf.Stream).DecodedData()
+	if err != nil {
+		t.Fatalf("Failed to decode stream: %v", err)
+	}
+	return decoded
+}
+
+// writeEmbeddedFont writes a document showing text with embedded, opens it
+// in openedDocument, and returns its font dictionary, font descriptor and
+// decoded font file. The descriptor of composite fonts is found in their
+// descendant font.
+func writeEmbeddedFont(t *testing.T, embedded *font.TrueType, text string, options pdf.WriteOptions) (*godyf.Dictionary, *godyf.Dictionary, *godyf.Stream, []byte) {
+	t.Helper()
+	document := pdf.NewPDF()
+	fontRef := document.AddResource(embedded)
+	draw := godyf.NewStream(nil, nil, true)
+	draw.BeginText()
+	draw.SetFontSize("F1", 12)
+	draw.ShowText(godyf.EncodedText(embedded, text))
+	draw.EndText()
+	document.AddObject(draw)
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":      godyf.Name("Page"),
+		"Parent":    document.Pages.Ref(),
+		"Contents":  draw.Ref(),
+		"MediaBox":  godyf.NewArray(0, 0, 200, 50),
+		"Resources": godyf.NewDictionary(map[string]interface{}{"Font": godyf.NewDictionary(map[string]interface{}{"F1": fontRef})}),
+	}))
+	var buf bytes.Buffer
+	if err := document.WriteWithOptions(&buf, options); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+
+	document = openBytes(t, buf.Bytes())
+	page := document.Resolve(document.PageReferences()[0]).(*godyf.Dictionary)
+	fonts := document.Resolve(document.Resolve(page.Get("Resources")).(*godyf.Dictionary).Get("Font")).(*godyf.Dictionary)
+	dictionary := document.Resolve(fonts.Get("F1")).(*godyf.Dictionary)
+	descendant := dictionary
+	if descendants, ok := dictionary.Get("DescendantFonts").(*godyf.Array); ok {
+		descendant = document.Resolve(descendants.Elements[0]).(*godyf.Dictionary)
+	}
+	descriptor := document.Resolve(descendant.Get("FontDescriptor")).(*godyf.Dictionary)
+	file := descriptor.Get("FontFile2")
+	if file == nil {
+		file = descriptor.Get("FontFile3")
+	}
+	openedDocument = document
+	return dictionary, descriptor, document.Resolve(file).(*godyf.Stream), decodedStream(t, file)
+}
+
+// sfntTable returns the table with the given tag of a font file
+func sfntTable(data []byte, tag string) []byte {
+	for i := 0; i < int(binary.BigEndian.Uint16(data[4:])); i++ {
+		record := data[12+16*i:]
+		if string(record[:4]) == tag {
+			offset := binary.BigEndian.Uint32(record[8:])
+			return data[offset : offset+binary.BigEndian.Uint32(record[12:])]
+		}
+	}
+	return nil
+}
+
+var subsetName = regexp.MustCompile(`^/[A-Z]{6}\+GodyfTest$`)
+
+func TestTrueTypeFont(t *testing.T) {
+	embedded := trueTypeFont(t, trueTypeFontData())
+	if embedded.Name != "GodyfTest" || embedded.BBox != [4]int{0, -200, 1000, 1000} {
+		t.Fatalf("Unexpected name %q or bounding box %v", embedded.Name, embedded.BBox)
+	}
+	if embedded.Ascent != 781 || embedded.Descent != -195 || embedded.CapHeight != 684 {
+		t.Fatalf("Unexpected metrics %d %d %d", embedded.Ascent, embedded.Descent, embedded.CapHeight)
+	}
+	if embedded.GlyphWidth('A') != 600 || embedded.GlyphWidth(' ') != 250 || embedded.GlyphWidth('Z') != 500 {
+		t.Fatal("Unexpected glyph widths")
+	}
+	if width := embedded.MeasureString(10, "AB A"); math.Abs(width-19.5) > 1e-9 {
+		t.Fatalf("Unexpected width %v", width)
+	}
+	if codes := embedded.EncodeText("AB A"); string(codes) != "!\" !" {
+		t.Fatalf("Unexpected codes %q", codes)
+	}
+
+	dictionary, descriptor, stream, subset := writeEmbeddedFont(t, embedded, "BAB", pdf.WriteOptions{})
+	if dictionary.Get("Subtype") != godyf.Name("TrueType") || !subsetName.Match(godyf.ToBytes(dictionary.Get("BaseFont"))) {
+		t.Fatalf("Unexpected font dictionary %s", dictionary.Data())
+	}
+	if dictionary.Get("FirstChar") != 32 || dictionary.Get("LastChar") != 34 ||
+		string(dictionary.Get("Widths").(*godyf.Array).Data()) != "[250 600 500]" {
+		t.Fatalf("Unexpected widths in %s", dictionary.Data())
+	}
+	if descriptor.Get("FontName") != dictionary.Get("BaseFont") || descriptor.Get("Flags") != 4 || descriptor.Get("CapHeight") != 684 {
+		t.Fatalf("Unexpected font descriptor %s", descriptor.Data())
+	}
+	if stream.Extra["Length1"] != len(subset) {
+		t.Fatalf("Unexpected font file length %v for %d bytes", stream.Extra["Length1"], len(subset))
+	}
+	if cmap := decodedStream(t, dictionary.Get("ToUnicode")); !bytes.Contains(cmap, []byte("3 beginbfchar\n<20> <0020>\n<21> <0041>\n<22> <0042>\n")) {
+		t.Fatalf("Unexpected ToUnicode CMap %s", cmap)
+	}
+
+	// The subset only has .notdef, space, A and B, mapped by the symbol cmap
+	if glyphs := binary.BigEndian.Uint16(sfntTable(subset, "maxp")[4:]); glyphs != 4 {
+		t.Fatalf("Unexpected glyph count %d", glyphs)
+	}
+	reread := trueTypeFont(t, subset)
+	if reread.GlyphWidth('!') != 600 || reread.GlyphWidth('"') != 500 || reread.GlyphWidth(' ') != 250 {
+		t.Fatal("Unexpected glyph widths in subset")
+	}
+}
+
+func TestTrueTypeFontComposite(t *testing.T) {
+	embedded := trueTypeFont(t, trueTypeFontData())
+	dictionary, _, _, subset := writeEmbeddedFont(t, embedded, "Å?", pdf.WriteOptions{ObjectStreams: true, XRef: pdf.XRefStream})
+
+	// Missing characters use the .notdef glyph with code 0
+	if dictionary.Get("FirstChar") != 0 || dictionary.Get("LastChar") != 33 {
+		t.Fatalf("Unexpected font dictionary %s", dictionary.Data())
+	}
+	widths := dictionary.Get("Widths").(*godyf.Array).Elements
+	if len(widths) != 34 || widths[0] != 500 || widths[1] != 0 || widths[33] != 600 {
+		t.Fatalf("Unexpected widths %v", widths)
+	}
+
+	// Aring is kept with its components, A and ring, renumbered 1 and 2
+	if glyphs := binary.BigEndian.Uint16(sfntTable(subset, "maxp")[4:]); glyphs != 4 {
+		t.Fatalf("Unexpected glyph count %d", glyphs)
+	}
+	loca, glyf := sfntTable(subset, "loca"), sfntTable(subset, "glyf")
+	aring := glyf[binary.BigEndian.Uint32(loca[12:]):binary.BigEndian.Uint32(loca[16:])]
+	if binary.BigEndian.Uint16(aring[12:]) != 1 || binary.BigEndian.Uint16(aring[20:]) != 2 {
+		t.Fatalf("Unexpected components in %x", aring)
+	}
+}
+
+func TestOpenTypeFont(t *testing.T) {
+	original := openTypeFontData()
+	embedded := trueTypeFont(t, original)
+	if embedded.GlyphWidth('Å') != 600 || embedded.BBox != [4]int{0, -200, 1000, 1000} {
+		t.Fatal("Unexpected font metrics")
+	}
+
+	dictionary, descriptor, stream, subset := writeEmbeddedFont(t, embedded, "A˚", pdf.WriteOptions{})
+	if dictionary.Get("Subtype") != godyf.Name("Type1") || !subsetName.Match(godyf.ToBytes(dictionary.Get("BaseFont"))) {
+		t.Fatalf("Unexpected font dictionary %s", dictionary.Data())
+	}
+	if string(dictionary.Get("Widths").(*godyf.Array).Data()) != "[600 600]" || descriptor.Get("FontFile2") != nil {
+		t.Fatalf("Unexpected font dictionaries %s %s", dictionary.Data(), descriptor.Data())
+	}
+	if stream.Extra["Subtype"] != godyf.Name("Type1C") {
+		t.Fatalf("Unexpected font file dictionary %v", stream.Extra)
+	}
+
+	// The CFF font is renamed, and only keeps 3 glyphs encoded with codes 33 and 34
+	name := string(godyf.ToBytes(dictionary.Get("BaseFont")))[1:]
+	if !bytes.HasPrefix(subset, []byte{1, 0, 4}) || !bytes.Contains(subset, []byte(name)) {
+		t.Fatalf("Unexpected CFF font %x", subset)
+	}
+	if !bytes.Contains(subset, []byte{0, 0, 34, 1, 135, 0, 2, 33, 34}) {
+		t.Fatalf("Missing charset and encoding in %x", subset)
+	}
+}
+
+func TestCompositeTrueTypeFont(t *testing.T) {
+	embedded, err := font.NewCompositeTrueType(trueTypeFontData())
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	if codes := embedded.EncodeText("AB A"); string(codes) != "\x00\x02\x00\x03\x00\x01\x00\x02" {
+		t.Fatalf("Unexpected codes %q", codes)
+	}
+
+	dictionary, descriptor, _, subset := writeEmbeddedFont(t, embedded, "BÅ", pdf.WriteOptions{})
+	if dictionary.Get("Subtype") != godyf.Name("Type0") || dictionary.Get("Encoding") != godyf.Name("Identity-H") ||
+		!subsetName.Match(godyf.ToBytes(dictionary.Get("BaseFont"))) {
+		t.Fatalf("Unexpected font dictionary %s", dictionary.Data())
+	}
+	descendant := openedDocument.Resolve(dictionary.Get("DescendantFonts").(*godyf.Array).Elements[0]).(*godyf.Dictionary)
+	if descendant.Get("Subtype") != godyf.Name("CIDFontType2") || descendant.Get("BaseFont") != dictionary.Get("BaseFont") {
+		t.Fatalf("Unexpected descendant font %s", descendant.Data())
+	}
+	info := openedDocument.Resolve(descendant.Get("CIDSystemInfo")).(*godyf.Dictionary)
+	if info.Get("Ordering").(*godyf.String).String != "Identity" || info.Get("Supplement") != 0 {
+		t.Fatalf("Unexpected system info %s", info.Data())
+	}
+	if widths := openedDocument.Resolve(descendant.Get("W")).(*godyf.Array); string(widths.Data()) != "[0 [500 250 600 500] 5 [600]]" {
+		t.Fatalf("Unexpected widths %s", widths.Data())
+	}
+	if descriptor.Get("FontFile2") == nil {
+		t.Fatalf("Unexpected font descriptor %s", descriptor.Data())
+	}
+
+	// Glyphs are renumbered in the subset, the CIDs being the original IDs,
+	// and the ring is only kept as a component of Aring
+	if glyphs := binary.BigEndian.Uint16(sfntTable(subset, "maxp")[4:]); glyphs != 6 {
+		t.Fatalf("Unexpected glyph count %d", glyphs)
+	}
+	if cidToGID := decodedStream(t, descendant.Get("CIDToGIDMap")); string(cidToGID) != "\x00\x00\x00\x01\x00\x02\x00\x03\x00\x00\x00\x05" {
+		t.Fatalf("Unexpected CID to glyph ID map %x", cidToGID)
+	}
+	if cmap := decodedStream(t, dictionary.Get("ToUnicode")); !bytes.Contains(cmap, []byte("<0000> <ffff>")) ||
+		!bytes.Contains(cmap, []byte("4 beginbfchar\n<0001> <0020>\n<0002> <0041>\n<0003> <0042>\n<0005> <00c5>\n")) {
+		t.Fatalf("Unexpected ToUnicode CMap %s", cmap)
+	}
+
+	// Contents use 2-byte hexadecimal strings
+	page := openedDocument.Resolve(openedDocument.PageReferences()[0]).(*godyf.Dictionary)
+	if contents := decodedStream(t, page.Get("Contents")); !bytes.Contains(contents, []byte("[<00030005>] TJ")) {
+		t.Fatalf("Unexpected contents %s", contents)
+	}
+}
+
+func TestCompositeOpenTypeFont(t *testing.T) {
+	original := openTypeFontData()
+	embedded, err := font.NewCompositeTrueType(original)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	dictionary, descriptor, stream, subset := writeEmbeddedFont(t, embedded, "A˚A", pdf.WriteOptions{})
+	descendant := openedDocument.Resolve(dictionary.Get("DescendantFonts").(*godyf.Array).Elements[0]).(*godyf.Dictionary)
+	if descendant.Get("Subtype") != godyf.Name("CIDFontType0") || descendant.Get("CIDToGIDMap") != nil {
+		t.Fatalf("Unexpected descendant font %s", descendant.Data())
+	}
+	if descriptor.Get("FontFile3") == nil || stream.Extra["Subtype"] != godyf.Name("CIDFontType0C") {
+		t.Fatalf("Unexpected font file %s %v", descriptor.Data(), stream.Extra)
+	}
+
+	// The subset is CID-keyed, with CIDs 2 and 4 in the Adobe-Identity-0
+	// collection and a single Font DICT
+	if !bytes.Contains(subset, []byte("AdobeIdentity")) || !bytes.Contains(subset, []byte{0, 0, 2, 0, 4, 0, 0, 0, 0}) {
+		t.Fatalf("Unexpected CFF font %x", subset)
+	}
+
+	// A font file with the CID-keyed subset can be embedded again, but only
+	// as a composite font
+	tables := make(map[string][]byte)
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "cmap", "name", "OS/2", "post"} {
+		tables[tag] = append([]byte(nil), sfntTable(original, tag)...)
+	}
+	tables["CFF "] = subset
+	binary.BigEndian.PutUint16(tables["maxp"][4:], 3)
+	binary.BigEndian.PutUint16(tables["hhea"][34:], 3)
+	data := sfntFile(0x4F54544F, tables)
+	if _, err := font.NewTrueType(data); err == nil {
+		t.Fatal("Expected an error for a CID-keyed font embedded as a simple font")
+	}
+	reread, err := font.NewCompositeTrueType(data)
+	if err != nil {
+		t.Fatalf("Failed to read CID-keyed font: %v", err)
+	}
+	if _, _, _, again := writeEmbeddedFont(t, reread, "A", pdf.WriteOptions{}); !bytes.Contains(again, []byte{0, 0, 2, 0, 0, 0}) {
+		t.Fatalf("Unexpected CFF font %x", again)
+	}
+}
+
+func TestTrueTypeFontInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("not a font file"), []byte("ttcf\x00\x01\x00\x00\x00\x00\x00\x00")} {
+		if _, err := font.NewTrueType(data); err == nil {
+			t.Fatalf("Expected an error for %q", data)
+		}
+	}
+	truncated := trueTypeFontData()[:200]
+	if _, err := font.NewTrueType(truncated); err == nil {
+		t.Fatal("Expected an error for a truncated font")
+	}
+}
+
+func TestShapeText(t *testing.T) {
+	embedded := trueTypeFont(t, shapingFontData())
+	ids := func(glyphs []font.Glyph) []uint16 {
+		list := make([]uint16, len(glyphs))
+		for i, glyph := range glyphs {
+			list[i] = glyph.ID
+		}
+		return list
+	}
+	for _, test := range []struct {
+		text string
+		ids  []uint16
+	}{
+		{"AB", []uint16{5}},                    // Ligature
+		{"BA", []uint16{3, 2}},                 // No ligature
+		{"ب", []uint16{8}},                     // Isolated beh
+		{"ببب", []uint16{11, 10, 9}},           // Final, medial and initial forms, right-to-left
+		{"با", []uint16{13, 9}},                // Alef joins the previous beh
+		{"اب", []uint16{8, 12}},                // Alef doesn't join the next beh
+		{"A אב B", []uint16{2, 1, 7, 6, 1, 3}}, // Hebrew run in left-to-right text
+		{"א AB ב", []uint16{7, 1, 5, 1, 6}},    // Latin run in right-to-left text
+		{"א(ב)", []uint16{14, 7, 15, 6}},       // Mirrored parentheses
+		{"AB ", []uint16{5, 1}},                // Trailing whitespace
+		{"אב ", []uint16{1, 7, 6}},             // Trailing whitespace in right-to-left text
+		{"Å", []uint16{2, 4}},                 // Mark
+		{"א̊ב", []uint16{7, 4, 6}},             // Mark in right-to-left text
+		{"", []uint16{}},                       // Empty text
+		{"C", []uint16{0}},                     // Missing glyph
+	} {
+		if glyphs := ids(embedded.Shape(test.text)); !equalGlyphIDs(glyphs, test.ids) {
+			t.Errorf("Unexpected glyphs %v for %q, expected %v", glyphs, test.text, test.ids)
+		}
+	}
+
+	// The ligature shows both characters
+	if glyphs := embedded.Shape("AB"); glyphs[0].Text != "AB" || glyphs[0].Advance != 1000 {
+		t.Fatalf("Unexpected ligature %+v", glyphs[0])
+	}
+
+	// B is kerned before A, the ring is attached above A
+	if glyphs := embedded.Shape("BA"); glyphs[0].Advance != 450 || glyphs[1].Advance != 600 {
+		t.Fatalf("Unexpected kerning %+v", glyphs)
+	}
+	if width := embedded.MeasureShapedString(10, "BA"); width != 10.5 {
+		t.Fatalf("Unexpected width %v", width)
+	}
+	mark := embedded.Shape("Å")[1]
+	if mark.Advance != 0 || mark.XOffset != -150 || mark.YOffset != 700 {
+		t.Fatalf("Unexpected mark %+v", mark)
+	}
+	mark = embedded.Shape("B̊A")[1]
+	if mark.Advance != 0 || mark.XOffset != -100 || mark.YOffset != 700 {
+		t.Fatalf("Unexpected mark %+v", mark)
+	}
+}
+
+func equalGlyphIDs(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestShowShapedText(t *testing.T) {
+	for _, composite := range []bool{false, true} {
+		embedded := trueTypeFont(t, shapingFontData())
+		if composite {
+			var err error
+			if embedded, err = font.NewCompositeTrueType(shapingFontData()); err != nil {
+				t.Fatalf("Failed to read font: %v", err)
+			}
+		}
+		stream := godyf.NewStream(nil, nil, false)
+		embedded.ShowShapedText(stream, 10, "AB BA")
+		embedded.ShowShapedText(stream, 10, "Å")
+		expected := []interface{}{"[<212022> 50 <23>] TJ", "[<23>] TJ", "7 Ts", "[150 <24> -150] TJ", "0 Ts"}
+		if composite {
+			expected = []interface{}{"[<000500010003> 50 <0002>] TJ", "[<0002>] TJ", "7 Ts", "[150 <0004> -150] TJ", "0 Ts"}
+		}
+		if len(stream.Stream) != len(expected) {
+			t.Fatalf("Unexpected operators %q", stream.Stream)
+		}
+		for i := range expected {
+			if stream.Stream[i] != expected[i] {
+				t.Fatalf("Unexpected operators %q", stream.Stream)
+			}
+		}
+
+		// The ToUnicode CMap maps the ligature to its characters
+		dictionary, _, _, _ := writeEmbeddedFont(t, embedded, "", pdf.WriteOptions{})
+		mapping := "<21> <00410042>"
+		if composite {
+			mapping = "<0005> <00410042>"
+		}
+		if cmap := decodedStream(t, dictionary.Get("ToUnicode")); !bytes.Contains(cmap, []byte(mapping)) {
+			t.Fatalf("Unexpected ToUnicode CMap %s", cmap)
+		}
+	}
+}
+
+func TestType3Font(t *testing.T) {
+	type3 := font.NewType3(1000)
+	star, err := type3.AddGlyph('★', 800)
+	if err != nil {
+		t.Fatalf("Failed to add glyph: %v", err)
+	}
+	star.SetColorRGB(1, 0.8, 0, false)
+	star.MoveTo(400, 0)
+	star.LineTo(800, 700)
+	star.LineTo(0, 700)
+	star.Fill(false)
+	square, err := type3.AddShapeGlyph('■', 600, [4]float64{50, -10, 550, 500})
+	if err != nil {
+		t.Fatalf("Failed to add glyph: %v", err)
+	}
+	square.Rectangle(50, 0, 500, 500)
+	square.Fill(false)
+	if _, err := type3.AddGlyph(' ', 250); err != nil {
+		t.Fatalf("Failed to add glyph: %v", err)
+	}
+	if _, err := type3.AddGlyph('■', 600); err == nil {
+		t.Fatalf("Glyph added twice")
+	}
+
+	if codes := type3.EncodeText("■ ★x"); string(codes) != "\x22\x20\x21" {
+		t.Fatalf("Unexpected codes %q", codes)
+	}
+	if width := type3.MeasureString(10, "★ ■"); width != 16.5 {
+		t.Fatalf("Unexpected width %v", width)
+	}
+
+	document := pdf.NewPDF()
+	fontRef := document.AddResource(type3)
+	draw := godyf.NewStream(nil, nil, false)
+	draw.BeginText()
+	draw.SetFontSize("F1", 12)
+	draw.ShowText(godyf.EncodedText(type3, "★ ■"))
+	draw.EndText()
+	document.AddObject(draw)
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":      godyf.Name("Page"),
+		"Parent":    document.Pages.Ref(),
+		"Contents":  draw.Ref(),
+		"MediaBox":  godyf.NewArray(0, 0, 200, 50),
+		"Resources": godyf.NewDictionary(map[string]interface{}{"Font": godyf.NewDictionary(map[string]interface{}{"F1": fontRef})}),
+	}))
+	var buf bytes.Buffer
+	if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+
+	openedDocument = openBytes(t, buf.Bytes())
+	dictionary := openedDocument.Resolve(fontRef).(*godyf.Dictionary)
+	for key, value := range map[string]string{
+		"Subtype":    "/Type3",
+		"FontMatrix": "[0.001 0 0 0.001 0 0]",
+		"FontBBox":   "[0 0 0 0]",
+		"FirstChar":  "32",
+		"LastChar":   "34",
+		"Widths":     "[250 800 600]",
+	} {
+		if data := godyf.ToBytes(openedDocument.Resolve(dictionary.Get(key))); string(data) != value {
+			t.Errorf("Unexpected %s %s, expected %s", key, data, value)
+		}
+	}
+	encoding := openedDocument.Resolve(dictionary.Get("Encoding")).(*godyf.Dictionary)
+	if differences := openedDocument.Resolve(encoding.Get("Differences")).(*godyf.Array); string(differences.Data()) != "[32 /uni0020 /uni2605 /uni25A0]" {
+		t.Fatalf("Unexpected differences %s", differences.Data())
+	}
+	charProcs := openedDocument.Resolve(dictionary.Get("CharProcs")).(*godyf.Dictionary)
+	if procedure := decodedStream(t, charProcs.Get("uni2605")); !bytes.HasPrefix(procedure, []byte("800 0 d0\n1 0.8 0 rg\n")) {
+		t.Fatalf("Unexpected glyph procedure %s", procedure)
+	}
+	if procedure := decodedStream(t, charProcs.Get("uni25A0")); !bytes.HasPrefix(procedure, []byte("600 0 50 -10 550 500 d1\n")) {
+		t.Fatalf("Unexpected glyph procedure %s", procedure)
+	}
+	if cmap := decodedStream(t, dictionary.Get("ToUnicode")); !bytes.Contains(cmap, []byte("3 beginbfchar\n<20> <0020>\n<21> <2605>\n<22> <25a0>\n")) {
+		t.Fatalf("Unexpected ToUnicode CMap %s", cmap)
+	}
+
+	// Fonts need glyphs
+	document = pdf.NewPDF()
+	document.AddResource(font.NewType3(1000))
+	if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err == nil {
+		t.Fatalf("Empty Type 3 font written")
+	}
+}
+
+// Glyphs of the fonts built by trueTypeFontData and openTypeFontData: .notdef,
+// space, A, B, ring and Aring, the last one being a composite glyph made
+// of A and ring in trueTypeFont
+var testGlyphRunes = map[rune]uint16{' ': 1, 'A': 2, 'B': 3, '˚': 4, 'Å': 5}
+
+// trueTypeFontData returns a minimal TrueType font named "GodyfTest", with
+// 2048 units per em and glyph widths of 500, 250, 600, 500, 600 and 600
+// thousandths of the font size
+func trueTypeFontData() []byte {
+	ring := box(400, 1500, 800, 1700)
+	aring := be(-1, 100, 0, 1100, 1700)
+	aring = append(aring, be(0x0023, 2, 0, 0)...) // Words, XY values, more components
+	aring = append(aring, be(0x0003, 4, 0, 0)...)
+	glyphs := [][]byte{box(100, 0, 900, 1400), nil, box(100, 0, 1100, 1400), box(100, 0, 900, 1400), ring, aring}
+	return glyfFont(2048, glyphs, be(1024, 100, 512, 0, 1229, 100, 1024, 100, 1229, 400, 100), testGlyphRunes, map[string][]byte{
+		"hhea": hhea(1800, -400, 5),
+		"OS/2": os2(1600, -400, 1400),
+	})
+}
+
+// Glyphs of the font built by shapingFontData
+var shapingGlyphRunes = map[rune]uint16{
+	' ': 1, 'A': 2, 'B': 3, '\u030A': 4, 'א': 6, 'ב': 7, 'ب': 8, 'ا': 12, '(': 14, ')': 15,
+}
+
+// shapingFontData returns a TrueType font with 1000 units per em, and GSUB,
+// GPOS and GDEF tables. Its glyphs are .notdef, space, A, B, the combining
+// ring mark, the A_B ligature, Hebrew alef and bet, the isolated, initial,
+// medial and final forms of Arabic beh, the isolated and final forms of
+// Arabic alef, and parentheses. B is kerned by -50 before A, and the ring
+// is attached 700 units above A and B.
+func shapingFontData() []byte {
+	advances := []int16{500, 250, 600, 500, 0, 1000, 500, 500, 400, 300, 250, 450, 200, 250, 300, 300}
+	glyphs := make([][]byte, len(advances))
+	var hmtx []byte
+	for i, advance := range advances {
+		glyphs[i] = box(0, 0, max(advance, 100), 700)
+		hmtx = append(hmtx, be(advance, 0)...)
+	}
+
+	gsub := layoutTable(
+		[]layoutFeature{{"fina", []int16{3}}, {"init", []int16{1}}, {"liga", []int16{0}}, {"medi", []int16{2}}},
+		[]layoutLookup{
+			{4, append(be(1, 8, 1, 14), append(coverage(2), be(1, 4, 5, 2, 3)...)...)},
+			{1, singleSubstitution([]int16{8}, []int16{9})},
+			{1, singleSubstitution([]int16{8}, []int16{10})},
+			{1, singleSubstitution([]int16{8, 12}, []int16{11, 13})},
+		})
+	markArray := be(1, 0, 6, 1, -150, 0)
+	baseArray := be(2, 6, 12, 1, 300, 700, 1, 250, 700)
+	markBase := append(be(1, 12, 18, 1, 26, 38), append(coverage(4), coverage(2, 3)...)...)
+	markBase = append(markBase, append(markArray, baseArray...)...)
+	gpos := layoutTable(
+		[]layoutFeature{{"kern", []int16{0}}, {"mark", []int16{1}}},
+		[]layoutLookup{
+			{2, append(be(1, 12, 4, 0, 1, 18), append(coverage(3), be(1, 2, -50)...)...)},
+			{4, markBase},
+		})
+
+	return glyfFont(1000, glyphs, hmtx, shapingGlyphRunes, map[string][]byte{
+		"hhea": hhea(800, -200, int16(len(advances))),
+		"OS/2": os2(800, -200, 700),
+		"GSUB": gsub,
+		"GPOS": gpos,
+		"GDEF": be(1, 0, 12, 0, 0, 0, 2, 2, 4, 4, 3, 5, 5, 2),
+	})
+}
+
+// box returns a simple glyph drawing a rectangle
+func box(xMin, yMin, xMax, yMax int16) []byte {
+	glyph := be(1, xMin, yMin, xMax, yMax, 3, 0)
+	glyph = append(glyph, 1, 1, 1, 1) // Four points on the curve
+	glyph = append(glyph, be(xMin, xMax-xMin, 0, xMin-xMax)...)
+	return append(glyph, be(yMin, 0, yMax-yMin, 0)...)
+}
+
+// glyfFont returns a TrueType font named "GodyfTest" made of glyphs, with
+// the given horizontal metrics and characters, and the extra tables
+func glyfFont(unitsPerEm int16, glyphs [][]byte, hmtx []byte, runes map[rune]uint16, extra map[string][]byte) []byte {
+	var glyf, loca []byte
+	for _, glyph := range glyphs {
+		loca = append(loca, be(int16(len(glyf)/2))...)
+		glyf = append(glyf, glyph...)
+	}
+	loca = append(loca, be(int16(len(glyf)/2))...)
+
+	maxp := be(1, 0, int16(len(glyphs)))
+	maxp = append(maxp, make([]byte, 26)...)
+	tables := map[string][]byte{
+		"head": head(unitsPerEm, 0),
+		"maxp": maxp,
+		"hmtx": hmtx,
+		"cmap": testCmap(runes),
+		"name": testName(),
+		"post": post(),
+		"glyf": glyf,
+		"loca": loca,
+	}
+	for tag, table := range extra {
+		tables[tag] = table
+	}
+	return sfntFile(0x00010000, tables)
+}
+
+// layoutFeature is a feature of the tables built by layoutTable
+type layoutFeature struct {
+	tag     string
+	lookups []int16
+}
+
+// layoutLookup is a lookup of the tables built by layoutTable, with a
+// single subtable
+type layoutLookup struct {
+	kind     int16
+	subtable []byte
+}
+
+// layoutTable returns a GSUB or GPOS table whose default script enables
+// all the features
+func layoutTable(features []layoutFeature, lookups []layoutLookup) []byte {
+	langSys := be(0, -1, int16(len(features)))
+	for i := range features {
+		langSys = append(langSys, be(int16(i))...)
+	}
+	scriptList := append(be(1, 'D'<<8|'F', 'L'<<8|'T', 8, 4, 0), langSys...)
+
+	featureList := be(int16(len(features)))
+	var featureTables []byte
+	for _, feature := range features {
+		featureList = append(featureList, feature.tag...)
+		featureList = append(featureList, be(int16(2+6*len(features)+len(featureTables)))...)
+		featureTables = append(featureTables, be(0, int16(len(feature.lookups)))...)
+		featureTables = append(featureTables, be(feature.lookups...)...)
+	}
+	featureList = append(featureList, featureTables...)
+
+	lookupList := be(int16(len(lookups)))
+	var lookupTables []byte
+	for _, lookup := range lookups {
+		lookupList = append(lookupList, be(int16(2+2*len(lookups)+len(lookupTables)))...)
+		lookupTables = append(lookupTables, be(lookup.kind, 0, 1, 8)...)
+		lookupTables = append(lookupTables, lookup.subtable...)
+	}
+	lookupList = append(lookupList, lookupTables...)
+
+	table := be(1, 0, 10, int16(10+len(scriptList)), int16(10+len(scriptList)+len(featureList)))
+	table = append(table, scriptList...)
+	table = append(table, featureList...)
+	return append(table, lookupList...)
+}
+
+// coverage returns a format 1 coverage table of sorted glyphs
+func coverage(glyphs ...int16) []byte {
+	return append(be(1, int16(len(glyphs))), be(glyphs...)...)
+}
+
+// singleSubstitution returns a format 2 single substitution subtable
+func singleSubstitution(glyphs, substitutes []int16) []byte {
+	subtable := be(2, int16(6+2*len(substitutes)), int16(len(substitutes)))
+	subtable = append(subtable, be(substitutes...)...)
+	return append(subtable, coverage(glyphs...)...)
+}
+
+// openTypeFontData returns a minimal OpenType font with CFF outlines named
+// "GodyfTest", with 1000 units per em and glyph widths of 500, 250, 600,
+// 500, 600 and 600 thousandths of the font size
+func openTypeFontData() []byte {
+	// Charstrings starting with the width difference from the nominal width
+	box := func(width, x, y, w, h int) []byte {
+		return charstring(width-500, x, y, rmoveto, w, hlineto, h, vlineto, -w, hlineto, endchar)
+	}
+	charStrings := [][]byte{
+		box(500, 50, 0, 400, 700), charstring(250-500, endchar),
+		box(600, 50, 0, 500, 700), box(500, 50, 0, 400, 700),
+		// The ring calls the local subroutine drawing its box
+		charstring(600-500, 200, 750, rmoveto, -107, callsubr, endchar),
+		box(600, 50, 0, 500, 850),
+	}
+	subroutine := charstring(200, hlineto, 100, vlineto, -200, hlineto, ret)
+
+	// Private DICT with a nominal width of 500 and local subroutines
+	privateDict := append(cffNumber(500), 21)
+	privateDict = append(privateDict, cffNumber(len(privateDict)+2)...)
+	privateDict = append(privateDict, 19)
+
+	stringIndex := cffIndex([][]byte{[]byte("ring"), []byte("Aring")})
+	charset := []byte{0}
+	for _, sid := range []int16{1, 34, 35, 391, 392} {
+		charset = append(charset, be(sid)...)
+	}
+	charStringsIndex := cffIndex(charStrings)
+	subrsIndex := cffIndex([][]byte{subroutine})
+
+	// Top DICT with 5-byte offsets, so that its length is known
+	top := func(charsetOffset, charStringsOffset, privateOffset int) []byte {
+		dict := append(cffInt32(charsetOffset), 15)
+		dict = append(dict, cffInt32(charStringsOffset)...)
+		dict = append(dict, 17)
+		dict = append(dict, cffInt32(len(privateDict))...)
+		dict = append(dict, cffInt32(privateOffset)...)
+		return append(dict, 18)
+	}
+	header := []byte{1, 0, 4, 1}
+	nameIndex := cffIndex([][]byte{[]byte("GodyfTest")})
+	start := len(header) + len(nameIndex) + len(cffIndex([][]byte{top(0, 0, 0)})) + len(stringIndex) + 2
+	topIndex := cffIndex([][]byte{top(start, start+len(charset), start+len(charset)+len(charStringsIndex))})
+	var cff []byte
+	for _, part := range [][]byte{header, nameIndex, topIndex, stringIndex, {0, 0}, charset, charStringsIndex, privateDict, subrsIndex} {
+		cff = append(cff, part...)
+	}
+
+	return sfntFile(0x4F54544F, map[string][]byte{
+		"head": head(1000, 0),
+		"hhea": hhea(800, -200, 6),
+		"maxp": be(0, 0x5000, 6),
+		"hmtx": be(500, 50, 250, 0, 600, 50, 500, 50, 600, 200, 600, 50),
+		"cmap": testCmap(testGlyphRunes),
+		"name": testName(),
+		"OS/2": os2(800, -200, 700),
+		"post": post(),
+		"CFF ": cff,
+	})
+}
+
+// be returns values as big-endian 16-bit integers
+func be(values ...int16) []byte {
+	data := make([]byte, 2*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint16(data[2*i:], uint16(value))
+	}
+	return data
+}
+
+// sfntFile returns a font file made of tables, without checksums
+func sfntFile(version uint32, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	data := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(data, version)
+	binary.BigEndian.PutUint16(data[4:], uint16(len(tags)))
+	for i, tag := range tags {
+		record := data[12+16*i:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[8:], uint32(len(data)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(tables[tag])))
+		data = append(data, tables[tag]...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return data
+}
+
+// head returns a head table
+func head(unitsPerEm, macStyle int16) []byte {
+	table := be(1, 0, 1, 0, 0, 0, 0x5F0F, 0x3CF5, 0, unitsPerEm)
+	table = append(table, make([]byte, 16)...) // Dates
+	return append(table, be(0, -unitsPerEm/5, unitsPerEm, unitsPerEm, macStyle, 8, 2, 0, 0)...)
+}
+
+// hhea returns an hhea table
+func hhea(ascent, descent, metrics int16) []byte {
+	table := be(1, 0, ascent, descent, 0)
+	table = append(table, make([]byte, 24)...)
+	return append(table, be(metrics)...)
+}
+
+// os2 returns a version 4 OS/2 table
+func os2(ascent, descent, capHeight int16) []byte {
+	table := make([]byte, 96)
+	binary.BigEndian.PutUint16(table, 4)
+	binary.BigEndian.PutUint16(table[4:], 700) // Bold
+	binary.BigEndian.PutUint16(table[68:], uint16(ascent))
+	binary.BigEndian.PutUint16(table[70:], uint16(descent))
+	binary.BigEndian.PutUint16(table[88:], uint16(capHeight))
+	return table
+}
+
+// post returns a version 3 post table
+func post() []byte {
+	return append(be(3, 0), make([]byte, 28)...)
+}
+
+// testCmap returns a cmap table with a Unicode format 4 subtable mapping
+// characters to glyphs
+func testCmap(glyphs map[rune]uint16) []byte {
+	runes := make([]int, 0, len(glyphs))
+	for r := range glyphs {
+		runes = append(runes, int(r))
+	}
+	sort.Ints(runes)
+	runes = append(runes, 0xFFFF)
+	segments := int16(len(runes))
+	subtable := be(4, 16+8*segments, 0, 2*segments, 0, 0, 0)
+	for _, r := range runes {
+		subtable = append(subtable, be(int16(r))...)
+	}
+	subtable = append(subtable, 0, 0)
+	for _, r := range runes {
+		subtable = append(subtable, be(int16(r))...)
+	}
+	for _, r := range runes {
+		delta := int16(1)
+		if r != 0xFFFF {
+			delta = int16(glyphs[rune(r)]) - int16(r)
+		}
+		subtable = append(subtable, be(delta)...)
+	}
+	subtable = append(subtable, make([]byte, 2*len(runes))...)
+	return append(be(0, 1, 3, 1, 0, 12), subtable...)
+}
+
+// testName returns a name table with the PostScript name "GodyfTest"
+func testName() []byte {
+	name := be('G', 'o', 'd', 'y', 'f', 'T', 'e', 's', 't')
+	return append(be(0, 1, 18, 3, 1, 0x409, 6, int16(len(name)), 0), name...)
+}
+
+// cffIndex returns a CFF INDEX with 2-byte offsets
+func cffIndex(items [][]byte) []byte {
+	index := be(int16(len(items)))
+	index = append(index, 2)
+	offset := 1
+	index = append(index, be(int16(offset))...)
+	for _, item := range items {
+		offset += len(item)
+		index = append(index, be(int16(offset))...)
+	}
+	for _, item := range items {
+		index = append(index, item...)
+	}
+	return index
+}
+
+// cffInt32 returns a 5-byte CFF DICT integer
+func cffInt32(value int) []byte {
+	operand := []byte{29, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(operand[1:], uint32(value))
+	return operand
+}
+
+// cffNumber returns a short CFF DICT or charstring integer
+func cffNumber(value int) []byte {
+	switch {
+	case value >= -107 && value <= 107:
+		return []byte{byte(value + 139)}
+	case value >= 108 && value <= 1131:
+		return []byte{byte((value-108)/256 + 247), byte((value - 108) % 256)}
+	case value >= -1131 && value <= -108:
+		return []byte{byte((-value-108)/256 + 251), byte((-value - 108) % 256)}
+	}
+	return []byte{28, byte(value >> 8), byte(value)}
+}
+
+// charstringOperator is an operator of a Type 2 charstring
+type charstringOperator byte
+
+// Charstring operators used by the glyphs of openTypeFontData
+const (
+	hlineto  charstringOperator = 6
+	vlineto  charstringOperator = 7
+	callsubr charstringOperator = 10
+	ret      charstringOperator = 11
+	endchar  charstringOperator = 14
+	rmoveto  charstringOperator = 21
+)
+
+// charstring returns a Type 2 charstring made of int numbers and operators
+func charstring(values ...interface{}) []byte {
+	var data []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case int:
+			data = append(data, cffNumber(v)...)
+		case charstringOperator:
+			data = append(data, byte(v))
+		}
+	}
+	return data
+}
@@ -2,6 +2,9 @@ package godyf_tests
 
 import (
 	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
 	"regexp"
 	"testing"
 
@@ -817,3 +820,605 @@ func TestVersion(t *testing.T) {
 		t.Fatal("Expected PDF version 1.7 not found in PDF")
 	}
 }
+
+func TestDictionaryKeyOrder(t *testing.T) {
+	dictionary := godyf.NewDictionary(map[string]interface{}{
+		"MediaBox": godyf.NewArray(0, 0, 10, 10),
+		"Parent":   "1 0 R",
+		"Subtype":  "/Form",
+		"Type":     "/XObject",
+	})
+	dictionary.Set("Resources", "3 0 R")
+	dictionary.Set("BBox", godyf.NewArray(0, 0, 1, 1))
+
+	expected := "<< /Type /XObject /Subtype /Form /Resources 3 0 R /BBox [0 0 1 1]" +
+		" /MediaBox [0 0 10 10] /Parent 1 0 R >>"
+	if string(dictionary.Data()) != expected {
+		t.Fatalf("Unexpected dictionary data: %s", dictionary.Data())
+	}
+
+	dictionary.Delete("Resources")
+	dictionary.Set("Resources", "4 0 R")
+	if keys := dictionary.Keys(); keys[3] != "Resources" {
+		t.Fatalf("Expected re-added key to move to the end of inserted keys, got %v", keys)
+	}
+}
+
+func TestDeterministicWrite(t *testing.T) {
+	build := func(compress bool) []byte {
+		document := pdf.NewPDF()
+		document.Info.Values["Title"] = godyf.NewString("Deterministic")
+		document.Info.Values["Author"] = godyf.NewString("godyf")
+		draw := godyf.NewStream(nil, map[string]interface{}{"A": 1, "B": 2, "C": 3}, compress)
+		draw.Rectangle(2, 2, 5, 6)
+		draw.Fill(false)
+		document.AddObject(draw)
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":     "/Page",
+			"Parent":   string(document.Pages.Reference()),
+			"Contents": string(draw.Reference()),
+			"MediaBox": godyf.NewArray(0, 0, 10, 10),
+		}))
+		var buf bytes.Buffer
+		if err := document.Write(&buf, nil, true, compress); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, compress := range []bool{false, true} {
+		first := build(compress)
+		for i := 0; i < 10; i++ {
+			if !bytes.Equal(first, build(compress)) {
+				t.Fatalf("Two writes of the same document differ (compress=%v)", compress)
+			}
+		}
+	}
+
+	// Writing a document again gives the same output, generated object
+	// streams and cross-reference streams being removed
+	document := buildLargeDocument(3)
+	count := len(document.Objects)
+	for _, xref := range []pdf.XRefStyle{pdf.XRefTable, pdf.XRefStream, pdf.XRefHybrid} {
+		options := pdf.WriteOptions{ObjectStreams: xref != pdf.XRefTable, XRef: xref, Deterministic: true}
+		var first, second bytes.Buffer
+		if err := document.WriteWithOptions(&first, options); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		if err := document.WriteWithOptions(&second, options); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Fatalf("Two writes of the same document differ (xref=%v)", xref)
+		}
+		if len(document.Objects) != count {
+			t.Fatalf("Unexpected %d objects after writing %d (xref=%v)", len(document.Objects), count, xref)
+		}
+		openBytes(t, second.Bytes())
+	}
+}
+
+func TestNameEscaping(t *testing.T) {
+	tests := map[godyf.Name]string{
+		"Type":          "/Type",
+		"Lime Green":    "/Lime#20Green",
+		"paired()":      "/paired#28#29",
+		"The_Key#1":     "/The_Key#231",
+		"A/B%C":         "/A#2FB#25C",
+		"Caf\xc3\xa9":   "/Caf#C3#A9",
+		"<tag>[x]{y}":   "/#3Ctag#3E#5Bx#5D#7By#7D",
+		"Adobe-Type1.0": "/Adobe-Type1.0",
+	}
+	for name, expected := range tests {
+		if string(godyf.ToBytes(name)) != expected {
+			t.Errorf("Name %q: expected %s, got %s", string(name), expected, godyf.ToBytes(name))
+		}
+	}
+}
+
+func TestPrimitiveTypes(t *testing.T) {
+	array := godyf.NewArray(godyf.Bool(true), false, godyf.Null{}, nil, godyf.Ref{Number: 12, Generation: 3})
+	if string(array.Data()) != "[true false null null 12 3 R]" {
+		t.Fatalf("Unexpected array data: %s", array.Data())
+	}
+}
+
+func TestPageReferences(t *testing.T) {
+	document := pdf.NewPDF()
+	for i := 0; i < 2; i++ {
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":     godyf.Name("Page"),
+			"Parent":   document.Pages.Ref(),
+			"MediaBox": godyf.NewArray(0, 0, 10, 10),
+		}))
+	}
+
+	references := document.PageReferences()
+	if len(references) != 2 || references[0] != (godyf.Ref{Number: 4}) || references[1] != (godyf.Ref{Number: 5}) {
+		t.Fatalf("Unexpected page references: %v", references)
+	}
+
+	kids := document.Pages.Values["Kids"].(*godyf.Array)
+	if string(kids.Data()) != "[4 0 R 5 0 R]" {
+		t.Fatalf("Unexpected Kids array: %s", kids.Data())
+	}
+}
+
+func TestASCII85(t *testing.T) {
+	tests := map[string]string{
+		"":                   "~>",
+		"Man ":               "9jqo^~>",
+		"Man":                "9jqo~>",
+		"\x00\x00\x00\x00":   "z~>",
+		"\x00\x00\x00\x00ab": "z@:B~>",
+	}
+	for input, expected := range tests {
+		encoded := godyf.ASCII85Encode([]byte(input))
+		if string(encoded) != expected {
+			t.Errorf("ASCII85Encode(%q): expected %q, got %q", input, expected, encoded)
+		}
+		decoded, err := godyf.ASCII85Decode(encoded)
+		if err != nil {
+			t.Fatalf("ASCII85Decode(%q): %v", encoded, err)
+		}
+		if string(decoded) != input {
+			t.Errorf("ASCII85Decode(%q): expected %q, got %q", encoded, input, decoded)
+		}
+	}
+
+	decoded, err := godyf.ASCII85Decode([]byte("<~9jqo\n^BlbD-\r\nBleB1DJ+*+F(f,q~>garbage"))
+	if err != nil {
+		t.Fatalf("ASCII85Decode: %v", err)
+	}
+	if string(decoded) != "Man is distinguished" {
+		t.Fatalf("Unexpected ASCII85 decoded data: %q", decoded)
+	}
+}
+
+func TestASCIIHex(t *testing.T) {
+	encoded := godyf.ASCIIHexEncode([]byte("\x00\xffgodyf"))
+	if string(encoded) != "00ff676f647966>" {
+		t.Fatalf("Unexpected ASCIIHex encoded data: %s", encoded)
+	}
+
+	decoded, err := godyf.ASCIIHexDecode([]byte("00 FF\n67 6f 64 79 66 7>"))
+	if err != nil {
+		t.Fatalf("ASCIIHexDecode: %v", err)
+	}
+	if string(decoded) != "\x00\xffgodyfp" {
+		t.Fatalf("Unexpected ASCIIHex decoded data: %q", decoded)
+	}
+
+	if _, err := godyf.ASCIIHexDecode([]byte("0g>")); err == nil {
+		t.Fatal("Expected an error for invalid hex digits")
+	}
+}
+
+func TestStreamASCII85(t *testing.T) {
+	draw := godyf.NewStream(nil, nil, true)
+	draw.ASCII85 = true
+	draw.Rectangle(2, 2, 5, 6)
+	draw.Fill(false)
+	data := draw.Data()
+
+	if !bytes.Contains(data, []byte("/Filter [/ASCII85Decode /FlateDecode]")) {
+		t.Fatalf("Expected ASCII85 and Flate filters in stream dictionary: %s", data)
+	}
+	for _, c := range data {
+		if c > 127 {
+			t.Fatalf("Expected 7-bit clean stream data, found byte %#x", c)
+		}
+	}
+
+	start := bytes.Index(data, []byte("stream\n")) + len("stream\n")
+	end := bytes.LastIndex(data, []byte("\nendstream"))
+	compressed, err := godyf.ASCII85Decode(data[start:end])
+	if err != nil {
+		t.Fatalf("ASCII85Decode: %v", err)
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Failed to open zlib stream: %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != "2 2 5 6 re\nf" {
+		t.Fatalf("Unexpected decoded stream content: %q", decoded)
+	}
+}
+
+func TestInlineImageASCII85(t *testing.T) {
+	draw := godyf.NewStream(nil, nil, false)
+	draw.InlineImage(2, 1, "RGB", 8, []byte{255, 0, 0, 0, 0, 255})
+	data := string(draw.Data())
+
+	re := regexp.MustCompile(`/F /A85 /L \d+ ID (\S+) EI`)
+	matches := re.FindStringSubmatch(data)
+	if matches == nil {
+		t.Fatalf("Unexpected inline image: %s", data)
+	}
+	decoded, err := godyf.ASCII85Decode([]byte(matches[1]))
+	if err != nil {
+		t.Fatalf("ASCII85Decode: %v", err)
+	}
+	if !bytes.Equal(decoded, []byte{255, 0, 0, 0, 0, 255}) {
+		t.Fatalf("Unexpected inline image data: %v", decoded)
+	}
+}
+
+func TestLZWSpecificationExample(t *testing.T) {
+	filter := &godyf.LZWFilter{}
+	encoded := filter.Encode([]byte("-----A---B"))
+	expected := []byte{0x80, 0x0B, 0x60, 0x50, 0x22, 0x0C, 0x0C, 0x85, 0x01}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("Unexpected LZW data: % X", encoded)
+	}
+}
+
+func TestFilterRoundTrip(t *testing.T) {
+	// Mix repetitive and pseudo-random data, large enough to fill LZW tables
+	var data []byte
+	seed := uint32(1)
+	for i := 0; i < 38400; i++ {
+		seed = seed*1103515245 + 12345
+		if i%3000 < 1500 {
+			data = append(data, byte(i/7))
+		} else {
+			data = append(data, byte(seed>>16))
+		}
+	}
+
+	filters := []godyf.Filter{
+		&godyf.FlateFilter{},
+		&godyf.FlateFilter{Level: 9},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 2, Colors: 3, Columns: 100}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 2, BitsPerComponent: 1, Columns: 77}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 2, BitsPerComponent: 16, Colors: 2, Columns: 10}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 10, Colors: 3, Columns: 100}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 11, Colors: 4, Columns: 10}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 12, Columns: 64}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 13, Colors: 3, Columns: 100}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 14, BitsPerComponent: 4, Columns: 80}},
+		&godyf.FlateFilter{PredictorParams: godyf.PredictorParams{Predictor: 15, Colors: 3, Columns: 100}},
+		&godyf.LZWFilter{},
+		&godyf.LZWFilter{NoEarlyChange: true},
+		&godyf.LZWFilter{PredictorParams: godyf.PredictorParams{Predictor: 12, Columns: 40}},
+		godyf.RunLengthFilter{},
+		godyf.ASCIIHexFilter{},
+		godyf.ASCII85Filter{},
+		&godyf.PassthroughFilter{FilterName: "DCTDecode"},
+	}
+
+	for _, filter := range filters {
+		inputs := [][]byte{data, data[:1], {}}
+		if filter.Params() != nil {
+			// Predictors work on whole rows, data is a multiple of every row length
+			inputs = inputs[:1]
+		}
+		for _, input := range inputs {
+			decoded, err := filter.Decode(filter.Encode(input))
+			if err != nil {
+				t.Fatalf("%s %v: %v", filter.Name(), filter.Params(), err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Fatalf("%s %v: round trip of %d bytes gave %d different bytes",
+					filter.Name(), filter.Params(), len(input), len(decoded))
+			}
+		}
+	}
+}
+
+func TestStreamFilters(t *testing.T) {
+	draw := godyf.NewStream(nil, nil, true)
+	draw.Rectangle(2, 2, 5, 6)
+	if !bytes.HasPrefix(draw.Data(), []byte("<< /Filter /FlateDecode /Length")) {
+		t.Fatalf("Expected Compress to use the Flate filter: %s", draw.Data())
+	}
+
+	draw = godyf.NewStream(nil, nil, false)
+	draw.Filters = []godyf.Filter{
+		godyf.ASCIIHexFilter{},
+		&godyf.FlateFilter{Level: 9, PredictorParams: godyf.PredictorParams{Predictor: 12, Columns: 5}},
+	}
+	draw.Rectangle(2, 2, 5, 6)
+	data := draw.Data()
+	expected := "<< /DecodeParms [null << /Predictor 12 /Colors 1 /BitsPerComponent 8 /Columns 5 >>]" +
+		" /Filter [/ASCIIHexDecode /FlateDecode] /Length"
+	if !bytes.HasPrefix(data, []byte(expected)) {
+		t.Fatalf("Unexpected stream dictionary: %s", data)
+	}
+
+	start := bytes.Index(data, []byte("stream\n")) + len("stream\n")
+	end := bytes.LastIndex(data, []byte("\nendstream"))
+	decoded := data[start:end]
+	for _, filter := range draw.Filters {
+		var err error
+		if decoded, err = filter.Decode(decoded); err != nil {
+			t.Fatalf("%s: %v", filter.Name(), err)
+		}
+	}
+	if string(decoded) != "2 2 5 6 re" {
+		t.Fatalf("Unexpected decoded stream content: %q", decoded)
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	params := godyf.NewDictionary(map[string]interface{}{"Predictor": 12, "Columns": 5, "EarlyChange": 0})
+	filter, err := godyf.NewFilter("LZW", params)
+	if err != nil {
+		t.Fatalf("NewFilter: %v", err)
+	}
+	lzw, ok := filter.(*godyf.LZWFilter)
+	if !ok || lzw.Predictor != 12 || lzw.Columns != 5 || !lzw.NoEarlyChange {
+		t.Fatalf("Unexpected filter: %#v", filter)
+	}
+
+	if _, err := godyf.NewFilter("Unknown", nil); err == nil {
+		t.Fatal("Expected an error for an unknown filter")
+	}
+}
+
+func TestInvalidPredictor(t *testing.T) {
+	compressed := (&godyf.FlateFilter{}).Encode(make([]byte, 64))
+	for _, params := range []map[string]interface{}{
+		{"Predictor": 12, "Columns": 1152921504606846976},
+		{"Predictor": 12, "Columns": 100000000000},
+		{"Predictor": 2, "Columns": 100000000000},
+		{"Predictor": 12, "Columns": 66},
+		{"Predictor": 12, "Columns": -1},
+		{"Predictor": 12, "Colors": -3},
+		{"Predictor": 12, "Colors": 1000},
+		{"Predictor": 2, "BitsPerComponent": 3},
+		{"Predictor": 2, "BitsPerComponent": 1 << 62},
+	} {
+		filter, err := godyf.NewFilter("FlateDecode", godyf.NewDictionary(params))
+		if err != nil {
+			t.Fatalf("NewFilter: %v", err)
+		}
+		if _, err := filter.Decode(compressed); err == nil {
+			t.Fatalf("Expected an error for %v", params)
+		}
+	}
+
+	// Encoding parameters are set by callers, invalid ones panic
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for rows longer than data")
+		}
+	}()
+	(&godyf.LZWFilter{PredictorParams: godyf.PredictorParams{Predictor: 2, Columns: 1 << 40}}).Encode([]byte("data"))
+}
+
+// buildLargeDocument returns a document with many pages whose content
+// streams are compressed
+func buildLargeDocument(pages int) *pdf.PDF {
+	document := pdf.NewPDF()
+	for i := 0; i < pages; i++ {
+		draw := godyf.NewStream(nil, nil, true)
+		for j := 0; j < 200; j++ {
+			draw.Rectangle(float64(i), float64(j), float64(i*j%17), 6)
+			draw.SetColorRGB(float64(j%3)/2, float64(i%5)/4, 0.5, false)
+			draw.Fill(false)
+		}
+		document.AddObject(draw)
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":     godyf.Name("Page"),
+			"Parent":   document.Pages.Ref(),
+			"Contents": draw.Ref(),
+			"MediaBox": godyf.NewArray(0, 0, 200, 200),
+		}))
+	}
+	return document
+}
+
+func TestParallelWrite(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var outputs [][]byte
+		for _, parallelism := range []int{1, 0, 3, 64} {
+			var buf bytes.Buffer
+			options := pdf.WriteOptions{Identifier: pdf.IdentifierContentHash, Parallelism: parallelism}
+			if compress {
+				options.ObjectStreams = true
+				options.XRef = pdf.XRefStream
+			}
+			err := buildLargeDocument(30).WriteWithOptions(&buf, options)
+			if err != nil {
+				t.Fatalf("Failed to write PDF: %v", err)
+			}
+			outputs = append(outputs, buf.Bytes())
+		}
+		for _, output := range outputs[1:] {
+			if !bytes.Equal(outputs[0], output) {
+				t.Fatalf("Serial and parallel writes differ (compress=%v)", compress)
+			}
+		}
+		document := openBytes(t, outputs[0])
+		if len(document.PageReferences()) != 30 {
+			t.Fatalf("Unexpected page count %d", len(document.PageReferences()))
+		}
+	}
+}
+
+func benchmarkWrite(b *testing.B, parallelism int) {
+	document := buildLargeDocument(500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := document.WriteWithOptions(io.Discard, pdf.WriteOptions{Parallelism: parallelism}); err != nil {
+			b.Fatalf("Failed to write PDF: %v", err)
+		}
+	}
+}
+
+func BenchmarkWriteSerial(b *testing.B) {
+	benchmarkWrite(b, 1)
+}
+
+func BenchmarkWriteParallel(b *testing.B) {
+	benchmarkWrite(b, 0)
+}
+
+func TestWriteOptionsValidation(t *testing.T) {
+	for _, options := range []pdf.WriteOptions{
+		{Version: []byte("1.x")},
+		{Version: []byte("1.4"), XRef: pdf.XRefStream},
+		{ObjectStreams: true},
+		{XRef: pdf.XRefHybrid},
+		{XRef: pdf.XRefStyle(42)},
+		{Identifier: pdf.IdentifierFixed},
+		{Identifier: pdf.IdentifierContentHash, FixedIdentifier: []byte("abc")},
+		{Identifier: pdf.IdentifierRandom, Deterministic: true},
+		{Identifier: pdf.IdentifierPolicy(42)},
+		{CompressionLevel: 10},
+		{MaxObjectsPerStream: 10},
+		{MaxObjectsPerStream: -1, ObjectStreams: true, XRef: pdf.XRefStream},
+	} {
+		var buf bytes.Buffer
+		if err := pdf.NewPDF().WriteWithOptions(&buf, options); err == nil {
+			t.Fatalf("Expected an error for options %+v", options)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("Unexpected output for invalid options %+v", options)
+		}
+	}
+}
+
+func TestWriteOptionsIdentifier(t *testing.T) {
+	write := func(options pdf.WriteOptions) []byte {
+		var buf bytes.Buffer
+		if err := buildLargeDocument(1).WriteWithOptions(&buf, options); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		return buf.Bytes()
+	}
+	id := regexp.MustCompile(`/ID \[\((\w+)\) \(([0-9a-f]{32})\)\]`)
+
+	if id.Match(write(pdf.WriteOptions{})) {
+		t.Fatal("Unexpected /ID with IdentifierNone")
+	}
+	hash := id.FindSubmatch(write(pdf.WriteOptions{Identifier: pdf.IdentifierContentHash}))
+	if hash == nil || !bytes.Equal(hash[1], hash[2]) {
+		t.Fatalf("Unexpected content hash /ID %q", hash)
+	}
+	fixed := id.FindSubmatch(write(pdf.WriteOptions{Identifier: pdf.IdentifierFixed, FixedIdentifier: []byte("abc")}))
+	if fixed == nil || string(fixed[1]) != "abc" || !bytes.Equal(fixed[2], hash[2]) {
+		t.Fatalf("Unexpected fixed /ID %q", fixed)
+	}
+	first := id.FindSubmatch(write(pdf.WriteOptions{Identifier: pdf.IdentifierRandom}))
+	second := id.FindSubmatch(write(pdf.WriteOptions{Identifier: pdf.IdentifierRandom}))
+	if first == nil || second == nil || len(first[1]) != 32 || bytes.Equal(first[1], second[1]) {
+		t.Fatalf("Unexpected random /IDs %q and %q", first, second)
+	}
+}
+
+func TestWriteOptionsXRef(t *testing.T) {
+	for _, options := range []pdf.WriteOptions{
+		{XRef: pdf.XRefStream},
+		{XRef: pdf.XRefStream, ObjectStreams: true, MaxObjectsPerStream: 4},
+		{XRef: pdf.XRefStream, ObjectStreams: true, CompressionLevel: zlib.BestCompression},
+		{Version: []byte("1.4"), CompressionLevel: zlib.BestSpeed},
+	} {
+		var buf bytes.Buffer
+		if err := buildLargeDocument(10).WriteWithOptions(&buf, options); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		output := buf.Bytes()
+		if got := bytes.Contains(output, []byte("\nxref\n")); got != (options.XRef == pdf.XRefTable) {
+			t.Fatalf("Unexpected cross-reference table for options %+v", options)
+		}
+		objectStreams := bytes.Count(output, []byte("/Type /ObjStm"))
+		switch {
+		case options.MaxObjectsPerStream > 0 && objectStreams != 4: // 3 dictionaries and 10 pages
+			t.Fatalf("Unexpected number of object streams %d", objectStreams)
+		case !options.ObjectStreams && objectStreams != 0:
+			t.Fatalf("Unexpected object streams for options %+v", options)
+		}
+		document := openBytes(t, output)
+		if len(document.PageReferences()) != 10 {
+			t.Fatalf("Unexpected page count %d", len(document.PageReferences()))
+		}
+	}
+}
+
+func TestICCBased(t *testing.T) {
+	// iccHeader returns a profile made of a header of the given class and
+	// color space
+	iccHeader := func(class, space string) []byte {
+		profile := make([]byte, 128)
+		profile[3] = 128
+		copy(profile[12:], class+space)
+		copy(profile[36:], "acsp")
+		return profile
+	}
+	for _, test := range []struct {
+		profile    []byte
+		components int
+		alternate  godyf.Name
+	}{
+		{iccHeader("scnr", "GRAY"), 1, "DeviceGray"},
+		{iccHeader("mntr", "RGB "), 3, "DeviceRGB"},
+		{iccHeader("prtr", "CMYK"), 4, "DeviceCMYK"},
+		{godyf.SRGBProfile(), 3, "DeviceRGB"},
+	} {
+		icc, err := godyf.NewICCBased(test.profile)
+		if err != nil {
+			t.Fatalf("Failed to read profile %q: %v", test.profile[12:20], err)
+		}
+		if icc.Components != test.components || icc.Stream.Extra["N"] != test.components || icc.Stream.Extra["Alternate"] != test.alternate {
+			t.Errorf("Unexpected color space %v for profile %q", icc.Stream.Extra, test.profile[12:20])
+		}
+	}
+	for _, invalid := range [][]byte{nil, iccHeader("mntr", "RGB ")[:100], iccHeader("link", "RGB "), iccHeader("mntr", "Lab "), append(iccHeader("mntr", "RGB "), 0)} {
+		if _, err := godyf.NewICCBased(invalid); err == nil {
+			t.Errorf("Invalid profile %q read", invalid)
+		}
+	}
+
+	// sRGB colors and output intents
+	document := pdf.NewPDF()
+	srgb := godyf.NewSRGB()
+	document.AddObject(srgb.Stream)
+	draw := godyf.NewStream(nil, nil, false)
+	if err := srgb.SetColor(draw, "CS0", false, 1, 0.5, 0); err != nil {
+		t.Fatalf("Failed to set color: %v", err)
+	}
+	if err := srgb.SetColor(draw, "CS0", true, 1); err == nil {
+		t.Fatalf("Color of 1 component set for sRGB")
+	}
+	draw.Rectangle(0, 0, 10, 10)
+	draw.Fill(false)
+	document.AddObject(draw)
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":      godyf.Name("Page"),
+		"Parent":    document.Pages.Ref(),
+		"Contents":  draw.Ref(),
+		"MediaBox":  godyf.NewArray(0, 0, 10, 10),
+		"Resources": godyf.NewDictionary(map[string]interface{}{"ColorSpace": godyf.NewDictionary(map[string]interface{}{"CS0": srgb.ColorSpace()})}),
+	}))
+	document.AddOutputIntent("GTS_PDFA1", "sRGB IEC61966-2.1", "sRGB", srgb)
+	document.AddOutputIntent("GTS_PDFX", "FOGRA39", "", nil)
+	var buf bytes.Buffer
+	if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+
+	openedDocument = openBytes(t, buf.Bytes())
+	page := openedDocument.Resolve(openedDocument.PageReferences()[0]).(*godyf.Dictionary)
+	if contents := string(decodedStream(t, page.Values["Contents"])); contents != "/CS0 cs\n1 0.5 0 scn\n0 0 10 10 re\nf" {
+		t.Errorf("Unexpected contents %q", contents)
+	}
+	colorSpaces := page.Values["Resources"].(*godyf.Dictionary).Values["ColorSpace"].(*godyf.Dictionary)
+	colorSpace := colorSpaces.Values["CS0"].(*godyf.Array)
+	if colorSpace.Get(0) != godyf.Name("ICCBased") || !bytes.Equal(decodedStream(t, colorSpace.Get(1)), godyf.SRGBProfile()) {
+		t.Errorf("Unexpected color space %s", godyf.ToBytes(colorSpace))
+	}
+	intents := openedDocument.Resolve(openedDocument.Catalog.Get("OutputIntents")).(*godyf.Array)
+	if intents.Len() != 2 {
+		t.Fatalf("Unexpected output intents %s", godyf.ToBytes(intents))
+	}
+	intent := openedDocument.Resolve(intents.Get(0)).(*godyf.Dictionary)
+	if data := string(intent.Data()); data != fmt.Sprintf("<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB) /DestOutputProfile %d 0 R >>", colorSpace.Get(1).(godyf.Ref).Number) {
+		t.Errorf("Unexpected output intent %s", data)
+	}
+	if data := string(openedDocument.Resolve(intents.Get(1)).(*godyf.Dictionary).Data()); data != "<< /Type /OutputIntent /S /GTS_PDFX /OutputConditionIdentifier (FOGRA39) >>" {
+		t.Errorf("Unexpected output intent %s", data)
+	}
+}
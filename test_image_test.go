@@ -0,0 +1,928 @@
+package godyf_tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/images"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+// writeImage writes a document drawing img and returns its image XObject
+// and soft mask once read again, with their decoded samples
+func writeImage(t *testing.T, img *images.Image) (*godyf.Stream, []byte, *godyf.Stream, []byte) {
+	t.Helper()
+	document := pdf.NewPDF()
+	imageRef := document.AddResource(img)
+	draw := godyf.NewStream(nil, nil, false)
+	draw.PushState()
+	draw.SetMatrix(float64(img.Width), 0, 0, float64(img.Height), 0, 0)
+	draw.DrawXObject("Im1")
+	draw.PopState()
+	document.AddObject(draw)
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{
+		"Type":      godyf.Name("Page"),
+		"Parent":    document.Pages.Ref(),
+		"Contents":  draw.Ref(),
+		"MediaBox":  godyf.NewArray(0, 0, 200, 200),
+		"Resources": godyf.NewDictionary(map[string]interface{}{"XObject": godyf.NewDictionary(map[string]interface{}{"Im1": imageRef})}),
+	}))
+	var buf bytes.Buffer
+	if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+
+	openedDocument = openBytes(t, buf.Bytes())
+	stream := openedDocument.Resolve(imageRef).(*godyf.Stream)
+	samples := decodedStream(t, imageRef)
+	if stream.Extra["Type"] != godyf.Name("XObject") || stream.Extra["Subtype"] != godyf.Name("Image") ||
+		stream.Extra["Width"] != img.Width || stream.Extra["Height"] != img.Height {
+		t.Fatalf("Unexpected image dictionary %v", stream.Extra)
+	}
+	if stream.Extra["SMask"] == nil {
+		return stream, samples, nil, nil
+	}
+	return stream, samples, openedDocument.Resolve(stream.Extra["SMask"]).(*godyf.Stream), decodedStream(t, stream.Extra["SMask"])
+}
+
+func TestPNGImage(t *testing.T) {
+	palette := []byte{255, 0, 0, 0, 0, 255}
+	for _, test := range []struct {
+		name                   string
+		png                    []byte
+		colorSpace             string
+		bits                   int
+		samples, alpha         []byte
+		mask, decodeParameters string
+	}{
+		{
+			"gray", pngFile(2, 2, 8, 0, false, []byte{0, 64, 128, 255}, nil, nil),
+			"/DeviceGray", 8, []byte{0, 64, 128, 255}, nil,
+			"", "<< /Predictor 15 /Colors 1 /BitsPerComponent 8 /Columns 2 >>",
+		},
+		{
+			"rgb 16 bits", pngFile(1, 2, 16, 2, false, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, nil, nil),
+			"/DeviceRGB", 16, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, nil,
+			"", "<< /Predictor 15 /Colors 3 /BitsPerComponent 16 /Columns 1 >>",
+		},
+		{
+			"palette 1 bit", pngFile(3, 2, 1, 3, false, []byte{0b10100000, 0b01000000}, palette, nil),
+			"[/Indexed /DeviceRGB 1 <ff00000000ff>]", 1, []byte{0b10100000, 0b01000000}, nil,
+			"", "<< /Predictor 15 /Colors 1 /BitsPerComponent 1 /Columns 3 >>",
+		},
+		{
+			"transparent gray", pngFile(2, 1, 8, 0, false, []byte{10, 20}, nil, []byte{0, 20}),
+			"/DeviceGray", 8, []byte{10, 20}, nil,
+			"[20 20]", "<< /Predictor 15 /Colors 1 /BitsPerComponent 8 /Columns 2 >>",
+		},
+		{
+			"rgba", pngFile(2, 1, 8, 6, false, []byte{1, 2, 3, 255, 4, 5, 6, 128}, nil, nil),
+			"/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, []byte{255, 128},
+			"", "",
+		},
+		{
+			"gray alpha 16 bits", pngFile(2, 1, 16, 4, false, []byte{1, 2, 0, 0, 3, 4, 255, 255}, nil, nil),
+			"/DeviceGray", 16, []byte{1, 2, 3, 4}, []byte{0, 0, 255, 255},
+			"", "",
+		},
+		{
+			"interlaced", pngFile(3, 3, 8, 0, true, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, nil, nil),
+			"/DeviceGray", 8, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, nil,
+			"", "",
+		},
+		{
+			"transparent palette", pngFile(3, 1, 8, 3, false, []byte{0, 1, 0}, palette, []byte{0}),
+			"[/Indexed /DeviceRGB 1 <ff00000000ff>]", 8, []byte{0, 1, 0}, []byte{0, 255, 0},
+			"", "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := images.NewImageFromPNG(bytes.NewReader(test.png))
+			if err != nil {
+				t.Fatalf("Failed to read PNG: %v", err)
+			}
+			stream, samples, smask, alpha := writeImage(t, img)
+			if colorSpace := godyf.ToBytes(openedDocument.Resolve(stream.Extra["ColorSpace"])); string(colorSpace) != test.colorSpace {
+				t.Fatalf("Unexpected color space %s", colorSpace)
+			}
+			if stream.Extra["BitsPerComponent"] != test.bits || !bytes.Equal(samples, test.samples) {
+				t.Fatalf("Unexpected %v bits samples %v", stream.Extra["BitsPerComponent"], samples)
+			}
+			if mask := stream.Extra["Mask"]; (mask == nil && test.mask != "") || (mask != nil && string(godyf.ToBytes(mask)) != test.mask) {
+				t.Fatalf("Unexpected mask %v", mask)
+			}
+			if test.decodeParameters != "" {
+				if parameters := godyf.ToBytes(stream.Extra["DecodeParms"]); string(parameters) != test.decodeParameters {
+					t.Fatalf("Unexpected decode parameters %s", parameters)
+				}
+			}
+			if (smask == nil) != (test.alpha == nil) || !bytes.Equal(alpha, test.alpha) {
+				t.Fatalf("Unexpected soft mask %v", alpha)
+			}
+			if smask != nil && (smask.Extra["ColorSpace"] != godyf.Name("DeviceGray") || smask.Extra["BitsPerComponent"] != test.bits) {
+				t.Fatalf("Unexpected soft mask dictionary %v", smask.Extra)
+			}
+		})
+	}
+
+	// PNG data is embedded unchanged when possible
+	data := pngFile(2, 2, 8, 2, false, bytes.Repeat([]byte{1, 2, 3}, 4), nil, nil)
+	img, err := images.NewImageFromPNG(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read PNG: %v", err)
+	}
+	if img.Width != 2 || img.Height != 2 || img.SMask != nil || !bytes.Contains(data, img.Stream.Stream[0].([]byte)) {
+		t.Fatalf("Unexpected image %+v", img)
+	}
+
+	// Invalid files
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)-20]++
+	for _, invalid := range [][]byte{nil, []byte("GIF89a"), data[:30], corrupted} {
+		if _, err := images.NewImageFromPNG(bytes.NewReader(invalid)); err == nil {
+			t.Errorf("Invalid PNG %q read", invalid)
+		}
+	}
+}
+
+func TestJPEGImage(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		jpeg        []byte
+		width       int
+		height      int
+		colorSpace  godyf.Name
+		decode      string
+		orientation int
+	}{
+		{"gray", jpegFile(3, 2, 1, false, 0), 3, 2, "DeviceGray", "", 1},
+		{"rgb", jpegFile(30, 20, 3, false, 0), 30, 20, "DeviceRGB", "", 1},
+		{"cmyk", jpegFile(3, 2, 4, false, 0), 3, 2, "DeviceCMYK", "", 1},
+		{"adobe cmyk", jpegFile(3, 2, 4, true, 0), 3, 2, "DeviceCMYK", "[1 0 1 0 1 0 1 0]", 1},
+		{"adobe rgb", jpegFile(3, 2, 3, true, 0), 3, 2, "DeviceRGB", "", 1},
+		{"rotated", jpegFile(3, 2, 3, false, 6), 3, 2, "DeviceRGB", "", 6},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := images.NewImageFromJPEG(bytes.NewReader(test.jpeg))
+			if err != nil {
+				t.Fatalf("Failed to read JPEG: %v", err)
+			}
+			if img.Width != test.width || img.Height != test.height || img.Orientation != test.orientation || img.SMask != nil {
+				t.Fatalf("Unexpected image %+v", img)
+			}
+			stream, data, _, _ := writeImage(t, img)
+			if stream.Extra["ColorSpace"] != test.colorSpace || stream.Extra["BitsPerComponent"] != 8 ||
+				stream.Extra["Filter"] != godyf.Name("DCTDecode") {
+				t.Fatalf("Unexpected image dictionary %v", stream.Extra)
+			}
+			if decode := stream.Extra["Decode"]; (decode == nil && test.decode != "") || (decode != nil && string(godyf.ToBytes(decode)) != test.decode) {
+				t.Fatalf("Unexpected decode array %v", decode)
+			}
+			if !bytes.Equal(data, test.jpeg) {
+				t.Fatalf("JPEG data changed")
+			}
+		})
+	}
+
+	// Data written by image/jpeg
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 5, 4)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	if img, err := images.NewImageFromJPEG(&buf); err != nil || img.Width != 5 || img.Height != 4 {
+		t.Fatalf("Unexpected image %+v: %v", img, err)
+	}
+
+	// Placement matrices, drawing the top left corner of the image data at
+	// the top left corner of the rectangle once oriented
+	for orientation, corner := range map[int][2]float64{
+		1: {10, 70}, 2: {110, 70}, 3: {110, 20}, 4: {10, 20},
+		5: {10, 70}, 6: {110, 70}, 7: {110, 20}, 8: {10, 20},
+	} {
+		img := &images.Image{Width: 50, Height: 100, Orientation: orientation}
+		m := img.Matrix(10, 20, 100, 50)
+		if x, y := m[2]+m[4], m[3]+m[5]; x != corner[0] || y != corner[1] {
+			t.Errorf("Unexpected top left corner (%v, %v) for orientation %d", x, y, orientation)
+		}
+		width, height := img.DisplaySize()
+		if (orientation >= 5) != (width == 100 && height == 50) {
+			t.Errorf("Unexpected display size %dx%d for orientation %d", width, height, orientation)
+		}
+	}
+	stream := godyf.NewStream(nil, nil, false)
+	(&images.Image{Orientation: 6}).Draw(stream, "Im1", 10, 20, 100, 50)
+	if operators := fmt.Sprint(stream.Stream); operators != "[q 0 -50 100 0 10 70 cm /Im1 Do Q]" {
+		t.Fatalf("Unexpected operators %s", operators)
+	}
+
+	// Invalid files
+	for _, invalid := range [][]byte{nil, []byte("\x89PNG"), {0xFF, 0xD8, 0xFF, 0xD9}, jpegFile(3, 2, 2, false, 0), jpegFile(0, 2, 1, false, 0)} {
+		if _, err := images.NewImageFromJPEG(bytes.NewReader(invalid)); err == nil {
+			t.Errorf("Invalid JPEG %q read", invalid)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 2, 2))
+	copy(gray.Pix, []byte{0, 64, 128, 255})
+	gray16 := image.NewGray16(image.Rect(0, 0, 1, 1))
+	copy(gray16.Pix, []byte{1, 2})
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	copy(rgba.Pix, []byte{1, 2, 3, 255, 4, 5, 6, 255})
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	copy(nrgba.Pix, []byte{1, 2, 3, 255, 4, 5, 6, 128})
+	cmyk := image.NewCMYK(image.Rect(0, 0, 2, 1))
+	copy(cmyk.Pix, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	paletted := image.NewPaletted(image.Rect(0, 0, 3, 1), color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 0, 0}})
+	copy(paletted.Pix, []byte{0, 1, 0})
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 2, 2), image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = 255
+	}
+	ycbcr.Cb[0], ycbcr.Cr[0] = 128, 128
+	large := image.NewGray(image.Rect(10, 10, 14, 12))
+	copy(large.Pix, []byte{10, 20, 30, 40, 30, 40, 50, 60})
+	largePaletted := image.NewPaletted(image.Rect(0, 0, 4, 1), color.Palette{color.Black, color.White})
+	copy(largePaletted.Pix, []byte{0, 1, 1, 0})
+
+	for _, test := range []struct {
+		name           string
+		image          image.Image
+		options        images.Options
+		colorSpace     string
+		bits           int
+		samples, alpha []byte
+	}{
+		{"gray", gray, images.Options{}, "/DeviceGray", 8, []byte{0, 64, 128, 255}, nil},
+		{"gray 16 bits", gray16, images.Options{}, "/DeviceGray", 16, []byte{1, 2}, nil},
+		{"rgba", rgba, images.Options{}, "/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, nil},
+		{"nrgba", nrgba, images.Options{}, "/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, []byte{255, 128}},
+		{"cmyk", cmyk, images.Options{}, "/DeviceCMYK", 8, []byte{1, 2, 3, 4, 5, 6, 7, 8}, nil},
+		{"paletted", paletted, images.Options{}, "[/Indexed /DeviceRGB 1 <ff0000000000>]", 8, []byte{0, 1, 0}, []byte{255, 0, 255}},
+		{"ycbcr", ycbcr, images.Options{}, "/DeviceRGB", 8, bytes.Repeat([]byte{255}, 12), nil},
+		{"downsampled", large, images.Options{Width: 2, Height: 1, DPI: 72}, "/DeviceGray", 8, []byte{25, 45}, nil},
+		{"downsampled width", large, images.Options{Width: 1, DPI: 144}, "/DeviceGray", 8, []byte{15, 35, 35, 55}, nil},
+		{"high resolution", large, images.Options{Width: 1, Height: 1, DPI: 300}, "/DeviceGray", 8, []byte{10, 20, 30, 40, 30, 40, 50, 60}, nil},
+		{"downsampled paletted", largePaletted, images.Options{Width: 2, Height: 1, DPI: 72}, "[/Indexed /DeviceRGB 1 <000000ffffff>]", 8, []byte{0, 1}, nil},
+		{"downsampled cmyk", cmyk, images.Options{Width: 1, Height: 1, DPI: 72}, "/DeviceCMYK", 8, []byte{3, 4, 5, 6}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img := images.NewImage(test.image, test.options)
+			stream, samples, smask, alpha := writeImage(t, img)
+			if colorSpace := godyf.ToBytes(openedDocument.Resolve(stream.Extra["ColorSpace"])); string(colorSpace) != test.colorSpace {
+				t.Fatalf("Unexpected color space %s", colorSpace)
+			}
+			if stream.Extra["BitsPerComponent"] != test.bits || !bytes.Equal(samples, test.samples) {
+				t.Fatalf("Unexpected %v bits samples %v", stream.Extra["BitsPerComponent"], samples)
+			}
+			if parameters := stream.Extra["DecodeParms"].(*godyf.Dictionary); parameters.Values["Predictor"] != 15 {
+				t.Fatalf("Unexpected decode parameters %v", parameters)
+			}
+			if (smask == nil) != (test.alpha == nil) || !bytes.Equal(alpha, test.alpha) {
+				t.Fatalf("Unexpected soft mask %v", alpha)
+			}
+		})
+	}
+}
+
+func TestTIFFImage(t *testing.T) {
+	// tiffTags returns the tags of a frame of the given size, samples per
+	// pixel, depth, compression and photometric interpretation
+	tiffTags := func(width, height, samples, bits, compression, photometric uint32, extra map[uint16][]uint32) map[uint16][]uint32 {
+		tags := map[uint16][]uint32{256: {width}, 257: {height}, 258: {bits}, 259: {compression}, 262: {photometric}, 277: {samples}}
+		for tag, values := range extra {
+			tags[tag] = values
+		}
+		return tags
+	}
+	lzw := (&godyf.LZWFilter{}).Encode([]byte{1, 2, 3, 4, 5, 6})
+	deflate := (&godyf.FlateFilter{}).Encode([]byte{2, 1, 2, 2})
+	colorMap := []uint32{0xFFFF, 0, 0, 0, 0, 0xFF00}
+
+	for _, test := range []struct {
+		name       string
+		tiff       []byte
+		colorSpace string
+		bits       int
+		samples    []byte
+		alpha      []byte
+		extra      string
+	}{
+		{
+			"ccitt group 4", tiffFile(false, tiffFrame{Tags: tiffTags(8, 2, 1, 1, 4, 0, nil), Strips: [][]byte{{0x26, 0xA0, 0x00, 0x10}}}),
+			"/DeviceGray", 1, []byte{0x26, 0xA0, 0x00, 0x10}, nil,
+			"/CCITTFaxDecode << /K -1 /Columns 8 /Rows 2 /BlackIs1 false >>",
+		},
+		{
+			"ccitt group 3 strips", tiffFile(true, tiffFrame{Tags: tiffTags(8, 2, 1, 1, 3, 1, map[uint16][]uint32{278: {1}, 292: {5}}), Strips: [][]byte{{1, 2}, {3}}}),
+			"/DeviceGray", 1, []byte{1, 2, 3}, nil,
+			"/CCITTFaxDecode << /K 1 /Columns 8 /Rows 2 /BlackIs1 true /EncodedByteAlign true >>",
+		},
+		{
+			"ccitt reversed bits", tiffFile(false, tiffFrame{Tags: tiffTags(8, 1, 1, 1, 2, 0, map[uint16][]uint32{266: {2}}), Strips: [][]byte{{0x01, 0x30}}}),
+			"/DeviceGray", 1, []byte{0x80, 0x0C}, nil,
+			"/CCITTFaxDecode << /K 0 /Columns 8 /Rows 1 /BlackIs1 false /EncodedByteAlign true >>",
+		},
+		{
+			"uncompressed gray strips", tiffFile(false, tiffFrame{Tags: tiffTags(2, 2, 1, 8, 1, 1, map[uint16][]uint32{278: {1}}), Strips: [][]byte{{1, 2}, {3, 4}}}),
+			"/DeviceGray", 8, []byte{1, 2, 3, 4}, nil, "/FlateDecode",
+		},
+		{
+			"white is zero", tiffFile(true, tiffFrame{Tags: tiffTags(8, 1, 1, 1, 1, 0, nil), Strips: [][]byte{{0x0F}}}),
+			"/DeviceGray", 1, []byte{0x0F}, nil, "/FlateDecode [1 0]",
+		},
+		{
+			"lzw rgb", tiffFile(true, tiffFrame{Tags: tiffTags(2, 1, 3, 8, 5, 2, nil), Strips: [][]byte{lzw}}),
+			"/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, nil, "/FlateDecode",
+		},
+		{
+			"deflate 16 bits predictor", tiffFile(false, tiffFrame{Tags: tiffTags(2, 1, 1, 16, 8, 1, map[uint16][]uint32{317: {2}}), Strips: [][]byte{deflate}}),
+			"/DeviceGray", 16, []byte{1, 2, 3, 4}, nil, "/FlateDecode",
+		},
+		{
+			"rgba", tiffFile(false, tiffFrame{Tags: tiffTags(2, 1, 4, 8, 1, 2, map[uint16][]uint32{338: {2}}), Strips: [][]byte{{1, 2, 3, 255, 4, 5, 6, 128}}}),
+			"/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, []byte{255, 128}, "/FlateDecode",
+		},
+		{
+			"opaque rgba", tiffFile(false, tiffFrame{Tags: tiffTags(1, 1, 4, 8, 1, 2, map[uint16][]uint32{338: {1}}), Strips: [][]byte{{1, 2, 3, 255}}}),
+			"/DeviceRGB", 8, []byte{1, 2, 3}, nil, "/FlateDecode",
+		},
+		{
+			"cmyk", tiffFile(false, tiffFrame{Tags: tiffTags(1, 1, 4, 8, 1, 5, nil), Strips: [][]byte{{1, 2, 3, 4}}}),
+			"/DeviceCMYK", 8, []byte{1, 2, 3, 4}, nil, "/FlateDecode",
+		},
+		{
+			"palette", tiffFile(false, tiffFrame{Tags: tiffTags(3, 1, 1, 1, 1, 3, map[uint16][]uint32{320: colorMap}), Strips: [][]byte{{0x40}}}),
+			"[/Indexed /DeviceRGB 1 <ff00000000ff>]", 1, []byte{0x40}, nil, "/FlateDecode",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			frames, err := images.NewImagesFromTIFF(bytes.NewReader(test.tiff))
+			if err != nil {
+				t.Fatalf("Failed to read TIFF: %v", err)
+			}
+			if len(frames) != 1 {
+				t.Fatalf("Unexpected %d frames", len(frames))
+			}
+			stream, samples, smask, alpha := writeImage(t, frames[0])
+			if colorSpace := godyf.ToBytes(openedDocument.Resolve(stream.Extra["ColorSpace"])); string(colorSpace) != test.colorSpace {
+				t.Fatalf("Unexpected color space %s", colorSpace)
+			}
+			if stream.Extra["BitsPerComponent"] != test.bits || !bytes.Equal(samples, test.samples) {
+				t.Fatalf("Unexpected %v bits samples %v", stream.Extra["BitsPerComponent"], samples)
+			}
+			extra := string(godyf.ToBytes(stream.Extra["Filter"]))
+			if stream.Extra["Filter"] == godyf.Name("CCITTFaxDecode") {
+				extra += " " + string(godyf.ToBytes(stream.Extra["DecodeParms"]))
+			}
+			if stream.Extra["Decode"] != nil {
+				extra += " " + string(godyf.ToBytes(stream.Extra["Decode"]))
+			}
+			if extra != test.extra {
+				t.Fatalf("Unexpected filter %s", extra)
+			}
+			if (smask == nil) != (test.alpha == nil) || !bytes.Equal(alpha, test.alpha) {
+				t.Fatalf("Unexpected soft mask %v", alpha)
+			}
+		})
+	}
+
+	// Associated alpha gives colors premultiplied by black
+	data := tiffFile(false, tiffFrame{Tags: tiffTags(1, 1, 2, 8, 1, 1, map[uint16][]uint32{338: {1}}), Strips: [][]byte{{64, 128}}})
+	frames, err := images.NewImagesFromTIFF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read TIFF: %v", err)
+	}
+	if matte := godyf.ToBytes(frames[0].SMask.Extra["Matte"]); string(matte) != "[0]" {
+		t.Fatalf("Unexpected matte %s", matte)
+	}
+
+	// One page per frame, sized by the resolution of the frame
+	strip := [][]byte{{0x26, 0xA0}}
+	data = tiffFile(true,
+		tiffFrame{Tags: tiffTags(200, 100, 1, 1, 4, 0, map[uint16][]uint32{282: {200}, 283: {100}}), Strips: strip},
+		tiffFrame{Tags: tiffTags(100, 200, 1, 1, 4, 0, map[uint16][]uint32{274: {6}}), Strips: strip},
+	)
+	document := pdf.NewPDF()
+	if err := images.AddTIFFPages(document, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to add TIFF pages: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	openedDocument = openBytes(t, buf.Bytes())
+	pages := openedDocument.PageReferences()
+	if len(pages) != 2 {
+		t.Fatalf("Unexpected %d pages", len(pages))
+	}
+	for i, expected := range []string{"[0 0 72 72]", "[0 0 200 100]"} {
+		page := openedDocument.Resolve(pages[i]).(*godyf.Dictionary)
+		if box := godyf.ToBytes(page.Values["MediaBox"]); string(box) != expected {
+			t.Errorf("Unexpected media box %s for page %d", box, i+1)
+		}
+	}
+	if operators := string(decodedStream(t, openedDocument.Resolve(pages[1]).(*godyf.Dictionary).Values["Contents"])); operators != "q\n0 -100 200 0 0 100 cm\n/Im1 Do\nQ" {
+		t.Errorf("Unexpected operators %q", operators)
+	}
+
+	// Invalid files
+	for _, invalid := range [][]byte{
+		nil,
+		[]byte("II\x2A\x00\xFF\x00\x00\x00"),
+		tiffFile(false, tiffFrame{Tags: tiffTags(8, 2, 1, 1, 4, 0, map[uint16][]uint32{278: {1}}), Strips: [][]byte{{1}, {2}}}),
+		tiffFile(false, tiffFrame{Tags: tiffTags(8, 2, 1, 1, 1, 0, map[uint16][]uint32{322: {16}}), Strips: [][]byte{{1, 2}}}),
+		tiffFile(false, tiffFrame{Tags: tiffTags(8, 2, 1, 8, 1, 1, nil), Strips: [][]byte{{1, 2}}}),
+		tiffFile(false, tiffFrame{Tags: tiffTags(8, 2, 1, 8, 7, 1, nil), Strips: [][]byte{{1, 2}}}),
+	} {
+		if _, err := images.NewImagesFromTIFF(bytes.NewReader(invalid)); err == nil {
+			t.Errorf("Invalid TIFF %q read", invalid)
+		}
+	}
+}
+
+func TestGIFImage(t *testing.T) {
+	// encodeGIF returns a GIF file made of indices in palette
+	encodeGIF := func(width, height int, palette color.Palette, indices []byte) []byte {
+		paletted := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		copy(paletted.Pix, indices)
+		var buf bytes.Buffer
+		if err := gif.Encode(&buf, paletted, nil); err != nil {
+			t.Fatalf("Failed to encode GIF: %v", err)
+		}
+		return buf.Bytes()
+	}
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	grays := make(color.Palette, 200)
+	for i := range grays {
+		grays[i] = color.Gray{Y: uint8(i)}
+	}
+
+	for _, test := range []struct {
+		name       string
+		gif        []byte
+		colorSpace string
+		bits       int
+		samples    []byte
+		mask       string
+	}{
+		{
+			"two colors", encodeGIF(3, 2, color.Palette{red, blue}, []byte{0, 1, 0, 1, 1, 0}),
+			"[/Indexed /DeviceRGB 1 <ff00000000ff>]", 1, []byte{0b01000000, 0b11000000}, "",
+		},
+		{
+			"transparent", encodeGIF(2, 1, color.Palette{red, color.RGBA{}, blue}, []byte{1, 2}),
+			"[/Indexed /DeviceRGB 3 <ff00000000000000ff000000>]", 2, []byte{0b01100000}, "[1 1]",
+		},
+		{
+			"large palette", encodeGIF(2, 1, grays, []byte{150, 3}),
+			"[/Indexed /DeviceRGB 255 <000000010101", 8, []byte{150, 3}, "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := images.NewImageFromGIF(bytes.NewReader(test.gif))
+			if err != nil {
+				t.Fatalf("Failed to read GIF: %v", err)
+			}
+			stream, samples, smask, _ := writeImage(t, img)
+			if colorSpace := godyf.ToBytes(openedDocument.Resolve(stream.Extra["ColorSpace"])); !bytes.HasPrefix(colorSpace, []byte(test.colorSpace)) {
+				t.Fatalf("Unexpected color space %s", colorSpace)
+			}
+			if stream.Extra["BitsPerComponent"] != test.bits || !bytes.Equal(samples, test.samples) {
+				t.Fatalf("Unexpected %v bits samples %v", stream.Extra["BitsPerComponent"], samples)
+			}
+			if mask := stream.Extra["Mask"]; (mask == nil && test.mask != "") || (mask != nil && string(godyf.ToBytes(mask)) != test.mask) {
+				t.Fatalf("Unexpected mask %v", mask)
+			}
+			if smask != nil {
+				t.Fatalf("Unexpected soft mask")
+			}
+		})
+	}
+
+	if _, err := images.NewImageFromGIF(bytes.NewReader([]byte("GIF89a"))); err == nil {
+		t.Errorf("Invalid GIF read")
+	}
+}
+
+func TestBMPImage(t *testing.T) {
+	palette := []byte{255, 0, 0, 0, 0, 255, 0, 255, 0}
+	for _, test := range []struct {
+		name           string
+		bmp            []byte
+		colorSpace     string
+		bits           int
+		samples, alpha []byte
+	}{
+		{
+			"1 bit", bmpFile(3, 2, 1, false, []byte{0b01000000, 0b10100000}, palette[:6], nil),
+			"[/Indexed /DeviceRGB 1 <ff00000000ff>]", 1, []byte{0b01000000, 0b10100000}, nil,
+		},
+		{
+			"4 bits", bmpFile(3, 1, 4, true, []byte{0x21, 0x00}, palette, nil),
+			"[/Indexed /DeviceRGB 15 <ff00000000ff00ff00" + strings.Repeat("000000", 13) + ">]", 4, []byte{0x21, 0x00}, nil,
+		},
+		{
+			"8 bits", bmpFile(2, 2, 8, false, []byte{0, 1, 2, 0}, palette, nil),
+			"[/Indexed /DeviceRGB 255 <ff00000000ff00ff00000000", 8, []byte{0, 1, 2, 0}, nil,
+		},
+		{
+			"24 bits", bmpFile(1, 2, 24, false, []byte{3, 2, 1, 6, 5, 4}, nil, nil),
+			"/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, nil,
+		},
+		{
+			"32 bits", bmpFile(2, 1, 32, true, []byte{3, 2, 1, 0, 6, 5, 4, 0}, nil, nil),
+			"/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, nil,
+		},
+		{
+			"32 bits alpha", bmpFile(2, 1, 32, false, []byte{3, 2, 1, 255, 6, 5, 4, 128}, nil, []uint32{0xFF0000, 0xFF00, 0xFF, 0xFF000000}),
+			"/DeviceRGB", 8, []byte{1, 2, 3, 4, 5, 6}, []byte{255, 128},
+		},
+		{
+			"32 bits masks", bmpFile(1, 1, 32, false, []byte{0x1F, 0, 0, 0}, nil, []uint32{0x1F, 0x3E0, 0x7C00, 0}),
+			"/DeviceRGB", 8, []byte{255, 0, 0}, nil,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := images.NewImageFromBMP(bytes.NewReader(test.bmp))
+			if err != nil {
+				t.Fatalf("Failed to read BMP: %v", err)
+			}
+			stream, samples, smask, alpha := writeImage(t, img)
+			if colorSpace := godyf.ToBytes(openedDocument.Resolve(stream.Extra["ColorSpace"])); !bytes.HasPrefix(colorSpace, []byte(test.colorSpace)) {
+				t.Fatalf("Unexpected color space %s", colorSpace)
+			}
+			if stream.Extra["BitsPerComponent"] != test.bits || !bytes.Equal(samples, test.samples) {
+				t.Fatalf("Unexpected %v bits samples %v", stream.Extra["BitsPerComponent"], samples)
+			}
+			if (smask == nil) != (test.alpha == nil) || !bytes.Equal(alpha, test.alpha) {
+				t.Fatalf("Unexpected soft mask %v", alpha)
+			}
+		})
+	}
+
+	// Invalid files
+	valid := bmpFile(2, 2, 8, false, []byte{0, 1, 2, 0}, palette, nil)
+	for _, invalid := range [][]byte{nil, []byte("GIF89a"), valid[:60], bmpFile(2, 2, 16, false, make([]byte, 8), nil, nil)} {
+		if _, err := images.NewImageFromBMP(bytes.NewReader(invalid)); err == nil {
+			t.Errorf("Invalid BMP %q read", invalid)
+		}
+	}
+}
+
+func TestImageDeduplication(t *testing.T) {
+	// writeLogos writes a document with the same logo, added three times, on
+	// three pages, and returns the references of the page images and the
+	// number of image XObjects once read again
+	writeLogos := func(deduplicate bool, writes int) ([]godyf.Ref, int) {
+		logo := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+		copy(logo.Pix, []byte{1, 2, 3, 255, 4, 5, 6, 128})
+		document := pdf.NewPDF()
+		document.NoDeduplication = !deduplicate
+		for i := 0; i < 3; i++ {
+			imageRef := document.AddResource(images.NewImage(logo, images.Options{}))
+			draw := godyf.NewStream(nil, nil, false)
+			draw.DrawXObject("Im1")
+			document.AddObject(draw)
+			document.AddPage(godyf.NewDictionary(map[string]interface{}{
+				"Type":      godyf.Name("Page"),
+				"Parent":    document.Pages.Ref(),
+				"Contents":  draw.Ref(),
+				"MediaBox":  godyf.NewArray(0, 0, 200, 200),
+				"Resources": godyf.NewDictionary(map[string]interface{}{"XObject": godyf.NewDictionary(map[string]interface{}{"Im1": imageRef})}),
+			}))
+		}
+		var buf bytes.Buffer
+		for i := 0; i < writes; i++ {
+			// Writing again finishes the images again
+			buf.Reset()
+			if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+				t.Fatalf("Failed to write PDF: %v", err)
+			}
+		}
+
+		openedDocument = openBytes(t, buf.Bytes())
+		var references []godyf.Ref
+		for _, page := range openedDocument.PageReferences() {
+			resources := openedDocument.Resolve(page).(*godyf.Dictionary).Values["Resources"].(*godyf.Dictionary)
+			xobjects := openedDocument.Resolve(resources.Values["XObject"]).(*godyf.Dictionary)
+			reference := xobjects.Values["Im1"].(godyf.Ref)
+			stream, ok := openedDocument.Resolve(reference).(*godyf.Stream)
+			if !ok || openedDocument.Resolve(stream.Extra["SMask"]) == nil {
+				t.Fatalf("Missing image or soft mask for page %v", page)
+			}
+			if contents := openedDocument.Resolve(openedDocument.Resolve(page).(*godyf.Dictionary).Values["Contents"]); contents == nil {
+				t.Fatalf("Missing contents for page %v", page)
+			}
+			references = append(references, reference)
+		}
+		count := 0
+		for _, obj := range openedDocument.Objects {
+			if stream, ok := obj.(*godyf.Stream); ok && stream.Extra["Subtype"] == godyf.Name("Image") {
+				count++
+			}
+		}
+		return references, count
+	}
+
+	for _, writes := range []int{1, 2} {
+		references, count := writeLogos(true, writes)
+		if count != 2 || references[0] != references[1] || references[1] != references[2] {
+			t.Errorf("Unexpected %d images referenced by %v after %d writes", count, references, writes)
+		}
+	}
+	references, count := writeLogos(false, 1)
+	if count != 6 || references[0] == references[1] {
+		t.Errorf("Unexpected %d images referenced by %v without deduplication", count, references)
+	}
+
+	// Streams folded into identical ones are left untouched, so that
+	// changes made between writes are written
+	document := pdf.NewPDF()
+	var draws []*godyf.Stream
+	for i := 0; i < 2; i++ {
+		draw := godyf.NewStream(nil, nil, false)
+		draw.Rectangle(0, 0, 10, 10)
+		draw.Fill(false)
+		document.AddObject(draw)
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":     godyf.Name("Page"),
+			"Parent":   document.Pages.Ref(),
+			"Contents": draw.Ref(),
+		}))
+		draws = append(draws, draw)
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		opened := openBytes(t, buf.Bytes())
+		pages := opened.PageReferences()
+		first := opened.Resolve(pages[0]).(*godyf.Dictionary).Values["Contents"]
+		second := opened.Resolve(pages[1]).(*godyf.Dictionary).Values["Contents"]
+		if (first == second) != (i == 0) || bytes.Contains(buf.Bytes(), []byte("5 5 1 1 re")) != (i == 1) {
+			t.Fatalf("Unexpected contents %v and %v after %d writes", first, second, i+1)
+		}
+		page := document.Resolve(document.PageReferences()[1]).(*godyf.Dictionary)
+		if document.Resolve(page.Values["Contents"]) != draws[1] {
+			t.Fatalf("Page contents changed to %v", page.Values["Contents"])
+		}
+		draws[1].Rectangle(5, 5, 1, 1)
+	}
+
+	// Identical streams added to opened documents are written once
+	document = pdf.NewPDF()
+	document.AddPage(godyf.NewDictionary(map[string]interface{}{"Type": godyf.Name("Page"), "Parent": document.Pages.Ref()}))
+	buf.Reset()
+	if err := document.WriteWithOptions(&buf, pdf.WriteOptions{}); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	original := buf.Len()
+	opened := openBytes(t, buf.Bytes())
+	page := opened.Resolve(opened.PageReferences()[0]).(*godyf.Dictionary)
+	var contents []interface{}
+	for i := 0; i < 2; i++ {
+		stream := godyf.NewStream([]interface{}{"0 0 10 10 re f"}, nil, false)
+		opened.AddObject(stream)
+		contents = append(contents, stream.Ref())
+	}
+	page.Values["Contents"] = godyf.NewArrayFromSlice(contents)
+	if err := opened.WriteIncremental(&buf); err != nil {
+		t.Fatalf("Failed to write incremental update: %v", err)
+	}
+	updated := openBytes(t, buf.Bytes())
+	page = updated.Resolve(updated.PageReferences()[0]).(*godyf.Dictionary)
+	if array := string(godyf.ToBytes(page.Values["Contents"])); array != fmt.Sprintf("[%d 0 R %d 0 R]", len(updated.Objects)-2, len(updated.Objects)-2) {
+		t.Errorf("Unexpected contents %s", array)
+	}
+	if bytes.Count(buf.Bytes()[original:], []byte("re f")) != 1 {
+		t.Errorf("Duplicate stream written in incremental update")
+	}
+}
+
+// pngFile returns a PNG file of the given size, depth and color type made
+// of pixels, rows of packed samples without filter bytes, with optional
+// PLTE and tRNS chunks. Interlaced images need pixels of whole bytes.
+func pngFile(width, height, bits, colorType int, interlaced bool, pixels, palette, transparency []byte) []byte {
+	channels := map[int]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[colorType]
+	rowSize := (width*channels*bits + 7) / 8
+	pixelSize := channels * bits / 8
+
+	// Scanlines with filter type 0, by Adam7 pass for interlaced images
+	var raw []byte
+	if interlaced {
+		passes := [][4]int{{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4}, {0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2}}
+		for _, pass := range passes {
+			for y := pass[1]; y < height; y += pass[3] {
+				if pass[0] >= width {
+					break
+				}
+				raw = append(raw, 0)
+				for x := pass[0]; x < width; x += pass[2] {
+					raw = append(raw, pixels[y*rowSize+x*pixelSize:y*rowSize+(x+1)*pixelSize]...)
+				}
+			}
+		}
+	} else {
+		for y := 0; y < height; y++ {
+			raw = append(raw, 0)
+			raw = append(raw, pixels[y*rowSize:(y+1)*rowSize]...)
+		}
+	}
+	var idat bytes.Buffer
+	writer := zlib.NewWriter(&idat)
+	writer.Write(raw)
+	writer.Close()
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header, uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	header[8], header[9] = byte(bits), byte(colorType)
+	if interlaced {
+		header[12] = 1
+	}
+	data := []byte("\x89PNG\r\n\x1a\n")
+	chunk := func(kind string, body []byte) {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(body)))
+		start := len(data)
+		data = append(data, kind...)
+		data = append(data, body...)
+		data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data[start:]))
+	}
+	chunk("IHDR", header)
+	if palette != nil {
+		chunk("PLTE", palette)
+	}
+	if transparency != nil {
+		chunk("tRNS", transparency)
+	}
+	chunk("IDAT", idat.Bytes())
+	chunk("IEND", nil)
+	return data
+}
+
+// jpegFile returns the headers of a baseline JPEG file of the given size
+// and components, without scan data, with an Adobe segment if adobe is set
+// and an EXIF segment if orientation isn't 0
+func jpegFile(width, height, components int, adobe bool, orientation int) []byte {
+	data := []byte{0xFF, 0xD8}
+	segment := func(marker byte, body []byte) {
+		data = append(data, 0xFF, marker)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(body)+2))
+		data = append(data, body...)
+	}
+	segment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	if orientation != 0 {
+		// Little-endian TIFF header followed by a directory of one entry
+		exif := []byte("Exif\x00\x00II\x2A\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00")
+		exif = append(exif, byte(orientation), 0, 0, 0, 0, 0, 0, 0)
+		segment(0xE1, exif)
+	}
+	if adobe {
+		segment(0xEE, []byte("Adobe\x00\x64\x00\x00\x00\x00\x02"))
+	}
+	frame := []byte{8}
+	frame = binary.BigEndian.AppendUint16(frame, uint16(height))
+	frame = binary.BigEndian.AppendUint16(frame, uint16(width))
+	frame = append(frame, byte(components))
+	for i := 0; i < components; i++ {
+		frame = append(frame, byte(i+1), 0x11, 0)
+	}
+	segment(0xC0, frame)
+	return append(data, 0xFF, 0xD9)
+}
+
+// tiffFrame is an image file directory of a TIFF file built by tiffFile
+type tiffFrame struct {
+	// Values of the tags, written as LONG values, or as RATIONAL values
+	// over 1 for resolutions
+	Tags map[uint16][]uint32
+	// Data of the strips, whose offsets and byte counts are added to tags
+	Strips [][]byte
+}
+
+// tiffFile returns a TIFF file made of frames, with big-endian or
+// little-endian values
+func tiffFile(bigEndian bool, frames ...tiffFrame) []byte {
+	var order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	} = binary.LittleEndian
+	data := []byte("II\x2A\x00\x00\x00\x00\x00")
+	if bigEndian {
+		order = binary.BigEndian
+		data = []byte("MM\x00\x2A\x00\x00\x00\x00")
+	}
+	// Offset of the value giving the offset of the next directory
+	next := 4
+	for _, frame := range frames {
+		tags := make(map[uint16][]uint32, len(frame.Tags)+2)
+		for tag, values := range frame.Tags {
+			tags[tag] = values
+		}
+		tags[273], tags[279] = nil, nil
+		for _, strip := range frame.Strips {
+			tags[273] = append(tags[273], uint32(len(data)))
+			tags[279] = append(tags[279], uint32(len(strip)))
+			data = append(data, strip...)
+		}
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+
+		// Directory entries, sorted by tag, with values stored after them
+		sorted := make([]uint16, 0, len(tags))
+		for tag := range tags {
+			sorted = append(sorted, tag)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		order.PutUint32(data[next:], uint32(len(data)))
+		directory := len(data)
+		data = order.AppendUint16(data, uint16(len(sorted)))
+		data = append(data, make([]byte, 12*len(sorted)+4)...)
+		next = len(data) - 4
+		for i, tag := range sorted {
+			entry := data[directory+2+12*i:]
+			var values []byte
+			kind := uint16(4)
+			for _, value := range tags[tag] {
+				values = order.AppendUint32(values, value)
+				if tag == 282 || tag == 283 {
+					kind = 5
+					values = order.AppendUint32(values, 1)
+				}
+			}
+			order.PutUint16(entry, tag)
+			order.PutUint16(entry[2:], kind)
+			order.PutUint32(entry[4:], uint32(len(tags[tag])))
+			if len(values) <= 4 {
+				copy(entry[8:], values)
+			} else {
+				order.PutUint32(entry[8:], uint32(len(data)))
+				data = append(data, values...)
+			}
+		}
+	}
+	return data
+}
+
+// bmpFile returns a BMP file of the given size and depth made of pixels,
+// rows of packed pixels from the top one without padding, stored bottom-up
+// unless topDown is set, with an optional palette of RGB colors. Pixels are
+// read with the red, green, blue and alpha masks if given, stored in the
+// header.
+func bmpFile(width, height, depth int, topDown bool, pixels, palette []byte, masks []uint32) []byte {
+	headerSize, compression := 40, 0
+	if masks != nil {
+		headerSize, compression = 56, 3
+	}
+	dataOffset := 14 + headerSize + len(palette)/3*4
+	rowSize := (width*depth + 31) / 32 * 4
+	packedSize := (width*depth + 7) / 8
+
+	data := make([]byte, dataOffset, dataOffset+rowSize*height)
+	copy(data, "BM")
+	binary.LittleEndian.PutUint32(data[10:], uint32(dataOffset))
+	header := data[14:]
+	binary.LittleEndian.PutUint32(header, uint32(headerSize))
+	binary.LittleEndian.PutUint32(header[4:], uint32(width))
+	binary.LittleEndian.PutUint32(header[8:], uint32(height))
+	if topDown {
+		binary.LittleEndian.PutUint32(header[8:], uint32(-height))
+	}
+	binary.LittleEndian.PutUint16(header[12:], 1)
+	binary.LittleEndian.PutUint16(header[14:], uint16(depth))
+	binary.LittleEndian.PutUint32(header[16:], uint32(compression))
+	binary.LittleEndian.PutUint32(header[32:], uint32(len(palette)/3))
+	for i, mask := range masks {
+		binary.LittleEndian.PutUint32(header[40+4*i:], mask)
+	}
+	for i := 0; i < len(palette)/3; i++ {
+		copy(data[14+headerSize+4*i:], []byte{palette[3*i+2], palette[3*i+1], palette[3*i]})
+	}
+	for i := 0; i < height; i++ {
+		y := i
+		if !topDown {
+			y = height - 1 - i
+		}
+		row := make([]byte, rowSize)
+		copy(row, pixels[y*packedSize:(y+1)*packedSize])
+		data = append(data, row...)
+	}
+	binary.LittleEndian.PutUint32(data[2:], uint32(len(data)))
+	return data
+}
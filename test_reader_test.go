@@ -0,0 +1,1055 @@
+package godyf_tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stackquest-hq/godyf/godyf"
+	"github.com/stackquest-hq/godyf/pdf"
+)
+
+// writeSection appends objects and a classic cross-reference section to
+// file, returning the offset of the section
+func writeSection(file *bytes.Buffer, objects map[int]string, trailer string) int {
+	numbers := make([]int, 0, len(objects))
+	offsets := make(map[int]int)
+	for number := 0; number < 100; number++ {
+		if body, ok := objects[number]; ok {
+			numbers = append(numbers, number)
+			offsets[number] = file.Len()
+			fmt.Fprintf(file, "%d 0 obj\n%s\nendobj\n", number, body)
+		}
+	}
+
+	xref := file.Len()
+	file.WriteString("xref\n")
+	for _, number := range numbers {
+		if number == 0 {
+			fmt.Fprintf(file, "0 1\n0000000000 65535 f \n")
+			continue
+		}
+		fmt.Fprintf(file, "%d 1\n%010d 00000 n \n", number, offsets[number])
+	}
+	fmt.Fprintf(file, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, xref)
+	return xref
+}
+
+// openBytes opens the PDF document in data
+func openBytes(t *testing.T, data []byte) *pdf.PDF {
+	t.Helper()
+	document, err := pdf.Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open PDF: %v", err)
+	}
+	return document
+}
+
+// buildTestDocument returns a document with metadata and two pages
+func buildTestDocument() *pdf.PDF {
+	document := pdf.NewPDF()
+	document.Info.Values["Title"] = godyf.NewString("Réadable (title)")
+	for i := 0; i < 2; i++ {
+		draw := godyf.NewStream(nil, nil, true)
+		draw.Rectangle(float64(i), 2, 5, 6)
+		draw.Fill(false)
+		document.AddObject(draw)
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":     godyf.Name("Page"),
+			"Parent":   document.Pages.Ref(),
+			"Contents": draw.Ref(),
+			"MediaBox": godyf.NewArray(0, 0, 10, 10.5),
+		}))
+	}
+	return document
+}
+
+func TestOpenWrittenDocument(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := buildTestDocument().Write(&buf, nil, true, compress); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+
+		document := openBytes(t, buf.Bytes())
+		if string(document.Version) != "1.7" {
+			t.Fatalf("Unexpected version %q", document.Version)
+		}
+		if document.Pages.Values["Count"] != 2 {
+			t.Fatalf("Unexpected page count %v (compress=%v)", document.Pages.Values["Count"], compress)
+		}
+		title := document.Info.Values["Title"].(*godyf.String)
+		if title.String != "Réadable (title)" {
+			t.Fatalf("Unexpected title %q", title.String)
+		}
+
+		for i, ref := range document.PageReferences() {
+			page := document.Resolve(ref).(*godyf.Dictionary)
+			if page.GetObject().Number != ref.Number {
+				t.Fatalf("Page object number %d doesn't match reference %v", page.GetObject().Number, ref)
+			}
+			if page.Values["Type"] != godyf.Name("Page") || page.Values["Parent"] != document.Pages.Ref() {
+				t.Fatalf("Unexpected page dictionary %s", page.Data())
+			}
+			if string(page.Values["MediaBox"].(*godyf.Array).Data()) != "[0 0 10 10.5]" {
+				t.Fatalf("Unexpected media box %s", page.Values["MediaBox"].(*godyf.Array).Data())
+			}
+			contents := document.Resolve(page.Values["Contents"]).(*godyf.Stream)
+			decoded, err := contents.DecodedData()
+			if err != nil {
+				t.Fatalf("Failed to decode page contents: %v", err)
+			}
+			if string(decoded) != fmt.Sprintf("%d 2 5 6 re\nf", i) {
+				t.Fatalf("Unexpected page contents %q", decoded)
+			}
+		}
+
+		// The opened document can be written and read again
+		var again bytes.Buffer
+		if err := document.Write(&again, nil, nil, compress); err != nil {
+			t.Fatalf("Failed to write opened PDF: %v", err)
+		}
+		if reopened := openBytes(t, again.Bytes()); len(reopened.PageReferences()) != 2 {
+			t.Fatalf("Unexpected pages after rewriting: %v", reopened.PageReferences())
+		}
+	}
+}
+
+func TestEditOpenedStrings(t *testing.T) {
+	// Raw bytes are written until String or Raw is assigned
+	title := godyf.NewByteString([]byte("\x80 title"))
+	if title.String != "\u2022 title" || string(title.Data()) != string(godyf.NewByteString([]byte("\x80 title")).Data()) {
+		t.Fatalf("Unexpected byte string %q, %s", title.String, title.Data())
+	}
+	title.String = "Edited"
+	if string(title.Data()) != string(godyf.NewString("Edited").Data()) {
+		t.Fatalf("Assigned string not written: %s", title.Data())
+	}
+	title = godyf.NewByteString([]byte("\x80 title"))
+	title.Raw = []byte("raw")
+	if string(title.Data()) != "(raw)" {
+		t.Fatalf("Assigned raw bytes not written: %s", title.Data())
+	}
+
+	// Strings of opened documents are written as edited
+	var buf bytes.Buffer
+	if err := buildTestDocument().Write(&buf, nil, true, false); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	document := openBytes(t, buf.Bytes())
+	document.Info.Values["Title"].(*godyf.String).String = "Édited"
+	buf.Reset()
+	if err := document.Write(&buf, nil, true, false); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	if title := openBytes(t, buf.Bytes()).Info.Values["Title"].(*godyf.String).String; title != "Édited" {
+		t.Fatalf("Unexpected title %q", title)
+	}
+}
+
+func TestOpenIncrementalUpdates(t *testing.T) {
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	first := writeSection(&file, map[int]string{
+		0: "",
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 10 10] /Contents 4 0 R >>",
+		4: "<< /Length 5 0 R >>\nstream\n0 0 1 1 re f\nendstream",
+		5: "12",
+		6: "(old info)",
+	}, "<< /Size 7 /Root 1 0 R >>")
+
+	// The update replaces the page contents and frees object 6
+	offset := file.Len()
+	file.WriteString("4 0 obj\n<< /Length 7 >>\nstream\n1 1 m S\nendstream\nendobj\n")
+	xref := file.Len()
+	fmt.Fprintf(&file, "xref\n4 1\n%010d 00000 n \n6 1\n0000000000 00001 f \n", offset)
+	fmt.Fprintf(&file, "trailer\n<< /Size 7 /Root 1 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", first, xref)
+
+	document := openBytes(t, file.Bytes())
+	if len(document.Objects) != 7 {
+		t.Fatalf("Expected 7 objects, got %d", len(document.Objects))
+	}
+	contents := document.Objects[4].(*godyf.Stream)
+	if data, _ := contents.DecodedData(); string(data) != "1 1 m S" {
+		t.Fatalf("Expected updated page contents, got %q", data)
+	}
+	if length := document.Objects[5].(*pdf.IndirectValue).Value; length != 12 {
+		t.Fatalf("Expected indirect integer 12, got %v", length)
+	}
+	if free := document.Objects[6].GetObject(); free.Free != 'f' || free.Generation != 1 {
+		t.Fatalf("Expected object 6 to be free with generation 1, got %+v", free)
+	}
+	if document.Resolve(godyf.Ref{Number: 6, Generation: 0}) != nil {
+		t.Fatal("Expected references to free objects to resolve to nil")
+	}
+	if document.Info != nil {
+		t.Fatal("Expected no Info dictionary")
+	}
+}
+
+func TestOpenHybridReference(t *testing.T) {
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.5\n")
+
+	// Objects 1 and 2 are only listed in the cross-reference stream
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] /Count 0 >>"}
+	header := fmt.Sprintf("1 0 2 %d", len(objects[0])+1)
+	objectStream := godyf.NewStream([]interface{}{header, objects[0], objects[1]}, map[string]interface{}{
+		"Type":  godyf.Name("ObjStm"),
+		"N":     2,
+		"First": len(header) + 1,
+	}, true)
+	objectStream.Number = 3
+	streamOffset := file.Len()
+	file.Write(objectStream.Indirect(objectStream.Data()))
+	file.WriteString("\n")
+
+	xrefStream := godyf.NewStream([]interface{}{[]byte{
+		2, 3, 0,
+		2, 3, 1,
+	}}, map[string]interface{}{
+		"Type":  godyf.Name("XRef"),
+		"Size":  5,
+		"Index": godyf.NewArray(1, 2),
+		"W":     godyf.NewArray(1, 1, 1),
+	}, false)
+	xrefStream.Number = 4
+	xrefStreamOffset := file.Len()
+	file.Write(xrefStream.Indirect(xrefStream.Data()))
+	file.WriteString("\n")
+
+	xref := file.Len()
+	fmt.Fprintf(&file, "xref\n0 1\n0000000000 65535 f \n3 2\n%010d 00000 n \n%010d 00000 n \n",
+		streamOffset, xrefStreamOffset)
+	fmt.Fprintf(&file, "trailer\n<< /Size 5 /Root 1 0 R /XRefStm %d >>\nstartxref\n%d\n%%%%EOF\n",
+		xrefStreamOffset, xref)
+
+	document := openBytes(t, file.Bytes())
+	if document.Catalog.GetObject().Number != 1 || document.Pages.GetObject().Number != 2 {
+		t.Fatalf("Unexpected catalog %v or pages %v", document.Catalog.Ref(), document.Pages.Ref())
+	}
+	if !document.Pages.Compressible() || document.Pages.Values["Count"] != 0 {
+		t.Fatalf("Unexpected page tree %s", document.Pages.Data())
+	}
+}
+
+func TestOpenSyntax(t *testing.T) {
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.7\n")
+	writeSection(&file, map[int]string{
+		0: "",
+		1: "<< /Type /Catalog /Pages 2 0 R % comment\n>>",
+		2: "<</Type/Pages/Kids[]/Count 0/Weird#20Name#2Fx true/Nothing null/Numbers[-.5 +3 4. -0]>>",
+		3: "[(esc\\(aped\\)\\n\\101\\0570\\\r\nline) <48 65 6C 6C 6F 7> <FEFF00E9> (\\\\)]",
+	}, "<< /Size 4 /Root 1 0 R /ID [<01ab> <01AB>] >>")
+
+	document := openBytes(t, file.Bytes())
+	pages := document.Pages
+	if pages.Values["Weird Name/x"] != godyf.Bool(true) {
+		t.Fatalf("Unexpected escaped name or boolean in %v", pages.Keys())
+	}
+	if _, ok := pages.Values["Nothing"]; ok {
+		t.Fatal("Expected null dictionary values to be dropped")
+	}
+	if numbers := string(pages.Values["Numbers"].(*godyf.Array).Data()); numbers != "[-0.5 3 4 0]" {
+		t.Fatalf("Unexpected numbers %s", numbers)
+	}
+
+	strings := document.Objects[3].(*godyf.Array)
+	expected := []string{"esc(aped)\nA/0line", "Hellop", "é", "\\"}
+	for i, value := range expected {
+		if got := strings.Get(i).(*godyf.String).String; got != value {
+			t.Fatalf("String %d: expected %q, got %q", i, value, got)
+		}
+	}
+	if id := document.Trailer.Values["ID"].(*godyf.Array); string(id.Data()) != "[<01ab> <01ab>]" {
+		t.Fatalf("Unexpected identifier %s", id.Data())
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"header":    "not a PDF",
+		"startxref": "%PDF-1.7\n1 0 obj << >> endobj\n",
+		"xref":      "%PDF-1.7\nstartxref\n5\n%%EOF",
+		"encrypted": "%PDF-1.7\nxref\n0 1\n0000000000 65535 f \ntrailer << /Size 1 /Encrypt << >> >>\nstartxref\n9\n%%EOF",
+		"size":      "%PDF-1.7\nxref\n0 1\n0000000000 65535 f \ntrailer << /Size -5 >>\nstartxref\n9\n%%EOF",
+		"number":    "%PDF-1.7\nxref\n0 1\n0000000000 65535 f \n2000000000 1\n0000000009 00000 n \ntrailer << /Size 1 >>\nstartxref\n9\n%%EOF",
+	} {
+		if _, err := pdf.Open(strings.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("Expected an error for invalid %s", name)
+		}
+	}
+}
+
+func TestOpenHugeSize(t *testing.T) {
+	catalog := map[int]string{
+		0: "",
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [] /Count 0 >>",
+	}
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.7\n")
+	writeSection(&file, catalog, "<< /Size 300000000 /Root 1 0 R >>")
+
+	// Objects are only allocated for the entries found
+	document := openBytes(t, file.Bytes())
+	if len(document.Objects) != 3 {
+		t.Fatalf("Unexpected number of objects %d", len(document.Objects))
+	}
+
+	// Object numbers past the end of the file are rejected, the table
+	// being rebuilt in recovery mode
+	data := []byte(strings.Replace(file.String(), "\n2 1\n", "\n2000000000 1\n", 1))
+	if _, err := pdf.Open(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("Expected an error for a huge object number")
+	}
+	document = openRecovered(t, data)
+	if len(document.Objects) != 3 || !hasWarning(document, pdf.WarningXRefRebuilt) {
+		t.Fatalf("Unexpected number of objects %d", len(document.Objects))
+	}
+}
+
+func TestOpenHostilePredictor(t *testing.T) {
+	compressed := (&godyf.FlateFilter{}).Encode([]byte("\x02\x01\x00\x00\x02\x01\x09\x00"))
+	for _, columns := range []string{"1152921504606846976", "100000000000"} {
+		var file bytes.Buffer
+		file.WriteString("%PDF-1.7\n")
+		fmt.Fprintf(&file, "1 0 obj\n<< /Type /XRef /Size 2 /W [1 1 1] /Filter /FlateDecode"+
+			" /DecodeParms << /Predictor 12 /Columns %s >> /Length %d >>\nstream\n", columns, len(compressed))
+		file.Write(compressed)
+		file.WriteString("\nendstream\nendobj\nstartxref\n9\n%%EOF\n")
+
+		data := file.Bytes()
+		if _, err := pdf.Open(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Fatalf("Expected an error for /Columns %s", columns)
+		}
+		// The rebuilt file has no catalog
+		if _, err := pdf.OpenWithOptions(bytes.NewReader(data), int64(len(data)), pdf.ReadOptions{Recover: true}); err == nil {
+			t.Fatalf("Expected an error for /Columns %s in recovery mode", columns)
+		}
+	}
+}
+
+// openRecovered opens the PDF document in data in recovery mode
+func openRecovered(t *testing.T, data []byte) *pdf.PDF {
+	t.Helper()
+	document, err := pdf.OpenWithOptions(bytes.NewReader(data), int64(len(data)), pdf.ReadOptions{Recover: true})
+	if err != nil {
+		t.Fatalf("Failed to open damaged PDF: %v", err)
+	}
+	return document
+}
+
+// hasWarning returns whether document has a warning of the given kind
+func hasWarning(document *pdf.PDF, kind pdf.WarningKind) bool {
+	for _, warning := range document.Warnings {
+		if warning.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOpenRecoverShiftedOffsets(t *testing.T) {
+	var buf bytes.Buffer
+	if err := buildTestDocument().Write(&buf, nil, true, false); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+
+	// Inserting bytes after the header shifts all the objects
+	data := append([]byte("%PDF-1.7\n% inserted by a careless editor\n"), buf.Bytes()[len("%PDF-1.7\n"):]...)
+	if _, err := pdf.Open(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("Expected an error without recovery")
+	}
+
+	document := openRecovered(t, data)
+	if !hasWarning(document, pdf.WarningXRefRebuilt) {
+		t.Fatalf("Expected a rebuilt cross-reference warning, got %v", document.Warnings)
+	}
+	if len(document.PageReferences()) != 2 {
+		t.Fatalf("Unexpected pages %v", document.PageReferences())
+	}
+	if title := document.Info.Values["Title"].(*godyf.String); title.String != "Réadable (title)" {
+		t.Fatalf("Unexpected title %q", title.String)
+	}
+}
+
+func TestOpenRecoverTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := buildTestDocument().Write(&buf, nil, true, true); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+
+	// Cut the file before the cross-reference stream, the trailer is lost
+	data := buf.Bytes()
+	data = data[:bytes.LastIndex(data, []byte("<< /Type /XRef"))]
+	data = data[:bytes.LastIndex(data, []byte("endobj"))+len("endobj\n")]
+
+	document := openRecovered(t, data)
+	if !hasWarning(document, pdf.WarningTrailerRebuilt) {
+		t.Fatalf("Expected a rebuilt trailer warning, got %v", document.Warnings)
+	}
+	if document.Pages.Values["Count"] != 2 {
+		t.Fatalf("Unexpected page count %v", document.Pages.Values["Count"])
+	}
+	for _, ref := range document.PageReferences() {
+		if page, ok := document.Resolve(ref).(*godyf.Dictionary); !ok || page.Values["Type"] != godyf.Name("Page") {
+			t.Fatalf("Page %v not recovered", ref)
+		}
+	}
+}
+
+func TestOpenRecoverStreamLength(t *testing.T) {
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.4\n")
+	writeSection(&file, map[int]string{
+		0: "",
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 10 10] /Contents [4 0 R 5 0 R] >>",
+		4: "<< /Length 100 >>\nstream\n0 0 1 1 re f\nendstream",
+		5: "<< /Length 2 0 R >>\nstream\n1 1 m S\r\nendstream",
+	}, "<< /Size 6 /Root 1 0 R >>")
+
+	if _, err := pdf.Open(bytes.NewReader(file.Bytes()), int64(file.Len())); err == nil {
+		t.Fatal("Expected an error without recovery")
+	}
+
+	document := openRecovered(t, file.Bytes())
+	if hasWarning(document, pdf.WarningXRefRebuilt) || !hasWarning(document, pdf.WarningStreamLength) {
+		t.Fatalf("Expected only stream length warnings, got %v", document.Warnings)
+	}
+	for number, expected := range map[int]string{4: "0 0 1 1 re f", 5: "1 1 m S"} {
+		if data, _ := document.Objects[number].(*godyf.Stream).DecodedData(); string(data) != expected {
+			t.Fatalf("Object %d: expected %q, got %q", number, expected, data)
+		}
+	}
+}
+
+func TestOpenRecoverDroppedObject(t *testing.T) {
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.4\n")
+	writeSection(&file, map[int]string{
+		0: "",
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [] /Count 0 >>",
+		3: "<< /Broken [1 2 >>",
+	}, "<< /Size 4 /Root 1 0 R >>")
+
+	document := openRecovered(t, file.Bytes())
+	if !hasWarning(document, pdf.WarningObjectDropped) {
+		t.Fatalf("Expected a dropped object warning, got %v", document.Warnings)
+	}
+	if document.Objects[3].GetObject().Free != 'f' {
+		t.Fatal("Expected the broken object to be replaced by a free object")
+	}
+}
+
+func TestWriteIncremental(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := buildTestDocument().Write(&buf, nil, true, compress); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		original := buf.Bytes()
+		document := openBytes(t, original)
+
+		// Change the title and add a page
+		document.Info.Values["Title"] = godyf.NewString("Updated")
+		page := godyf.NewDictionary(map[string]interface{}{
+			"Type":     godyf.Name("Page"),
+			"Parent":   document.Pages.Ref(),
+			"MediaBox": godyf.NewArray(0, 0, 10, 10),
+		})
+		document.AddPage(page)
+
+		var update bytes.Buffer
+		if err := document.WriteIncremental(&update); err != nil {
+			t.Fatalf("Failed to write incremental update: %v", err)
+		}
+
+		// Only the Info, page tree and new page objects are written
+		if objects := bytes.Count(update.Bytes(), []byte(" 0 obj\n")); compress && objects != 4 || !compress && objects != 3 {
+			t.Fatalf("Unexpected number of objects in update (compress=%v): %d\n%s", compress, objects, update.Bytes())
+		}
+		if compress != bytes.Contains(update.Bytes(), []byte("/Type /XRef")) {
+			t.Fatalf("Cross-reference section of the update doesn't match the original (compress=%v)", compress)
+		}
+		startXRef := bytes.Fields(original[bytes.LastIndex(original, []byte("startxref")):])[1]
+		if !bytes.Contains(update.Bytes(), append([]byte("/Prev "), startXRef...)) {
+			t.Fatalf("Expected /Prev to point to %s", startXRef)
+		}
+
+		updated := append(append([]byte{}, original...), update.Bytes()...)
+		reopened := openBytes(t, updated)
+		if title := reopened.Info.Values["Title"].(*godyf.String); title.String != "Updated" {
+			t.Fatalf("Unexpected title %q", title.String)
+		}
+		if len(reopened.PageReferences()) != 3 {
+			t.Fatalf("Unexpected pages %v", reopened.PageReferences())
+		}
+		if id := reopened.Trailer.Values["ID"].(*godyf.Array); string(godyf.ToBytes(id.Get(0))) != string(godyf.ToBytes(document.Trailer.Values["ID"].(*godyf.Array).Get(0))) {
+			t.Fatal("Expected the first identifier to be kept")
+		}
+
+		// A second update is chained to the first one
+		reopened.Info.Values["Title"] = godyf.NewString("Twice")
+		update.Reset()
+		if err := reopened.WriteIncremental(&update); err != nil {
+			t.Fatalf("Failed to write second incremental update: %v", err)
+		}
+		if objects := bytes.Count(update.Bytes(), []byte(" 0 obj\n")); compress && objects != 2 || !compress && objects != 1 {
+			t.Fatalf("Unexpected number of objects in second update: %d", objects)
+		}
+		twice := openBytes(t, append(updated, update.Bytes()...))
+		if title := twice.Info.Values["Title"].(*godyf.String); title.String != "Twice" || len(twice.PageReferences()) != 3 {
+			t.Fatalf("Unexpected title %q or pages %v", title.String, twice.PageReferences())
+		}
+	}
+
+	if err := pdf.NewPDF().WriteIncremental(io.Discard); err == nil {
+		t.Fatal("Expected an error for documents that weren't opened")
+	}
+}
+
+func TestWriteIncrementalFreeList(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		document := buildTestDocument()
+		var freed []int
+		for i := 0; i < 3; i++ {
+			array := godyf.NewArray(i)
+			document.AddObject(array)
+			if i != 1 {
+				freed = append(freed, array.Number)
+			}
+		}
+		var buf bytes.Buffer
+		if err := document.Write(&buf, nil, true, compress); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		original := buf.Bytes()
+		document = openBytes(t, original)
+
+		for _, number := range freed {
+			document.Objects[number].GetObject().Free = 'f'
+			document.Objects[number].GetObject().Generation++
+		}
+		var update bytes.Buffer
+		if err := document.WriteIncremental(&update); err != nil {
+			t.Fatalf("Failed to write incremental update: %v", err)
+		}
+
+		// Object 0 starts the list, the last free object ends it
+		if !compress {
+			for _, entry := range []string{
+				fmt.Sprintf("%010d 65535 f ", freed[0]),
+				fmt.Sprintf("%010d 00001 f ", freed[1]),
+				"0000000000 00001 f ",
+			} {
+				if !bytes.Contains(update.Bytes(), []byte(entry)) {
+					t.Fatalf("Missing free entry %q in update\n%s", entry, update.Bytes())
+				}
+			}
+		}
+		reopened := openBytes(t, append(append([]byte{}, original...), update.Bytes()...))
+		for _, number := range freed {
+			if reopened.Resolve(godyf.Ref{Number: number, Generation: 1}) != nil || reopened.Objects[number].GetObject().Free != 'f' {
+				t.Fatalf("Expected object %d to be free (compress=%v)", number, compress)
+			}
+		}
+		if reopened.Resolve(godyf.Ref{Number: freed[0] + 1}) == nil {
+			t.Fatalf("Expected object %d to be kept (compress=%v)", freed[0]+1, compress)
+		}
+	}
+}
+
+// buildSharingDocument returns a document with three pages sharing resources
+func buildSharingDocument() *pdf.PDF {
+	document := pdf.NewPDF()
+	document.Info.Values["Title"] = godyf.NewString("Linearized")
+	font := godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Font"),
+		"Subtype":  godyf.Name("Type1"),
+		"BaseFont": godyf.Name("Helvetica"),
+	})
+	document.AddObject(font)
+	pattern := godyf.NewArray(1, 2, 3)
+	document.AddObject(pattern)
+
+	for i := 0; i < 3; i++ {
+		draw := godyf.NewStream(nil, nil, true)
+		draw.Rectangle(float64(i), 2, 5, 6)
+		draw.Fill(false)
+		document.AddObject(draw)
+		own := godyf.NewArray(i)
+		document.AddObject(own)
+		resources := map[string]interface{}{
+			"Font": godyf.NewDictionary(map[string]interface{}{"F1": font.Ref()}),
+			"Own":  own.Ref(),
+		}
+		if i > 0 {
+			// Only shared by the last two pages, given as a raw reference
+			resources["Pattern"] = string(pattern.Reference())
+		}
+		document.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":      godyf.Name("Page"),
+			"Parent":    document.Pages.Ref(),
+			"Contents":  draw.Ref(),
+			"MediaBox":  godyf.NewArray(0, 0, 10, 10),
+			"Resources": godyf.NewDictionary(resources),
+		}))
+	}
+	return document
+}
+
+func TestWriteLinearized(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		for _, limit := range []int{0, 20} {
+			var buf bytes.Buffer
+			options := pdf.LinearizeOptions{PrimaryHintLimit: limit}
+			options.Identifier = pdf.IdentifierContentHash
+			if compress {
+				options.ObjectStreams, options.XRef = true, pdf.XRefStream
+			}
+			if err := buildSharingDocument().WriteLinearized(&buf, options); err != nil {
+				t.Fatalf("Failed to write linearized PDF: %v", err)
+			}
+			data := buf.Bytes()
+			if err := pdf.CheckLinearization(bytes.NewReader(data), int64(len(data))); err != nil {
+				t.Fatalf("Invalid linearization (compress=%v, limit=%d): %v", compress, limit, err)
+			}
+
+			// The linearization dictionary comes right after the header
+			if !bytes.Contains(data[:64], []byte("/Linearized 1")) {
+				t.Fatalf("Missing linearization dictionary at the beginning of %q", data[:64])
+			}
+			if compress != bytes.Contains(data, []byte("/Type /ObjStm")) {
+				t.Fatalf("Unexpected object streams (compress=%v)", compress)
+			}
+
+			document := openBytes(t, data)
+			if title := document.Info.Values["Title"].(*godyf.String); title.String != "Linearized" {
+				t.Fatalf("Unexpected title %q", title.String)
+			}
+			pages, first := document.PageReferences(), 0
+			if len(pages) != 3 {
+				t.Fatalf("Unexpected pages %v", pages)
+			}
+			for i, ref := range pages {
+				page := document.Resolve(ref).(*godyf.Dictionary)
+				contents := document.Resolve(page.Values["Contents"]).(*godyf.Stream)
+				if decoded, _ := contents.DecodedData(); string(decoded) != fmt.Sprintf("%d 2 5 6 re\nf", i) {
+					t.Fatalf("Unexpected page contents %q", decoded)
+				}
+				resources := page.Values["Resources"].(*godyf.Dictionary)
+				if i > 0 {
+					if pattern, ok := document.Resolve(resources.Values["Pattern"]).(*godyf.Array); !ok || pattern.Len() != 3 {
+						t.Fatalf("Raw reference not renumbered on page %d", i+1)
+					}
+				}
+				if i == 0 {
+					first = ref.Number
+				}
+			}
+			if first < pages[1].Number {
+				t.Fatalf("Expected the first page to be numbered after the other ones, got %v", pages)
+			}
+		}
+	}
+}
+
+// finishedStream is a resource made of a stream whose content is set when
+// the resource is finished
+type finishedStream struct {
+	stream  *godyf.Stream
+	content string
+}
+
+func (r *finishedStream) Objects() []godyf.PDFObject { return []godyf.PDFObject{r.stream} }
+
+func (r *finishedStream) Finish() error {
+	r.stream.Stream = []interface{}{r.content}
+	return nil
+}
+
+func TestWriteLinearizedOptions(t *testing.T) {
+	for _, options := range []pdf.LinearizeOptions{
+		{WriteOptions: pdf.WriteOptions{Version: []byte("1.x")}},
+		{WriteOptions: pdf.WriteOptions{Version: []byte("1.4"), ObjectStreams: true, XRef: pdf.XRefStream}},
+		{WriteOptions: pdf.WriteOptions{ObjectStreams: true, XRef: pdf.XRefHybrid}},
+		{WriteOptions: pdf.WriteOptions{XRef: pdf.XRefStream}},
+		{WriteOptions: pdf.WriteOptions{ObjectStreams: true, XRef: pdf.XRefStream, MaxObjectsPerStream: 2}},
+		{WriteOptions: pdf.WriteOptions{CompressionLevel: 12}},
+		{PrimaryHintLimit: -1},
+	} {
+		var buf bytes.Buffer
+		if err := buildSharingDocument().WriteLinearized(&buf, options); err == nil || buf.Len() > 0 {
+			t.Errorf("Expected an error before writing with %+v", options)
+		}
+	}
+
+	// The identifier is the hash of the objects as written, once resources
+	// are finished
+	var identifiers []string
+	for _, content := range []string{"first", "second"} {
+		document := buildSharingDocument()
+		document.AddResource(&finishedStream{godyf.NewStream(nil, nil, false), content})
+		var buf bytes.Buffer
+		options := pdf.LinearizeOptions{WriteOptions: pdf.WriteOptions{Identifier: pdf.IdentifierContentHash}}
+		if err := document.WriteLinearized(&buf, options); err != nil {
+			t.Fatalf("Failed to write linearized PDF: %v", err)
+		}
+		id, ok := openBytes(t, buf.Bytes()).Trailer.Get("ID").(*godyf.Array)
+		if !ok || id.Len() != 2 {
+			t.Fatalf("Unexpected identifier %v", id)
+		}
+		identifiers = append(identifiers, string(godyf.ToBytes(id.Get(1))))
+	}
+	if identifiers[0] == identifiers[1] {
+		t.Errorf("Identifier %s doesn't depend on finished resources", identifiers[0])
+	}
+}
+
+func TestCheckLinearizationInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := buildTestDocument().Write(&buf, nil, true, false); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	if err := pdf.CheckLinearization(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Fatal("Expected an error for a document that isn't linearized")
+	}
+
+	buf.Reset()
+	if err := buildSharingDocument().WriteLinearized(&buf, pdf.LinearizeOptions{}); err != nil {
+		t.Fatalf("Failed to write linearized PDF: %v", err)
+	}
+	// Appending data changes the file length
+	data := append(buf.Bytes(), "% trailing comment\n"...)
+	if err := pdf.CheckLinearization(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("Expected an error for a wrong file length")
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := pdf.NewStreamWriter(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to create stream writer: %v", err)
+	}
+
+	// The font is referenced by pages before being written
+	font := godyf.NewDictionary(map[string]interface{}{
+		"Type":     godyf.Name("Font"),
+		"Subtype":  godyf.Name("Type1"),
+		"BaseFont": godyf.Name("Helvetica"),
+	})
+	font.Number = writer.Reserve().Number
+
+	for i := 0; i < 50; i++ {
+		draw := godyf.NewStream(nil, nil, true)
+		draw.Rectangle(float64(i), 2, 5, 6)
+		draw.Fill(false)
+		if err := writer.WriteObject(draw); err != nil {
+			t.Fatalf("Failed to write stream: %v", err)
+		}
+		written := buf.Len()
+		if err := writer.AddPage(godyf.NewDictionary(map[string]interface{}{
+			"Type":      godyf.Name("Page"),
+			"Contents":  draw.Ref(),
+			"MediaBox":  godyf.NewArray(0, 0, 10, 10),
+			"Resources": godyf.NewDictionary(map[string]interface{}{"Font": font.Ref()}),
+		})); err != nil {
+			t.Fatalf("Failed to add page: %v", err)
+		}
+		if buf.Len() == written {
+			t.Fatal("Expected the page to be written immediately")
+		}
+	}
+	if err := writer.WriteObject(font); err != nil {
+		t.Fatalf("Failed to write reserved object: %v", err)
+	}
+	if err := writer.WriteObject(font); err == nil {
+		t.Fatal("Expected an error when writing an object twice")
+	}
+	writer.Info.Values["Title"] = godyf.NewString("Streamed")
+	if err := writer.Close(true); err != nil {
+		t.Fatalf("Failed to close stream writer: %v", err)
+	}
+	if err := writer.WriteObject(godyf.NewArray()); err == nil {
+		t.Fatal("Expected an error when writing after closing")
+	}
+
+	document := openBytes(t, buf.Bytes())
+	if document.Pages.Values["Count"] != 50 || len(document.PageReferences()) != 50 {
+		t.Fatalf("Unexpected page count %v", document.Pages.Values["Count"])
+	}
+	if title := document.Info.Values["Title"].(*godyf.String); title.String != "Streamed" {
+		t.Fatalf("Unexpected title %q", title.String)
+	}
+	if _, ok := document.Trailer.Values["ID"].(*godyf.Array); !ok {
+		t.Fatal("Expected an identifier")
+	}
+	page := document.Resolve(document.PageReferences()[49]).(*godyf.Dictionary)
+	if page.Values["Parent"] != document.Pages.Ref() {
+		t.Fatalf("Unexpected parent %v", page.Values["Parent"])
+	}
+	resources := page.Values["Resources"].(*godyf.Dictionary)
+	if font := document.Resolve(resources.Values["Font"]).(*godyf.Dictionary); font.Values["BaseFont"] != godyf.Name("Helvetica") {
+		t.Fatalf("Unexpected font %s", font.Data())
+	}
+	contents := document.Resolve(page.Values["Contents"]).(*godyf.Stream)
+	if decoded, _ := contents.DecodedData(); string(decoded) != "49 2 5 6 re\nf" {
+		t.Fatalf("Unexpected page contents %q", decoded)
+	}
+
+	// Reserved objects must be written before closing, nothing being
+	// written until they are
+	buf.Reset()
+	writer, _ = pdf.NewStreamWriter(&buf, nil)
+	reserved := godyf.NewArray()
+	reserved.Number = writer.Reserve().Number
+	written := buf.Len()
+	for _, identifier := range []interface{}{nil, 1} {
+		if err := writer.Close(identifier); err == nil || buf.Len() != written {
+			t.Fatalf("Expected an error before writing for identifier %v", identifier)
+		}
+	}
+
+	// Only generation 0 can be written
+	reserved.Generation = 1
+	if err := writer.WriteObject(reserved); err == nil || buf.Len() != written {
+		t.Fatal("Expected an error for a non-zero generation")
+	}
+	reserved.Generation = 0
+	if err := writer.WriteObject(reserved); err != nil {
+		t.Fatalf("Failed to write reserved object: %v", err)
+	}
+	if err := writer.Close(nil); err != nil {
+		t.Fatalf("Failed to close stream writer: %v", err)
+	}
+	openBytes(t, buf.Bytes())
+
+	// Failed writes make later calls fail
+	output := &failingWriter{limit: 100}
+	writer, _ = pdf.NewStreamWriter(output, nil)
+	for i := 0; i < 5; i++ {
+		writer.WriteObject(godyf.NewArray(i))
+	}
+	for i := 0; i < 2; i++ {
+		if err := writer.Close(nil); !errors.Is(err, errWriteFailed) {
+			t.Fatalf("Expected a write error, got %v", err)
+		}
+	}
+	if err := writer.WriteObject(godyf.NewArray()); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("Expected the write error again, got %v", err)
+	}
+}
+
+// errWriteFailed is returned by failingWriter
+var errWriteFailed = errors.New("write failed")
+
+// failingWriter accepts limit bytes, then fails
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	if len(data) > w.limit {
+		return 0, errWriteFailed
+	}
+	w.limit -= len(data)
+	return len(data), nil
+}
+
+// objectStreamMembers returns the numbers of the objects stored in each
+// object stream of an opened document
+func objectStreamMembers(t *testing.T, document *pdf.PDF) ([][]int, []int) {
+	t.Helper()
+	var members [][]int
+	var sizes []int
+	for _, obj := range document.Objects {
+		stream, ok := obj.(*godyf.Stream)
+		if !ok || stream.Extra["Type"] != godyf.Name("ObjStm") {
+			continue
+		}
+		decoded, err := stream.DecodedData()
+		if err != nil {
+			t.Fatalf("Failed to decode object stream: %v", err)
+		}
+		header := strings.Fields(string(decoded[:stream.Extra["First"].(int)]))
+		var numbers []int
+		for i := 0; i < len(header); i += 2 {
+			number, _ := strconv.Atoi(header[i])
+			numbers = append(numbers, number)
+		}
+		if len(numbers) != stream.Extra["N"].(int) {
+			t.Fatalf("Unexpected /N %v for %d objects", stream.Extra["N"], len(numbers))
+		}
+		members = append(members, numbers)
+		sizes = append(sizes, len(decoded)-stream.Extra["First"].(int))
+	}
+	return members, sizes
+}
+
+func TestObjectStreamChunks(t *testing.T) {
+	write := func(document *pdf.PDF, options pdf.WriteOptions) *pdf.PDF {
+		options.ObjectStreams = true
+		options.XRef = pdf.XRefStream
+		var buf bytes.Buffer
+		if err := document.WriteWithOptions(&buf, options); err != nil {
+			t.Fatalf("Failed to write PDF: %v", err)
+		}
+		return openBytes(t, buf.Bytes())
+	}
+
+	build := func() *pdf.PDF {
+		document := pdf.NewPDF()
+		for i := 0; i < 250; i++ {
+			document.AddObject(godyf.NewArray(i, godyf.NewString(strings.Repeat("x", i))))
+		}
+		return document
+	}
+
+	// Object count is limited by default
+	opened := write(build(), pdf.WriteOptions{})
+	members, _ := objectStreamMembers(t, opened)
+	if len(members) != 3 || len(members[0]) != pdf.DefaultMaxObjectsPerStream {
+		t.Fatalf("Unexpected object streams %v", members)
+	}
+	for number := 4; number < 254; number++ {
+		array := opened.Resolve(godyf.Ref{Number: number}).(*godyf.Array)
+		if array.Get(0) != number-4 {
+			t.Fatalf("Unexpected object %d: %s", number, array.Data())
+		}
+	}
+
+	// Size is limited, larger objects get their own stream
+	members, sizes := objectStreamMembers(t, write(build(), pdf.WriteOptions{MaxObjectStreamBytes: 1000}))
+	for i, size := range sizes {
+		if size > 1000 && len(members[i]) > 1 {
+			t.Fatalf("Object stream of %d bytes holds %d objects", size, len(members[i]))
+		}
+	}
+	if len(sizes) < 30 {
+		t.Fatalf("Unexpected number of object streams %d", len(sizes))
+	}
+
+	// Objects needed by the same page are stored together
+	opened = write(buildSharingDocument(), pdf.WriteOptions{GroupObjectStreamsByPage: true})
+	members, _ = objectStreamMembers(t, opened)
+	stream := make(map[int]int)
+	for i, numbers := range members {
+		for _, number := range numbers {
+			stream[number] = i
+		}
+	}
+	pages := opened.PageReferences()
+	for i, page := range pages {
+		dictionary := opened.Resolve(page).(*godyf.Dictionary)
+		own := dictionary.Get("Resources").(*godyf.Dictionary).Get("Own").(godyf.Ref)
+		if stream[own.Number] != stream[page.Number] {
+			t.Fatalf("Page %d and its resources are in different object streams", i)
+		}
+		if i > 0 && stream[page.Number] == stream[pages[i-1].Number] {
+			t.Fatalf("Pages %d and %d are in the same object stream", i-1, i)
+		}
+	}
+}
+
+func TestWriteHybridXRef(t *testing.T) {
+	var buf bytes.Buffer
+	options := pdf.WriteOptions{
+		Identifier:          pdf.IdentifierContentHash,
+		ObjectStreams:       true,
+		XRef:                pdf.XRefHybrid,
+		MaxObjectsPerStream: 4,
+	}
+	document := buildSharingDocument()
+
+	// Objects only reached through other objects can be stored in streams
+	state := godyf.NewDictionary(map[string]interface{}{"Type": godyf.Name("ExtGState"), "LW": 2})
+	document.AddObject(state)
+	states := godyf.NewDictionary(map[string]interface{}{"GS1": state.Ref()})
+	document.AddObject(states)
+	page := document.Resolve(document.PageReferences()[0]).(*godyf.Dictionary)
+	page.Get("Resources").(*godyf.Dictionary).Set("ExtGState", states.Ref())
+
+	if err := document.WriteWithOptions(&buf, options); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	data := buf.String()
+
+	// Legacy readers only see the objects written directly
+	table := data[strings.LastIndex(data, "\nxref\n")+6 : strings.LastIndex(data, "trailer\n")]
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	listed := 0
+	for i := 0; i < len(lines); {
+		var start, count int
+		if _, err := fmt.Sscanf(lines[i], "%d %d", &start, &count); err != nil {
+			t.Fatalf("Invalid subsection header %q", lines[i])
+		}
+		for _, entry := range lines[i+1 : i+1+count] {
+			if !strings.HasSuffix(strings.TrimSpace(entry), "n") && start != 0 {
+				t.Fatalf("Unexpected entry %q", entry)
+			}
+		}
+		listed += count
+		i += count + 1
+	}
+	var size, xrefStream int
+	trailer := data[strings.LastIndex(data, "trailer\n"):]
+	fmt.Sscanf(trailer[strings.Index(trailer, "/Size"):], "/Size %d", &size)
+	fmt.Sscanf(trailer[strings.Index(trailer, "/XRefStm"):], "/XRefStm %d", &xrefStream)
+	if listed == 0 || listed >= size {
+		t.Fatalf("Table lists %d objects out of %d", listed, size)
+	}
+	if !strings.HasPrefix(data[xrefStream:], fmt.Sprintf("%d 0 obj", size-1)) {
+		t.Fatalf("/XRefStm %d doesn't point to the cross-reference stream", xrefStream)
+	}
+
+	// Legacy readers find the document structure in the table only
+	start := strings.LastIndex(data, "/XRefStm")
+	end := start + strings.Index(data[start:], "\n")
+	legacy := []byte(data[:start] + strings.Repeat(" ", end-start) + data[end:])
+	for _, read := range []struct {
+		data []byte
+		full bool
+	}{{legacy, false}, {buf.Bytes(), true}} {
+		document := openBytes(t, read.data)
+		if len(document.PageReferences()) != 3 || document.Info == nil || document.Info.Values["Title"] == nil {
+			t.Fatalf("Unexpected pages %v or information %v", document.PageReferences(), document.Info)
+		}
+		for _, page := range document.PageReferences() {
+			dictionary, ok := document.Resolve(page).(*godyf.Dictionary)
+			if !ok {
+				t.Fatalf("Page %v not found", page)
+			}
+			if _, ok := document.Resolve(dictionary.Get("Contents")).(*godyf.Stream); !ok {
+				t.Fatalf("Unexpected page %s", dictionary.Data())
+			}
+		}
+		states, ok := document.Resolve(states.Ref()).(*godyf.Dictionary)
+		if !ok {
+			t.Fatalf("Resources %v not found", states.Ref())
+		}
+		if _, ok := document.Resolve(states.Get("GS1")).(*godyf.Dictionary); ok != read.full {
+			t.Fatalf("Unexpected graphics state %v", document.Resolve(states.Get("GS1")))
+		}
+		if _, ok := document.Trailer.Get("ID").(*godyf.Array); !ok {
+			t.Fatal("Expected an identifier")
+		}
+	}
+
+	// Newer readers see all the objects
+	document = openBytes(t, buf.Bytes())
+	if !document.Catalog.Compressible() {
+		t.Fatalf("Unexpected catalog %v", document.Catalog.Ref())
+	}
+}